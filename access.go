@@ -0,0 +1,260 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Set writes value to the field stored under key, converting between numeric
+// types the same way Unflatten does. An error is returned if there is no such
+// key, if the Map value isn't a pointer that can be written through, like the
+// entries for map elements, or if value can't be assigned to the field.
+func (m Map) Set(key string, value interface{}) error {
+	dst, store, err := m.target("Set", key)
+	if err != nil {
+		return err
+	}
+	if err := assignValue(dst, value); err != nil {
+		return keyError("Set", key, err)
+	}
+	if err := store(); err != nil {
+		return keyError("Set", key, err)
+	}
+	return nil
+}
+
+// SetString parses s according to the type of the field stored under key and
+// writes the result to it, which is useful when values come from text such as
+// command line flags or query parameters. Types implementing
+// encoding.TextUnmarshaler parse s themselves; otherwise the field must have a
+// string, boolean or numeric kind, or be a pointer to one, which is allocated
+// if it is nil. It fails in the same cases as Set, and if s can't be parsed.
+func (m Map) SetString(key, s string) error {
+	dst, store, err := m.target("SetString", key)
+	if err != nil {
+		return err
+	}
+	if err := parseValue(dst, s); err != nil {
+		return keyError("SetString", key, err)
+	}
+	if err := store(); err != nil {
+		return keyError("SetString", key, err)
+	}
+	return nil
+}
+
+// Zero writes the zero value of each field stored in m to it, such as for
+// resetting counters at the end of each interval: an empty string, 0, false,
+// or nil for pointers, slices and maps. Entries that can't be written through,
+// as by Set, are left as they are, and listed in the returned error, but the
+// others are still zeroed.
+func (m Map) Zero() error {
+	return Options{}.ZeroPrefix(m, "")
+}
+
+// ZeroPrefix is like Zero, but only zeroes the fields stored under the keys
+// starting with prefix, matched against whole key segments as by Filter. The
+// separator is assumed to be the default one; see Options.ZeroPrefix.
+func (m Map) ZeroPrefix(prefix string) error {
+	return Options{}.ZeroPrefix(m, prefix)
+}
+
+// ZeroPrefix is like Map.ZeroPrefix, but matches key segments using
+// o.Separator.
+func (o Options) ZeroPrefix(m Map, prefix string) error {
+	var skipped []string
+	for key, value := range m.expandDynamic() {
+		if !o.under(key, prefix) {
+			continue
+		}
+		dst, store, ok := settable(value)
+		if ok {
+			dst.Set(reflect.Zero(dst.Type()))
+			ok = store() == nil
+		}
+		if !ok {
+			skipped = append(skipped, key)
+		}
+	}
+	if len(skipped) > 0 {
+		return keyListError("ZeroPrefix", ErrNotSettable, "keys that can't be zeroed", skipped)
+	}
+	return nil
+}
+
+// GetString returns the current value stored under key if it is a string.
+func (m Map) GetString(key string) (string, bool) {
+	var s string
+	ok := m.get(key, reflect.ValueOf(&s).Elem())
+	return s, ok
+}
+
+// GetInt64 returns the current value stored under key if it is a number that
+// can be represented as an int64.
+func (m Map) GetInt64(key string) (int64, bool) {
+	var i int64
+	ok := m.get(key, reflect.ValueOf(&i).Elem())
+	return i, ok
+}
+
+// GetFloat64 returns the current value stored under key if it is a number.
+func (m Map) GetFloat64(key string) (float64, bool) {
+	var f float64
+	ok := m.get(key, reflect.ValueOf(&f).Elem())
+	return f, ok
+}
+
+// GetBool returns the current value stored under key if it is a boolean.
+func (m Map) GetBool(key string) (bool, bool) {
+	var b bool
+	ok := m.get(key, reflect.ValueOf(&b).Elem())
+	return b, ok
+}
+
+// Walk calls fn for each entry in m, in sorted key order, with the current
+// value of the field rather than a pointer to it. Entries for fields tagged
+// with omitempty are visited even if they are currently empty. If fn returns an
+// error, Walk stops and returns it.
+func (m Map) Walk(fn func(key string, value interface{}) error) error {
+	return m.walk(func(key string, value interface{}) error {
+		var current interface{}
+		if rv := resolve(value); rv.IsValid() {
+			current = rv.Interface()
+		}
+		return fn(key, current)
+	})
+}
+
+// WalkPointers is like Walk, but calls fn with the pointer to each field, so
+// that fn can modify it. Entries that don't hold a pointer, like those for map
+// elements, are passed their current value instead, as are sync/atomic values.
+func (m Map) WalkPointers(fn func(key string, value interface{}) error) error {
+	return m.walk(func(key string, value interface{}) error {
+		return fn(key, unwrap(value))
+	})
+}
+
+func (m Map) walk(fn func(key string, value interface{}) error) error {
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	for _, key := range *keys {
+		if err := fn(key, m[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get sets dst to the current value stored under key, dereferencing pointers
+// and converting between numeric types as needed. Named types are converted
+// to dst's type if they have the same kind. It returns false, leaving dst
+// unchanged, if there is no such key, or if the value is nil or has an
+// incompatible type.
+func (m Map) get(key string, dst reflect.Value) bool {
+	v, ok := m[key]
+	if !ok {
+		return false
+	}
+
+	sval := reflect.ValueOf(unwrap(v))
+	for {
+		if !sval.IsValid() {
+			return false
+		}
+		if sval.Type().AssignableTo(dst.Type()) {
+			dst.Set(sval)
+			return true
+		}
+		if sval.Kind() != reflect.Ptr && sval.Kind() != reflect.Interface {
+			break
+		}
+		sval = sval.Elem()
+	}
+
+	if n, ok := sval.Interface().(json.Number); ok && dst.Kind() != reflect.String {
+		// Numbers from FlattenJSON.
+		if i, err := n.Int64(); err == nil {
+			sval = reflect.ValueOf(i)
+		} else if f, err := n.Float64(); err == nil {
+			sval = reflect.ValueOf(f)
+		} else {
+			return false
+		}
+	}
+
+	ok, err := convertValue(dst, sval)
+	return ok && err == nil
+}
+
+// target returns the settable field stored under key, and the function to call
+// once it has been written, as returned by settable. Errors are reported
+// for op.
+func (m Map) target(op, key string) (reflect.Value, func() error, error) {
+	v, ok := m[key]
+	if !ok {
+		return reflect.Value{}, nil, &Error{Op: op, Key: key, kind: ErrKeyNotFound, msg: fmt.Sprintf("flatjson: unknown key %q", key)}
+	}
+
+	dst, store, ok := settable(v)
+	if !ok {
+		return reflect.Value{}, nil, &Error{Op: op, Key: key, kind: ErrNotSettable, msg: fmt.Sprintf("flatjson: key %q can't be set", key)}
+	}
+	return dst, store, nil
+}
+
+// parseValue sets dst to the value parsed from s.
+func parseValue(dst reflect.Value, s string) error {
+	if dst.Kind() == reflect.Ptr {
+		v := reflect.New(dst.Type().Elem())
+		if err := parseValue(v.Elem(), s); err != nil {
+			return err
+		}
+		dst.Set(v)
+		return nil
+	}
+
+	if u, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	var err error
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(s)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			dst.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, dst.Type().Bits()); err == nil {
+			dst.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, err = strconv.ParseUint(s, 10, dst.Type().Bits()); err == nil {
+			dst.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, dst.Type().Bits()); err == nil {
+			dst.SetFloat(f)
+		}
+	default:
+		return typeError(dst.Type(), "cannot parse a string into %s", dst.Type())
+	}
+
+	if err != nil {
+		return &Error{Type: dst.Type(), Err: err, kind: ErrTypeMismatch, msg: fmt.Sprintf("cannot parse %q as %s", s, dst.Type())}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package flatjson
+
+import "reflect"
+
+// Get returns the current value stored under key in m as a T. Like the typed
+// getters such as Map.GetInt64, it dereferences pointers and converts between
+// numeric types, strings and booleans of different named types. It returns
+// false if there is no such key or if the value can't be converted to a T.
+func Get[T any](m Map, key string) (T, bool) {
+	var v T
+	ok := m.get(key, reflect.ValueOf(&v).Elem())
+	return v, ok
+}
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package flatjson_test
+
+import (
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestGet(t *testing.T) {
+	n := 5
+	val := &struct {
+		Hits  Count
+		Ptr   *int
+		Name  string
+		Point Point `flatjson:",noflatten"`
+	}{Hits: 3, Ptr: &n, Name: "a", Point: Point{1, 2}}
+	flat := flatjson.Flatten(val)
+
+	if c, ok := flatjson.Get[Count](flat, "Hits"); !ok || c != 3 {
+		t.Errorf("Unexpected Get result: %d, %v", c, ok)
+	}
+	if i, ok := flatjson.Get[uint8](flat, "Ptr"); !ok || i != 5 {
+		t.Errorf("Unexpected Get result for pointer: %d, %v", i, ok)
+	}
+	if p, ok := flatjson.Get[*int](flat, "Ptr"); !ok || p != &n {
+		t.Errorf("Unexpected Get result for the pointer itself: %v, %v", p, ok)
+	}
+	if p, ok := flatjson.Get[Point](flat, "Point"); !ok || p != val.Point {
+		t.Errorf("Unexpected Get result for struct: %v, %v", p, ok)
+	}
+	if s, ok := flatjson.Get[State](flat, "Hits"); !ok || s != 3 {
+		t.Errorf("Unexpected Get result for other named type: %v, %v", s, ok)
+	}
+
+	if s, ok := flatjson.Get[string](flat, "Hits"); ok {
+		t.Errorf("Expected Get to fail for incompatible type, got %q", s)
+	}
+	if i, ok := flatjson.Get[int](flat, "missing"); ok {
+		t.Errorf("Expected Get to fail for missing key, got %d", i)
+	}
+	if i, ok := flatjson.Get[int8](flat, "Hits"); !ok || i != 3 {
+		t.Errorf("Unexpected Get result: %d, %v", i, ok)
+	}
+}
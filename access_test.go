@@ -0,0 +1,312 @@
+package flatjson_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestSet(t *testing.T) {
+	val := &Config{Other: &Child{}}
+	flat := flatjson.Flatten(val)
+
+	for key, value := range map[string]interface{}{
+		"Name":     "server",
+		"port":     9090,
+		"ratio":    int64(2),
+		"other.CC": 3.0,
+		"started":  "2015-01-02T03:04:05Z",
+	} {
+		if err := flat.Set(key, value); err != nil {
+			t.Errorf("Unexpected error setting %s: %v", key, err)
+		}
+	}
+
+	started := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	if val.Name != "server" || val.Port != 9090 || val.Ratio != 2 || val.Other.C != 3 || !val.Started.Equal(started) {
+		t.Errorf("Set to unexpected value: %#v", val)
+	}
+
+	for key, value := range map[string]interface{}{
+		"missing":  1,
+		"port":     70000,
+		"other.CC": 1.5,
+		"Name":     5,
+	} {
+		if err := flat.Set(key, value); err == nil {
+			t.Errorf("Expected error setting %s to %#v", key, value)
+		}
+	}
+	if val.Port != 9090 || val.Other.C != 3 || val.Name != "server" {
+		t.Errorf("Failed Set changed the value: %#v", val)
+	}
+
+	// Map elements can't be written through.
+	m := flatjson.FlattenWithOptions(&struct{ M map[string]int }{map[string]int{"a": 1}}, flatjson.Options{FlattenMaps: true})
+	if err := m.Set("M.a", 2); err == nil {
+		t.Error("Expected error setting a map element")
+	}
+}
+
+func TestSetString(t *testing.T) {
+	val := &struct {
+		Name    string
+		Port    uint16
+		Debug   bool
+		Ratio   float32
+		Offset  int8
+		Count   *int
+		Level   State
+		Started time.Time
+		Tags    []string
+	}{}
+	flat := flatjson.Flatten(val)
+
+	for key, s := range map[string]string{
+		"Name":    "server",
+		"Port":    "9090",
+		"Debug":   "true",
+		"Ratio":   "0.5",
+		"Offset":  "-3",
+		"Count":   "7",
+		"Level":   "1",
+		"Started": "2015-01-02T03:04:05Z",
+	} {
+		if err := flat.SetString(key, s); err != nil {
+			t.Errorf("Unexpected error setting %s: %v", key, err)
+		}
+	}
+
+	if val.Name != "server" || val.Port != 9090 || !val.Debug || val.Ratio != 0.5 || val.Offset != -3 ||
+		val.Count == nil || *val.Count != 7 || val.Level != 1 || val.Started.Year() != 2015 {
+		t.Errorf("Set to unexpected value: %#v", val)
+	}
+
+	for key, s := range map[string]string{
+		"missing": "1",
+		"Port":    "70000",
+		"Offset":  "1.5",
+		"Debug":   "maybe",
+		"Count":   "x",
+		"Tags":    "a,b",
+		"Started": "yesterday",
+	} {
+		if err := flat.SetString(key, s); err == nil {
+			t.Errorf("Expected error setting %s to %q", key, s)
+		}
+	}
+	if val.Port != 9090 || *val.Count != 7 {
+		t.Errorf("Failed SetString changed the value: %#v", val)
+	}
+}
+
+func TestZero(t *testing.T) {
+	type Counters struct {
+		Requests int64             `json:"requests"`
+		Name     string            `json:"name"`
+		Up       bool              `json:"up"`
+		Errors   []string          `json:"errors"`
+		Labels   map[string]string `json:"labels"`
+		Last     *int              `json:"last"`
+		Pool     Pool              `json:"pool"`
+		Omitted  int               `json:"omitted,omitempty"`
+	}
+	last := 5
+	val := &Counters{1, "a", true, []string{"x"}, map[string]string{"k": "v"}, &last, Pool{2, 3}, 4}
+	flat := flatjson.Flatten(val)
+
+	if err := flat.ZeroPrefix("pool"); err != nil {
+		t.Fatal(err)
+	}
+	if val.Pool != (Pool{}) || val.Requests != 1 {
+		t.Errorf("Unexpected values after ZeroPrefix: %+v", val)
+	}
+
+	if err := flat.Zero(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(val, &Counters{}) {
+		t.Errorf("Expected the fields to be zero, got %+v", val)
+	}
+	testEncoding(t, flat, flatjson.Map{
+		"requests":    0.0,
+		"name":        "",
+		"up":          false,
+		"errors":      nil,
+		"labels":      nil,
+		"last":        nil,
+		"pool.active": 0.0,
+		"pool.idle":   0.0,
+	})
+
+	// Entries that can't be written through are left alone and reported.
+	val.Requests = 6
+	flat.AddFunc("uptime", func() interface{} { return 7 })
+	flat["snapshot"] = 8
+	err := flat.Zero()
+	if err == nil || err.Error() != "flatjson: keys that can't be zeroed: snapshot, uptime" {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if val.Requests != 0 {
+		t.Errorf("Expected the other fields to be zeroed, got %+v", val)
+	}
+}
+
+type Count int
+
+func TestGetters(t *testing.T) {
+	n := 5
+	val := &struct {
+		Name   string
+		Label  State
+		Hits   Count
+		Big    uint64
+		Ratio  float32
+		Whole  float64
+		Ptr    *int
+		Nil    *int
+		Debug  bool
+		Labels map[string]string
+	}{Name: "a", Hits: 3, Big: 1 << 63, Ratio: 0.5, Whole: 2, Ptr: &n, Debug: true, Labels: map[string]string{"env": "prod"}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{FlattenMaps: true})
+
+	if s, ok := flat.GetString("Name"); !ok || s != "a" {
+		t.Errorf("Unexpected GetString result: %q, %v", s, ok)
+	}
+	if s, ok := flat.GetString("Labels.env"); !ok || s != "prod" {
+		t.Errorf("Unexpected GetString result for map element: %q, %v", s, ok)
+	}
+	if i, ok := flat.GetInt64("Hits"); !ok || i != 3 {
+		t.Errorf("Unexpected GetInt64 result for named type: %d, %v", i, ok)
+	}
+	if i, ok := flat.GetInt64("Ptr"); !ok || i != 5 {
+		t.Errorf("Unexpected GetInt64 result for pointer: %d, %v", i, ok)
+	}
+	if i, ok := flat.GetInt64("Whole"); !ok || i != 2 {
+		t.Errorf("Unexpected GetInt64 result for float: %d, %v", i, ok)
+	}
+	if f, ok := flat.GetFloat64("Ratio"); !ok || f != 0.5 {
+		t.Errorf("Unexpected GetFloat64 result: %v, %v", f, ok)
+	}
+	if f, ok := flat.GetFloat64("Hits"); !ok || f != 3 {
+		t.Errorf("Unexpected GetFloat64 result for integer: %v, %v", f, ok)
+	}
+	if b, ok := flat.GetBool("Debug"); !ok || !b {
+		t.Errorf("Unexpected GetBool result: %v, %v", b, ok)
+	}
+
+	// Values are read at the time of the call.
+	n = 6
+	val.Hits = 4
+	if i, ok := flat.GetInt64("Ptr"); !ok || i != 6 {
+		t.Errorf("Unexpected GetInt64 result after update: %d, %v", i, ok)
+	}
+	if i, ok := flat.GetInt64("Hits"); !ok || i != 4 {
+		t.Errorf("Unexpected GetInt64 result after update: %d, %v", i, ok)
+	}
+
+	for _, key := range []string{"missing", "Name", "Big", "Ratio", "Nil", "Debug"} {
+		if i, ok := flat.GetInt64(key); ok {
+			t.Errorf("Expected GetInt64 to fail for %s, got %d", key, i)
+		}
+	}
+	if s, ok := flat.GetString("Hits"); ok {
+		t.Errorf("Expected GetString to fail for a number, got %q", s)
+	}
+	if b, ok := flat.GetBool("Name"); ok {
+		t.Errorf("Expected GetBool to fail for a string, got %v", b)
+	}
+}
+
+func TestGettersJSON(t *testing.T) {
+	flat, err := flatjson.FlattenJSON([]byte(`{"a": {"n": 12345678901}, "f": 1.5, "s": "x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if i, ok := flat.GetInt64("a.n"); !ok || i != 12345678901 {
+		t.Errorf("Unexpected GetInt64 result: %d, %v", i, ok)
+	}
+	if f, ok := flat.GetFloat64("f"); !ok || f != 1.5 {
+		t.Errorf("Unexpected GetFloat64 result: %v, %v", f, ok)
+	}
+	if i, ok := flat.GetInt64("f"); ok {
+		t.Errorf("Expected GetInt64 to fail for 1.5, got %d", i)
+	}
+	if s, ok := flat.GetString("s"); !ok || s != "x" {
+		t.Errorf("Unexpected GetString result: %q, %v", s, ok)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	val := &struct {
+		B    int
+		A    string `json:",omitempty"`
+		Ptr  *Child
+		Pool Pool
+		M    map[string]int
+	}{B: 1, M: map[string]int{"x": 2}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{FlattenMaps: true})
+
+	type visit struct {
+		key   string
+		value interface{}
+	}
+	var visits []visit
+	walk := func(key string, value interface{}) error {
+		visits = append(visits, visit{key, value})
+		return nil
+	}
+
+	if err := flat.Walk(walk); err != nil {
+		t.Fatal(err)
+	}
+	expected := []visit{{"A", ""}, {"B", 1}, {"M.x", 2}, {"Pool.active", 0}, {"Pool.idle", 0}, {"Ptr", (*Child)(nil)}}
+	if !reflect.DeepEqual(visits, expected) {
+		t.Errorf("Unexpected visits:\n     got: %v\nexpected: %v", visits, expected)
+	}
+
+	// The values are read when they are visited.
+	val.B = 3
+	val.M["x"] = 4
+	val.Pool.Idle = 5
+	visits = nil
+	if err := flat.Walk(walk); err != nil {
+		t.Fatal(err)
+	}
+	expected = []visit{{"A", ""}, {"B", 3}, {"M.x", 4}, {"Pool.active", 0}, {"Pool.idle", 5}, {"Ptr", (*Child)(nil)}}
+	if !reflect.DeepEqual(visits, expected) {
+		t.Errorf("Unexpected visits:\n     got: %v\nexpected: %v", visits, expected)
+	}
+
+	// Walking stops at the first error.
+	stop := errors.New("stop")
+	visits = nil
+	err := flat.Walk(func(key string, value interface{}) error {
+		walk(key, value)
+		if key == "B" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(visits) != 2 {
+		t.Errorf("Expected Walk to stop after B, got %v after %v", err, visits)
+	}
+
+	// Fields can be modified through their pointers.
+	err = flat.WalkPointers(func(key string, value interface{}) error {
+		if p, ok := value.(*int); ok {
+			*p++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.B != 4 || val.Pool.Active != 1 || val.Pool.Idle != 6 || val.M["x"] != 4 {
+		t.Errorf("Unexpected value after WalkPointers: %#v", val)
+	}
+}
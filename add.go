@@ -0,0 +1,88 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Add adds an entry for a value that doesn't live in the flattened struct,
+// such as a package-level counter, under key. Ptr must be a non-nil pointer,
+// whose current value is used each time m is encoded or exported, just like
+// the entry for a flattened field, or a func() interface{}, which is added as
+// by AddFunc. Pointers to the sync/atomic types, to a Counter or to a Gauge are
+// encoded as the value their Load method returns, like fields of those types.
+// An error is returned if m already has an entry under key, or if
+// key breaks the rules of Options.StrictKeys for the default Separator.
+//
+// Refresh and Rebind keep entries added this way, and those added with
+// AddFunc, as they are. Add is Options.Add with the zero Options.
+func (m Map) Add(key string, ptr interface{}) error {
+	return Options{}.Add(m, key, ptr)
+}
+
+// AddFunc adds an entry under key whose value is computed by calling fn each
+// time m is encoded or exported, which suits values like gauges that are
+// derived from other state. It fails in the same cases as Add.
+func (m Map) AddFunc(key string, fn func() interface{}) error {
+	return Options{}.Add(m, key, fn)
+}
+
+// Add is like Map.Add, but checks key against the rules of o.StrictKeys for
+// o.Separator and o.KeyPattern.
+func (o Options) Add(m Map, key string, ptr interface{}) error {
+	var value interface{}
+	switch v := ptr.(type) {
+	case func() interface{}:
+		if v == nil {
+			return &Error{Op: "Add", Key: key, kind: ErrTypeMismatch, msg: fmt.Sprintf("flatjson: key %q: nil func", key)}
+		}
+		value = &computed{v}
+	default:
+		rv := reflect.ValueOf(ptr)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return &Error{Op: "Add", Key: key, Type: reflect.TypeOf(ptr), kind: ErrTypeMismatch, msg: fmt.Sprintf("flatjson: key %q: expected non-nil pointer or func() interface{}, got %T", key, ptr)}
+		}
+		value = ptr
+		if infoFor(rv.Type().Elem()).atomic {
+			// Encoded and exported as the value it holds, like a field.
+			value = &atomicValue{ptr}
+		}
+		value = &entry{value: value, added: true}
+	}
+
+	if problem := o.keyProblem(key); problem != "" {
+		return &Error{Op: "Add", Key: key, kind: ErrInvalidKey, msg: fmt.Sprintf("flatjson: key %q %s", key, problem)}
+	}
+	if _, ok := m[key]; ok {
+		return duplicateKeysError("Add", []string{key})
+	}
+	m[key] = value
+	return nil
+}
+
+// isAdded reports whether the Map value v was added with Add or AddFunc rather
+// than by flattening.
+func isAdded(v interface{}) bool {
+	switch v := v.(type) {
+	case *computed:
+		return true
+	case *entry:
+		return v.added
+	}
+	return false
+}
+
+// A computed is the entry for a value added with AddFunc. Its function is
+// called again each time the value is needed.
+type computed struct {
+	fn func() interface{}
+}
+
+func (c *computed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.fn())
+}
@@ -0,0 +1,93 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestAdd(t *testing.T) {
+	val := &struct {
+		Hits int `json:"hits"`
+	}{1}
+	flat := flatjson.Flatten(val)
+
+	var open int64 = 2
+	queue := []int{1, 2, 3}
+	if err := flat.Add("conns.open", &open); err != nil {
+		t.Fatal(err)
+	}
+	if err := flat.AddFunc("queue.len", func() interface{} { return len(queue) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := flat.Add("version", func() interface{} { return "v1" }); err != nil {
+		t.Fatal(err)
+	}
+
+	testEncoding(t, flat, flatjson.Map{"hits": 1.0, "conns.open": 2.0, "queue.len": 3.0, "version": "v1"})
+
+	// Added values are read each time, like flattened fields.
+	val.Hits, open, queue = 4, 5, queue[:1]
+	testEncoding(t, flat, flatjson.Map{"hits": 4.0, "conns.open": 5.0, "queue.len": 1.0, "version": "v1"})
+
+	var buf bytes.Buffer
+	if err := flat.Filter("conns").WriteStatsd(&buf, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "app.conns.open:5|g\n"; buf.String() != expected {
+		t.Errorf("Unexpected statsd output: %q", buf.String())
+	}
+
+	values := flat.Values()
+	if values["conns.open"] != int64(5) || values["queue.len"] != 1 {
+		t.Errorf("Unexpected values: %v", values)
+	}
+	if n, ok := flat.GetInt64("queue.len"); !ok || n != 1 {
+		t.Errorf("Expected queue.len to be 1, got %d, %v", n, ok)
+	}
+
+	// Added pointers can be written through.
+	if err := flat.Set("conns.open", 6); err != nil || open != 6 {
+		t.Errorf("Expected Set to write through the pointer, got %d, %v", open, err)
+	}
+}
+
+func TestAddErrors(t *testing.T) {
+	flat := flatjson.Flatten(&struct {
+		Hits int `json:"hits"`
+	}{})
+
+	n := 0
+	var nilPtr *int
+	var nilFunc func() interface{}
+	for _, test := range []struct {
+		key      string
+		ptr      interface{}
+		expected string
+	}{
+		{"n", n, `flatjson: key "n": expected non-nil pointer or func() interface{}, got int`},
+		{"n", nilPtr, `flatjson: key "n": expected non-nil pointer or func() interface{}, got *int`},
+		{"n", nil, `flatjson: key "n": expected non-nil pointer or func() interface{}, got <nil>`},
+		{"n", nilFunc, `flatjson: key "n": nil func`},
+		{"hits", &n, `flatjson: duplicate keys: hits`},
+		{"a..b", &n, `flatjson: key "a..b" has an empty segment`},
+		{"a b", &n, `flatjson: key "a b" contains whitespace`},
+	} {
+		if err := flat.Add(test.key, test.ptr); err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for %q:\n     got: %v\nexpected: %s", test.key, err, test.expected)
+		}
+	}
+
+	// The rules follow the Options' Separator.
+	opts := flatjson.Options{Separator: "/"}
+	if err := opts.Add(flat, "a..b", &n); err != nil {
+		t.Errorf("Unexpected error with a custom separator: %v", err)
+	}
+	if err := opts.Add(flat, "a//b", &n); err == nil {
+		t.Error("Expected an error for an empty segment")
+	}
+	if len(flat) != 2 {
+		t.Errorf("Expected only one key to be added, got %v", flat)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"math"
+	"strings"
+)
+
+// ReducePrefix combines the current values of the numeric entries of m whose
+// keys start with prefix, in sorted key order, by calling fn with the result
+// so far, starting with init, and each value in turn. It returns the result,
+// and the number of values combined. Prefix is matched against whole key
+// segments, as by Filter, and may end with the separator, so that shards and
+// shards. both match shards.0.reqs but not shardsx.reqs. An empty prefix
+// matches every key. The separator is assumed to be the default one.
+//
+// Values of integer and floating point kinds, and pointers to them, are
+// converted to float64, as by GetFloat64; other values, like strings,
+// booleans and nil pointers, are skipped. Combined with AddFunc, that allows
+// publishing totals over a group of entries:
+//
+//	flat.AddFunc("shards.total", func() interface{} {
+//		sum, _ := flat.SumPrefix("shards")
+//		return sum
+//	})
+func (m Map) ReducePrefix(prefix string, fn func(acc, v float64) float64, init float64) (float64, int) {
+	m = m.expandDynamic()
+	acc, n := init, 0
+	for _, key := range m.Keys(strings.TrimSuffix(prefix, ".")) {
+		if v, ok := m.GetFloat64(key); ok {
+			acc = fn(acc, v)
+			n++
+		}
+	}
+	return acc, n
+}
+
+// SumPrefix returns the sum of the numeric entries under prefix, and their
+// number, as described by ReducePrefix.
+func (m Map) SumPrefix(prefix string) (float64, int) {
+	return m.ReducePrefix(prefix, func(acc, v float64) float64 { return acc + v }, 0)
+}
+
+// MaxPrefix returns the largest of the numeric entries under prefix, and their
+// number, as described by ReducePrefix. Without any, it returns -Inf.
+func (m Map) MaxPrefix(prefix string) (float64, int) {
+	return m.ReducePrefix(prefix, math.Max, math.Inf(-1))
+}
+
+// MinPrefix returns the smallest of the numeric entries under prefix, and
+// their number, as described by ReducePrefix. Without any, it returns +Inf.
+func (m Map) MinPrefix(prefix string) (float64, int) {
+	return m.ReducePrefix(prefix, math.Min, math.Inf(1))
+}
@@ -0,0 +1,71 @@
+package flatjson_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type Shard struct {
+	Name     string  `json:"name"`
+	Requests int64   `json:"requests"`
+	Bytes    uint32  `json:"bytes"`
+	Load     float64 `json:"load"`
+	Up       bool    `json:"up"`
+	Limit    *int    `json:"limit"`
+}
+
+func TestReducePrefix(t *testing.T) {
+	limit := 100
+	val := &struct {
+		Shards []Shard `json:"shards"`
+		Other  int     `json:"shardsx"`
+	}{
+		Shards: []Shard{
+			{Name: "a", Requests: 10, Bytes: 5, Load: 0.5, Up: true},
+			{Name: "b", Requests: 20, Bytes: 7, Load: -1.5, Limit: &limit},
+		},
+		Other: 1000,
+	}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{IndexSlices: true})
+
+	for _, prefix := range []string{"shards", "shards."} {
+		if sum, n := flat.SumPrefix(prefix); sum != 141 || n != 7 {
+			t.Errorf("Unexpected sum %v of %d values under %q", sum, n, prefix)
+		}
+	}
+	if sum, n := flat.SumPrefix("shards.1"); sum != 125.5 || n != 4 {
+		t.Errorf("Unexpected sum %v of %d values", sum, n)
+	}
+	if max, n := flat.MaxPrefix("shards"); max != 100 || n != 7 {
+		t.Errorf("Unexpected max %v of %d values", max, n)
+	}
+	if min, n := flat.MinPrefix("shards"); min != -1.5 || n != 7 {
+		t.Errorf("Unexpected min %v of %d values", min, n)
+	}
+
+	// The values are read when called.
+	val.Shards[0].Requests = 30
+	count := func(acc, v float64) float64 { return acc + 1 }
+	if sum, _ := flat.SumPrefix("shards"); sum != 161 {
+		t.Errorf("Unexpected sum %v", sum)
+	}
+	if c, n := flat.ReducePrefix("", count, 0); c != 8 || n != 8 {
+		t.Errorf("Unexpected count %v of %d values", c, n)
+	}
+
+	// Without any numeric values, the initial value is returned.
+	if max, n := flat.MaxPrefix("shards.0.name"); !math.IsInf(max, -1) || n != 0 {
+		t.Errorf("Unexpected max %v of %d values", max, n)
+	}
+
+	// Totals can be published along with the values.
+	flat.AddFunc("total", func() interface{} {
+		sum, _ := flat.SumPrefix("shards")
+		return sum
+	})
+	if total, ok := flat.GetFloat64("total"); !ok || total != 161 {
+		t.Errorf("Unexpected total %v", total)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// isAtomic reports whether t is one of the types from sync/atomic holding a
+// value that is read with Load, like atomic.Int64 or atomic.Value, or a Counter
+// or a Gauge. Their fields are unexported, so they are treated as leaves
+// holding the loaded value.
+func isAtomic(t reflect.Type) bool {
+	if t == counterType || t == gaugeType {
+		return true
+	}
+	if t.Kind() != reflect.Struct || t.PkgPath() != "sync/atomic" {
+		return false
+	}
+	_, ok := reflect.PtrTo(t).MethodByName("Load")
+	return ok
+}
+
+// loadsFloat reports whether t, an atomic type, holds a float, like a Gauge,
+// so that its loaded values follow Options.NonFinite and FloatPrecision.
+func loadsFloat(t reflect.Type) bool {
+	load, ok := reflect.PtrTo(t).MethodByName("Load")
+	return ok && load.Type.NumOut() == 1 && isFloat(load.Type.Out(0))
+}
+
+var lockerType = reflect.TypeOf((*sync.Locker)(nil)).Elem()
+
+// isLock reports whether t, after dereferencing pointers, is a lock, like
+// sync.Mutex, or a struct holding nothing but locks and unexported state,
+// like sync.Once, sync.WaitGroup or a type with a noCopy field. Such values
+// are skipped unless Options.IncludeLocks is set.
+func isLock(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return isLockStruct(t)
+}
+
+// isLockStruct is isLock for types other than pointers. It doesn't follow
+// pointers, so that it terminates for recursive types.
+func isLockStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || isAtomic(t) {
+		return false
+	}
+
+	lock := reflect.PtrTo(t).Implements(lockerType)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		switch {
+		case field.Name == "noCopy", field.Type.Name() == "noCopy", isLockStruct(field.Type):
+			lock = true
+		case field.PkgPath == "":
+			// Exported state, which is flattened even if the struct
+			// embeds a lock.
+			return false
+		}
+	}
+	return lock
+}
+
+// An atomicValue is the entry for a sync/atomic value. It is encoded as the
+// value returned by Load, so reading it is safe while it is being updated.
+type atomicValue struct {
+	value interface{} // A pointer to the field, or a *lookup.
+}
+
+func (a *atomicValue) MarshalJSON() ([]byte, error) {
+	v := a.load()
+	if !v.IsValid() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(v.Interface())
+}
+
+// load returns the value currently held by the atomic, or the invalid Value if
+// it holds nil.
+func (a *atomicValue) load() reflect.Value {
+	v := resolve(a.value)
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+
+	v = v.Addr().MethodByName("Load").Call(nil)[0]
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v
+}
+
+// storeTarget returns a settable value of the type the atomic holds, and a
+// function that stores it in the atomic once it has been written. It returns
+// false if the atomic isn't addressable.
+func (a *atomicValue) storeTarget() (reflect.Value, func() error, bool) {
+	if _, ok := a.value.(*lookup); ok {
+		return reflect.Value{}, nil, false
+	}
+
+	ptr := reflect.ValueOf(a.value)
+	load := ptr.MethodByName("Load")
+	dst := reflect.New(load.Type().Out(0)).Elem()
+	storeMethod := "Store"
+	if t := ptr.Type().Elem(); t == counterType || t == gaugeType {
+		storeMethod = "Set"
+	}
+
+	store := func() error {
+		if dst.Kind() == reflect.Interface {
+			// atomic.Value panics on these instead.
+			if dst.IsNil() {
+				return typeError(ptr.Type().Elem(), "cannot store nil in %s", ptr.Type().Elem())
+			}
+			if cur := load.Call(nil)[0].Elem(); cur.IsValid() && cur.Type() != dst.Elem().Type() {
+				return typeError(dst.Elem().Type(), "cannot store %s in %s holding %s", dst.Elem().Type(), ptr.Type().Elem(), cur.Type())
+			}
+		}
+		ptr.MethodByName(storeMethod).Call([]reflect.Value{dst})
+		return nil
+	}
+	return dst, store, true
+}
+
+// settable returns the value that writes to the Map value v should go to, and
+// a function to call once it has been written. It returns false if v can't be
+// written through, like the copies of unexported fields.
+func settable(v interface{}) (reflect.Value, func() error, bool) {
+	if e, ok := v.(*entry); ok {
+		if e.snapshot {
+			return reflect.Value{}, nil, false
+		}
+		v = e.value
+	}
+	if a, ok := v.(*atomicValue); ok {
+		return a.storeTarget()
+	}
+
+	switch v.(type) {
+	case *lookup, *computed, *dynamic:
+		return reflect.Value{}, nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return reflect.Value{}, nil, false
+	}
+	return rv.Elem(), func() error { return nil }, true
+}
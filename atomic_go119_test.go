@@ -0,0 +1,113 @@
+//go:build go1.19
+// +build go1.19
+
+package flatjson_test
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type AtomicStats struct {
+	Requests atomic.Int64
+	Bytes    atomic.Uint64
+	Up       atomic.Bool
+	Config   atomic.Pointer[Child]
+	Version  atomic.Value
+	Pool     struct {
+		Active atomic.Int32 `json:"active"`
+	} `json:"pool"`
+}
+
+func TestAtomicValues(t *testing.T) {
+	val := &AtomicStats{}
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{
+		"Requests":    0.0,
+		"Bytes":       0.0,
+		"Up":          false,
+		"Config":      nil,
+		"Version":     nil,
+		"pool.active": 0.0,
+	})
+
+	val.Requests.Add(3)
+	val.Bytes.Store(1 << 40)
+	val.Up.Store(true)
+	val.Config.Store(&Child{1, "2"})
+	val.Version.Store("v1")
+	val.Pool.Active.Store(-1)
+	testEncoding(t, flat, flatjson.Map{
+		"Requests":    3.0,
+		"Bytes":       float64(1 << 40),
+		"Up":          true,
+		"Config":      map[string]interface{}{"CC": 1.0, "CD": "2"},
+		"Version":     "v1",
+		"pool.active": -1.0,
+	})
+
+	if n, ok := flat.GetInt64("Requests"); !ok || n != 3 {
+		t.Errorf("Unexpected value from GetInt64: %d, %v", n, ok)
+	}
+	if err := flat.Set("Requests", 10); err != nil || val.Requests.Load() != 10 {
+		t.Errorf("Unexpected result from Set: %v, %d", err, val.Requests.Load())
+	}
+	if err := flat.SetString("Up", "false"); err != nil || val.Up.Load() {
+		t.Errorf("Unexpected result from SetString: %v, %v", err, val.Up.Load())
+	}
+	if err := flat.Set("Version", 2); err == nil {
+		t.Error("Expected an error storing a different type in an atomic.Value")
+	}
+}
+
+func TestAtomicUnflatten(t *testing.T) {
+	var m flatjson.Map
+	if err := json.Unmarshal([]byte(`{"Requests":5,"Up":true,"Version":"v2","pool.active":7}`), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	val := &AtomicStats{}
+	if err := flatjson.Unflatten(m, val); err != nil {
+		t.Fatal(err)
+	}
+	if val.Requests.Load() != 5 || !val.Up.Load() || val.Version.Load() != "v2" || val.Pool.Active.Load() != 7 {
+		t.Errorf("Unexpected values after Unflatten: %d, %v, %v, %d",
+			val.Requests.Load(), val.Up.Load(), val.Version.Load(), val.Pool.Active.Load())
+	}
+}
+
+func TestAtomicConcurrentMarshal(t *testing.T) {
+	val := &AtomicStats{}
+	flat := flatjson.Flatten(val)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				val.Requests.Add(1)
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		if _, err := json.Marshal(flat); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if n, ok := flat.GetInt64("Requests"); !ok || n != val.Requests.Load() {
+		t.Errorf("Unexpected final value: %d, %v", n, ok)
+	}
+}
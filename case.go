@@ -0,0 +1,86 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A KeyCase is a naming convention that field names can be converted to.
+//
+// Field names are split into words at each lower case letter or digit that is
+// followed by an upper case letter, and before the last letter of a run of
+// upper case letters that is followed by a lower case one, so acronyms stay
+// together: HTTPServer is split into HTTP and Server. Underscores also
+// separate words.
+type KeyCase int
+
+const (
+	// KeyCaseOriginal leaves field names unchanged.
+	KeyCaseOriginal KeyCase = iota
+
+	// KeyCaseSnake converts field names to snake_case: HTTPServer becomes
+	// http_server.
+	KeyCaseSnake
+
+	// KeyCaseLowerCamel converts field names to lowerCamelCase by lower
+	// casing the first word: HTTPServer becomes httpServer.
+	KeyCaseLowerCamel
+
+	// KeyCaseKebab converts field names to kebab-case: HTTPServer becomes
+	// http-server.
+	KeyCaseKebab
+)
+
+func (c KeyCase) apply(name string) string {
+	switch c {
+	case KeyCaseSnake:
+		return strings.ToLower(strings.Join(splitWords(name), "_"))
+	case KeyCaseLowerCamel:
+		words := splitWords(name)
+		if len(words) == 0 {
+			return name
+		}
+		words[0] = strings.ToLower(words[0])
+		return strings.Join(words, "")
+	case KeyCaseKebab:
+		return strings.ToLower(strings.Join(splitWords(name), "-"))
+	}
+	return name
+}
+
+// splitWords splits an identifier into words as described by KeyCase.
+func splitWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		case i == start || !unicode.IsUpper(r):
+			continue
+		}
+
+		prev := runes[i-1]
+		nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
@@ -0,0 +1,67 @@
+package flatjson_test
+
+import (
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type CaseInner struct {
+	MaxConns  int
+	HTTPPort  int `json:"HTTPPort"`
+	P50Millis float64
+}
+
+type CaseOuter struct {
+	CaseInner
+	HTTPServer    CaseInner
+	Tagged        CaseInner `json:"TaggedServer"`
+	UserID        string
+	Already_Snake int
+	X             bool
+}
+
+func TestKeyCase(t *testing.T) {
+	tests := []struct {
+		keyCase  flatjson.KeyCase
+		expected []string
+	}{
+		{flatjson.KeyCaseOriginal, []string{
+			"MaxConns", "HTTPPort", "P50Millis",
+			"HTTPServer.MaxConns", "HTTPServer.HTTPPort", "HTTPServer.P50Millis",
+			"TaggedServer.MaxConns", "TaggedServer.HTTPPort", "TaggedServer.P50Millis",
+			"UserID", "Already_Snake", "X",
+		}},
+		{flatjson.KeyCaseSnake, []string{
+			"max_conns", "HTTPPort", "p50_millis",
+			"http_server.max_conns", "http_server.HTTPPort", "http_server.p50_millis",
+			"TaggedServer.max_conns", "TaggedServer.HTTPPort", "TaggedServer.p50_millis",
+			"user_id", "already_snake", "x",
+		}},
+		{flatjson.KeyCaseLowerCamel, []string{
+			"maxConns", "HTTPPort", "p50Millis",
+			"httpServer.maxConns", "httpServer.HTTPPort", "httpServer.p50Millis",
+			"TaggedServer.maxConns", "TaggedServer.HTTPPort", "TaggedServer.p50Millis",
+			"userID", "alreadySnake", "x",
+		}},
+		{flatjson.KeyCaseKebab, []string{
+			"max-conns", "HTTPPort", "p50-millis",
+			"http-server.max-conns", "http-server.HTTPPort", "http-server.p50-millis",
+			"TaggedServer.max-conns", "TaggedServer.HTTPPort", "TaggedServer.p50-millis",
+			"user-id", "already-snake", "x",
+		}},
+	}
+
+	for _, tt := range tests {
+		flat := flatjson.FlattenWithOptions(&CaseOuter{}, flatjson.Options{KeyCase: tt.keyCase})
+
+		if len(flat) != len(tt.expected) {
+			t.Errorf("Unexpected keys for case %d: %v", tt.keyCase, flat)
+		}
+		for _, key := range tt.expected {
+			if _, ok := flat[key]; !ok {
+				t.Errorf("Missing key %q for case %d: %v", key, tt.keyCase, flat)
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+// Command flatjson flattens the JSON documents read from standard input into
+// objects with one member per leaf value, or expands flattened objects back
+// into nested documents with -expand.
+//
+// Usage:
+//
+//	flatjson [-expand] [-sep .] [-prefix p] [-sort] [-indent] < input.json
+//
+// The input holds any number of documents, such as NDJSON with one document
+// per line, and each is written as one line of output, or indented over
+// several with -indent. Flattened objects list their keys in document order,
+// or sorted with -sort; the members of expanded objects are always sorted.
+//
+// A document that can't be processed is reported on standard error with the
+// line it starts on, and the remaining documents are still processed, but the
+// exit status is then 1.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pushrax/flatjson"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// config holds the command line flags.
+type config struct {
+	expand bool
+	sort   bool
+	indent bool
+	opts   flatjson.Options
+}
+
+// run runs the command with args, returning the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("flatjson", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var c config
+	fs.BoolVar(&c.expand, "expand", false, "expand flattened objects into nested documents")
+	fs.StringVar(&c.opts.Separator, "sep", ".", "key segment separator")
+	fs.StringVar(&c.opts.Prefix, "prefix", "", "prefix for flattened keys, or to strip when expanding")
+	fs.BoolVar(&c.sort, "sort", false, "sort the keys of flattened objects")
+	fs.BoolVar(&c.indent, "indent", false, "indent the output")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "flatjson: unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return 2
+	}
+
+	out := bufio.NewWriter(stdout)
+	status := 0
+	err := readDocuments(stdin, func(doc []byte, line int) error {
+		enc, err := c.process(doc)
+		if err != nil {
+			fmt.Fprintf(stderr, "flatjson: line %d: %s\n", line, strings.TrimPrefix(err.Error(), "flatjson: "))
+			status = 1
+			return nil
+		}
+		out.Write(enc)
+		return out.WriteByte('\n')
+	})
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "flatjson: %v\n", err)
+		return 1
+	}
+	return status
+}
+
+// readDocuments calls fn with each JSON document in r, along with the line it
+// starts on. Documents normally take up one line each, but one which isn't
+// complete at the end of a line continues on the next, so that indented
+// documents can be read too. A document which is incomplete at the end of
+// the input, or which has data after it on its last line, is still passed to
+// fn, which reports the error.
+func readDocuments(r io.Reader, fn func(doc []byte, line int) error) error {
+	br := bufio.NewReader(r)
+	var doc []byte
+	start, line := 0, 0
+
+	for {
+		text, err := br.ReadBytes('\n')
+		if len(text) > 0 {
+			line++
+			if len(bytes.TrimSpace(doc)) == 0 {
+				doc, start = doc[:0], line
+			}
+			doc = append(doc, text...)
+
+			if len(bytes.TrimSpace(doc)) > 0 && !incomplete(doc) {
+				if ferr := fn(doc, start); ferr != nil {
+					return ferr
+				}
+				doc = doc[:0]
+			}
+		}
+
+		if err == io.EOF {
+			if len(bytes.TrimSpace(doc)) > 0 {
+				return fn(doc, start)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// incomplete reports whether doc is the beginning of a JSON value which
+// continues past the end of doc.
+func incomplete(doc []byte) bool {
+	var v interface{}
+	return json.NewDecoder(bytes.NewReader(doc)).Decode(&v) == io.ErrUnexpectedEOF
+}
+
+// process returns the output for the document doc.
+func (c *config) process(doc []byte) ([]byte, error) {
+	var v interface{}
+	if c.expand {
+		var err error
+		if v, err = c.expandDocument(doc); err != nil {
+			return nil, err
+		}
+	} else {
+		pairs, err := c.opts.FlattenJSONPairs(doc)
+		if err != nil {
+			return nil, err
+		}
+		if c.sort {
+			sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		}
+		v = pairs
+	}
+
+	if c.indent {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// expandDocument decodes doc, a flattened object, and returns the nested
+// document its keys describe, without the prefix.
+func (c *config) expandDocument(doc []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var flat map[string]interface{}
+	if err := dec.Decode(&flat); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after top-level JSON value")
+	}
+	if flat == nil {
+		return nil, errors.New("expected a JSON object, got null")
+	}
+
+	if c.opts.Prefix != "" {
+		prefix := c.opts.Prefix + c.opts.Separator
+		stripped := make(map[string]interface{}, len(flat))
+		var missing []string
+		for key, value := range flat {
+			if !strings.HasPrefix(key, prefix) {
+				missing = append(missing, key)
+				continue
+			}
+			stripped[strings.TrimPrefix(key, prefix)] = value
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return nil, fmt.Errorf("key %q doesn't start with the prefix %q", missing[0], prefix)
+		}
+		flat = stripped
+	}
+	return c.opts.Expand(flat)
+}
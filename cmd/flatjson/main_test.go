@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGolden(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		input  string
+		args   []string
+		status int
+	}{
+		{"nested", "nested", nil, 0},
+		{"nested-sorted", "nested", []string{"-sort"}, 0},
+		{"nested-indent", "nested", []string{"-indent", "-sep", "_", "-prefix", "cfg"}, 0},
+		{"ndjson", "ndjson", nil, 0},
+		{"errors", "errors", nil, 1},
+		{"expand", "flat", []string{"-expand"}, 1},
+		{"expand-prefix", "flat", []string{"-expand", "-sep", "/", "-prefix", "app", "-indent"}, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			input, err := ioutil.ReadFile(filepath.Join("testdata", test.input+".input"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			status := run(test.args, bytes.NewReader(input), &stdout, &stderr)
+			if status != test.status {
+				t.Errorf("Expected exit status %d, got %d", test.status, status)
+			}
+
+			compareGolden(t, filepath.Join("testdata", test.name+".golden"), stdout.Bytes())
+			compareGolden(t, filepath.Join("testdata", test.name+".stderr"), stderr.Bytes())
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-nope"}, bytes.NewReader(nil), &stdout, &stderr); status != 2 {
+		t.Errorf("Expected exit status 2 for an unknown flag, got %d", status)
+	}
+	if status := run([]string{"file.json"}, bytes.NewReader(nil), &stdout, &stderr); status != 2 {
+		t.Errorf("Expected exit status 2 for an argument, got %d", status)
+	}
+}
+
+// compareGolden compares got to the contents of the golden file at path,
+// which is written instead with -update. A missing file is the same as an
+// empty one.
+func compareGolden(t *testing.T, path string, got []byte) {
+	if *update {
+		if len(got) == 0 {
+			os.Remove(path)
+			return
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Output differs from %s:\n     got: %s\nexpected: %s", path, got, expected)
+	}
+}
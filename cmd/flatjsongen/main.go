@@ -0,0 +1,201 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+// Command flatjsongen generates a file with a string constant for each key of
+// the Map flattening a struct type produces, so that mistyped keys fail to
+// compile instead of going unnoticed, and optionally a function building the
+// Map without reflection.
+//
+// Usage:
+//
+//	flatjsongen -type Server [-func] [-sep .] [-prefix p] [-tags json] [-o file] [package]
+//
+// It is meant to be run by go generate, from a comment in the package
+// declaring the type, which is the package in the current directory unless
+// another is given:
+//
+//	//go:generate flatjsongen -type Server -func
+//
+// For a Server with a DB field holding a Pool with a field tagged
+// json:"active", the constant KeyDBPoolActive is "DB.Pool.active", and with
+// -func, FlattenServer(v *Server) flatjson.Map returns the same Map as Flatten
+// would. The flags set the Options the keys are flattened with. The file is
+// written to server_flatjson.go in the package's directory, unless -o is given.
+//
+// The keys are found by building and running a program which flattens the type
+// with the flatjson package itself, so the package must build and can't be a
+// main package. If it doesn't build because the generated file is out of date,
+// delete the file first.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// config holds the command line flags.
+type config struct {
+	typeName string
+	genFunc  bool
+	sep      string
+	prefix   string
+	tags     string
+	output   string
+}
+
+// run runs the command with args, returning the exit status.
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("flatjsongen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var c config
+	fs.StringVar(&c.typeName, "type", "", "name of the struct type")
+	fs.BoolVar(&c.genFunc, "func", false, "generate a function flattening the type without reflection")
+	fs.StringVar(&c.sep, "sep", ".", "key segment separator")
+	fs.StringVar(&c.prefix, "prefix", "", "prefix for the keys")
+	fs.StringVar(&c.tags, "tags", "json", "comma-separated struct tags naming the fields")
+	fs.StringVar(&c.output, "o", "", "output file (default <type>_flatjson.go in the package's directory)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if c.typeName == "" || fs.NArg() > 1 {
+		fmt.Fprintln(stderr, "usage: flatjsongen -type name [flags] [package]")
+		fs.PrintDefaults()
+		return 2
+	}
+
+	pkg := "."
+	if fs.NArg() == 1 {
+		pkg = fs.Arg(0)
+	}
+	command := strings.Join(append([]string{"flatjsongen"}, args...), " ")
+	if err := c.generate(pkg, command); err != nil {
+		fmt.Fprintf(stderr, "flatjsongen: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// generate writes the file for the package pkg, recording command in its
+// header.
+func (c *config) generate(pkg, command string) error {
+	out, err := goCommand("", "list", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{.Name}}", pkg)
+	if err != nil {
+		return err
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), "\t")
+	if len(fields) != 3 {
+		return fmt.Errorf("unexpected output from go list: %q", out)
+	}
+	importPath, dir, name := fields[0], fields[1], fields[2]
+	if name == "main" {
+		return fmt.Errorf("%s is a main package, whose types can't be imported", importPath)
+	}
+
+	var src bytes.Buffer
+	if err := bootstrap.Execute(&src, map[string]interface{}{
+		"ImportPath": importPath,
+		"Type":       c.typeName,
+		"Func":       c.genFunc,
+		"Separator":  c.sep,
+		"Prefix":     c.prefix,
+		"TagNames":   c.tags,
+		"Command":    command,
+	}); err != nil {
+		return err
+	}
+
+	// The program goes in the package's directory, so that it builds in the
+	// same module. The underscore keeps ./... patterns from matching it.
+	tmp, err := ioutil.TempDir(dir, "_flatjsongen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "main.go")
+	if err := ioutil.WriteFile(file, src.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	generated, err := goCommand(dir, "run", file)
+	if err != nil {
+		return err
+	}
+
+	output := c.output
+	if output == "" {
+		output = filepath.Join(dir, strings.ToLower(c.typeName)+"_flatjson.go")
+	}
+	return ioutil.WriteFile(output, generated, 0644)
+}
+
+// goCommand runs the go command with args in dir, returning its standard
+// output, or an error with its standard error if it fails.
+func goCommand(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		// go run adds the exit status of the program to its output.
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndex(msg, "\nexit status "); i >= 0 {
+			msg = msg[:i]
+		}
+		if msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("go %s: %v", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// bootstrap is the program generating the file, which imports the package
+// declaring the type.
+var bootstrap = template.Must(template.New("bootstrap").Parse(`// Code generated by flatjsongen; DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pushrax/flatjson"
+	"github.com/pushrax/flatjson/gen"
+
+	pkg {{printf "%q" .ImportPath}}
+)
+
+func main() {
+	src, err := gen.Generate(gen.Config{
+		Type: reflect.TypeOf((*pkg.{{.Type}})(nil)).Elem(),
+		Options: flatjson.Options{
+			Separator: {{printf "%q" .Separator}},
+			Prefix:    {{printf "%q" .Prefix}},
+			TagNames:  strings.Split({{printf "%q" .TagNames}}, ","),
+		},
+		Func:    {{.Func}},
+		Command: {{printf "%q" .Command}},
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(src)
+}
+`))
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	var stderr bytes.Buffer
+	if status := run([]string{"-nope"}, &stderr); status != 2 {
+		t.Errorf("Expected exit status 2 for an unknown flag, got %d", status)
+	}
+	if status := run([]string{"-func"}, &stderr); status != 2 {
+		t.Errorf("Expected exit status 2 without -type, got %d", status)
+	}
+	if status := run([]string{"-type", "T", "a", "b"}, &stderr); status != 2 {
+		t.Errorf("Expected exit status 2 for two packages, got %d", status)
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	var src bytes.Buffer
+	err := bootstrap.Execute(&src, map[string]interface{}{
+		"ImportPath": "example.com/srv",
+		"Type":       "Server",
+		"Func":       true,
+		"Separator":  `"`,
+		"Prefix":     "app",
+		"TagNames":   "yaml,json",
+		"Command":    "flatjsongen -type Server -func",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "main.go", src.Bytes(), 0); err != nil {
+		t.Errorf("Invalid program: %v\n%s", err, src.Bytes())
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+)
+
+// A Counter is an int64 which is safe for concurrent use, for fields that
+// are updated while the Map flattened from their struct is encoded. Like the
+// sync/atomic types, a Counter field is a leaf encoded as the value returned
+// by Load, and Set replaces the value of its entry. The zero value is a
+// Counter holding 0. A Counter must not be copied after first use, and on
+// 32-bit platforms it must be 64-bit aligned, as for the functions of
+// sync/atomic; the first field of an allocated struct is.
+type Counter struct {
+	v int64
+}
+
+// Add adds delta to the Counter and returns the new value.
+func (c *Counter) Add(delta int64) int64 {
+	return atomic.AddInt64(&c.v, delta)
+}
+
+// Set replaces the value of the Counter.
+func (c *Counter) Set(v int64) {
+	atomic.StoreInt64(&c.v, v)
+}
+
+// Load returns the value of the Counter.
+func (c *Counter) Load() int64 {
+	return atomic.LoadInt64(&c.v)
+}
+
+// MarshalJSON encodes the Counter as its current value.
+func (c *Counter) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, c.Load(), 10), nil
+}
+
+// A Gauge is a float64 which is safe for concurrent use, the same way as a
+// Counter.
+type Gauge struct {
+	bits uint64
+}
+
+// Add adds delta to the Gauge and returns the new value.
+func (g *Gauge) Add(delta float64) float64 {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		v := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(v)) {
+			return v
+		}
+	}
+}
+
+// Set replaces the value of the Gauge.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Load returns the value of the Gauge.
+func (g *Gauge) Load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// MarshalJSON encodes the Gauge as its current value, with an error for NaN
+// and infinite values, as encoding/json has.
+func (g *Gauge) MarshalJSON() ([]byte, error) {
+	v := g.Load()
+	if b, ok := appendFloat(nil, v, 64); ok {
+		return b, nil
+	}
+	return nil, newError("MarshalJSON", nil, "flatjson: unsupported Gauge value %v", v)
+}
+
+var (
+	counterType = reflect.TypeOf(Counter{})
+	gaugeType   = reflect.TypeOf(Gauge{})
+)
+
+// Counter returns the Counter stored under key, adding a new one if there is
+// no entry for the key, which is encoded with the rest of m from then on. That
+// gives a Map built with Add and AddFunc counters without a struct to
+// flatten them from, and lets code that only has the Map update counters of
+// the flattened struct. An error is returned if the entry holds anything
+// other than a Counter, and in the same cases as Add for a new entry. Adding a
+// Counter modifies m, so it isn't safe while m is being used concurrently,
+// unlike the Counter itself.
+func (m Map) Counter(key string) (*Counter, error) {
+	c, err := m.attach("Counter", key, new(Counter))
+	if err != nil {
+		return nil, err
+	}
+	return c.(*Counter), nil
+}
+
+// Gauge is like Counter, but returns a Gauge.
+func (m Map) Gauge(key string) (*Gauge, error) {
+	g, err := m.attach("Gauge", key, new(Gauge))
+	if err != nil {
+		return nil, err
+	}
+	return g.(*Gauge), nil
+}
+
+// attach returns the pointer stored under key if it has the type of ptr, and
+// otherwise adds ptr if there is no entry for key. Errors are reported for op.
+func (m Map) attach(op, key string, ptr interface{}) (interface{}, error) {
+	value, ok := m[key]
+	if !ok {
+		if err := m.Add(key, ptr); err != nil {
+			e := err.(*Error)
+			e.Op = op
+			return nil, e
+		}
+		return ptr, nil
+	}
+
+	if e, ok := value.(*entry); ok {
+		value = e.value
+	}
+	if a, ok := value.(*atomicValue); ok {
+		value = a.value
+	}
+	if _, ok := value.(*lookup); ok {
+		// A map element, which can't be updated in place.
+		return nil, &Error{Op: op, Key: key, kind: ErrNotSettable, msg: fmt.Sprintf("flatjson: key %q can't be updated in place", key)}
+	}
+	if reflect.TypeOf(value) != reflect.TypeOf(ptr) {
+		return nil, &Error{Op: op, Key: key, Type: reflect.TypeOf(value), kind: ErrTypeMismatch, msg: fmt.Sprintf("flatjson: key %q holds %T, not %T", key, value, ptr)}
+	}
+	return value, nil
+}
@@ -0,0 +1,140 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type ServerCounters struct {
+	Requests flatjson.Counter `json:"requests"`
+	Load     flatjson.Gauge   `json:"load"`
+	Name     string           `json:"name"`
+}
+
+func TestCounters(t *testing.T) {
+	val := &ServerCounters{Name: "a"}
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{"requests": 0.0, "load": 0.0, "name": "a"})
+
+	val.Requests.Add(2)
+	val.Load.Set(0.5)
+	val.Load.Add(0.25)
+	testEncoding(t, flat, flatjson.Map{"requests": 2.0, "load": 0.75, "name": "a"})
+
+	// Set writes through the counter, and Counter finds it.
+	if err := flat.Set("requests", 5); err != nil || val.Requests.Load() != 5 {
+		t.Errorf("Unexpected Set result: %v, %d", err, val.Requests.Load())
+	}
+	if c, err := flat.Counter("requests"); err != nil || c != &val.Requests {
+		t.Errorf("Expected Counter to return the field, got %p, %v", c, err)
+	}
+	if g, err := flat.Gauge("load"); err != nil || g != &val.Load {
+		t.Errorf("Expected Gauge to return the field, got %p, %v", g, err)
+	}
+	if s := flat.Strings(false); s["requests"] != "5" || s["load"] != "0.75" {
+		t.Errorf("Unexpected strings: %v", s)
+	}
+
+	// Counters are added for missing keys.
+	errs, err := flat.Counter("errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs.Add(3)
+	testEncoding(t, flat, flatjson.Map{"requests": 5.0, "load": 0.75, "name": "a", "errors": 3.0})
+	if again, err := flat.Counter("errors"); err != nil || again != errs {
+		t.Errorf("Expected the same Counter again, got %p, %v", again, err)
+	}
+
+	if _, err := flat.Counter("name"); err == nil {
+		t.Error("Expected an error for a key holding a string")
+	}
+	if _, err := flat.Gauge("requests"); err == nil {
+		t.Error("Expected an error for a key holding a Counter")
+	}
+
+	// Counters encode themselves outside of Maps too.
+	if data, err := json.Marshal(val); err != nil || string(data) != `{"requests":5,"load":0.75,"name":"a"}` {
+		t.Errorf("Unexpected encoding of the struct: %s, %v", data, err)
+	}
+}
+
+func TestGaugeFloatOptions(t *testing.T) {
+	val := &ServerCounters{Name: "a"}
+	for _, test := range []struct {
+		opts     flatjson.Options
+		load     float64
+		expected string
+	}{
+		{flatjson.Options{NonFinite: flatjson.NonFiniteNull}, math.Inf(1), `{"load":null,"name":"a","requests":0}`},
+		{flatjson.Options{NonFinite: flatjson.NonFiniteZero}, math.NaN(), `{"load":0,"name":"a","requests":0}`},
+		{flatjson.Options{NonFinite: flatjson.NonFiniteString}, math.Inf(-1), `{"load":"-Inf","name":"a","requests":0}`},
+		{flatjson.Options{FloatPrecision: 2}, 1.0 / 3, `{"load":0.33,"name":"a","requests":0}`},
+	} {
+		val.Load.Set(test.load)
+		flat := flatjson.FlattenWithOptions(val, test.opts)
+		enc, err := flat.MarshalJSON()
+		if err != nil || string(enc) != test.expected {
+			t.Errorf("Unexpected encoding of %v:\n     got: %s, %v\nexpected: %s", test.load, enc, err, test.expected)
+		}
+		if g, err := flat.Gauge("load"); err != nil || g != &val.Load {
+			t.Errorf("Expected Gauge to return the field, got %p, %v", g, err)
+		}
+	}
+
+	// Without a policy, a non-finite Gauge is an error, as with a float64.
+	val.Load.Set(math.NaN())
+	if _, err := flatjson.Flatten(val).MarshalJSON(); err == nil {
+		t.Error("Expected an error encoding NaN")
+	}
+}
+
+func TestCountersConcurrent(t *testing.T) {
+	val := &ServerCounters{}
+	flat := flatjson.Flatten(val)
+	hits, err := flat.Counter("hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers, increments = 8, 1000
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				val.Requests.Add(1)
+				val.Load.Add(0.5)
+				hits.Add(2)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for encoding := true; encoding; {
+		select {
+		case <-done:
+			encoding = false
+		default:
+		}
+		if _, err := json.Marshal(flat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testEncoding(t, flat, flatjson.Map{
+		"requests": float64(workers * increments),
+		"load":     float64(workers * increments / 2),
+		"hits":     float64(2 * workers * increments),
+		"name":     "",
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// A CSVWriter writes the current values of a Map as CSV rows, such as once per
+// sampling interval. The first row written is a header holding the keys of the
+// Map in sorted order.
+type CSVWriter struct {
+	m      Map
+	w      *csv.Writer
+	header []string
+}
+
+// NewCSVWriter returns a CSVWriter writing the values of m to w.
+func NewCSVWriter(w io.Writer, m Map) *CSVWriter {
+	return &CSVWriter{m: m, w: csv.NewWriter(w)}
+}
+
+// WriteRow writes a row of the current values in the Map, preceded by the
+// header if this is the first row. Types implementing encoding.TextMarshaler,
+// such as time.Time in RFC 3339 format, format themselves, strings, booleans
+// and numbers are formatted with the strconv package, with floats never in
+// exponent form, nil pointers as an empty field, and anything else as JSON.
+//
+// An error is returned if the keys of the Map changed since the header was
+// written, since the row wouldn't match it.
+func (c *CSVWriter) WriteRow() error {
+	keys := c.m.sortedKeys()
+	defer putKeys(keys)
+
+	if c.header == nil {
+		c.header = append([]string{}, *keys...)
+		if err := c.w.Write(c.header); err != nil {
+			return err
+		}
+	} else if !equalStrings(*keys, c.header) {
+		return newError("WriteRow", nil, "flatjson: keys changed since the CSV header was written")
+	}
+
+	row := make([]string, len(*keys))
+	for i, key := range *keys {
+		s, err := formatText(resolve(c.m[key]), textOptions(c.m[key]))
+		if err != nil {
+			return err
+		}
+		row[i] = s
+	}
+
+	if err := c.w.Write(row); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatText formats v, after dereferencing pointers, as text, formatting
+// scalars with formatValue according to o. A nil pointer is formatted as an
+// empty string, and NaN and infinite floats the way strconv formats them.
+func formatText(v reflect.Value, o formatOptions) (string, error) {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return "", nil
+	}
+
+	if s, ok := netText(v); ok {
+		return s, nil
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			text, err := m.MarshalText()
+			return string(text), err
+		}
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+
+	if s, ok := formatValue(v, o); ok {
+		return s, nil
+	}
+	if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+
+	enc, err := json.Marshal(v.Interface())
+	return string(enc), err
+}
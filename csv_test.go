@@ -0,0 +1,50 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestCSVWriter(t *testing.T) {
+	val := &struct {
+		Requests int
+		Ratio    float64
+		Name     string
+		Started  time.Time
+		Tags     []string
+		Ptr      *int
+	}{
+		Requests: 1,
+		Ratio:    0.25,
+		Name:     "a, b",
+		Started:  time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Tags:     []string{"x"},
+	}
+	flat := flatjson.Flatten(val)
+
+	var buf bytes.Buffer
+	w := flatjson.NewCSVWriter(&buf, flat)
+	if err := w.WriteRow(); err != nil {
+		t.Fatal(err)
+	}
+	val.Requests++
+	val.Ratio = 1e21
+	if err := w.WriteRow(); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = "Name,Ptr,Ratio,Requests,Started,Tags\n" +
+		"\"a, b\",,0.25,1,2015-06-01T12:00:00Z,\"[\"\"x\"\"]\"\n" +
+		"\"a, b\",,1000000000000000000000,2,2015-06-01T12:00:00Z,\"[\"\"x\"\"]\"\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n     got: %q\nexpected: %q", buf.String(), expected)
+	}
+
+	flat["Extra"] = new(int)
+	if err := w.WriteRow(); err == nil {
+		t.Error("Expected an error after the keys changed")
+	}
+}
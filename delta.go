@@ -0,0 +1,119 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// A DeltaEncoder encodes the entries of a Map whose values changed since the
+// previous encoding, for sending updates rather than full snapshots. It keeps
+// a copy of each value it has encoded, taken the same way as by Map.Values,
+// and compares the current values to those with reflect.DeepEqual.
+//
+// A DeltaEncoder isn't safe for concurrent use.
+type DeltaEncoder struct {
+	m    Map
+	last map[string]interface{}
+}
+
+// NewDeltaEncoder returns a DeltaEncoder for m.
+func NewDeltaEncoder(m Map) *DeltaEncoder {
+	return &DeltaEncoder{m: m}
+}
+
+// Marshal encodes the entries whose values changed since the previous call as
+// a JSON object, in the same form as Map.MarshalJSON. The first call, and the
+// first call after Reset, encodes every entry. Nothing changing results in an
+// empty object.
+//
+// Entries which were encoded before but have since been removed from the Map,
+// or are now omitted because of omitempty or omitzero, are encoded as null, as
+// in a JSON merge patch, and are then forgotten. Entries which are omitted
+// and weren't encoded before are left out.
+//
+// If an entry can't be encoded, the error is returned and the next call
+// compares against the same values as this one.
+func (d *DeltaEncoder) Marshal() ([]byte, error) {
+	m := d.m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	var buf bytes.Buffer
+	ow := objectWriter{w: &buf}
+	ow.begin()
+
+	// Keys which were encoded before but are gone from the Map are encoded
+	// too, in order with the rest.
+	n := len(*keys)
+	for key := range d.last {
+		if _, ok := m[key]; !ok {
+			*keys = append(*keys, key)
+		}
+	}
+	if len(*keys) > n {
+		sort.Strings(*keys)
+	}
+
+	var removed []string
+	var changed map[string]interface{}
+	copied := map[visit]reflect.Value{}
+
+	for _, key := range *keys {
+		value, ok := m[key]
+		if !ok || omitted(value) {
+			if _, sent := d.last[key]; sent {
+				removed = append(removed, key)
+				ow.entry(key, nil)
+			}
+			continue
+		}
+
+		var current interface{}
+		if rv := resolve(value); rv.IsValid() {
+			if last, ok := d.last[key]; ok && reflect.DeepEqual(last, rv.Interface()) {
+				continue
+			}
+			current = deepCopy(rv, copied).Interface()
+		} else if last, ok := d.last[key]; ok && last == nil {
+			continue
+		}
+
+		if changed == nil {
+			changed = map[string]interface{}{}
+		}
+		changed[key] = current
+		ow.entry(key, value)
+	}
+
+	if err := ow.end(); err != nil {
+		return nil, err
+	}
+
+	if d.last == nil {
+		d.last = make(map[string]interface{}, len(changed))
+	}
+	for key, value := range changed {
+		d.last[key] = value
+	}
+	for _, key := range removed {
+		delete(d.last, key)
+	}
+	return buf.Bytes(), nil
+}
+
+// omitted reports whether value is an entry which is currently omitted.
+func omitted(value interface{}) bool {
+	e, ok := value.(*entry)
+	return ok && e.omit()
+}
+
+// Reset forgets the previously encoded values, so that the next call to
+// Marshal encodes every entry.
+func (d *DeltaEncoder) Reset() {
+	d.last = nil
+}
@@ -0,0 +1,101 @@
+package flatjson_test
+
+import (
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestDeltaEncoder(t *testing.T) {
+	val := &struct {
+		Hits  int
+		Name  string
+		Tags  []string
+		Child *Child
+	}{Hits: 1, Name: "a", Tags: []string{"x"}}
+	enc := flatjson.NewDeltaEncoder(flatjson.Flatten(val))
+
+	testDelta(t, enc, `{"Child":null,"Hits":1,"Name":"a","Tags":["x"]}`)
+	testDelta(t, enc, `{}`)
+
+	val.Hits++
+	testDelta(t, enc, `{"Hits":2}`)
+	testDelta(t, enc, `{}`)
+
+	// Changes through slices are detected, since the encoder keeps copies.
+	val.Tags[0] = "y"
+	val.Child = &Child{1, "2"}
+	testDelta(t, enc, `{"Child":{"CC":1,"CD":"2"},"Tags":["y"]}`)
+
+	// Reverting to an earlier value is still a change.
+	val.Hits = 1
+	testDelta(t, enc, `{"Hits":1}`)
+
+	enc.Reset()
+	testDelta(t, enc, `{"Child":{"CC":1,"CD":"2"},"Hits":1,"Name":"a","Tags":["y"]}`)
+}
+
+func TestDeltaEncoderOmitted(t *testing.T) {
+	val := &struct {
+		Hits int
+		Name string `json:",omitempty"`
+	}{Hits: 1}
+	enc := flatjson.NewDeltaEncoder(flatjson.Flatten(val))
+
+	testDelta(t, enc, `{"Hits":1}`)
+
+	val.Name = "a"
+	testDelta(t, enc, `{"Name":"a"}`)
+
+	// Becoming omitted is reported once, and is then forgotten.
+	val.Name = ""
+	testDelta(t, enc, `{"Name":null}`)
+	testDelta(t, enc, `{}`)
+
+	val.Name = "a"
+	testDelta(t, enc, `{"Name":"a"}`)
+}
+
+func TestDeltaEncoderRemoved(t *testing.T) {
+	m := flatjson.Map{"a": 1, "b": 2, "c": 3}
+	enc := flatjson.NewDeltaEncoder(m)
+
+	testDelta(t, enc, `{"a":1,"b":2,"c":3}`)
+
+	delete(m, "b")
+	m["d"] = 4
+	testDelta(t, enc, `{"b":null,"d":4}`)
+	testDelta(t, enc, `{}`)
+
+	m["b"] = 2
+	testDelta(t, enc, `{"b":2}`)
+}
+
+func TestDeltaEncoderDynamic(t *testing.T) {
+	child := &Child{1, "2"}
+	val := &struct {
+		Cur interface{} `json:",dynamic"`
+	}{child}
+	enc := flatjson.NewDeltaEncoder(flatjson.Flatten(val))
+
+	// The entries are those of MarshalJSON, one for each field.
+	testDelta(t, enc, `{"Cur.CC":1,"Cur.CD":"2"}`)
+
+	child.C = 3
+	testDelta(t, enc, `{"Cur.CC":3}`)
+
+	// Fields of the previous value are removed.
+	val.Cur = &Point{4, 5}
+	testDelta(t, enc, `{"Cur.CC":null,"Cur.CD":null,"Cur.X":4,"Cur.Y":5}`)
+	testDelta(t, enc, `{}`)
+}
+
+func testDelta(t *testing.T, enc *flatjson.DeltaEncoder, expected string) {
+	got, err := enc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != expected {
+		t.Errorf("Encoded unexpected delta:\n     got: %s\nexpected: %s", got, expected)
+	}
+}
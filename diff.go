@@ -0,0 +1,75 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Changes describes the differences between two sets of values, as returned
+// by Diff. Each list is sorted by key.
+type Changes struct {
+	Added   []string // Keys only present afterwards.
+	Removed []string // Keys only present before.
+	Changed []Change // Keys present in both whose value differs.
+}
+
+// A Change records the old and new value of a key.
+type Change struct {
+	Key      string
+	Old, New interface{}
+}
+
+// Empty reports whether c contains no differences.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Diff compares two sets of values keyed like a Map, such as snapshots taken
+// with Map.Values, or Maps themselves, in which case their current values are
+// compared. Values are compared with reflect.DeepEqual after dereferencing any
+// pointers, so a pointer compares equal to the value it points to, and a nil
+// pointer to nil. The Old and New values of a Change are dereferenced the same
+// way.
+func Diff(before, after map[string]interface{}) Changes {
+	var c Changes
+
+	for key, old := range before {
+		value, ok := after[key]
+		if !ok {
+			c.Removed = append(c.Removed, key)
+			continue
+		}
+
+		old, value = indirect(old), indirect(value)
+		if !reflect.DeepEqual(old, value) {
+			c.Changed = append(c.Changed, Change{key, old, value})
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			c.Added = append(c.Added, key)
+		}
+	}
+
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	sort.Slice(c.Changed, func(i, j int) bool { return c.Changed[i].Key < c.Changed[j].Key })
+	return c
+}
+
+// indirect returns the current value of the Map value v with all pointers
+// dereferenced, or nil if it leads to a nil pointer.
+func indirect(v interface{}) interface{} {
+	rv := resolve(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+		return nil
+	}
+	return rv.Interface()
+}
@@ -0,0 +1,69 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestDiff(t *testing.T) {
+	val := &struct {
+		Hits  int
+		Name  string
+		Tags  []string
+		Child *Child
+	}{Hits: 1, Name: "a", Tags: []string{"x"}, Child: &Child{1, "2"}}
+
+	before := flatjson.Flatten(val).Values()
+	if c := flatjson.Diff(before, flatjson.Flatten(val).Values()); !c.Empty() {
+		t.Errorf("Expected no changes, got %#v", c)
+	}
+
+	// A value flipping to its zero value is a change, and the fields of a
+	// struct pointer that became nil are replaced by the pointer itself.
+	val.Hits = 0
+	val.Tags = append(val.Tags, "y")
+	val.Child = nil
+	after := flatjson.Flatten(val).Values()
+
+	expected := flatjson.Changes{
+		Added:   []string{"Child"},
+		Removed: []string{"Child.CC", "Child.CD"},
+		Changed: []flatjson.Change{
+			{Key: "Hits", Old: 1, New: 0},
+			{Key: "Tags", Old: []string{"x"}, New: []string{"x", "y"}},
+		},
+	}
+	if c := flatjson.Diff(before, after); !reflect.DeepEqual(c, expected) {
+		t.Errorf("Unexpected changes:\n     got: %#v\nexpected: %#v", c, expected)
+	}
+}
+
+func TestDiffMaps(t *testing.T) {
+	val := &struct {
+		Hits int
+		Ptr  *int
+	}{Hits: 1}
+	live := flatjson.Flatten(val)
+	before := live.Values()
+
+	// A live Map is compared by its current values, which match the snapshot
+	// until the struct changes.
+	if c := flatjson.Diff(before, live); !c.Empty() {
+		t.Errorf("Expected no changes, got %#v", c)
+	}
+
+	n := 0
+	val.Hits = 2
+	val.Ptr = &n
+	expected := flatjson.Changes{
+		Changed: []flatjson.Change{
+			{Key: "Hits", Old: 1, New: 2},
+			{Key: "Ptr", Old: nil, New: 0},
+		},
+	}
+	if c := flatjson.Diff(before, live); !reflect.DeepEqual(c, expected) {
+		t.Errorf("Unexpected changes:\n     got: %#v\nexpected: %#v", c, expected)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// A dynamic is the Map value for an interface field with
+// Options.DynamicInterfaces, or one tagged with dynamic, and for a map field
+// tagged with dynamicmap. The value the interface holds, or the elements the
+// map holds, are flattened again each time the Map is encoded, so its entries
+// follow whatever is assigned to it.
+type dynamic struct {
+	src  source // Finds the interface.
+	node node   // Describes the interface field.
+	opts Options
+
+	// visiting holds the structs that were being flattened when the field
+	// was reached, so that cycles through the interface terminate.
+	visiting map[visit]bool
+}
+
+// rekeyed returns a copy of d which is expanded under the keys rekey returns
+// for those d is expanded under, for when it is moved to another key.
+func (d *dynamic) rekeyed(rekey func(key string) string) *dynamic {
+	c := *d
+	c.node.key, c.node.prefix = rekey(d.node.key), rekey(d.node.prefix)
+	return &c
+}
+
+// flattenDynamic adds the entry for v, an interface or a map described by n,
+// which is flattened when the Map is encoded.
+func (f *flattener) flattenDynamic(v reflect.Value, n node) int {
+	src := n.src
+	if src == nil {
+		src = addressed(v)
+	}
+
+	visiting := make(map[visit]bool, len(f.visiting))
+	for v := range f.visiting {
+		visiting[v] = true
+	}
+
+	if f.output.add(n.key, &dynamic{src, n, f.opts, visiting}) {
+		f.duplicates = append(f.duplicates, n.key)
+	}
+	return 1
+}
+
+// flatten adds the entries for the value the interface currently holds, or
+// the elements the map currently holds, to out, which may include other
+// dynamic entries.
+func (d *dynamic) flatten(out Map) {
+	f := newFlattener(d.opts, out)
+	for v := range d.visiting {
+		f.visiting[v] = true
+	}
+
+	v := d.src()
+	switch {
+	case !v.IsValid():
+		out[d.node.key] = nil
+	case v.Kind() == reflect.Map:
+		if l := d.opts.MapLocker; l != nil {
+			l.Lock()
+			defer l.Unlock()
+		}
+		n := d.node
+		n.dynMap = false
+		f.flattenMap(v, n)
+	case v.IsNil():
+		// Added as a leaf, which honors the field's tag options.
+		f.opts.DynamicInterfaces = false
+		n := d.node
+		n.dynamic = false
+		f.flattenChild(v, n)
+	default:
+		n := d.node
+		n.src = nil
+		f.flattenChild(v.Elem(), n)
+	}
+}
+
+// expandInto adds the entries for the value the interface currently holds to
+// out, expanding nested dynamic entries too. Keys already in out are kept.
+func (d *dynamic) expandInto(out Map) {
+	flat := Map{}
+	d.flatten(flat)
+
+	for key, value := range flat {
+		if nested, ok := value.(*dynamic); ok {
+			nested.expandInto(out)
+		} else if _, ok := out[key]; !ok {
+			out[key] = value
+		}
+	}
+}
+
+// MarshalJSON encodes the value the interface currently holds as a whole, for
+// the uses of a Map which don't expand dynamic entries.
+func (d *dynamic) MarshalJSON() ([]byte, error) {
+	v := d.src()
+	if !v.IsValid() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(v.Interface())
+}
+
+// expandDynamic returns m with its dynamic entries replaced by the entries
+// for the current values of their interfaces. If m has none, it is returned
+// as is.
+func (m Map) expandDynamic() Map {
+	var dynamics []*dynamic
+	for _, value := range m {
+		if d, ok := value.(*dynamic); ok {
+			dynamics = append(dynamics, d)
+		}
+	}
+	if len(dynamics) == 0 {
+		return m
+	}
+
+	out := make(Map, len(m))
+	for key, value := range m {
+		if _, ok := value.(*dynamic); !ok {
+			out[key] = value
+		}
+	}
+	for _, d := range dynamics {
+		d.expandInto(out)
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type Payload struct {
+	Kind string      `json:"kind"`
+	Data interface{} `json:"data"`
+	Err  error       `json:"err,omitempty"`
+}
+
+func TestInterfaceFields(t *testing.T) {
+	val := &Payload{Kind: "a"}
+
+	// By default the field is a single entry encoded as its current value.
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data": nil})
+
+	val.Data = 5
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data": 5.0})
+
+	val.Data = Child{1, "x"}
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data": map[string]interface{}{"CC": 1.0, "CD": "x"}})
+}
+
+func TestDynamicInterfaces(t *testing.T) {
+	val := &Payload{Kind: "a"}
+	opts := flatjson.Options{DynamicInterfaces: true}
+	flat := flatjson.FlattenWithOptions(val, opts)
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data": nil})
+
+	val.Data = 5
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data": 5.0})
+
+	// A struct has its fields flattened, whether or not it is addressable.
+	val.Data = Child{1, "x"}
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data.CC": 1.0, "data.CD": "x"})
+
+	child := &Child{2, "y"}
+	val.Data = child
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data.CC": 2.0, "data.CD": "y"})
+
+	// Tag options still apply, and nested interfaces are expanded too.
+	val.Err = errors.New("failed")
+	val.Data = &Payload{Kind: "b", Data: []int{1}}
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "err": map[string]interface{}{}, "data.kind": "b", "data.data": []interface{}{1.0}})
+
+	val.Err = nil
+	val.Data = nil
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data": nil})
+
+	// Snapshots are expanded the same way, while accessors see a single
+	// entry.
+	val.Data = *child
+	expected := map[string]interface{}{"kind": "a", "err": nil, "data.CC": 2, "data.CD": "y"}
+	if values := flat.Values(); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Unexpected values:\n     got: %v\nexpected: %v", values, expected)
+	}
+	val.Data = 7
+	if n, ok := flat.GetInt64("data"); !ok || n != 7 {
+		t.Errorf("Expected GetInt64 to return the interface's value, got %v", n)
+	}
+}
+
+func TestDynamicInterfacesCycle(t *testing.T) {
+	val := &Payload{Kind: "a"}
+	val.Data = val
+
+	// The cycle is cut when the field is expanded, as it would be when
+	// flattening.
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{DynamicInterfaces: true})
+	testEncoding(t, flat, flatjson.Map{"kind": "a"})
+
+	val.Data = &Payload{Kind: "b", Data: val}
+	testEncoding(t, flat, flatjson.Map{"kind": "a", "data.kind": "b"})
+}
+
+type Machine struct {
+	State   string      `json:"state"`
+	Current interface{} `json:"current,dynamic"`
+	Last    interface{} `json:"last"`
+}
+
+type Connecting struct {
+	Attempt int    `json:"attempt"`
+	Addr    string `json:"addr"`
+}
+
+type Connected struct {
+	Since int  `json:"since"`
+	TLS   bool `json:"tls"`
+}
+
+func TestDynamicTag(t *testing.T) {
+	val := &Machine{State: "connecting", Current: &Connecting{1, "a"}, Last: Child{1, "x"}}
+	flat := flatjson.Flatten(val)
+
+	testEncoding(t, flat, flatjson.Map{"state": "connecting", "current.attempt": 1.0, "current.addr": "a", "last.CC": 1.0, "last.CD": "x"})
+
+	// The keys of the previous value are gone once another type is
+	// assigned, while the untagged field keeps the keys it got when the Map
+	// was flattened.
+	val.State, val.Current = "connected", Connected{5, true}
+	testEncoding(t, flat, flatjson.Map{"state": "connected", "current.since": 5.0, "current.tls": true, "last.CC": 1.0, "last.CD": "x"})
+
+	var buf bytes.Buffer
+	if err := flat.MarshalTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"current.since":5,"current.tls":true,"last.CC":1,"last.CD":"x","state":"connected"}`; buf.String() != expected {
+		t.Errorf("Unexpected output:\n     got: %s\nexpected: %s", buf.String(), expected)
+	}
+
+	val.Current = &Connecting{2, "b"}
+	testEncoding(t, flat, flatjson.Map{"state": "connected", "current.attempt": 2.0, "current.addr": "b", "last.CC": 1.0, "last.CD": "x"})
+
+	val.Current = nil
+	testEncoding(t, flat, flatjson.Map{"state": "connected", "current": nil, "last.CC": 1.0, "last.CD": "x"})
+}
+
+type ShardStats struct {
+	Requests int    `json:"requests"`
+	Leader   string `json:"leader,omitempty"`
+}
+
+type ShardedServer struct {
+	Name   string                 `json:"name"`
+	Shards map[string]*ShardStats `json:"shards,dynamicmap"`
+	Static map[string]ShardStats  `json:"static,dynamicmap"`
+}
+
+func TestDynamicMapTag(t *testing.T) {
+	var mu sync.Mutex
+	val := &ShardedServer{Name: "a", Shards: map[string]*ShardStats{"s1": {Requests: 1}}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{MapLocker: &mu})
+	testEncoding(t, flat, flatjson.Map{"name": "a", "shards.s1.requests": 1.0})
+
+	// Shards are added and removed under the lock while the Map is encoded.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mu.Lock()
+			if i%2 == 0 {
+				val.Shards["s2"] = &ShardStats{Requests: 2, Leader: "x"}
+			} else {
+				delete(val.Shards, "s2")
+			}
+			mu.Unlock()
+		}
+		mu.Lock()
+		delete(val.Shards, "s1")
+		val.Shards["s3"] = &ShardStats{Requests: 3}
+		mu.Unlock()
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := flat.MarshalJSON(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	testEncoding(t, flat, flatjson.Map{"name": "a", "shards.s3.requests": 3.0})
+
+	// The elements are encoded in sorted key order, which also holds for
+	// elements held by value.
+	val.Shards["s0"] = &ShardStats{Requests: 4, Leader: "y"}
+	val.Static = map[string]ShardStats{"b": {Requests: 5}, "a": {Requests: 6}}
+	var buf bytes.Buffer
+	if err := flat.MarshalTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"name":"a","shards.s0.leader":"y","shards.s0.requests":4,"shards.s3.requests":3,"static.a.requests":6,"static.b.requests":5}`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n     got: %s\nexpected: %s", buf.String(), expected)
+	}
+
+	val.Shards, val.Static = nil, nil
+	testEncoding(t, flat, flatjson.Map{"name": "a"})
+}
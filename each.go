@@ -0,0 +1,84 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"strings"
+)
+
+// FlattenEach flattens each element of slice, which must be a slice of structs
+// or of pointers to structs, or a pointer to one, into its own Map. It is
+// equivalent to calling FlattenE on a pointer to each element in turn, but
+// reuses the work that only depends on the element type, so that it's faster
+// for a large number of elements.
+//
+// For a slice of structs, the Maps point into the slice's backing array, so
+// that later changes to the elements are visible through them.
+//
+// WARNING: growing the slice past its capacity, such as with append, moves the
+// elements to a new backing array, and the Maps keep pointing at the old one,
+// whose elements no longer change. The same goes for replacing the slice, or
+// copying elements around in it. Call FlattenEach again after any of these.
+// A slice of pointers doesn't have this problem, since the Maps point into the
+// structs themselves.
+func FlattenEach(slice interface{}) ([]Map, error) {
+	return Options{}.FlattenEach(slice)
+}
+
+// FlattenEach is like the package-level FlattenEach, but flattens the elements
+// according to o. An error is returned if slice isn't a slice of structs or of
+// pointers to structs, if one of the pointers is nil, or in the same cases as
+// Options.Flatten for any of the elements.
+func (o Options) FlattenEach(slice interface{}) ([]Map, error) {
+	v := reflect.ValueOf(slice)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Slice {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice || !isStructOrPointer(v.Type().Elem()) {
+		return nil, rootError("FlattenEach", reflect.TypeOf(slice), "flatjson: expected slice of structs or pointers to structs, got %T", slice)
+	}
+
+	f := newFlattener(o, nil)
+	prefix := f.opts.rootPrefix()
+	maps := make([]Map, v.Len())
+	for i := range maps {
+		elem := v.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				return nil, rootError("FlattenEach", elem.Type(), "flatjson: element %d is a nil pointer", i)
+			}
+			elem = elem.Elem()
+		}
+
+		// The elements usually have the same number of entries, so each
+		// Map is made as large as the previous one to begin with.
+		size := 0
+		if i > 0 {
+			size = len(maps[i-1])
+		}
+		maps[i] = make(Map, size)
+
+		f.reset(maps[i])
+		f.flatten(elem, prefix, nil)
+		if err := f.err(); err != nil {
+			e := newError("FlattenEach", nil, "flatjson: element %d: %s", i, strings.TrimPrefix(err.Error(), "flatjson: "))
+			if cause, ok := err.(*Error); ok {
+				e.Key = cause.Key
+			}
+			e.Err = err
+			return nil, e
+		}
+	}
+	return maps, nil
+}
+
+// isStructOrPointer reports whether t is a struct type or a pointer to one.
+func isStructOrPointer(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
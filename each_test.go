@@ -0,0 +1,88 @@
+package flatjson_test
+
+import (
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestFlattenEach(t *testing.T) {
+	pools := []Pool{{1, 2}, {3, 4}}
+	maps, err := flatjson.FlattenEach(pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) != 2 {
+		t.Fatalf("Expected 2 Maps, got %d", len(maps))
+	}
+	expected := []flatjson.Map{
+		{"active": 1.0, "idle": 2.0},
+		{"active": 3.0, "idle": 4.0},
+	}
+	for i, m := range maps {
+		testEncoding(t, m, expected[i])
+	}
+
+	// The Maps point into the backing array.
+	pools[1].Active = 5
+	testEncoding(t, maps[1], flatjson.Map{"active": 5.0, "idle": 4.0})
+
+	// Pointers are followed, and the options apply to every element.
+	ptrs := []*Pool{{6, 7}, {8, 9}}
+	maps, err = flatjson.Options{Prefix: "pool"}.FlattenEach(&ptrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptrs[0].Idle = 10
+	testEncoding(t, maps[0], flatjson.Map{"pool.active": 6.0, "pool.idle": 10.0})
+	testEncoding(t, maps[1], flatjson.Map{"pool.active": 8.0, "pool.idle": 9.0})
+
+	if maps, err := flatjson.FlattenEach([]Pool{}); err != nil || len(maps) != 0 {
+		t.Errorf("Expected no Maps, got %v, %v", maps, err)
+	}
+}
+
+func TestFlattenEachErrors(t *testing.T) {
+	for _, val := range []interface{}{
+		nil,
+		Pool{},
+		&Pool{},
+		[]int{1},
+		[]**Pool{},
+		[]*Pool{{}, nil},
+		[]struct {
+			A int `json:"a"`
+			B int `flatjson:"a"`
+		}{{}},
+	} {
+		if maps, err := flatjson.FlattenEach(val); err == nil {
+			t.Errorf("Expected error for %#v, got %v", val, maps)
+		}
+	}
+}
+
+func BenchmarkFlattenEach(b *testing.B) {
+	stats := make([]MixedStats, 100)
+	for i := range stats {
+		stats[i].Ptr = &PlainStats{}
+	}
+
+	b.Run("Loop", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := range stats {
+				if _, err := flatjson.FlattenE(&stats[j]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("Each", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := flatjson.FlattenEach(stats); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
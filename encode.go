@@ -0,0 +1,215 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+)
+
+// MarshalJSON encodes m as a JSON object. The keys are always emitted in
+// sorted order, compared byte-wise as by sort.Strings, so encoding the same
+// values twice produces identical output. Entries for fields tagged with
+// omitempty are left out if the field's current value is empty, and those
+// tagged with omitzero if it is zero.
+func (m Map) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+
+	var buf bytes.Buffer
+	if err := m.writeJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the same encoding of m as MarshalJSON to w, without building
+// the whole encoding in memory first. It returns the number of bytes written.
+// If an entry can't be encoded, the error is returned and the output written
+// so far is incomplete.
+func (m Map) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if m == nil {
+		_, err := io.WriteString(cw, "null")
+		return cw.n, err
+	}
+
+	err := m.writeJSON(cw)
+	return cw.n, err
+}
+
+// MarshalIndent is like MarshalJSON, but indents the output the way
+// json.MarshalIndent does: each entry begins on a new line starting with
+// prefix followed by indent, and values holding nested JSON, like slices, are
+// indented one level further for each level of nesting.
+func (m Map) MarshalIndent(prefix, indent string) ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+
+	var buf bytes.Buffer
+	if err := m.writeIndentedJSON(&buf, indentation{prefix, indent, true}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m Map) writeJSON(w io.Writer) error {
+	return m.writeIndentedJSON(w, indentation{})
+}
+
+func (m Map) writeIndentedJSON(w io.Writer, ind indentation) error {
+	m = m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	ow := objectWriter{w: w, ind: ind}
+	ow.begin()
+	for _, key := range *keys {
+		ow.entry(key, m[key])
+	}
+	return ow.end()
+}
+
+// objectWriter writes a JSON object made up of Map entries. Once a write
+// fails, the error is kept and the remaining calls do nothing.
+type objectWriter struct {
+	w   io.Writer
+	n   int // The number of entries written.
+	err error
+
+	// quoteErrors causes entries that can't be encoded to be written as a
+	// string holding the error, rather than failing.
+	quoteErrors bool
+
+	ind indentation
+}
+
+func (ow *objectWriter) write(p []byte) {
+	if ow.err == nil {
+		_, ow.err = ow.w.Write(p)
+	}
+}
+
+func (ow *objectWriter) begin() {
+	ow.write([]byte{'{'})
+}
+
+// entry writes a key and value, unless the value is currently omitted.
+func (ow *objectWriter) entry(key string, value interface{}) {
+	if ow.err != nil {
+		return
+	}
+	if e, ok := value.(*entry); ok && e.omit() {
+		return
+	}
+
+	enc, err := json.Marshal(value)
+	if err != nil && ow.quoteErrors {
+		enc, err = json.Marshal(err.Error())
+	}
+	if err != nil {
+		ow.err = err
+		return
+	}
+	name, _ := json.Marshal(key)
+
+	if ow.n > 0 {
+		ow.write([]byte{','})
+	}
+	ow.write(ow.ind.appendNewline(nil, 1))
+	ow.write(name)
+	ow.write(ow.ind.appendColon(nil))
+	ow.write(ow.ind.appendNested(nil, enc))
+	ow.n++
+}
+
+func (ow *objectWriter) end() error {
+	if ow.n > 0 {
+		ow.write(ow.ind.appendNewline(nil, 0))
+	}
+	ow.write([]byte{'}'})
+	return ow.err
+}
+
+// An indentation describes how JSON objects are indented, the same way as
+// json.MarshalIndent. The zero value leaves them compact.
+type indentation struct {
+	prefix, indent string
+	enabled        bool
+}
+
+// appendNewline appends the start of a new line for an object at depth, when
+// indenting, to buf.
+func (ind indentation) appendNewline(buf []byte, depth int) []byte {
+	if !ind.enabled {
+		return buf
+	}
+	buf = append(buf, '\n')
+	buf = append(buf, ind.prefix...)
+	for i := 0; i < depth; i++ {
+		buf = append(buf, ind.indent...)
+	}
+	return buf
+}
+
+// appendColon appends the separator between a key and its value to buf.
+func (ind indentation) appendColon(buf []byte) []byte {
+	if !ind.enabled {
+		return append(buf, ':')
+	}
+	return append(buf, ':', ' ')
+}
+
+// appendNested appends enc, the encoding of a value in the object, to buf,
+// indented one level into the object if it holds nested JSON.
+func (ind indentation) appendNested(buf, enc []byte) []byte {
+	if !ind.enabled || len(enc) == 0 || enc[0] != '{' && enc[0] != '[' {
+		return append(buf, enc...)
+	}
+	b := bytes.NewBuffer(buf)
+	if err := json.Indent(b, enc, ind.prefix+ind.indent, ind.indent); err != nil {
+		// Encoded by encoding/json, so it is always valid.
+		return append(buf, enc...)
+	}
+	return b.Bytes()
+}
+
+var keysPool = sync.Pool{
+	New: func() interface{} { return new([]string) },
+}
+
+// sortedKeys returns the keys of m in sorted order. The slice is reused across
+// calls, and must be released with putKeys once it is no longer needed.
+func (m Map) sortedKeys() *[]string {
+	keys := keysPool.Get().(*[]string)
+	*keys = (*keys)[:0]
+
+	for key := range m {
+		*keys = append(*keys, key)
+	}
+	sort.Strings(*keys)
+	return keys
+}
+
+func putKeys(keys *[]string) {
+	keysPool.Put(keys)
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
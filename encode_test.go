@@ -0,0 +1,1011 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestOmitEmptyAtMarshal(t *testing.T) {
+	val := &struct {
+		Count int    `json:"count,omitempty"`
+		Name  string `json:"name,omitempty"`
+		Ptr   *Child `json:"ptr,omitempty"`
+		Kept  int    `json:"kept"`
+	}{}
+
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{"kept": 0.0})
+
+	// Fields that become non-empty after flattening appear...
+	val.Count = 5
+	val.Name = "abc"
+	val.Ptr = &Child{1, "2"}
+	testEncoding(t, flat, flatjson.Map{
+		"count": 5.0,
+		"name":  "abc",
+		"ptr":   map[string]interface{}{"CC": 1.0, "CD": "2"},
+		"kept":  0.0,
+	})
+
+	// ...and disappear again once they are reset.
+	val.Count = 0
+	val.Ptr = nil
+	testEncoding(t, flat, flatjson.Map{"name": "abc", "kept": 0.0})
+
+	// The previous behavior is still available.
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{EagerOmitEmpty: true})
+	val.Count = 5
+	testEncoding(t, flat, flatjson.Map{"name": "abc", "kept": 0.0})
+}
+
+type EmptyKinds struct {
+	Bool    bool                   `json:"bool,omitempty"`
+	Int     int                    `json:"int,omitempty"`
+	Int8    int8                   `json:"int8,omitempty"`
+	Uint    uint                   `json:"uint,omitempty"`
+	Uintptr uintptr                `json:"uintptr,omitempty"`
+	Float32 float32                `json:"float32,omitempty"`
+	Float64 float64                `json:"float64,omitempty"`
+	String  string                 `json:"string,omitempty"`
+	Empty   [0]int                 `json:"empty,omitempty"`
+	Array   [2]int                 `json:"array,omitempty"`
+	Map     map[string]int         `json:"map,omitempty"`
+	Slice   []string               `json:"slice,omitempty"`
+	Nil     []string               `json:"nil,omitempty"`
+	Ptr     *int                   `json:"ptr,omitempty"`
+	Any     interface{}            `json:"any,omitempty"`
+	Time    time.Time              `json:"time,omitempty"`
+	Child   Child                  `json:"child,omitempty"`
+	Func    func()                 `json:"func,omitempty"`
+	Chan    chan int               `json:"chan,omitempty"`
+	Values  map[string]interface{} `json:"values,omitempty"`
+}
+
+func TestOmitEmptyKinds(t *testing.T) {
+	for _, opts := range []flatjson.Options{{}, {EagerOmitEmpty: true}} {
+		// Arrays are only empty if they have no elements, and types that
+		// can't be encoded are left out either way.
+		val := &EmptyKinds{Map: map[string]int{}, Slice: []string{}}
+		testFlatteningWithOptions(t, val, opts, flatjson.Map{"array": []interface{}{0.0, 0.0}})
+
+		one := 1
+		val = &EmptyKinds{
+			Bool: true, Int: -1, Int8: 1, Uint: 1, Uintptr: 1, Float32: 0.5, Float64: -0.5, String: "s",
+			Array: [2]int{1, 2}, Map: map[string]int{"a": 1}, Slice: []string{"b"}, Ptr: &one, Any: 0,
+			Time: time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC), Child: Child{1, ""}, Func: func() {},
+			Chan: make(chan int), Values: map[string]interface{}{"c": nil},
+		}
+		testFlatteningWithOptions(t, val, opts, flatjson.Map{
+			"bool":     true,
+			"int":      -1.0,
+			"int8":     1.0,
+			"uint":     1.0,
+			"uintptr":  1.0,
+			"float32":  0.5,
+			"float64":  -0.5,
+			"string":   "s",
+			"array":    []interface{}{1.0, 2.0},
+			"map":      map[string]interface{}{"a": 1.0},
+			"slice":    []interface{}{"b"},
+			"ptr":      1.0,
+			"any":      0.0,
+			"time":     "2015-06-01T00:00:00Z",
+			"child.CC": 1.0,
+			"child.CD": "",
+			"values":   map[string]interface{}{"c": nil},
+		})
+	}
+
+	// Fields are evaluated when the Map is encoded, whatever their type.
+	val := &EmptyKinds{Slice: []string{"a"}, Map: map[string]int{"b": 1}}
+	flat := flatjson.Flatten(val)
+	val.Slice, val.Map["b"] = val.Slice[:0], 2
+	testEncoding(t, flat, flatjson.Map{"array": []interface{}{0.0, 0.0}, "map": map[string]interface{}{"b": 2.0}})
+	delete(val.Map, "b")
+	testEncoding(t, flat, flatjson.Map{"array": []interface{}{0.0, 0.0}})
+}
+
+func TestOmitEmptyNestedStruct(t *testing.T) {
+	type TLS struct {
+		Cert  string `json:"cert"`
+		Inner struct {
+			Depth int `json:"depth"`
+		} `json:"inner,omitempty"`
+	}
+	val := &struct {
+		Name  string `json:"name"`
+		Child Child  `json:"child,omitempty"`
+		TLS   *TLS   `json:"tls,omitempty"`
+	}{TLS: &TLS{}}
+
+	// The whole subtree is left out while all of its entries are empty.
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{"name": ""})
+
+	val.Child.C = 1
+	testEncoding(t, flat, flatjson.Map{"name": "", "child.CC": 1.0, "child.CD": ""})
+
+	val.Child.C = 0
+	testEncoding(t, flat, flatjson.Map{"name": ""})
+
+	// Nested groups are evaluated separately.
+	val.TLS.Cert = "x"
+	testEncoding(t, flat, flatjson.Map{"name": "", "tls.cert": "x"})
+
+	val.TLS.Inner.Depth = 2
+	testEncoding(t, flat, flatjson.Map{"name": "", "tls.cert": "x", "tls.inner.depth": 2.0})
+
+	val.TLS.Cert = ""
+	testEncoding(t, flat, flatjson.Map{"name": "", "tls.cert": "", "tls.inner.depth": 2.0})
+
+	val.TLS.Inner.Depth = 0
+	testEncoding(t, flat, flatjson.Map{"name": ""})
+
+	// The previous behavior is still available.
+	val.Child.C = 1
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{EagerOmitEmpty: true})
+	val.Child.C = 0
+	testEncoding(t, flat, flatjson.Map{"name": "", "child.CC": 0.0, "child.CD": "", "tls.cert": ""})
+}
+
+// A Limit is unset while negative.
+type Limit int
+
+func (l Limit) IsZero() bool { return l < 0 }
+
+// A Version is unset while its numbers are, whatever its label.
+type Version struct {
+	Major int    `json:"major"`
+	Minor int    `json:"minor"`
+	Label string `json:"label"`
+}
+
+func (v Version) IsZero() bool { return v.Major == 0 && v.Minor == 0 }
+
+func TestOmitZero(t *testing.T) {
+	zero := 0
+	val := &struct {
+		Count   int       `json:"count,omitzero"`
+		Ratio   float64   `json:"ratio,omitzero"`
+		Started time.Time `json:"started,omitzero"`
+		Limit   Limit     `json:"limit,omitzero"`
+		Version Version   `json:"version,omitzero"`
+		Child   Child     `json:"child,omitzero"`
+		Tags    []string  `json:"tags,omitzero"`
+		Ptr     *int      `json:"ptr,omitzero"`
+		Kept    int       `json:"kept"`
+	}{
+		// Not the zero value of time.Time, but IsZero reports true.
+		Started: time.Time{}.In(time.FixedZone("UTC+1", 3600)),
+		Limit:   -1,
+		// Unlike with omitempty, empty slices aren't left out.
+		Tags: []string{},
+	}
+
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{"tags": []interface{}{}, "kept": 0.0})
+
+	// Evaluated when the Map is encoded, like omitempty.
+	val.Count = 1
+	val.Started = time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	val.Limit = 0
+	val.Version.Label = "beta"
+	val.Ptr = &zero
+	testEncoding(t, flat, flatjson.Map{
+		"count":   1.0,
+		"started": "2015-06-01T12:00:00Z",
+		"limit":   0.0,
+		"tags":    []interface{}{},
+		"ptr":     0.0,
+		"kept":    0.0,
+	})
+
+	// Structs are left out as a whole, using IsZero if they have it.
+	val.Version.Minor = 2
+	val.Child.D = "x"
+	testEncoding(t, flat, flatjson.Map{
+		"count":         1.0,
+		"started":       "2015-06-01T12:00:00Z",
+		"limit":         0.0,
+		"version.major": 0.0,
+		"version.minor": 2.0,
+		"version.label": "beta",
+		"child.CC":      0.0,
+		"child.CD":      "x",
+		"tags":          []interface{}{},
+		"ptr":           0.0,
+		"kept":          0.0,
+	})
+
+	val.Count, val.Version.Minor, val.Child.D, val.Ptr = 0, 0, "", nil
+	testEncoding(t, flat, flatjson.Map{
+		"started": "2015-06-01T12:00:00Z",
+		"limit":   0.0,
+		"tags":    []interface{}{},
+		"kept":    0.0,
+	})
+
+	// With EagerOmitEmpty, fields are evaluated once.
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{EagerOmitEmpty: true})
+	val.Count = 1
+	val.Version.Major = 1
+	testEncoding(t, flat, flatjson.Map{
+		"started": "2015-06-01T12:00:00Z",
+		"limit":   0.0,
+		"tags":    []interface{}{},
+		"kept":    0.0,
+	})
+}
+
+func TestNilPointers(t *testing.T) {
+	val := &struct {
+		Count *int       `json:"count"`
+		Name  *string    `json:"name"`
+		When  *time.Time `json:"when"`
+		Quote *int       `json:"quote,string"`
+		Kept  int        `json:"kept"`
+	}{}
+
+	for _, test := range []struct {
+		policy   flatjson.NilPointerPolicy
+		unset    flatjson.Map
+		expected flatjson.Map
+	}{
+		{
+			flatjson.NilPointerKeep,
+			flatjson.Map{"count": nil, "name": nil, "when": nil, "quote": nil, "kept": 0.0},
+			flatjson.Map{"count": 3.0, "name": "a", "when": nil, "quote": "4", "kept": 0.0},
+		},
+		{
+			flatjson.NilPointerOmit,
+			flatjson.Map{"kept": 0.0},
+			flatjson.Map{"count": 3.0, "name": "a", "quote": "4", "kept": 0.0},
+		},
+		{
+			flatjson.NilPointerZero,
+			flatjson.Map{"count": 0.0, "name": "", "when": "0001-01-01T00:00:00Z", "quote": "0", "kept": 0.0},
+			flatjson.Map{"count": 3.0, "name": "a", "when": "0001-01-01T00:00:00Z", "quote": "4", "kept": 0.0},
+		},
+	} {
+		val.Count, val.Name, val.Quote = nil, nil, nil
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{NilPointers: test.policy})
+		testEncoding(t, flat, test.unset)
+
+		// The pointers are checked each time the Map is encoded.
+		count, name, quote := 3, "a", 4
+		val.Count, val.Name, val.Quote = &count, &name, &quote
+		testEncoding(t, flat, test.expected)
+
+		val.Count, val.Name, val.Quote = nil, nil, nil
+		testEncoding(t, flat, test.unset)
+	}
+}
+
+func TestStringOption(t *testing.T) {
+	n := 7
+	val := &struct {
+		Retries int       `json:"retries,string"`
+		Ratio   float64   `json:"ratio,string"`
+		On      bool      `json:"on,string"`
+		Name    string    `json:"name,string"`
+		Ptr     *int      `json:"ptr,string"`
+		NilPtr  *int      `json:"nilPtr,string"`
+		Empty   int       `json:"empty,omitempty,string"`
+		Slice   []int     `json:"slice,string"`
+		Price   Decimal   `json:"price,string"`
+		Started time.Time `json:"started,string"`
+		State   State     `json:"state,string"`
+	}{
+		Retries: 3,
+		Ratio:   0.5,
+		On:      true,
+		Name:    `a "quoted" name`,
+		Ptr:     &n,
+		Slice:   []int{1, 2},
+		Price:   Decimal{1, 2},
+		State:   1,
+	}
+
+	testMatchesEncodingJSON(t, val)
+
+	val.Retries = 4
+	val.Empty = 1
+	testMatchesEncodingJSON(t, val)
+}
+
+// testMatchesEncodingJSON checks that the encoding of val, which must not
+// contain nested structs, matches after flattening.
+func testMatchesEncodingJSON(t *testing.T, val interface{}) {
+	enc, err := json.Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := flatjson.Map{}
+	if err := json.Unmarshal(enc, &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	testFlattening(t, val, expected)
+}
+
+func TestMarshalDeterministic(t *testing.T) {
+	val := &struct {
+		Zebra  int
+		Apple  string
+		Nested struct{ B, A, C int }
+		Pool   `json:"pool"`
+		Omit   int `json:",omitempty"`
+	}{Zebra: 1, Apple: "a"}
+	flat := flatjson.Flatten(val)
+
+	const expected = `{"Apple":"a","Nested.A":0,"Nested.B":0,"Nested.C":0,"Zebra":1,"pool.active":0,"pool.idle":0}`
+
+	for i := 0; i < 10; i++ {
+		enc, err := flat.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(enc) != expected {
+			t.Fatalf("Unexpected encoding:\n     got: %s\nexpected: %s", enc, expected)
+		}
+
+		enc, err = json.Marshal(flat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(enc) != expected {
+			t.Fatalf("Unexpected encoding through encoding/json:\n     got: %s\nexpected: %s", enc, expected)
+		}
+
+		var buf bytes.Buffer
+		n, err := flat.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected || n != int64(len(expected)) {
+			t.Fatalf("Unexpected output from WriteTo (%d bytes):\n     got: %s\nexpected: %s", n, buf.String(), expected)
+		}
+	}
+
+	var nilMap flatjson.Map
+	if enc, err := json.Marshal(nilMap); err != nil || string(enc) != "null" {
+		t.Errorf("Unexpected encoding of nil Map: %s, %v", enc, err)
+	}
+}
+
+type Level int
+
+func (l *Level) String() string { return "level " + strconv.Itoa(int(*l)) }
+
+type Tagged string
+
+func (t Tagged) String() string               { return "string " + string(t) }
+func (t Tagged) MarshalJSON() ([]byte, error) { return json.Marshal("json " + string(t)) }
+
+func TestStringers(t *testing.T) {
+	val := &struct {
+		State   State
+		Timeout time.Duration
+		Level   Level
+		Nil     *Level
+		Ptr     *Level
+		Tagged  Tagged
+		Empty   State `json:",omitempty"`
+		Quoted  State `json:",string"`
+		Count   int
+	}{State: 1, Timeout: 90 * time.Second, Level: 2, Ptr: new(Level), Tagged: "a"}
+
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{Stringers: true})
+	testEncoding(t, flat, flatjson.Map{
+		"State":   "on",
+		"Timeout": "1m30s",
+		"Level":   "level 2",
+		"Nil":     nil,
+		"Ptr":     "level 0",
+		"Tagged":  "json a",
+		"Quoted":  "off",
+		"Count":   0.0,
+	})
+
+	// The values are formatted when the Map is encoded.
+	val.State = 0
+	val.Timeout = time.Millisecond
+	*val.Ptr = 3
+	val.Empty = 1
+	testEncoding(t, flat, flatjson.Map{
+		"State":   "off",
+		"Timeout": "1ms",
+		"Level":   "level 2",
+		"Nil":     nil,
+		"Ptr":     "level 3",
+		"Tagged":  "json a",
+		"Empty":   "on",
+		"Quoted":  "off",
+		"Count":   0.0,
+	})
+
+	tagged := &struct {
+		State   State `flatjson:",stringer"`
+		Timeout time.Duration
+	}{State: 1, Timeout: time.Second}
+	testFlattening(t, tagged, flatjson.Map{"State": "on", "Timeout": float64(time.Second)})
+}
+
+// A CodedError encodes itself with its code.
+type CodedError struct {
+	Code int
+}
+
+func (e *CodedError) Error() string { return "code " + strconv.Itoa(e.Code) }
+
+func (e *CodedError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int{"code": e.Code})
+}
+
+func TestErrorStrings(t *testing.T) {
+	val := &struct {
+		LastErr error   `json:"last_err"`
+		Wrapped error   `json:"wrapped,omitempty"`
+		Coded   error   `json:"coded"`
+		Errs    []error `json:"errs"`
+		Path    error   `json:"path"`
+	}{
+		Coded: &CodedError{7},
+		Errs:  []error{errors.New("a"), nil},
+		Path:  &os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist},
+	}
+
+	// By default, errors are encoded, or even flattened, like any other
+	// value.
+	testFlattening(t, val, flatjson.Map{
+		"last_err":  nil,
+		"coded":     map[string]interface{}{"code": 7.0},
+		"errs":      []interface{}{map[string]interface{}{}, nil},
+		"path.Op":   "open",
+		"path.Path": "/x",
+		"path.Err":  map[string]interface{}{},
+	})
+
+	opts := flatjson.Options{ErrorStrings: true, IndexSlices: true}
+	flat := flatjson.FlattenWithOptions(val, opts)
+	expected := flatjson.Map{
+		"last_err": nil,
+		"coded":    map[string]interface{}{"code": 7.0},
+		"errs.0":   "a",
+		"errs.1":   nil,
+		"path":     "open /x: file does not exist",
+	}
+	testEncoding(t, flat, expected)
+
+	// The current error is encoded each time, including wrapped ones.
+	val.LastErr = errors.New("timeout")
+	val.Wrapped = fmt.Errorf("dial: %v", val.LastErr)
+	val.Path = nil
+	expected["last_err"], expected["wrapped"], expected["path"] = "timeout", "dial: timeout", nil
+	testEncoding(t, flat, expected)
+
+	var buf bytes.Buffer
+	if err := flat.MarshalTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := json.Marshal(flat)
+	if buf.String() != string(enc) {
+		t.Errorf("Unexpected output:\n     got: %s\nexpected: %s", buf.String(), enc)
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	started := time.Date(2015, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	val := &struct {
+		Started time.Time
+		Ptr     *time.Time
+		Nil     *time.Time
+		Zero    time.Time `json:",omitempty"`
+		Now     time.Time
+	}{Started: started, Ptr: &started, Now: time.Now()}
+
+	// Monotonic clock readings don't affect the encoding.
+	val.Now = val.Now.Add(time.Hour)
+	now := val.Now.Round(0)
+
+	for _, test := range []struct {
+		format string
+		encode func(time.Time) interface{}
+	}{
+		{flatjson.TimeUnix, func(t time.Time) interface{} { return float64(t.Unix()) }},
+		{flatjson.TimeUnixMilli, func(t time.Time) interface{} { return float64(t.UnixNano() / 1e6) }},
+		{flatjson.TimeUnixNano, func(t time.Time) interface{} { return json.Number(strconv.FormatInt(t.UnixNano(), 10)) }},
+		{time.RFC3339, func(t time.Time) interface{} { return t.Format(time.RFC3339) }},
+		{"2006-01-02", func(t time.Time) interface{} { return t.Format("2006-01-02") }},
+	} {
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{TimeFormat: test.format})
+		expected := flatjson.Map{
+			"Started": test.encode(started),
+			"Ptr":     test.encode(started),
+			"Nil":     nil,
+			"Now":     test.encode(now),
+		}
+
+		enc, err := json.Marshal(flat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(enc))
+		if test.format == flatjson.TimeUnixNano {
+			dec.UseNumber()
+		}
+		// Decoded as a plain map, since Decoder.UseNumber doesn't apply to
+		// Map.UnmarshalJSON.
+		var actual map[string]interface{}
+		if err := dec.Decode(&actual); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(flatjson.Map(actual), expected) {
+			t.Errorf("Unexpected encoding with %s:\n     got: %v\nexpected: %v", test.format, actual, expected)
+		}
+	}
+
+	// Without a TimeFormat, times are encoded by MarshalJSON.
+	testEncoding(t, flatjson.Flatten(val), flatjson.Map{
+		"Started": started.Format(time.RFC3339Nano),
+		"Ptr":     started.Format(time.RFC3339Nano),
+		"Nil":     nil,
+		"Now":     now.Format(time.RFC3339Nano),
+	})
+}
+
+type Timeout time.Duration
+
+func TestDurationFormat(t *testing.T) {
+	d := -1500 * time.Millisecond
+	val := &struct {
+		Latency time.Duration
+		Ptr     *time.Duration
+		Nil     *time.Duration
+		Timeout Timeout
+		Count   int64
+	}{Latency: 90 * time.Second, Ptr: &d, Timeout: Timeout(time.Second), Count: 5}
+
+	for _, test := range []struct {
+		format                flatjson.DurationFormat
+		latency, ptr, timeout interface{}
+	}{
+		{flatjson.DurationNanos, float64(90 * time.Second), float64(d), float64(time.Second)},
+		{flatjson.DurationString, "1m30s", "-1.5s", float64(time.Second)},
+		{flatjson.DurationSeconds, 90.0, -1.5, float64(time.Second)},
+		{flatjson.DurationMillis, 90000.0, -1500.0, float64(time.Second)},
+	} {
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{DurationFormat: test.format})
+		testEncoding(t, flat, flatjson.Map{
+			"Latency": test.latency,
+			"Ptr":     test.ptr,
+			"Nil":     nil,
+			"Timeout": test.timeout,
+			"Count":   5.0,
+		})
+	}
+
+	// The format is applied when the Map is encoded.
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{DurationFormat: flatjson.DurationString})
+	val.Latency = time.Millisecond
+	testEncoding(t, flat, flatjson.Map{
+		"Latency": "1ms",
+		"Ptr":     "-1.5s",
+		"Nil":     nil,
+		"Timeout": float64(time.Second),
+		"Count":   5.0,
+	})
+}
+
+func TestDurationFormatTag(t *testing.T) {
+	val := &struct {
+		Latency  time.Duration `flatjson:",durfmt=ms"`
+		Timeout  Timeout       `flatjson:",durfmt=string"`
+		Interval time.Duration `flatjson:",durfmt=ns"`
+		Other    time.Duration
+	}{Latency: 2 * time.Second, Timeout: Timeout(time.Minute), Interval: time.Second, Other: time.Second}
+
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{DurationFormat: flatjson.DurationSeconds})
+	testEncoding(t, flat, flatjson.Map{
+		"Latency":  2000.0,
+		"Timeout":  "1m0s",
+		"Interval": float64(time.Second),
+		"Other":    1.0,
+	})
+
+	for _, val := range []interface{}{
+		&struct {
+			Latency time.Duration `flatjson:",durfmt=hours"`
+		}{},
+		&struct {
+			Name string `flatjson:",durfmt=ms"`
+		}{},
+	} {
+		if _, err := flatjson.FlattenE(val); err == nil {
+			t.Errorf("Expected an error for %#v", val)
+		}
+	}
+}
+
+func TestFloatPrecision(t *testing.T) {
+	third := 1.0 / 3
+	val := &struct {
+		A float64  `json:"a"`
+		B float32  `json:"b"`
+		C float64  `json:"c"`
+		D float64  `json:"d"`
+		E float64  `json:"e"`
+		F float64  `json:"f,string"`
+		G *float64 `json:"g"`
+		H *float64 `json:"h"`
+		I int64    `json:"i"`
+	}{1.0 / 3, 2.0 / 3, 1e6, 12345, 1.23456e-7, 0.125, &third, nil, 123456789}
+
+	for _, test := range []struct {
+		precision int
+		expected  string
+	}{
+		{0, `{"a":0.3333333333333333,"b":0.6666667,"c":1000000,"d":12345,"e":1.23456e-7,"f":"0.125","g":0.3333333333333333,"h":null,"i":123456789}`},
+		{3, `{"a":0.333,"b":0.667,"c":1000000,"d":12300,"e":1.23e-7,"f":"0.125","g":0.333,"h":null,"i":123456789}`},
+		{1, `{"a":0.3,"b":0.7,"c":1000000,"d":10000,"e":1e-7,"f":"0.1","g":0.3,"h":null,"i":123456789}`},
+		{10, `{"a":0.3333333333,"b":0.6666667,"c":1000000,"d":12345,"e":1.23456e-7,"f":"0.125","g":0.3333333333,"h":null,"i":123456789}`},
+	} {
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{FloatPrecision: test.precision})
+		enc, err := flat.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(enc) != test.expected {
+			t.Errorf("Unexpected encoding with precision %d:\n     got: %s\nexpected: %s", test.precision, enc, test.expected)
+		}
+
+		var buf bytes.Buffer
+		if err := flat.MarshalTo(&buf); err != nil || buf.String() != string(enc) {
+			t.Errorf("Expected MarshalTo to match MarshalJSON, got %s (%v)", buf.Bytes(), err)
+		}
+
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(enc, &decoded); err != nil {
+			t.Errorf("Expected valid JSON with precision %d: %v", test.precision, err)
+		}
+	}
+
+	// Non-finite values are still handled by the NonFinite policy.
+	val.A = math.NaN()
+	if _, err := flatjson.FlattenWithOptions(val, flatjson.Options{FloatPrecision: 3}).MarshalJSON(); err == nil {
+		t.Error("Expected an error for NaN")
+	}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{FloatPrecision: 3, NonFinite: flatjson.NonFiniteNull})
+	if enc, err := flat.MarshalJSON(); err != nil || !bytes.HasPrefix(enc, []byte(`{"a":null,`)) {
+		t.Errorf("Expected NaN to be encoded as null, got %s (%v)", enc, err)
+	}
+}
+
+// A Digest is a hash, usually encoded in hex.
+type Digest []byte
+
+func TestBytesFormat(t *testing.T) {
+	type Bytes struct {
+		Data   []byte  `json:"data"`
+		Hash   Digest  `json:"hash,hex"`
+		Token  []byte  `json:"token,rawstring"`
+		Blob   []byte  `json:"blob,base64"`
+		Ptr    *[]byte `json:"ptr"`
+		Nil    []byte  `json:"nil"`
+		Empty  []byte  `json:"empty"`
+		Binary []byte  `json:"binary,rawstring"`
+		Plain  string  `json:"plain,hex"`
+	}
+	data := []byte("hi")
+	val := &Bytes{
+		Data:   data,
+		Hash:   Digest{0xde, 0xad, 0xbe, 0xef},
+		Token:  []byte("abc"),
+		Blob:   []byte{0xff},
+		Ptr:    &data,
+		Empty:  []byte{},
+		Binary: []byte{'a', 0xff, 'b'},
+		Plain:  "x",
+	}
+
+	for _, test := range []struct {
+		format   flatjson.BytesFormat
+		expected string
+	}{
+		{flatjson.BytesBase64, `{"binary":"a�b","blob":"/w==","data":"aGk=","empty":"","hash":"deadbeef","nil":null,"plain":"x","ptr":"aGk=","token":"abc"}`},
+		{flatjson.BytesHex, `{"binary":"a�b","blob":"/w==","data":"6869","empty":"","hash":"deadbeef","nil":null,"plain":"x","ptr":"6869","token":"abc"}`},
+		{flatjson.BytesString, `{"binary":"a�b","blob":"/w==","data":"hi","empty":"","hash":"deadbeef","nil":null,"plain":"x","ptr":"hi","token":"abc"}`},
+	} {
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{BytesFormat: test.format})
+		enc, err := flat.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(enc) != test.expected {
+			t.Errorf("Unexpected encoding with format %d:\n     got: %s\nexpected: %s", test.format, enc, test.expected)
+		}
+	}
+
+	// The default matches encoding/json, where it applies.
+	val.Hash, val.Token, val.Binary = nil, nil, nil
+	enc, _ := json.Marshal(flatjson.Flatten(val))
+	expected, _ := json.Marshal(map[string]interface{}{
+		"data": val.Data, "hash": nil, "token": nil, "blob": val.Blob, "ptr": val.Ptr,
+		"nil": val.Nil, "empty": val.Empty, "binary": nil, "plain": val.Plain,
+	})
+	if string(enc) != string(expected) {
+		t.Errorf("Unexpected default encoding:\n     got: %s\nexpected: %s", enc, expected)
+	}
+
+	// The values are read when the Map is encoded.
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{BytesFormat: flatjson.BytesHex})
+	val.Data[0] = 'H'
+	val.Nil = []byte{1}
+	if enc, _ := flat.MarshalJSON(); !bytes.Contains(enc, []byte(`"data":"4869"`)) || !bytes.Contains(enc, []byte(`"nil":"01"`)) {
+		t.Errorf("Expected the current values, got %s", enc)
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	inf := float32(math.Inf(1))
+	val := &struct {
+		Ratio  float64
+		Rate   float32
+		Ptr    *float32
+		Neg    float64 `json:",string"`
+		Finite float64
+		Count  int
+	}{Ratio: math.NaN(), Rate: float32(math.NaN()), Ptr: &inf, Neg: math.Inf(-1), Finite: 1.5, Count: 2}
+
+	if _, err := json.Marshal(flatjson.Flatten(val)); err == nil {
+		t.Error("Expected an error for NaN by default")
+	}
+
+	for _, test := range []struct {
+		policy                flatjson.NonFinitePolicy
+		ratio, rate, ptr, neg interface{}
+	}{
+		{flatjson.NonFiniteNull, nil, nil, nil, nil},
+		{flatjson.NonFiniteZero, 0.0, 0.0, 0.0, "0"},
+		{flatjson.NonFiniteString, "NaN", "NaN", "+Inf", "-Inf"},
+	} {
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{NonFinite: test.policy})
+		expected := flatjson.Map{
+			"Ratio":  test.ratio,
+			"Rate":   test.rate,
+			"Ptr":    test.ptr,
+			"Neg":    test.neg,
+			"Finite": 1.5,
+			"Count":  2.0,
+		}
+		testEncoding(t, flat, expected)
+
+		var buf bytes.Buffer
+		if err := flat.MarshalTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got := flatjson.Map{}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("MarshalTo encoded to unexpected value:\n     got: %#v\nexpected: %#v", got, expected)
+		}
+	}
+
+	// The policy is applied when the Map is encoded, to each key alone.
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{NonFinite: flatjson.NonFiniteNull})
+	val.Ratio = 0.25
+	val.Rate = float32(math.Inf(-1))
+	val.Ptr = nil
+	testEncoding(t, flat, flatjson.Map{
+		"Ratio":  0.25,
+		"Rate":   nil,
+		"Ptr":    nil,
+		"Neg":    nil,
+		"Finite": 1.5,
+		"Count":  2.0,
+	})
+}
+
+func TestMarshalTo(t *testing.T) {
+	n := -3
+	val := &struct {
+		Bool    bool
+		Int8    int8
+		Uint    uint64
+		Float   float64
+		Small   float32
+		Tiny    float64
+		Huge    float64
+		Str     string
+		Escaped string
+		Ptr     *int
+		Nil     *int
+		State   State
+		Price   Decimal
+		Started time.Time
+		Slice   []int
+		Omit    int `json:",omitempty"`
+		Quoted  int `json:",string"`
+		Map     map[string]int
+	}{
+		Bool:    true,
+		Int8:    -8,
+		Uint:    1 << 63,
+		Float:   1.5,
+		Small:   0.1,
+		Tiny:    1e-9,
+		Huge:    1e21,
+		Str:     "plain",
+		Escaped: "<a href=\"x\">&\\\n\r\t\x01   \xff héllo</a>",
+		Ptr:     &n,
+		State:   1,
+		Price:   Decimal{1, 2},
+		Slice:   []int{1, 2},
+		Quoted:  4,
+		Map:     map[string]int{"a": 1},
+	}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{FlattenMaps: true})
+
+	expected, err := json.Marshal(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := flat.MarshalTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("Unexpected output:\n     got: %s\nexpected: %s", buf.String(), expected)
+	}
+
+	// Large Maps are written in several chunks.
+	big := flatjson.Map{}
+	for i := 0; i < 1000; i++ {
+		s := strconv.Itoa(i)
+		big["key"+s] = &s
+	}
+	expected, _ = json.Marshal(big)
+	buf.Reset()
+	if err := big.MarshalTo(&buf); err != nil || buf.String() != string(expected) {
+		t.Errorf("Unexpected output for a large Map: %v", err)
+	}
+
+	bad := 0.0
+	if err := (flatjson.Map{"a": &bad, "b": func() {}}).MarshalTo(&buf); err == nil {
+		t.Error("Expected an error for a value that can't be encoded")
+	}
+}
+
+func TestMarshalToEscaping(t *testing.T) {
+	var control []byte
+	for c := byte(0); c < 0x20; c++ {
+		control = append(control, c)
+	}
+	for _, s := range []string{
+		string(control),
+		"a\u2028b\u2029c",
+		"\xff\xfe invalid",
+		"<&>\"\\",
+	} {
+		s := s
+		flat := flatjson.Map{"value": &s, s: 1}
+		expected, err := json.Marshal(flat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := flat.MarshalTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("Unexpected output for %q:\n     got: %s\nexpected: %s", s, buf.String(), expected)
+		}
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	n := 1
+	val := &struct {
+		Name    string
+		Escaped string
+		Ptr     *int
+		Nil     *int
+		Started time.Time
+		Slice   []int
+		Empty   []int
+		Nested  [][]string
+		Map     map[string]interface{}
+		Child   Child
+		Omit    int `json:",omitempty"`
+	}{
+		Name:    "a",
+		Escaped: "<b>\n",
+		Ptr:     &n,
+		Slice:   []int{1, 2},
+		Empty:   []int{},
+		Nested:  [][]string{{"x"}, {}},
+		Map:     map[string]interface{}{"k": []int{3}, "e": map[string]int{}},
+		Child:   Child{4, "5"},
+	}
+	flat := flatjson.Flatten(val)
+
+	// The output is what encoding/json indents the compact encoding to.
+	compact, err := json.Marshal(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(compact, &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, indent := range [][2]string{{"", "  "}, {"> ", "\t"}, {"", ""}} {
+		expected, err := json.MarshalIndent(raw, indent[0], indent[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := flat.MarshalIndent(indent[0], indent[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(expected) {
+			t.Errorf("Unexpected output for %q:\n     got: %s\nexpected: %s", indent, got, expected)
+		}
+
+		var buf bytes.Buffer
+		if err := flat.MarshalIndentTo(&buf, indent[0], indent[1]); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("Unexpected streamed output for %q:\n     got: %s\nexpected: %s", indent, buf.String(), expected)
+		}
+	}
+
+	// Without any entries to write, the object is written as {}.
+	omitted := flatjson.Flatten(&struct {
+		N int `json:",omitempty"`
+	}{})
+	for _, m := range []flatjson.Map{{}, omitted} {
+		if got, _ := m.MarshalIndent("", "  "); string(got) != "{}" {
+			t.Errorf("Unexpected output %s", got)
+		}
+	}
+}
+
+func benchmarkMap() flatjson.Map {
+	val := &struct {
+		ConnStats
+		Names  [8]string
+		Ratios [8]float64
+	}{}
+	return flatjson.FlattenWithOptions(val, flatjson.Options{IndexSlices: true})
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	flat := benchmarkMap()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		json.Marshal(flat)
+	}
+}
+
+func BenchmarkMarshalTo(b *testing.B) {
+	flat := benchmarkMap()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		flat.MarshalTo(ioutil.Discard)
+	}
+}
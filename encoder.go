@@ -0,0 +1,260 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// An Encoder encodes the same Map over and over, for Maps that are encoded
+// frequently enough that the work MarshalTo repeats each time matters. The
+// first call to Encode prepares the sorted keys, their encoded names, and a
+// function for encoding each value, chosen once by its kind, and the output
+// is built in a buffer kept by the Encoder. After that, Encode makes no
+// allocations while the Map holds only entries whose values are pointers to
+// booleans, numbers and strings without marshalers, which is what Flatten
+// produces for fields of those kinds without tag options. Other values, like
+// fields tagged with omitempty, slices and times, are encoded the same way as
+// by MarshalTo, and allocate as much as it does.
+//
+// Entries added to the Map, removed from it or replaced, as by Refresh, are
+// noticed by the next call to Encode, which prepares the Encoder again. A Map
+// with the entries of interfaces flattened with Options.DynamicInterfaces is
+// encoded by MarshalTo each time, since its keys can change with every
+// encoding.
+//
+// An Encoder isn't safe for concurrent use.
+type Encoder struct {
+	m Map
+
+	keys    []string
+	names   [][]byte      // The encoding of each key, followed by a colon.
+	values  []interface{} // The value of each key when it was prepared.
+	encode  []encodeFunc  // The function encoding each value.
+	compare []bool        // Whether each value can be compared to notice replacements.
+	dynamic bool          // Whether m holds dynamic entries.
+	ready   bool
+
+	buf []byte
+}
+
+// An encodeFunc appends the encoding of the Map value v to buf.
+type encodeFunc func(buf []byte, v interface{}) ([]byte, error)
+
+// Encoder returns an Encoder for m.
+func (m Map) Encoder() *Encoder {
+	return &Encoder{m: m}
+}
+
+// Encode writes the same encoding of the Map as MarshalTo to w, in a single
+// write. If an entry can't be encoded, the error is returned and nothing is
+// written.
+func (e *Encoder) Encode(w io.Writer) error {
+	if e.m == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+	if !e.current() {
+		e.prepare()
+	}
+	if e.dynamic {
+		return e.m.MarshalTo(w)
+	}
+
+	buf := append(e.buf[:0], '{')
+	first := true
+	for i, value := range e.values {
+		if en, ok := value.(*entry); ok && en.omit() {
+			continue
+		}
+		if !first {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = append(buf, e.names[i]...)
+
+		var err error
+		if buf, err = e.encode[i](buf, value); err != nil {
+			e.buf = buf
+			return err
+		}
+	}
+	buf = append(buf, '}')
+	e.buf = buf
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// current reports whether the Encoder was prepared for the entries the Map
+// currently holds. Values which can't be compared are taken from the Map
+// again, as long as their type is the same.
+func (e *Encoder) current() bool {
+	if !e.ready || len(e.m) != len(e.keys) {
+		return false
+	}
+	for i, key := range e.keys {
+		value, ok := e.m[key]
+		switch {
+		case !ok:
+			return false
+		case !e.compare[i]:
+			if reflect.TypeOf(value) != reflect.TypeOf(e.values[i]) {
+				return false
+			}
+			e.values[i] = value
+		case value != e.values[i]:
+			return false
+		}
+	}
+	return true
+}
+
+// prepare sets the Encoder up for the entries the Map currently holds.
+func (e *Encoder) prepare() {
+	keys := e.m.sortedKeys()
+	defer putKeys(keys)
+
+	n := len(*keys)
+	e.keys = append(e.keys[:0], *keys...)
+	e.names = make([][]byte, n)
+	e.values = make([]interface{}, n)
+	e.encode = make([]encodeFunc, n)
+	e.compare = make([]bool, n)
+	e.dynamic = false
+
+	for i, key := range e.keys {
+		value := e.m[key]
+		if _, ok := value.(*dynamic); ok {
+			e.dynamic = true
+		}
+		e.names[i] = append(appendString(nil, key), ':')
+		e.values[i] = value
+		e.encode[i] = encodeFuncFor(value)
+		e.compare[i] = value == nil || reflect.TypeOf(value).Comparable()
+	}
+	e.ready = true
+}
+
+// encodeFuncFor returns the function encoding v, a Map value.
+func encodeFuncFor(v interface{}) encodeFunc {
+	switch v.(type) {
+	case *bool:
+		return encodeBool
+	case *string:
+		return encodeString
+	case *int:
+		return encodeInt
+	case *int64:
+		return encodeInt64
+	case *uint64:
+		return encodeUint64
+	case *float64:
+		return encodeFloat64
+	}
+
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Ptr && isScalarKind(t.Elem().Kind()) {
+		if elem := t.Elem(); elem.PkgPath() == "" || !infoFor(elem).marshaler && elem != numberType {
+			return encodeScalar
+		}
+	}
+	return appendValue
+}
+
+// isScalarKind reports whether k is the kind of a boolean, number or string.
+func isScalarKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func encodeBool(buf []byte, v interface{}) ([]byte, error) {
+	p := v.(*bool)
+	if p == nil {
+		return append(buf, "null"...), nil
+	}
+	if *p {
+		return append(buf, "true"...), nil
+	}
+	return append(buf, "false"...), nil
+}
+
+func encodeString(buf []byte, v interface{}) ([]byte, error) {
+	p := v.(*string)
+	if p == nil {
+		return append(buf, "null"...), nil
+	}
+	return appendString(buf, *p), nil
+}
+
+func encodeInt(buf []byte, v interface{}) ([]byte, error) {
+	p := v.(*int)
+	if p == nil {
+		return append(buf, "null"...), nil
+	}
+	return strconv.AppendInt(buf, int64(*p), 10), nil
+}
+
+func encodeInt64(buf []byte, v interface{}) ([]byte, error) {
+	p := v.(*int64)
+	if p == nil {
+		return append(buf, "null"...), nil
+	}
+	return strconv.AppendInt(buf, *p, 10), nil
+}
+
+func encodeUint64(buf []byte, v interface{}) ([]byte, error) {
+	p := v.(*uint64)
+	if p == nil {
+		return append(buf, "null"...), nil
+	}
+	return strconv.AppendUint(buf, *p, 10), nil
+}
+
+func encodeFloat64(buf []byte, v interface{}) ([]byte, error) {
+	p := v.(*float64)
+	if p == nil {
+		return append(buf, "null"...), nil
+	}
+	if b, ok := appendFloat(buf, *p, 64); ok {
+		return b, nil
+	}
+	return appendValue(buf, v)
+}
+
+// encodeScalar encodes v, a pointer to a boolean, number or string of any
+// other type without a marshaler, through reflect.
+func encodeScalar(buf []byte, v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return append(buf, "null"...), nil
+	}
+	rv = rv.Elem()
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return append(buf, "true"...), nil
+		}
+		return append(buf, "false"...), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(buf, rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.AppendUint(buf, rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		if b, ok := appendFloat(buf, rv.Float(), rv.Type().Bits()); ok {
+			return b, nil
+		}
+		return appendValue(buf, v)
+	}
+	return appendString(buf, rv.String()), nil
+}
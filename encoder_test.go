@@ -0,0 +1,153 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func testEncoder(t *testing.T, enc *flatjson.Encoder, m flatjson.Map) {
+	t.Helper()
+	var expected, buf bytes.Buffer
+	if err := m.MarshalTo(&expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected.String() {
+		t.Errorf("Unexpected output:\n     got: %s\nexpected: %s", buf.String(), expected.String())
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	plain := PlainStats{Name: "s", Count: 1, Small: -1, Port: 80, Ratio: 0.5, Up: true}
+	plain.Latency.Min, plain.Queue.Label = 1, "q"
+	mixed := &MixedStats{
+		Plain:  PlainStats{Name: "a", Count: 2, Ratio: 0.25},
+		Tagged: PlainStats{Name: "b", Count: 3, Up: true},
+	}
+	mixed.Inner.Plain = PlainStats{Name: "c", Count: 4, Port: 81}
+
+	for _, m := range []flatjson.Map{
+		flatjson.Flatten(&plain),
+		flatjson.Flatten(mixed),
+		flatjson.FlattenWithOptions(mixed, flatjson.Options{DynamicInterfaces: true}),
+		{"count": new(Count), "nil": (*int)(nil), "list": []interface{}{1.0, "a"}, "html": "<&>"},
+		{},
+	} {
+		enc := m.Encoder()
+		testEncoder(t, enc, m)
+
+		// Values are read again each time.
+		plain.Count++
+		plain.Name = " "
+		mixed.Tagged = PlainStats{}
+		mixed.Any = &Child{1, "x"}
+		testEncoder(t, enc, m)
+	}
+
+	testEncoder(t, flatjson.Map(nil).Encoder(), nil)
+}
+
+func TestEncoderChanges(t *testing.T) {
+	val := &ConnStats{}
+	flat := flatjson.Flatten(val)
+	enc := flat.Encoder()
+	testEncoder(t, enc, flat)
+
+	// Added, removed and replaced entries are noticed.
+	fresh := &ConnStats{}
+	fresh.Requests = 7
+	if err := flat.Rebind(fresh); err != nil {
+		t.Fatal(err)
+	}
+	testEncoder(t, enc, flat)
+
+	extra := 5
+	flat.Add("extra", &extra)
+	testEncoder(t, enc, flat)
+
+	delete(flat, "extra")
+	testEncoder(t, enc, flat)
+
+	flat["extra"] = "plain"
+	for key := range flat {
+		if key != "extra" {
+			delete(flat, key)
+			break
+		}
+	}
+	testEncoder(t, enc, flat)
+
+	// So are values of other types replacing those that can't be
+	// compared.
+	flat = flatjson.Map{"list": []int{1}}
+	enc = flat.Encoder()
+	testEncoder(t, enc, flat)
+	flat["list"] = &extra
+	testEncoder(t, enc, flat)
+}
+
+func TestEncoderEscaping(t *testing.T) {
+	var control []byte
+	for c := byte(0); c < 0x20; c++ {
+		control = append(control, c)
+	}
+	for _, s := range []string{
+		string(control),
+		"a\u2028b\u2029c",
+		"\xff\xfe invalid",
+		"<&>\"\\",
+	} {
+		s := s
+		flat := flatjson.Map{"value": &s, s: 1}
+		expected, err := json.Marshal(flat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := flat.Encoder().Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(expected) {
+			t.Errorf("Unexpected output for %q:\n     got: %s\nexpected: %s", s, buf.String(), expected)
+		}
+	}
+}
+
+func TestEncoderAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are unreliable with the race detector")
+	}
+	val := &struct {
+		PlainStats
+		Hits  Count
+		Ratio float32
+		Name  *string
+	}{PlainStats: PlainStats{Name: "s", Count: 1, Small: -1, Port: 80, Ratio: 0.5, Up: true}}
+	flat := flatjson.Flatten(val)
+	enc := flat.Encoder()
+	if err := enc.Encode(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		val.Count++
+		val.Ratio += 0.5
+		enc.Encode(ioutil.Discard)
+	}); allocs != 0 {
+		t.Errorf("Expected Encode not to allocate, got %v allocations per call", allocs)
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	flat := benchmarkMap()
+	enc := flat.Encoder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc.Encode(ioutil.Discard)
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// An entry is the Map value for a field whose encoding depends on its tag
+// options, which are evaluated each time the Map is encoded.
+type entry struct {
+	value     interface{} // A pointer to the field, a *lookup or an *atomicValue.
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool // Encode the value inside a JSON string.
+	stringer  bool // Encode the result of the value's String method.
+	netText   bool // Encode the text of one of builtinTextTypes.
+	complex   bool // Encode a complex number as a complexObject.
+
+	// errorString is set for values of type error with
+	// Options.ErrorStrings, which are encoded as their message.
+	errorString bool
+
+	// timeFormat is the Options.TimeFormat for time.Time values, and
+	// durationFormat the DurationFormat for durations.
+	timeFormat     string
+	durationFormat DurationFormat
+
+	// bytesFormat is the BytesFormat for []byte values.
+	bytesFormat BytesFormat
+
+	// nonFinite is the Options.NonFinite policy for float values, and
+	// precision the Options.FloatPrecision.
+	nonFinite NonFinitePolicy
+	precision int
+
+	// nilPointers is the Options.NilPointers policy for pointer values.
+	nilPointers NilPointerPolicy
+
+	// redact is set for fields tagged with redact, and redactFunc is the
+	// Options.RedactFunc, which is passed key.
+	redact     bool
+	redactFunc RedactFunc
+	key        string
+
+	// valueFunc is the Options.ValueFunc, and keyValueFunc the function
+	// Options.ValueFuncs holds for key, which replace the current value.
+	valueFunc    func(key string, v interface{}) interface{}
+	keyValueFunc func(v interface{}) interface{}
+
+	// group is the innermost struct tagged with omitempty or omitzero that
+	// the field is nested under, if any.
+	group *omitGroup
+
+	// meta describes the field, with Options.RecordMeta.
+	meta *FieldMeta
+
+	// added is set for pointers added with Map.Add rather than by
+	// flattening, which Refresh and Rebind keep as they are.
+	added bool
+
+	// snapshot is set for the copies of unexported fields made with
+	// Options.IncludeUnexported, which can be read but not set.
+	snapshot bool
+}
+
+func (e *entry) MarshalJSON() ([]byte, error) {
+	if e.redact {
+		return redactedJSON(resolve(e.value)), nil
+	}
+	if e.redactFunc != nil {
+		if enc, ok, err := e.marshalRedacted(); ok {
+			return enc, err
+		}
+	}
+	if e.valueFunc != nil || e.keyValueFunc != nil {
+		return json.Marshal(e.transformed())
+	}
+	if e.errorString {
+		return marshalError(resolve(e.value))
+	}
+	if e.nilPointers == NilPointerZero {
+		if t, ok := nilPointerElem(resolve(e.value)); ok {
+			zero := *e
+			zero.value, zero.nilPointers = reflect.New(t).Interface(), NilPointerKeep
+			return zero.MarshalJSON()
+		}
+	}
+	if e.netText {
+		s, ok := netText(resolve(e.value))
+		if !ok {
+			return []byte("null"), nil
+		}
+		return json.Marshal(s)
+	}
+	if e.stringer {
+		s, ok := stringerValue(resolve(e.value))
+		if !ok {
+			return []byte("null"), nil
+		}
+		return json.Marshal(s.String())
+	}
+	if e.bytesFormat != BytesBase64 {
+		return formatBytes(resolve(e.value), e.bytesFormat)
+	}
+	if e.timeFormat != "" {
+		v := indirectValue(resolve(e.value))
+		if !v.IsValid() {
+			return []byte("null"), nil
+		}
+		return json.Marshal(formatTime(v.Interface().(time.Time), e.timeFormat))
+	}
+	if e.complex {
+		return marshalComplex(resolve(e.value))
+	}
+	if e.durationFormat != DurationNanos {
+		v := indirectValue(resolve(e.value))
+		if !v.IsValid() {
+			return []byte("null"), nil
+		}
+		return json.Marshal(formatDuration(time.Duration(v.Int()), e.durationFormat))
+	}
+
+	if enc, ok := formatNonFinite(resolve(e.value), e.nonFinite); ok {
+		if e.quoted && e.nonFinite == NonFiniteZero {
+			return []byte(`"0"`), nil
+		}
+		return enc, nil
+	}
+	if e.precision > 0 {
+		if enc, ok := formatFloat(resolve(e.value), e.precision); ok {
+			if e.quoted {
+				return json.Marshal(string(enc))
+			}
+			return enc, nil
+		}
+	}
+
+	enc, err := json.Marshal(e.value)
+	if err != nil || !e.quoted || string(enc) == "null" {
+		return enc, err
+	}
+	return json.Marshal(string(enc))
+}
+
+// omit reports whether the entry should currently be left out of the encoded
+// Map.
+func (e *entry) omit() bool {
+	if e.group.omit() {
+		return true
+	}
+	v := resolve(e.value)
+	if e.nilPointers == NilPointerOmit {
+		if _, ok := nilPointerElem(v); ok {
+			return true
+		}
+	}
+	if e.omitZero && (!v.IsValid() || isZeroValue(v)) {
+		return true
+	}
+	if !e.omitEmpty {
+		return false
+	}
+	if e.timeFormat != "" && v.IsValid() && v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	return !v.IsValid() || isEmptyValue(v)
+}
+
+// transformed returns the result of the entry's value functions for its
+// current value, Options.ValueFuncs first.
+func (e *entry) transformed() interface{} {
+	var v interface{}
+	if rv := resolve(e.value); rv.IsValid() {
+		v = rv.Interface()
+	}
+	if e.keyValueFunc != nil {
+		v = e.keyValueFunc(v)
+	}
+	if e.valueFunc != nil {
+		v = e.valueFunc(e.key, v)
+	}
+	return v
+}
+
+// marshalError encodes v, a value of type error, as its message, or null if
+// it is nil. Errors implementing json.Marshaler or encoding.TextMarshaler are
+// encoded by those methods instead.
+func marshalError(v reflect.Value) ([]byte, error) {
+	if !v.IsValid() || v.IsNil() {
+		return []byte("null"), nil
+	}
+	err := v.Interface().(error)
+	if isMarshaler(reflect.TypeOf(err)) {
+		return json.Marshal(err)
+	}
+	return json.Marshal(err.Error())
+}
+
+// nilPointerElem returns the type at the end of the chain of pointer types
+// starting at v's type, if one of the pointers along v is nil.
+func nilPointerElem(v reflect.Value) (reflect.Type, bool) {
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return structType(v.Type()), true
+		}
+		v = v.Elem()
+	}
+	return nil, false
+}
+
+// An omitGroup holds the entries nested under a struct field tagged with
+// omitempty, which are all left out while every one of them is empty, or with
+// omitzero, which are left out while the struct is zero.
+type omitGroup struct {
+	parent  *omitGroup // The enclosing group, if any.
+	members []interface{}
+	zero    interface{} // The Map value for the struct, for omitzero.
+}
+
+// omit reports whether g, or one of the groups enclosing it, is currently
+// empty. A nil group is never empty.
+func (g *omitGroup) omit() bool {
+	for ; g != nil; g = g.parent {
+		if g.empty() {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *omitGroup) empty() bool {
+	if g.zero != nil {
+		v := resolve(g.zero)
+		return !v.IsValid() || isZeroValue(v)
+	}
+	for _, m := range g.members {
+		if v := resolve(m); v.IsValid() && !isEmptyValue(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// join adds value, the Map value of an entry nested under g, to g and the
+// groups enclosing it.
+func (g *omitGroup) join(value interface{}) {
+	for ; g != nil; g = g.parent {
+		g.members = append(g.members, value)
+	}
+}
+
+// stringerValue returns the fmt.Stringer for v, dereferencing pointers until
+// one implements it. It returns false if a nil pointer is found first.
+func stringerValue(v reflect.Value) (fmt.Stringer, bool) {
+	for v.IsValid() {
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil, false
+		}
+		if v.Type().Implements(stringerType) {
+			return v.Interface().(fmt.Stringer), true
+		}
+		if v.Kind() != reflect.Ptr && reflect.PtrTo(v.Type()).Implements(stringerType) {
+			if !v.CanAddr() {
+				c := reflect.New(v.Type()).Elem()
+				c.Set(v)
+				v = c
+			}
+			return v.Addr().Interface().(fmt.Stringer), true
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			break
+		}
+		v = v.Elem()
+	}
+	return nil, false
+}
+
+// resolve returns the current value of the Map value v: the value a pointer
+// points at, the value found by a lookup or computed by an AddFunc function,
+// the value held by an atomic, or the value an entry's value functions
+// return. Any other value is returned as is.
+func resolve(v interface{}) reflect.Value {
+	switch v := v.(type) {
+	case *entry:
+		if v.valueFunc != nil || v.keyValueFunc != nil {
+			return reflect.ValueOf(v.transformed())
+		}
+		return resolve(v.value)
+	case *lookup:
+		return v.src()
+	case *dynamic:
+		return v.src()
+	case *computed:
+		return resolve(v.fn())
+	case *atomicValue:
+		return v.load()
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		return rv.Elem()
+	}
+	return rv
+}
+
+// unwrap returns the value that should be used in place of the Map value v
+// when its contents are needed: the pointer or value held by an entry, or the
+// current value found by a lookup, computed by an AddFunc function or held by
+// an atomic. Any other value is returned as is.
+func unwrap(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *entry:
+		return unwrap(v.value)
+	case *lookup:
+		if rv := v.src(); rv.IsValid() {
+			return rv.Interface()
+		}
+		return nil
+	case *dynamic:
+		if rv := v.src(); rv.IsValid() {
+			return rv.Interface()
+		}
+		return nil
+	case *computed:
+		return unwrap(v.fn())
+	case *atomicValue:
+		if rv := v.load(); rv.IsValid() {
+			return rv.Interface()
+		}
+		return nil
+	}
+	return v
+}
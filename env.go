@@ -0,0 +1,128 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// EnvOptions controls how a Map is written as environment variables.
+type EnvOptions struct {
+	// SkipComposite causes slices, arrays, maps and structs that were left
+	// as leaves to be skipped, rather than written as JSON.
+	SkipComposite bool
+}
+
+// WriteEnv writes the values in m to w as environment variable assignments in
+// the format of dotenv files, in sorted key order. It is WriteEnvWithOptions
+// with the zero EnvOptions.
+func (m Map) WriteEnv(w io.Writer, prefix string) error {
+	return m.WriteEnvWithOptions(w, prefix, EnvOptions{})
+}
+
+// WriteEnvWithOptions writes the values in m to w as "NAME=value" lines in the
+// format of dotenv files, in sorted key order. The names are the keys, with
+// prefix prepended if it isn't empty, converted to UPPER_SNAKE_CASE: the words
+// of each segment are split the same way as by KeyCase, and the segments and
+// words are joined by underscores, so Server.MaxConns with a prefix of APP
+// becomes APP_SERVER_MAX_CONNS. Characters other than letters and digits
+// separate words too, so any separator works.
+//
+// Values are formatted the same way as by CSVWriter, and nil pointers are
+// written as empty values. Values containing anything other than letters,
+// digits and the punctuation characters _-.,:/@+ are double-quoted, with
+// backslashes, double quotes, dollar signs, backquotes and newlines escaped by
+// a backslash. An error is returned, before anything is written, if two keys
+// produce the same name.
+func (m Map) WriteEnvWithOptions(w io.Writer, prefix string, opts EnvOptions) error {
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	var lines []string
+	names := map[string]string{}
+
+	for _, key := range *keys {
+		v := indirectValue(resolve(m[key]))
+		if opts.SkipComposite && isComposite(v) {
+			continue
+		}
+
+		name := envName(prefix, key)
+		if other, ok := names[name]; ok {
+			return &Error{Op: "WriteEnv", Key: other, kind: ErrDuplicateKey, msg: fmt.Sprintf("flatjson: keys %q and %q produce the same environment variable %s", other, key, name)}
+		}
+		names[name] = key
+
+		value, err := formatText(v, textOptions(m[key]))
+		if err != nil {
+			return keyError("WriteEnv", key, err)
+		}
+		lines = append(lines, name+"="+quoteEnv(value)+"\n")
+	}
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envName returns the environment variable name for key.
+func envName(prefix, key string) string {
+	var words []string
+	for _, s := range []string{prefix, key} {
+		segments := strings.FieldsFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, segment := range segments {
+			words = append(words, splitWords(segment)...)
+		}
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(strings.Join(words, "_")))
+
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+var envEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\n", `\n`)
+
+// quoteEnv quotes value if it contains characters that have a special meaning
+// in dotenv files or to shells.
+func quoteEnv(value string) string {
+	for _, r := range value {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("_-.,:/@+", r):
+		default:
+			return `"` + envEscaper.Replace(value) + `"`
+		}
+	}
+	return value
+}
+
+// isComposite reports whether v is a slice, array, map or struct that doesn't
+// format itself as text.
+func isComposite(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+	default:
+		return false
+	}
+	return !v.Type().Implements(textMarshalerType) && !reflect.PtrTo(v.Type()).Implements(textMarshalerType)
+}
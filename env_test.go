@@ -0,0 +1,80 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestWriteEnv(t *testing.T) {
+	val := &struct {
+		Server struct {
+			HTTPPort int
+			MaxConns int
+			TLS      bool
+		}
+		Greeting string
+		Path     string
+		Started  time.Time
+		Hosts    []string
+		Ptr      *int
+	}{
+		Greeting: `say "hi" $USER`,
+		Path:     "/var/lib/app",
+		Started:  time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Hosts:    []string{"a", "b"},
+	}
+	val.Server.HTTPPort = 8080
+	val.Server.MaxConns = 100
+	flat := flatjson.Flatten(val)
+
+	var buf bytes.Buffer
+	if err := flat.WriteEnv(&buf, "app"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `APP_GREETING="say \"hi\" \$USER"
+APP_HOSTS="[\"a\",\"b\"]"
+APP_PATH=/var/lib/app
+APP_PTR=
+APP_SERVER_HTTP_PORT=8080
+APP_SERVER_MAX_CONNS=100
+APP_SERVER_TLS=false
+APP_STARTED=2015-06-01T12:00:00Z
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if err := flat.WriteEnvWithOptions(&buf, "", flatjson.EnvOptions{SkipComposite: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected = `GREETING="say \"hi\" \$USER"
+PATH=/var/lib/app
+PTR=
+SERVER_HTTP_PORT=8080
+SERVER_MAX_CONNS=100
+SERVER_TLS=false
+STARTED=2015-06-01T12:00:00Z
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output with SkipComposite:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteEnvCollision(t *testing.T) {
+	flat := flatjson.Flatten(&struct {
+		MaxConns  int
+		Max_Conns int
+	}{})
+
+	var buf bytes.Buffer
+	if err := flat.WriteEnv(&buf, ""); err == nil {
+		t.Error("Expected an error for colliding names")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"math"
+	"reflect"
+	"time"
+)
+
+// Equal reports whether a and b have the same keys, and the current values
+// under each key are equal. Values are compared without encoding them: after
+// dereferencing the entries of the Maps, values of different types are never
+// equal, and pointers and interfaces are compared by what they hold, slices,
+// arrays and structs element by element, and maps key by key. Floats are
+// compared numerically, except that NaNs are equal to each other, and
+// time.Time values are compared with their Equal method, so that the same
+// instant in different locations is equal. Pointers nested more than 100
+// levels deep, such as those forming a cycle, are only equal if they are the
+// same pointer.
+//
+// Entries are compared whether or not they are currently omitted.
+func Equal(a, b Map) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, av := range a {
+		bv, ok := b[key]
+		if !ok || !equalValues(resolve(av), resolve(bv), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualKeys reports whether a and b have the same keys, regardless of their
+// values.
+func EqualKeys(a, b Map) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func equalValues(x, y reflect.Value, depth int) bool {
+	if !x.IsValid() || !y.IsValid() {
+		return x.IsValid() == y.IsValid()
+	}
+	if x.Type() != y.Type() {
+		return false
+	}
+	if x.Type() == timeType && x.CanInterface() && y.CanInterface() {
+		return x.Interface().(time.Time).Equal(y.Interface().(time.Time))
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		return x.Bool() == y.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() == y.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return x.Uint() == y.Uint()
+	case reflect.Float32, reflect.Float64:
+		return equalFloats(x.Float(), y.Float())
+	case reflect.Complex64, reflect.Complex128:
+		cx, cy := x.Complex(), y.Complex()
+		return equalFloats(real(cx), real(cy)) && equalFloats(imag(cx), imag(cy))
+	case reflect.String:
+		return x.String() == y.String()
+
+	case reflect.Ptr:
+		if x.Pointer() == y.Pointer() {
+			return true
+		}
+		if x.IsNil() || y.IsNil() || depth >= maxHashDepth {
+			return false
+		}
+		return equalValues(x.Elem(), y.Elem(), depth+1)
+
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return equalValues(x.Elem(), y.Elem(), depth)
+
+	case reflect.Slice:
+		// A nil slice and an empty one are encoded differently.
+		if x.IsNil() != y.IsNil() || x.Len() != y.Len() {
+			return false
+		}
+		if x.Pointer() == y.Pointer() {
+			return true
+		}
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			if !equalValues(x.Index(i), y.Index(i), depth) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if !equalValues(x.Field(i), y.Field(i), depth) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Map:
+		if x.IsNil() != y.IsNil() || x.Len() != y.Len() {
+			return false
+		}
+		if x.Pointer() == y.Pointer() {
+			return true
+		}
+		for _, k := range x.MapKeys() {
+			if !equalValues(x.MapIndex(k), y.MapIndex(k), depth) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Func:
+		// Like reflect.DeepEqual, functions are only equal if both are nil.
+		return x.IsNil() && y.IsNil()
+	}
+
+	// Channels and unsafe pointers.
+	return x.Pointer() == y.Pointer()
+}
+
+func equalFloats(x, y float64) bool {
+	return x == y || math.IsNaN(x) && math.IsNaN(y)
+}
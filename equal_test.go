@@ -0,0 +1,104 @@
+package flatjson_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type EqualStats struct {
+	Name    string
+	Ratio   float64
+	Tags    []string
+	Limits  map[string]int
+	Started time.Time
+	Child   *Child
+	Nothing *Child
+}
+
+func TestEqual(t *testing.T) {
+	for _, change := range []func(*EqualStats){
+		func(s *EqualStats) { s.Name = "b" },
+		func(s *EqualStats) { s.Ratio = 1 },
+		func(s *EqualStats) { s.Tags[0] = "y" },
+		func(s *EqualStats) { s.Tags = append(s.Tags, "y") },
+		func(s *EqualStats) { s.Tags = []string{} },
+		func(s *EqualStats) { s.Tags = nil },
+		func(s *EqualStats) { s.Limits["max"] = 2 },
+		func(s *EqualStats) { s.Limits["min"] = 0 },
+		func(s *EqualStats) { s.Started = s.Started.Add(time.Second) },
+		func(s *EqualStats) { s.Child.C = 2 },
+		func(s *EqualStats) { s.Nothing = &Child{} },
+	} {
+		val := &EqualStats{
+			Name:    "a",
+			Ratio:   math.NaN(),
+			Tags:    []string{"x"},
+			Limits:  map[string]int{"max": 1},
+			Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+			Child:   &Child{1, "2"},
+		}
+		flat := flatjson.Flatten(val)
+
+		// The same instant in another location is equal.
+		other := *val
+		other.Started = other.Started.In(time.FixedZone("UTC+1", 3600))
+		if flatOther := flatjson.Flatten(&other); !flatjson.Equal(flat, flatOther) || !flatjson.EqualKeys(flat, flatOther) {
+			t.Fatal("Expected Maps of equal structs to be equal")
+		}
+
+		before := flat.Clone()
+		if !flatjson.Equal(flat, before) {
+			t.Fatal("Expected a Map to equal its clone")
+		}
+
+		// The Map sees the change, while the clone doesn't.
+		change(val)
+		if flatjson.Equal(flat, before) || flatjson.Equal(before, flat) {
+			t.Errorf("Expected Maps to differ after changing %+v", val)
+		}
+		if !flatjson.EqualKeys(flat, before) {
+			t.Error("Expected the keys to stay the same")
+		}
+	}
+}
+
+func TestEqualKeys(t *testing.T) {
+	a := flatjson.Map{"a": 1, "b": 2}
+	for _, test := range []struct {
+		b           flatjson.Map
+		keys, equal bool
+	}{
+		{flatjson.Map{"a": 1, "b": 2}, true, true},
+		{flatjson.Map{"a": 1, "b": 3}, true, false},
+		{flatjson.Map{"a": 1, "b": int64(2)}, true, false},
+		{flatjson.Map{"a": 1, "c": 2}, false, false},
+		{flatjson.Map{"a": 1}, false, false},
+		{flatjson.Map{"a": 1, "b": 2, "c": 3}, false, false},
+	} {
+		if got := flatjson.EqualKeys(a, test.b); got != test.keys {
+			t.Errorf("Expected EqualKeys to be %v for %v", test.keys, test.b)
+		}
+		if got := flatjson.Equal(a, test.b); got != test.equal {
+			t.Errorf("Expected Equal to be %v for %v", test.equal, test.b)
+		}
+	}
+}
+
+func BenchmarkEqual(b *testing.B) {
+	x := flatjson.Flatten(&EqualStats{
+		Name:    "a",
+		Ratio:   math.NaN(),
+		Tags:    []string{"x"},
+		Limits:  map[string]int{"max": 1},
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Child:   &Child{1, "2"},
+	})
+	y := x.Clone()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		flatjson.Equal(x, y)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// The kinds of failures reported by the errors of the package, for use with
+// errors.Is, which matches an Error against the kind of failure it describes.
+var (
+	// ErrKeyNotFound is reported for a key that has no entry in a Map, or
+	// that matches no field of a struct.
+	ErrKeyNotFound = errors.New("flatjson: key not found")
+
+	// ErrDuplicateKey is reported for keys that are produced more than once,
+	// or that collide once converted to another form, like metric names or
+	// environment variables, or once expanded into nested objects.
+	ErrDuplicateKey = errors.New("flatjson: duplicate key")
+
+	// ErrTypeMismatch is reported for a value of a type that doesn't fit
+	// where it is used, like a value that can't be assigned to a field, or a
+	// value passed to a function that expects a struct.
+	ErrTypeMismatch = errors.New("flatjson: type mismatch")
+
+	// ErrUnsupportedKind is reported for fields of kinds encoding/json can't
+	// encode, like functions and channels, with Options.RejectUnsupported.
+	ErrUnsupportedKind = errors.New("flatjson: unsupported kind")
+
+	// ErrNotSettable is reported for an entry that can't be written through,
+	// like the entry for a map element.
+	ErrNotSettable = errors.New("flatjson: key can't be set")
+
+	// ErrInvalidKey is reported for a key or a key pattern that is malformed,
+	// or that breaks the rules of Options.StrictKeys.
+	ErrInvalidKey = errors.New("flatjson: invalid key")
+
+	// ErrInvalidTag is reported for a field with an invalid tag option.
+	ErrInvalidTag = errors.New("flatjson: invalid tag option")
+
+	// ErrKeyLimit is reported for a struct that produces more entries than
+	// Options.MaxKeys.
+	ErrKeyLimit = errors.New("flatjson: too many keys")
+
+	// ErrAmbiguousField is reported for embedded fields at the same depth
+	// with the same name, with Options.RejectAmbiguousFields.
+	ErrAmbiguousField = errors.New("flatjson: ambiguous field")
+)
+
+// An Error is returned by the functions and methods of the package when they
+// fail, so that callers don't have to match messages. Whether it is of one of
+// the kinds above, such as ErrKeyNotFound, is reported by errors.Is, which
+// also looks at its cause, and errors.As finds it among the errors wrapping
+// it. The messages are the same as before Error was introduced.
+type Error struct {
+	// Op is the name of the function or method that failed, like "Set" or
+	// "Unflatten". It is "Flatten" for everything that flattens a struct.
+	Op string
+
+	// Key is the flattened key, or the path of the field, the failure
+	// concerns. If it concerns several, as for duplicate keys, Key is the
+	// first of them in sorted order, and the message lists all of them.
+	Key string
+
+	// Type is the type of the value the failure concerns, if any.
+	Type reflect.Type
+
+	// Err is the cause of the failure, if any, such as an error returned by
+	// a method of the value, or another Error with more details.
+	Err error
+
+	kind error  // One of the kinds above, if any.
+	msg  string // The message, in the form the package always used.
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the cause of the failure, if any.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of failure e describes.
+func (e *Error) Is(target error) bool {
+	return target != nil && target == e.kind
+}
+
+// newError returns an Error of the given kind for op, with the message
+// formatted as by fmt.Sprintf.
+func newError(op string, kind error, format string, args ...interface{}) *Error {
+	return &Error{Op: op, kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// keyError returns an Error for op wrapping err, the cause of a failure
+// concerning key, with the type of err if it is an Error too.
+func keyError(op, key string, err error) *Error {
+	e := &Error{Op: op, Key: key, Err: err, msg: fmt.Sprintf("flatjson: key %q: %v", key, err)}
+	if cause, ok := err.(*Error); ok {
+		e.Type = cause.Type
+	}
+	return e
+}
+
+// typeError returns an Error of kind ErrTypeMismatch for a value of type t, to
+// be wrapped by keyError, with the message formatted as by fmt.Sprintf.
+func typeError(t reflect.Type, format string, args ...interface{}) *Error {
+	e := newError("", ErrTypeMismatch, format, args...)
+	e.Type = t
+	return e
+}
+
+// rootError returns an Error of kind ErrTypeMismatch for op, for a value of
+// type t that was passed to it, with the message formatted as by fmt.Sprintf.
+func rootError(op string, t reflect.Type, format string, args ...interface{}) *Error {
+	e := typeError(t, format, args...)
+	e.Op = op
+	return e
+}
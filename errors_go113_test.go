@@ -0,0 +1,94 @@
+//go:build go1.13
+// +build go1.13
+
+package flatjson_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestErrorKinds(t *testing.T) {
+	flat := flatjson.FlattenWithOptions(&struct {
+		Pool   Pool           `json:"pool"`
+		Limits map[string]int `json:"limits"`
+	}{Limits: map[string]int{"a": 1}}, flatjson.Options{FlattenMaps: true})
+
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		op   string
+		key  string
+	}{
+		{"unknown key", flat.Set("pool.busy", 1), flatjson.ErrKeyNotFound, "Set", "pool.busy"},
+		{"mismatch", flat.Set("pool.idle", "x"), flatjson.ErrTypeMismatch, "Set", "pool.idle"},
+		{"parse", flat.SetString("pool.idle", "x"), flatjson.ErrTypeMismatch, "SetString", "pool.idle"},
+		{"not settable", flat.Set("limits.a", 2), flatjson.ErrNotSettable, "Set", "limits.a"},
+		{"duplicate", flat.Add("pool.idle", new(int)), flatjson.ErrDuplicateKey, "Add", "pool.idle"},
+		{"unsupported", func() error {
+			_, err := flatjson.Options{RejectUnsupported: true}.Flatten(&struct{ F func() }{})
+			return err
+		}(), flatjson.ErrUnsupportedKind, "Flatten", "F"},
+		{"not a struct", func() error {
+			_, err := flatjson.FlattenE(new(int))
+			return err
+		}(), flatjson.ErrTypeMismatch, "Flatten", ""},
+		{"element", func() error {
+			_, err := flatjson.FlattenEach([]struct {
+				X int
+				Y int `json:"X"`
+			}{{}})
+			return err
+		}(), flatjson.ErrDuplicateKey, "FlattenEach", "X"},
+	}
+
+	kinds := []error{flatjson.ErrKeyNotFound, flatjson.ErrDuplicateKey, flatjson.ErrTypeMismatch, flatjson.ErrUnsupportedKind, flatjson.ErrNotSettable}
+	for _, tt := range tests {
+		var e *flatjson.Error
+		if !errors.As(tt.err, &e) {
+			t.Errorf("%s: expected a *flatjson.Error, got %#v", tt.name, tt.err)
+			continue
+		}
+		if e.Op != tt.op || e.Key != tt.key {
+			t.Errorf("%s: expected op %q and key %q, got %q and %q", tt.name, tt.op, tt.key, e.Op, e.Key)
+		}
+		for _, kind := range kinds {
+			if is := errors.Is(tt.err, kind); is != (kind == tt.kind) {
+				t.Errorf("%s: errors.Is(%v, %v) returned %v", tt.name, tt.err, kind, is)
+			}
+		}
+	}
+}
+
+func TestErrorNested(t *testing.T) {
+	err := flatjson.Unflatten(flatjson.Map{"Read.Hits.Latency.P99": "slow"}, &DeepStats{})
+	if !errors.Is(err, flatjson.ErrTypeMismatch) {
+		t.Fatalf("Expected a type mismatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"Read.Hits.Latency.P99"`) {
+		t.Errorf("Expected the message to include the key, got %q", err.Error())
+	}
+
+	var e *flatjson.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Expected a *flatjson.Error, got %#v", err)
+	}
+	if e.Op != "Unflatten" || e.Key != "Read.Hits.Latency.P99" || e.Type != reflect.TypeOf(0.0) {
+		t.Errorf("Unexpected error details: %q %q %v", e.Op, e.Key, e.Type)
+	}
+	if e.Unwrap() == nil {
+		t.Error("Expected the error to wrap its cause")
+	}
+
+	// UnknownKeysError is of the kind ErrKeyNotFound too.
+	err = flatjson.UnmarshalFlat([]byte(`{"Read.Hits.Count":1,"Read.Nope":2}`), &DeepStats{})
+	var uke *flatjson.UnknownKeysError
+	if !errors.As(err, &uke) || !errors.Is(err, flatjson.ErrKeyNotFound) {
+		t.Errorf("Expected an UnknownKeysError of kind ErrKeyNotFound, got %#v", err)
+	}
+}
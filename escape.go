@@ -0,0 +1,102 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import "io"
+
+// EncodeOptions control how MarshalToWithOptions encodes a Map.
+type EncodeOptions struct {
+	// NoEscapeHTML leaves <, > and & in strings as they are, as with
+	// json.Encoder's SetEscapeHTML(false), which keeps URLs and query
+	// strings readable. By default they are escaped as \u003c, \u003e and
+	// \u0026, as by MarshalJSON and MarshalTo, so that the output can be
+	// embedded in HTML.
+	NoEscapeHTML bool
+
+	// Prefix and Indent, if Indent is non-empty, indent the output as
+	// MarshalIndent does.
+	Prefix, Indent string
+}
+
+// MarshalToWithOptions writes the encoding of m to w in the same way as
+// MarshalTo, but according to opts.
+func (m Map) MarshalToWithOptions(w io.Writer, opts EncodeOptions) error {
+	if m == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+
+	ind := indentation{opts.Prefix, opts.Indent, opts.Indent != ""}
+	if !opts.NoEscapeHTML {
+		return m.streamTo(w, ind)
+	}
+	uw := &htmlUnescaper{w: w}
+	if err := m.streamTo(uw, ind); err != nil {
+		return err
+	}
+	return uw.flush()
+}
+
+// An htmlUnescaper passes the JSON written to it on to w with the escapes of
+// <, > and & in its strings replaced by the characters themselves. An escape
+// split between two writes is held back until the next one.
+type htmlUnescaper struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (uw *htmlUnescaper) Write(p []byte) (int, error) {
+	data := append(uw.pending, p...)
+	out, n := unescapeHTML(nil, data)
+	uw.pending = append(uw.pending[:0], data[n:]...)
+	if _, err := uw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush writes out anything held back, which there is only for invalid JSON.
+func (uw *htmlUnescaper) flush() error {
+	if len(uw.pending) == 0 {
+		return nil
+	}
+	_, err := uw.w.Write(uw.pending)
+	uw.pending = uw.pending[:0]
+	return err
+}
+
+// unescapeHTML appends enc, JSON produced by encoding/json, to dst with the
+// escapes of <, > and & replaced by the characters themselves. Since outside
+// of strings there are no backslashes, each one starts an escape. It returns
+// the number of bytes of enc that were appended, which is less than len(enc)
+// if it ends in the middle of an escape.
+func unescapeHTML(dst, enc []byte) ([]byte, int) {
+	i := 0
+	for i < len(enc) {
+		if enc[i] != '\\' {
+			dst = append(dst, enc[i])
+			i++
+			continue
+		}
+		if i+1 >= len(enc) || enc[i+1] == 'u' && i+6 > len(enc) {
+			break
+		}
+		if enc[i+1] == 'u' {
+			switch string(enc[i+2 : i+6]) {
+			case "003c":
+				dst, i = append(dst, '<'), i+6
+				continue
+			case "003e":
+				dst, i = append(dst, '>'), i+6
+				continue
+			case "0026":
+				dst, i = append(dst, '&'), i+6
+				continue
+			}
+		}
+		dst, i = append(dst, enc[i], enc[i+1]), i+2
+	}
+	return dst, i
+}
@@ -0,0 +1,60 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+// byteWriter writes to a buffer one byte at a time, splitting every escape.
+type byteWriter struct{ buf bytes.Buffer }
+
+func (w *byteWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.buf.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+func TestEscapeHTML(t *testing.T) {
+	link := `<a href="?x=1&y=2">`
+	flat := flatjson.Flatten(&struct {
+		Link    string   `json:"link"`
+		Links   []string `json:"links"`
+		Literal string   `json:"a&b"`
+	}{link, []string{link}, `\u003c`})
+
+	escaped := `{"a\u0026b":"\\u003c","link":"\u003ca href=\"?x=1\u0026y=2\"\u003e","links":["\u003ca href=\"?x=1\u0026y=2\"\u003e"]}`
+	unescaped := `{"a&b":"\\u003c","link":"<a href=\"?x=1&y=2\">","links":["<a href=\"?x=1&y=2\">"]}`
+
+	// The default stays the same as encoding/json.
+	if enc, err := flat.MarshalJSON(); err != nil || string(enc) != escaped {
+		t.Errorf("Unexpected output %s, %v", enc, err)
+	}
+
+	for _, test := range []struct {
+		opts     flatjson.EncodeOptions
+		expected string
+	}{
+		{flatjson.EncodeOptions{}, escaped},
+		{flatjson.EncodeOptions{NoEscapeHTML: true}, unescaped},
+		{flatjson.EncodeOptions{NoEscapeHTML: true, Indent: " "}, "{\n \"a&b\": \"\\\\u003c\",\n \"link\": \"<a href=\\\"?x=1&y=2\\\">\",\n \"links\": [\n  \"<a href=\\\"?x=1&y=2\\\">\"\n ]\n}"},
+	} {
+		var buf bytes.Buffer
+		if err := flat.MarshalToWithOptions(&buf, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("Unexpected output for %+v:\n     got: %s\nexpected: %s", test.opts, buf.String(), test.expected)
+		}
+
+		var w byteWriter
+		if err := flat.MarshalToWithOptions(&w, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if w.buf.String() != test.expected {
+			t.Errorf("Unexpected output written byte by byte for %+v:\n     got: %s\nexpected: %s", test.opts, w.buf.String(), test.expected)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Expand is the inverse of flattening: it splits the keys of flat on the
+// default separator and returns the nested maps they describe, so that
+// "db.pool.active" becomes the element active of the map pool of the map db.
+// It is Options.Expand with the zero Options.
+func Expand(flat map[string]interface{}) (map[string]interface{}, error) {
+	return Options{}.Expand(flat)
+}
+
+// Expand is like the package-level Expand, but splits keys as Options.SplitKey
+// does, on o.Separator and taking escaped separators into account if
+// o.EscapeSeparators is set. Pointers, including the Map values pointing into
+// a flattened struct, are replaced by the values they currently point at, and
+// nil pointers by nil. An error is returned if a key is also the prefix of
+// another key, like "a" and "a.b", since the value of a can't be both.
+func (o Options) Expand(flat map[string]interface{}) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	root := &expandNode{}
+	for _, key := range keys {
+		n := root
+		for _, segment := range o.SplitKey(key) {
+			if n.leaf {
+				return nil, conflictError(n.key, key)
+			}
+			child, ok := n.children[segment]
+			if !ok {
+				child = &expandNode{key: key}
+				if n.children == nil {
+					n.children = map[string]*expandNode{}
+				}
+				n.children[segment] = child
+			}
+			n = child
+		}
+		if n.children != nil {
+			return nil, conflictError(key, n.key)
+		}
+
+		n.leaf, n.key = true, key
+		if v := indirectValue(resolve(flat[key])); v.IsValid() {
+			n.value = v.Interface()
+		}
+	}
+	return root.expand(), nil
+}
+
+// An expandNode is a key segment in the tree of keys built by Expand.
+type expandNode struct {
+	key      string // The first key passing through the node, or its own.
+	leaf     bool
+	value    interface{}
+	children map[string]*expandNode
+}
+
+// expand returns the nested maps n describes.
+func (n *expandNode) expand() map[string]interface{} {
+	m := make(map[string]interface{}, len(n.children))
+	for segment, child := range n.children {
+		if child.leaf {
+			m[segment] = child.value
+		} else {
+			m[segment] = child.expand()
+		}
+	}
+	return m
+}
+
+// conflictError returns the error for key, which is also the prefix of other.
+func conflictError(key, other string) error {
+	return &Error{Op: "Expand", Key: key, kind: ErrDuplicateKey, msg: fmt.Sprintf("flatjson: keys %q and %q conflict", key, other)}
+}
@@ -0,0 +1,119 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestExpandRoundTrip(t *testing.T) {
+	max := 10
+	val := &struct {
+		Name  string
+		Port  int
+		Ratio float64
+		TLS   *struct {
+			Cert    string
+			Enabled bool
+		}
+		Pool struct {
+			Active, Idle int
+			Limits       struct{ Max *int }
+		}
+		Tags   []string
+		Labels map[string]string
+		Nil    *int
+	}{Name: "a", Port: 8080, Ratio: 0.5, Tags: []string{"x"}, Labels: map[string]string{"k": "v"}}
+	val.TLS = &struct {
+		Cert    string
+		Enabled bool
+	}{"c", true}
+	val.Pool.Active = 3
+	val.Pool.Limits.Max = &max
+
+	flat := flatjson.Flatten(val)
+
+	// Both the Map itself and a snapshot of it expand to what encoding/json
+	// makes of the struct.
+	for _, m := range []map[string]interface{}{flat, flat.Values()} {
+		expanded, err := flatjson.Expand(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, expected := jsonView(t, expanded), jsonView(t, val); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Unexpected expansion:\n     got: %v\nexpected: %v", got, expected)
+		}
+	}
+
+	// Pointers are dereferenced.
+	expanded, _ := flatjson.Expand(flat)
+	pool := expanded["Pool"].(map[string]interface{})
+	if max := pool["Limits"].(map[string]interface{})["Max"]; max != 10 {
+		t.Errorf("Expected the pointer to be dereferenced, got %#v", max)
+	}
+	if expanded["Nil"] != nil {
+		t.Errorf("Expected nil for a nil pointer, got %#v", expanded["Nil"])
+	}
+}
+
+func TestExpandOptions(t *testing.T) {
+	opts := flatjson.Options{Separator: "/", EscapeSeparators: true}
+	val := &struct {
+		Disk struct {
+			Usage int `json:"usage/pct"`
+		}
+	}{}
+	val.Disk.Usage = 5
+
+	flat := flatjson.FlattenWithOptions(val, opts)
+	expanded, err := opts.Expand(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"Disk": map[string]interface{}{"usage/pct": 5}}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("Unexpected expansion:\n     got: %v\nexpected: %v", expanded, expected)
+	}
+}
+
+func TestExpandConflicts(t *testing.T) {
+	for _, test := range []struct {
+		flat     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"a": 1, "a.b": 2}, `flatjson: keys "a" and "a.b" conflict`},
+		{map[string]interface{}{"x.a": 1, "x.a.b.c": 2}, `flatjson: keys "x.a" and "x.a.b.c" conflict`},
+	} {
+		if m, err := flatjson.Expand(test.flat); err == nil {
+			t.Errorf("Expected error for %v, got %v", test.flat, m)
+		} else if err.Error() != test.expected {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	// Map values are kept as they are.
+	nested := map[string]interface{}{"b": 2}
+	expanded, err := flatjson.Expand(map[string]interface{}{"a": nested, "c.d": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"a": nested, "c": map[string]interface{}{"d": 3}}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("Unexpected expansion:\n     got: %v\nexpected: %v", expanded, expected)
+	}
+}
+
+// jsonView returns v as decoded by encoding/json into an interface{}.
+func jsonView(t *testing.T, v interface{}) interface{} {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var view interface{}
+	if err := json.Unmarshal(enc, &view); err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
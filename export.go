@@ -0,0 +1,112 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteGraphite writes the numeric values in m to w in Graphite's plaintext
+// format, one "path value timestamp" line per entry in sorted key order. The
+// path is the key, with prefix prepended if it isn't empty. Integers, floats
+// and booleans, as 0 or 1, are written; entries of other kinds, nil pointers
+// and non-finite floats are skipped. Characters Graphite doesn't allow in
+// paths are replaced with underscores, and empty path segments are dropped, so
+// the prefix may or may not end with a dot.
+func (m Map) WriteGraphite(w io.Writer, prefix string, ts time.Time) error {
+	suffix := " " + strconv.FormatInt(ts.Unix(), 10) + "\n"
+	return m.writeMetrics(w, func(key, value string) string {
+		return graphitePath(prefix, key) + " " + value + suffix
+	})
+}
+
+// WriteStatsd writes the numeric values in m to w as StatsD gauges, one
+// "name:value|g" line per entry in sorted key order, with the same values
+// written and skipped as by WriteGraphite. The name is the key, with prefix
+// and a dot prepended if prefix isn't empty. Characters with a special meaning
+// to StatsD, and whitespace, are replaced with underscores.
+func (m Map) WriteStatsd(w io.Writer, prefix string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return m.writeMetrics(w, func(key, value string) string {
+		return strings.Map(statsdRune, prefix+key) + ":" + value + "|g\n"
+	})
+}
+
+// writeMetrics writes the line returned by format for each numeric entry in m.
+func (m Map) writeMetrics(w io.Writer, format func(key, value string) string) error {
+	m = m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	for _, key := range *keys {
+		value, ok := formatNumber(resolve(m[key]), textOptions(m[key]))
+		if !ok {
+			continue
+		}
+		if _, err := io.WriteString(w, format(key, value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatNumber formats v, after dereferencing pointers, with formatValue
+// according to o if it is a finite number or a boolean. Booleans are
+// formatted as 1 and 0, as metric backends expect.
+func formatNumber(v reflect.Value, o formatOptions) (string, bool) {
+	v = indirectValue(v)
+	if v.Kind() == reflect.String {
+		return "", false
+	}
+	o.boolNumbers = true
+	return formatValue(v, o)
+}
+
+// indirectValue dereferences pointers and interfaces in v, returning the
+// invalid Value if one of them is nil.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// graphitePath joins prefix and key into a Graphite metric path.
+func graphitePath(prefix, key string) string {
+	var segments []string
+	for _, s := range strings.Split(prefix+"."+key, ".") {
+		if s != "" {
+			segments = append(segments, strings.Map(graphiteRune, s))
+		}
+	}
+	return strings.Join(segments, ".")
+}
+
+func graphiteRune(r rune) rune {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return r
+	case r == '-' || r == '_':
+		return r
+	}
+	return '_'
+}
+
+func statsdRune(r rune) rune {
+	switch r {
+	case ':', '|', '@', '#', ' ', '\t', '\n', '\r':
+		return '_'
+	}
+	return r
+}
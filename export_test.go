@@ -0,0 +1,119 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestWriteGraphite(t *testing.T) {
+	n := 7
+	flat := flatjson.Flatten(&struct {
+		Hits    uint64
+		Delta   int8
+		Ratio   float64
+		Small   float32
+		Huge    float64
+		Up      bool
+		Name    string
+		Latency time.Duration
+		Ptr     *int
+		Nil     *int
+		Labels  []string
+		Disk    struct {
+			Free int `json:"free space"`
+		}
+	}{
+		Hits:    3,
+		Delta:   -2,
+		Ratio:   0.000001,
+		Small:   0.1,
+		Huge:    1e21,
+		Up:      true,
+		Name:    "x",
+		Latency: time.Millisecond,
+		Ptr:     &n,
+	})
+	ts := time.Unix(1500000000, 0)
+
+	const expected = `app.Delta -2 1500000000
+app.Disk.free_space 0 1500000000
+app.Hits 3 1500000000
+app.Huge 1000000000000000000000 1500000000
+app.Latency 1000000 1500000000
+app.Ptr 7 1500000000
+app.Ratio 0.000001 1500000000
+app.Small 0.1 1500000000
+app.Up 1 1500000000
+`
+	for _, prefix := range []string{"app", "app."} {
+		var buf bytes.Buffer
+		if err := flat.WriteGraphite(&buf, prefix, ts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("Unexpected output for prefix %q:\n%s", prefix, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := flat.Filter("Hits").WriteGraphite(&buf, "", ts); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Hits 3 1500000000\n" {
+		t.Errorf("Unexpected output without prefix:\n%s", buf.String())
+	}
+}
+
+func TestExportDynamic(t *testing.T) {
+	val := &struct {
+		Cur interface{} `json:",dynamic"`
+	}{&Point{4, 5}}
+	flat := flatjson.Flatten(val)
+
+	// The fields of the struct the interface holds are exported too.
+	for _, test := range []struct {
+		write    func(*bytes.Buffer) error
+		expected string
+	}{
+		{func(buf *bytes.Buffer) error { return flat.WriteGraphite(buf, "", time.Unix(1, 0)) }, "Cur.X 4 1\nCur.Y 5 1\n"},
+		{func(buf *bytes.Buffer) error { return flat.WriteStatsd(buf, "") }, "Cur.X:4|g\nCur.Y:5|g\n"},
+		{func(buf *bytes.Buffer) error { return flat.WritePrometheus(buf, "") }, "# TYPE Cur_X gauge\nCur_X 4\n# TYPE Cur_Y gauge\nCur_Y 5\n"},
+	} {
+		var buf bytes.Buffer
+		if err := test.write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("Unexpected output:\n     got: %q\nexpected: %q", buf.String(), test.expected)
+		}
+	}
+}
+
+func TestWriteStatsd(t *testing.T) {
+	flat := flatjson.Flatten(&struct {
+		Hits  uint64
+		Ratio float64
+		Up    bool
+		Name  string
+		Disk  struct {
+			Free int `json:"free space"`
+		}
+	}{Hits: 3, Ratio: 0.5, Up: true, Name: "x"})
+
+	var buf bytes.Buffer
+	if err := flat.WriteStatsd(&buf, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = `app.Disk.free_space:0|g
+app.Hits:3|g
+app.Ratio:0.5|g
+app.Up:1|g
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"expvar"
+)
+
+// String returns the same encoding of m as MarshalJSON, so that a Map can be
+// published with expvar. Rather than failing, entries which can't be encoded
+// are encoded as a string holding the error.
+func (m Map) String() string {
+	if m == nil {
+		return "null"
+	}
+
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	var buf bytes.Buffer
+	ow := objectWriter{w: &buf, quoteErrors: true}
+	ow.begin()
+	for _, key := range *keys {
+		ow.entry(key, m[key])
+	}
+	ow.end()
+	return buf.String()
+}
+
+// Publish flattens val, which must be a pointer to a struct, and publishes the
+// resulting Map with expvar under name, so that its current values are served
+// by expvar's handler. Like Flatten, it panics if val can't be flattened, and
+// like expvar.Publish, it panics if name is already in use.
+func Publish(name string, val interface{}) Map {
+	m := Flatten(val)
+	expvar.Publish(name, m)
+	return m
+}
@@ -0,0 +1,65 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type Failing struct{}
+
+func (Failing) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("failed")
+}
+
+func TestPublish(t *testing.T) {
+	val := &struct {
+		Hits int
+		Pool Pool
+	}{Hits: 1}
+	flatjson.Publish("flatjson_test", val)
+
+	v := expvar.Get("flatjson_test")
+	if v == nil {
+		t.Fatal("Expected the Map to be published")
+	}
+	if s := v.String(); s != `{"Hits":1,"Pool.active":0,"Pool.idle":0}` {
+		t.Errorf("Unexpected expvar output: %s", s)
+	}
+
+	val.Hits = 2
+	if s := v.String(); s != `{"Hits":2,"Pool.active":0,"Pool.idle":0}` {
+		t.Errorf("Unexpected expvar output after update: %s", s)
+	}
+}
+
+func TestMapString(t *testing.T) {
+	val := &struct {
+		Bad  Failing
+		Good int
+	}{Good: 1}
+	flat := flatjson.Flatten(val)
+
+	if _, err := json.Marshal(flat); err == nil {
+		t.Error("Expected MarshalJSON to fail")
+	}
+
+	s := flat.String()
+	got := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &got); err != nil {
+		t.Fatalf("String returned invalid JSON %s: %v", s, err)
+	}
+	if got["Good"] != 1.0 {
+		t.Errorf("Unexpected output: %s", s)
+	}
+	if msg, ok := got["Bad"].(string); !ok || msg == "" {
+		t.Errorf("Expected an error string for the failing entry, got %s", s)
+	}
+
+	if s := flatjson.Map(nil).String(); s != "null" {
+		t.Errorf("Unexpected output for nil Map: %s", s)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A fastPlan lists the leaves of a struct type whose entries can be added
+// straight from their offsets with Options.Unsafe: every field, including
+// those of struct fields nested by value, is exported, has a predeclared
+// scalar type and no tag options that change its entry. The offsets of such
+// fields from the start of the struct are fixed, so nothing about them needs
+// to be checked again for each value.
+type fastPlan struct {
+	leaves []fastLeaf
+}
+
+// A fastLeaf is one field of a fastPlan.
+type fastLeaf struct {
+	key    string       // The key, relative to the prefix of the struct.
+	offset uintptr      // The offset from the start of the struct.
+	kind   reflect.Kind // The kind of the field's predeclared type.
+}
+
+// A fastPlanKey identifies a struct type along with the options that affect
+// the keys of its fields, and the hooks registered when it was built.
+type fastPlanKey struct {
+	planKey
+	generation uint64
+}
+
+// fastPlans caches the fastPlans built so far, keyed by fastPlanKey. Types
+// which can't be flattened this way are stored as nil.
+var fastPlans sync.Map
+
+// canFlattenFast reports whether v, a struct described by n, may be flattened
+// with a fastPlan. Options that are checked for every leaf, and nodes whose
+// entries need more than a pointer to the field, always take the regular
+// path.
+func (f *flattener) canFlattenFast(v reflect.Value, n node) bool {
+	o := f.opts
+	return o.Unsafe && v.CanAddr() && n.src == nil && n.group == nil && !n.redact && !n.embedded &&
+		o.SanitizeFunc == nil && o.FieldFilter == nil && o.RedactFunc == nil && o.ValueFunc == nil && len(o.ValueFuncs) == 0 && !o.StrictKeys && !o.RecordMeta &&
+		o.MaxDepth == 0 && len(o.LeafTypes) == 0 && o.NonFinite == NonFiniteError && o.FloatPrecision == 0
+}
+
+// fastPlan returns the fastPlan for t, building it the first time t is seen
+// with the key format of f.opts, or nil if t can't be flattened with one.
+func (f *flattener) fastPlan(t reflect.Type) *fastPlan {
+	key := fastPlanKey{
+		planKey:    f.planKeyFor(t),
+		generation: atomic.LoadUint64(&registrations),
+	}
+	if p, ok := fastPlans.Load(key); ok {
+		return p.(*fastPlan)
+	}
+
+	p := &fastPlan{}
+	if !f.addFastLeaves(p, t, "", 0) {
+		p = nil
+	}
+	fastPlans.Store(key, p)
+	return p
+}
+
+// addFastLeaves adds the leaves of t, a struct at offset within the struct p
+// is built for whose keys have prefix, to p. It reports false if any field of
+// t can't be added this way.
+func (f *flattener) addFastLeaves(p *fastPlan, t reflect.Type, prefix string, offset uintptr) bool {
+	sp := f.plan(t)
+	if sp.promoted != nil || len(sp.fields) == 0 {
+		// Embedded structs take part in resolving promoted fields, and
+		// structs without fields are encoded as a whole.
+		return false
+	}
+
+	for _, fp := range sp.fields {
+		if fp.anonymous || fp.unexported || fp.readOnly || fp.inline || fp.omitEmpty || fp.omitZero || fp.quoted || fp.noflatten ||
+			fp.stringer || fp.flatten || fp.durfmt != "" || fp.bytesfmt != "" || fp.redact {
+			return false
+		}
+
+		field := t.Field(fp.index)
+		key, off := prefix+fp.key, offset+field.Offset
+		switch {
+		case isFastLeaf(field.Type):
+			p.leaves = append(p.leaves, fastLeaf{key, off, field.Type.Kind()})
+		case isFastStruct(field.Type):
+			if !f.addFastLeaves(p, field.Type, key+f.opts.Separator, off) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isFastLeaf reports whether t is a predeclared boolean, numeric or string
+// type without a FlattenFunc, whose fields can be added to a fastPlan.
+func isFastLeaf(t reflect.Type) bool {
+	if t.PkgPath() != "" || t.Name() != t.Kind().String() || infoFor(t).flattenFunc != nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// isFastStruct reports whether t is a struct type that is always flattened
+// field by field, so that its fields can be added to a fastPlan.
+func isFastStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	info := infoFor(t)
+	return info.flattenFunc == nil && info.unwrap == nil && !info.leaf && !info.marshaler && !info.atomic &&
+		!reflect.PtrTo(t).Implements(flattenerType)
+}
+
+// flattenFast adds the entries for the fields of v, a struct described by n,
+// using p.
+func (f *flattener) flattenFast(v reflect.Value, n node, p *fastPlan) int {
+	base := unsafe.Pointer(v.UnsafeAddr())
+	for _, leaf := range p.leaves {
+		key := n.prefix + leaf.key
+		if f.output.add(key, fastPointer(leaf.kind, unsafe.Pointer(uintptr(base)+leaf.offset))) {
+			f.duplicates = append(f.duplicates, key)
+		}
+	}
+	return len(p.leaves)
+}
+
+// fastPointer returns ptr, which points at a value of the predeclared type of
+// kind, as a pointer of that type, the same as taking the field's address
+// through reflect would.
+func fastPointer(kind reflect.Kind, ptr unsafe.Pointer) interface{} {
+	switch kind {
+	case reflect.Bool:
+		return (*bool)(ptr)
+	case reflect.String:
+		return (*string)(ptr)
+	case reflect.Float32:
+		return (*float32)(ptr)
+	case reflect.Float64:
+		return (*float64)(ptr)
+	case reflect.Int:
+		return (*int)(ptr)
+	case reflect.Int8:
+		return (*int8)(ptr)
+	case reflect.Int16:
+		return (*int16)(ptr)
+	case reflect.Int32:
+		return (*int32)(ptr)
+	case reflect.Int64:
+		return (*int64)(ptr)
+	case reflect.Uint:
+		return (*uint)(ptr)
+	case reflect.Uint8:
+		return (*uint8)(ptr)
+	case reflect.Uint16:
+		return (*uint16)(ptr)
+	case reflect.Uint32:
+		return (*uint32)(ptr)
+	case reflect.Uint64:
+		return (*uint64)(ptr)
+	case reflect.Uintptr:
+		return (*uintptr)(ptr)
+	}
+	panic("flatjson: unexpected kind " + kind.String())
+}
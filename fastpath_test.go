@@ -0,0 +1,138 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type PlainStats struct {
+	Name    string `json:"name"`
+	Count   int64  `json:"count"`
+	Small   int8
+	Port    uint16
+	Ratio   float64 `json:"ratio"`
+	Up      bool
+	Latency struct {
+		Min, Max float32
+	} `json:"latency"`
+	Queue struct {
+		Depth struct{ Cur, Max int }
+		Label string
+	}
+}
+
+type MixedStats struct {
+	CommonStats
+	Plain   PlainStats  `json:"plain"`
+	Ptr     *PlainStats `json:"ptr"`
+	Nil     *PlainStats `json:"nil"`
+	Any     interface{} `json:"any"`
+	Tagged  PlainStats  `json:"tagged,omitempty"`
+	Uptime  time.Duration
+	Started time.Time
+	Inner   struct {
+		N     int `json:",string"`
+		Plain PlainStats
+	}
+}
+
+func TestUnsafe(t *testing.T) {
+	// Each struct holds different values, so that reading a field of the
+	// wrong one shows.
+	plain := PlainStats{Name: "s", Count: 1, Small: -1, Port: 80, Ratio: 0.5, Up: true}
+	plain.Latency.Min, plain.Latency.Max = 1, 2
+	plain.Queue.Depth.Cur, plain.Queue.Depth.Max, plain.Queue.Label = 1, 10, "q"
+
+	mixed := &MixedStats{
+		Plain:  PlainStats{Name: "a", Count: 2, Small: -2, Port: 81},
+		Ptr:    &PlainStats{Name: "b", Count: 3, Ratio: 0.25, Up: true},
+		Any:    &PlainStats{},
+		Tagged: PlainStats{Name: "c", Count: 4, Port: 82},
+	}
+	mixed.Plain.Latency.Max, mixed.Plain.Queue.Depth.Cur = 3, 4
+	mixed.Tagged.Queue.Depth.Max, mixed.Tagged.Queue.Label = 5, "t"
+	mixed.Inner.Plain = PlainStats{Name: "d", Count: 6, Small: 7}
+	mixed.Inner.Plain.Latency.Min = 8
+	mixed.Requests = 9
+
+	for _, opts := range []flatjson.Options{
+		{},
+		{Prefix: "p", Separator: "/"},
+		{KeyCase: flatjson.KeyCaseSnake, IndexSlices: true},
+		{EscapeSeparators: true, TagNames: []string{"yaml", "json"}},
+		{RedactFunc: func(key string, v interface{}) (interface{}, bool) { return nil, false }},
+	} {
+		for _, val := range []interface{}{&plain, mixed} {
+			safe := flatjson.FlattenWithOptions(val, opts)
+			opts.Unsafe = true
+			fast := flatjson.FlattenWithOptions(val, opts)
+			opts.Unsafe = false
+
+			if !flatjson.EqualKeys(safe, fast) {
+				t.Fatalf("Unexpected keys for %T with %+v:\n     got: %v\nexpected: %v", val, opts, fast, safe)
+			}
+			for key, value := range safe {
+				if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.Elem().Kind() != reflect.Struct && fast[key] != value {
+					t.Errorf("Expected %q to point at the same field, got %#v and %#v", key, fast[key], value)
+				}
+			}
+			testSameEncoding(t, safe, fast)
+
+			// Both follow changes to the struct.
+			plain.Queue.Depth.Cur++
+			mixed.Plain.Latency.Max++
+			mixed.Inner.Plain.Name += "x"
+			testSameEncoding(t, safe, fast)
+		}
+	}
+}
+
+func TestUnsafeDuplicateKeys(t *testing.T) {
+	val := &struct {
+		A int `json:"a"`
+		B int `flatjson:"a"`
+	}{}
+	_, safeErr := flatjson.Options{}.Flatten(val)
+	_, fastErr := flatjson.Options{Unsafe: true}.Flatten(val)
+	if safeErr == nil || fastErr == nil || fastErr.Error() != safeErr.Error() {
+		t.Errorf("Expected the same error, got %v and %v", fastErr, safeErr)
+	}
+}
+
+func testSameEncoding(t *testing.T, expected, got flatjson.Map) {
+	a, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != string(b) {
+		t.Errorf("Unexpected encoding:\n     got: %s\nexpected: %s", b, a)
+	}
+}
+
+func BenchmarkFlattenPlain(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts flatjson.Options
+	}{
+		{"Safe", flatjson.Options{}},
+		{"Unsafe", flatjson.Options{Unsafe: true}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			val := &MixedStats{Ptr: &PlainStats{}}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bench.opts.Flatten(val); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
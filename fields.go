@@ -0,0 +1,151 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import "reflect"
+
+// A fieldSet records which of the fields promoted through the embedded structs
+// of a struct type are visible, following the rules encoding/json uses: among
+// the fields sharing a key, the least nested one wins, and if several are
+// equally nested, the one whose name comes from a tag wins. If there still
+// isn't a single winner, none of them are visible.
+//
+// Fields declared directly in the struct are never hidden by one another;
+// if they share a key, it is reported as a duplicate instead.
+type fieldSet struct {
+	// visible maps each key to the index path of the field that wins it.
+	// Promoted fields from structs that don't need to be walked, because
+	// their type is also embedded at a lesser depth, produce keys that are
+	// won by another path.
+	visible map[string][]int
+
+	// ambiguous holds the contested keys that no field wins.
+	ambiguous map[string]bool
+}
+
+// hidden reports whether the field at index, which produces key, is hidden by
+// another field.
+func (fs *fieldSet) hidden(key string, index []int) bool {
+	if fs.ambiguous[key] {
+		return true
+	}
+
+	winner, ok := fs.visible[key]
+	if !ok {
+		return false
+	}
+	if len(winner) != len(index) {
+		return true
+	}
+	for i := range winner {
+		if winner[i] != index[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// promotedFields walks the embedded structs of t breadth first, as
+// encoding/json does, and resolves the keys that more than one field produces.
+// It returns nil if t has no embedded structs.
+func (f *flattener) promotedFields(t reflect.Type) *fieldSet {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	type candidate struct {
+		index  []int
+		tagged bool
+	}
+
+	candidates := map[string][]candidate{}
+	visited := map[reflect.Type]bool{}
+	promotes := false
+
+	for next := []embedded{{typ: t}}; len(next) > 0; {
+		current := next
+		next = nil
+
+		// A type embedded more than once at the same depth is walked once for
+		// each, so that its fields conflict with themselves, but a type seen
+		// at a lesser depth isn't walked again.
+		for _, e := range current {
+			visited[e.typ] = true
+		}
+
+		for _, e := range current {
+			for i := 0; i < e.typ.NumField(); i++ {
+				field := e.typ.Field(i)
+				index := append(e.index[:len(e.index):len(e.index)], i)
+
+				key, anonymous, opts := f.keyForField(field)
+				if anonymous {
+					if st := embeddedStruct(field.Type); st != nil {
+						promotes = true
+						if !visited[st] {
+							next = append(next, embedded{st, index})
+						}
+					}
+					continue
+				}
+				if field.PkgPath != "" || key == "" || isInlineField(field, opts) {
+					continue
+				}
+
+				name, _, _, ok := fieldTag(field, f.opts.TagNames)
+				candidates[key] = append(candidates[key], candidate{index, ok && name != ""})
+			}
+		}
+	}
+
+	if !promotes {
+		return nil
+	}
+
+	fs := &fieldSet{visible: map[string][]int{}, ambiguous: map[string]bool{}}
+	for key, cs := range candidates {
+		// Keep the least nested fields, and of those, the tagged ones if
+		// there are any.
+		depth := len(cs[0].index)
+		for _, c := range cs {
+			if len(c.index) < depth {
+				depth = len(c.index)
+			}
+		}
+		var dominant, tagged []candidate
+		for _, c := range cs {
+			if len(c.index) == depth {
+				dominant = append(dominant, c)
+				if c.tagged {
+					tagged = append(tagged, c)
+				}
+			}
+		}
+		if depth == 1 && len(dominant) > 1 {
+			continue
+		}
+		if len(tagged) > 0 {
+			dominant = tagged
+		}
+		if len(dominant) == 1 {
+			fs.visible[key] = dominant[0].index
+		} else {
+			fs.ambiguous[key] = true
+		}
+	}
+	return fs
+}
+
+// embeddedStruct returns the struct type of an embedded field of type t, or nil
+// if t isn't a struct or a pointer to one.
+func embeddedStruct(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"sort"
+	"strings"
+)
+
+// Filter returns a new Map containing the entries of m whose keys start with
+// prefix, which is matched against whole key segments: a prefix of db matches
+// db and db.conns but not dbx.conns. The entries share their values with m, so
+// they still point into the flattened struct. An empty prefix matches every
+// key. The separator is assumed to be the default one; see Options.Filter.
+func (m Map) Filter(prefix string) Map {
+	return Options{}.Filter(m, prefix)
+}
+
+// Sub is like Filter, but strips prefix and the separator following it from
+// the keys of the returned Map. A key equal to prefix itself is left out.
+func (m Map) Sub(prefix string) Map {
+	return Options{}.Sub(m, prefix)
+}
+
+// Filter is like Map.Filter, but matches key segments using o.Separator.
+func (o Options) Filter(m Map, prefix string) Map {
+	return o.filter(m, prefix, false)
+}
+
+// Sub is like Map.Sub, but matches key segments using o.Separator.
+func (o Options) Sub(m Map, prefix string) Map {
+	return o.filter(m, prefix, true)
+}
+
+func (o Options) filter(m Map, prefix string, strip bool) Map {
+	if prefix == "" {
+		filtered := make(Map, len(m))
+		for key, value := range m {
+			filtered[key] = value
+		}
+		return filtered
+	}
+
+	sep := o.withDefaults().Separator
+	filtered := Map{}
+	for key, value := range m {
+		if !o.under(key, prefix) || strip && key == prefix {
+			continue
+		}
+		if strip {
+			key = key[len(prefix)+len(sep):]
+			if d, ok := value.(*dynamic); ok {
+				value = d.rekeyed(func(key string) string { return key[len(prefix)+len(sep):] })
+			}
+		}
+		filtered[key] = value
+	}
+	return filtered
+}
+
+// AddPrefix returns a new Map with the entries of m under keys made of prefix,
+// the separator and their keys in m, as if m had been flattened with
+// Options.Prefix set to prefix, so that Sub(prefix) gives back the same keys.
+// The entries share their values with m, so they still point into the
+// flattened struct, and m is left as it is. The separator is assumed to be the
+// default one; see Options.AddPrefix.
+func (m Map) AddPrefix(prefix string) Map {
+	return Options{}.AddPrefix(m, prefix)
+}
+
+// AddPrefix is like Map.AddPrefix, but joins prefix to the keys using
+// o.Separator, or as a JSON Pointer if o.KeyFormat is KeyFormatJSONPointer.
+func (o Options) AddPrefix(m Map, prefix string) Map {
+	o.Prefix = prefix
+	root := o.rootPrefix()
+	rekey := func(key string) string {
+		if o.KeyFormat == KeyFormatJSONPointer {
+			key = strings.TrimPrefix(key, "/")
+		}
+		return root + key
+	}
+
+	prefixed := make(Map, len(m))
+	for key, value := range m {
+		if d, ok := value.(*dynamic); ok {
+			value = d.rekeyed(rekey)
+		}
+		prefixed[rekey(key)] = value
+	}
+	return prefixed
+}
+
+// Rekey returns a new Map with the entries of m under the keys fn returns for
+// their keys in m, or an error listing the keys fn returns for more than one
+// entry. The entries share their values with m, which is left as it is. The
+// entries of interface fields flattened with Options.DynamicInterfaces are
+// rekeyed as they currently are, so they no longer follow changes to the
+// values the fields hold.
+func (m Map) Rekey(fn func(key string) string) (Map, error) {
+	expanded := m.expandDynamic()
+	rekeyed := make(Map, len(expanded))
+	var duplicates []string
+	for key, value := range expanded {
+		key = fn(key)
+		if _, ok := rekeyed[key]; ok {
+			duplicates = append(duplicates, key)
+		}
+		rekeyed[key] = value
+	}
+	if len(duplicates) > 0 {
+		return nil, duplicateKeysError("Rekey", duplicates)
+	}
+	return rekeyed, nil
+}
+
+// DeletePrefix removes the entries of m whose keys start with prefix, matched
+// against whole key segments as by Filter, and returns the number removed.
+// An empty prefix removes every entry. The separator is assumed to be the
+// default one; see Options.DeletePrefix.
+func (m Map) DeletePrefix(prefix string) int {
+	return Options{}.DeletePrefix(m, prefix)
+}
+
+// Keys returns the sorted keys of m which start with prefix, matched against
+// whole key segments as by Filter. An empty prefix matches every key. The
+// separator is assumed to be the default one; see Options.KeysWithPrefix.
+func (m Map) Keys(prefix string) []string {
+	return Options{}.KeysWithPrefix(m, prefix)
+}
+
+// DeletePrefix is like Map.DeletePrefix, but matches key segments using
+// o.Separator.
+func (o Options) DeletePrefix(m Map, prefix string) int {
+	deleted := 0
+	for key := range m {
+		if o.under(key, prefix) {
+			delete(m, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// KeysWithPrefix is like Map.Keys, but matches key segments using
+// o.Separator.
+func (o Options) KeysWithPrefix(m Map, prefix string) []string {
+	var keys []string
+	for key := range m {
+		if o.under(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// under reports whether key is prefix, or starts with prefix followed by the
+// separator. Every key is under an empty prefix.
+func (o Options) under(key, prefix string) bool {
+	if prefix == "" || key == prefix {
+		return true
+	}
+	return strings.HasPrefix(key, prefix) && strings.HasPrefix(key[len(prefix):], o.withDefaults().Separator)
+}
@@ -0,0 +1,151 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestFilter(t *testing.T) {
+	val := &struct {
+		DB  Pool `json:"db"`
+		DBX Pool `json:"dbx"`
+		N   int  `json:"n"`
+	}{DB: Pool{1, 2}, DBX: Pool{3, 4}}
+	flat := flatjson.Flatten(val)
+
+	filtered := flat.Filter("db")
+	testEncoding(t, filtered, flatjson.Map{"db.active": 1.0, "db.idle": 2.0})
+
+	sub := flat.Sub("db")
+	testEncoding(t, sub, flatjson.Map{"active": 1.0, "idle": 2.0})
+
+	// The filtered Maps share the pointers into the struct.
+	val.DB.Active = 10
+	testEncoding(t, filtered, flatjson.Map{"db.active": 10.0, "db.idle": 2.0})
+	testEncoding(t, sub, flatjson.Map{"active": 10.0, "idle": 2.0})
+
+	// Filtering doesn't modify the original Map.
+	if len(flat) != 5 {
+		t.Errorf("Expected 5 entries in the original Map, got %d", len(flat))
+	}
+
+	if m := flat.Filter(""); len(m) != len(flat) {
+		t.Errorf("Expected an empty prefix to match everything, got %#v", m)
+	}
+	if m := flat.Filter("d"); len(m) != 0 {
+		t.Errorf("Expected no matches for a partial segment, got %#v", m)
+	}
+
+	// A key equal to the prefix is kept by Filter, but has nothing left once
+	// the prefix is stripped.
+	m := flatjson.Map{"a": 1, "a.b": 2, "a_c": 3}
+	testEncoding(t, m.Filter("a"), flatjson.Map{"a": 1.0, "a.b": 2.0})
+	testEncoding(t, m.Sub("a"), flatjson.Map{"b": 2.0})
+	testEncoding(t, flatjson.Options{Separator: "_"}.Sub(m, "a"), flatjson.Map{"c": 3.0})
+}
+
+func TestDeletePrefix(t *testing.T) {
+	val := &struct {
+		DB  Pool `json:"db"`
+		DBX Pool `json:"dbx"`
+		N   int  `json:"n"`
+	}{DB: Pool{1, 2}, DBX: Pool{3, 4}}
+	flat := flatjson.Flatten(val)
+	flat["db"] = 5
+
+	if keys := flat.Keys("db"); !reflect.DeepEqual(keys, []string{"db", "db.active", "db.idle"}) {
+		t.Errorf("Unexpected keys %q", keys)
+	}
+	if keys := flat.Keys(""); len(keys) != len(flat) {
+		t.Errorf("Expected an empty prefix to match everything, got %q", keys)
+	}
+	if keys := flat.Keys("d"); keys != nil {
+		t.Errorf("Expected no keys for a partial segment, got %q", keys)
+	}
+
+	if n := flat.DeletePrefix("db"); n != 3 {
+		t.Errorf("Expected 3 entries to be deleted, got %d", n)
+	}
+	testEncoding(t, flat, flatjson.Map{"dbx.active": 3.0, "dbx.idle": 4.0, "n": 0.0})
+
+	// Deleting a prefix without entries does nothing.
+	if n := flat.DeletePrefix("db"); n != 0 {
+		t.Errorf("Expected nothing to be deleted, got %d", n)
+	}
+	if n := flat.DeletePrefix("missing"); n != 0 {
+		t.Errorf("Expected nothing to be deleted, got %d", n)
+	}
+
+	// The remaining entries still point into the struct.
+	val.DBX.Active = 6
+	testEncoding(t, flat, flatjson.Map{"dbx.active": 6.0, "dbx.idle": 4.0, "n": 0.0})
+
+	m := flatjson.Map{"a_b": 1, "a.c": 2}
+	if n := (flatjson.Options{Separator: "_"}).DeletePrefix(m, "a"); n != 1 || len(m) != 1 {
+		t.Errorf("Unexpected deletion of %d entries, leaving %v", n, m)
+	}
+}
+
+func TestAddPrefix(t *testing.T) {
+	val := &struct {
+		DB  Pool        `json:"db"`
+		Any interface{} `json:"any"`
+	}{DB: Pool{1, 2}, Any: &Child{3, "a"}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{DynamicInterfaces: true})
+
+	prefixed := flat.AddPrefix("worker-3")
+	expected := flatjson.Map{
+		"worker-3.db.active": 1.0,
+		"worker-3.db.idle":   2.0,
+		"worker-3.any.CC":    3.0,
+		"worker-3.any.CD":    "a",
+	}
+	testEncoding(t, prefixed, expected)
+
+	// The entries share the pointers into the struct, including those of
+	// interfaces flattened when encoding.
+	val.DB.Active = 4
+	val.Any = &Pool{5, 6}
+	expected = flatjson.Map{
+		"worker-3.db.active":  4.0,
+		"worker-3.db.idle":    2.0,
+		"worker-3.any.active": 5.0,
+		"worker-3.any.idle":   6.0,
+	}
+	testEncoding(t, prefixed, expected)
+	testEncoding(t, prefixed.Sub("worker-3"), flatjson.Map{"db.active": 4.0, "db.idle": 2.0, "any.active": 5.0, "any.idle": 6.0})
+	if _, ok := flat["db.active"]; !ok || len(flat) != 3 {
+		t.Errorf("Expected the original Map to be unchanged, got %v", flat)
+	}
+
+	opts := flatjson.Options{KeyFormat: flatjson.KeyFormatJSONPointer}
+	pointers := opts.AddPrefix(flatjson.FlattenWithOptions(&Pool{7, 8}, opts), "pool")
+	testEncoding(t, pointers, flatjson.Map{"/pool/active": 7.0, "/pool/idle": 8.0})
+
+	opts = flatjson.Options{Separator: "_"}
+	testEncoding(t, opts.AddPrefix(flatjson.Flatten(&Pool{}), "p"), flatjson.Map{"p_active": 0.0, "p_idle": 0.0})
+}
+
+func TestRekey(t *testing.T) {
+	val := &struct {
+		DB    Pool `json:"db"`
+		Cache Pool `json:"cache"`
+	}{DB: Pool{1, 2}, Cache: Pool{3, 4}}
+	flat := flatjson.Flatten(val)
+
+	upper, err := flat.Rekey(strings.ToUpper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val.Cache.Idle = 5
+	testEncoding(t, upper, flatjson.Map{"DB.ACTIVE": 1.0, "DB.IDLE": 2.0, "CACHE.ACTIVE": 3.0, "CACHE.IDLE": 5.0})
+
+	// Dropping the first segment makes the keys collide.
+	_, err = flat.Rekey(func(key string) string { return key[strings.Index(key, ".")+1:] })
+	if err == nil || err.Error() != "flatjson: duplicate keys: active, idle" {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
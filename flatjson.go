@@ -9,47 +9,470 @@
 package flatjson
 
 import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 type Map map[string]interface{}
 
-// Flatten returns the Map representation of val.
+// Flatten returns the Map representation of val, which must be a pointer to a
+// struct. It panics if val can't be flattened; see FlattenE.
+//
+// Val may also be a map, or a pointer to one, such as a registry of the stats
+// of several subsystems. Each element is then flattened under its key, as the
+// elements of a map field are with Options.FlattenMaps: elements which are
+// pointers to structs have their fields flattened, and the entries point into
+// them, while other elements aren't addressable, so their entries look up the
+// element in the map again each time the Map is encoded. Elements added to the
+// map later don't get entries; see Refresh.
+//
+// Fields which lead back to a struct that is already being flattened, through
+// a cycle of pointers or interfaces, are left out of the Map.
+//
+// A field tagged with the noflatten option, as in flatjson:",noflatten", is
+// added as a single entry even if it could be flattened further, so that it is
+// encoded as nested JSON. An embedded struct tagged with noflatten is added
+// under its type name. Conversely, a struct field tagged with inline has its
+// fields flattened without the field's own key segment, as if it were
+// embedded.
+//
+// Embedded fields of exported interface types have the fields of the struct
+// they hold, or point to, promoted like those of an embedded struct, so that
+// pluggable sources of stats can be embedded. Which struct that is, and so
+// which keys the Map has, is fixed when flattening; a struct held by value is
+// looked up through the interface again each time the Map is encoded, but
+// storing a different type, or a pointer to another struct, in the interface
+// takes a Refresh to show up. An interface which is nil, or holds anything
+// other than a struct or a non-nil pointer to one, adds no entries.
+//
+// Fields holding a Map, such as one returned by an earlier call to Flatten,
+// have its entries merged into the Map being built, with the field's key and
+// the separator prepended to theirs, as do fields of other map types with
+// string keys and interface{} values which are tagged with merge, as in
+// flatjson:",merge". The entries keep pointing where they did, so they stay
+// live, but entries added to the field's Map after flattening don't appear;
+// see Refresh. A nil or empty Map adds no entries.
+//
+// Fields of map types tagged with dynamicmap, as in flatjson:",dynamicmap",
+// such as a map of shards, have their elements flattened again each time the
+// Map is encoded, so that added elements appear and removed ones vanish; see
+// Options.MapLocker.
+//
+// Fields of the sync/atomic types, like atomic.Int64 and atomic.Value, and
+// Counter and Gauge fields, are added as single entries that are encoded as
+// the value returned by Load, so the Map can be encoded while they are being
+// updated.
+//
+// Fields whose values encoding/json can't encode, like functions and
+// channels, are left out of the Map; see Options.RejectUnsupported.
 func Flatten(val interface{}) Map {
-	rval := reflect.ValueOf(val)
-	rval = extractStruct(rval, rval)
+	return FlattenWithOptions(val, Options{})
+}
 
-	if rval.Kind() != reflect.Struct {
-		panic("Flatten: must be called with a struct type")
+// FlattenWithOptions returns the Map representation of val, flattened
+// according to opts. It panics if val can't be flattened; see Options.Flatten.
+func FlattenWithOptions(val interface{}, opts Options) Map {
+	m, err := opts.Flatten(val)
+	if err != nil {
+		panic(err)
 	}
+	return m
+}
+
+// FlattenE is like Flatten, but returns an error instead of panicking if val
+// isn't a pointer to a struct or if two fields produce the same key.
+func FlattenE(val interface{}) (Map, error) {
+	return Options{}.Flatten(val)
+}
 
+// Flatten returns the Map representation of val, flattened according to o. An
+// error is returned if val isn't a pointer to a struct, if two fields produce
+// the same key and o.AllowDuplicateKeys isn't set, if a field has an invalid
+// durfmt tag option, if a field was left out because of its type and
+// o.RejectUnsupported is set, or if a key is invalid and o.StrictKeys is set.
+func (o Options) Flatten(val interface{}) (Map, error) {
 	m := Map{}
-	recursiveFlatten(rval, "", m)
-	return m
+	if err := flattenValue(reflect.ValueOf(val), o, m); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 
-func keyForField(field reflect.StructField, v reflect.Value) (string, bool) {
-	if tag := field.Tag.Get("json"); tag != "" {
-		tokens := strings.SplitN(tag, ",", 2)
-		name := tokens[0]
-		opts := ""
+// FlattenValue is like FlattenE, but takes val as a reflect.Value, such as one
+// built with reflect.New or taken from a field of another struct, so that it
+// doesn't have to be converted to an interface first. Val must hold a pointer
+// to a struct, or be an addressable struct itself.
+func FlattenValue(val reflect.Value) (Map, error) {
+	return Options{}.FlattenValue(val)
+}
 
-		if len(tokens) > 1 {
-			opts = tokens[1]
+// FlattenValue is like the package-level FlattenValue, but flattens val
+// according to o. An error is returned in the same cases as Options.Flatten,
+// and if val was obtained through unexported struct fields.
+func (o Options) FlattenValue(val reflect.Value) (Map, error) {
+	m := Map{}
+	if err := flattenValue(val, o, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FlattenInto adds the Map representation of val to m, with prefix prepended
+// to every key as with Options.Prefix. It returns the number of entries added.
+// If any of the keys is already present in m, an error listing them is
+// returned and m is left unchanged.
+func FlattenInto(val interface{}, prefix string, m Map) (int, error) {
+	return Options{Prefix: prefix}.FlattenInto(val, m)
+}
+
+// FlattenInto is like the package-level FlattenInto, but flattens val
+// according to o.
+func (o Options) FlattenInto(val interface{}, m Map) (int, error) {
+	flat, err := o.Flatten(val)
+	if err != nil {
+		return 0, err
+	}
+
+	var duplicates []string
+	for key := range flat {
+		if _, ok := m[key]; ok {
+			duplicates = append(duplicates, key)
 		}
+	}
+	if len(duplicates) > 0 {
+		return 0, duplicateKeysError("Flatten", duplicates)
+	}
 
-		if name == "-" || strings.Contains(opts, "omitempty") && isEmptyValue(v) {
-			return "", false
-		} else if name != "" {
-			return name, false
+	for key, v := range flat {
+		m[key] = v
+	}
+	return len(flat), nil
+}
+
+// Compose flattens each of parts under the prefix it is keyed by, as with
+// FlattenInto, and returns the combined Map. Parts which are nil, or nil
+// pointers, are skipped. An error is returned if any part can't be flattened,
+// or if two parts produce the same key.
+func Compose(parts map[string]interface{}) (Map, error) {
+	return Options{}.Compose(parts)
+}
+
+// Compose is like the package-level Compose, but flattens each part according
+// to o. The prefix of each part is appended to o.Prefix, if it is set.
+func (o Options) Compose(parts map[string]interface{}) (Map, error) {
+	prefixes := make([]string, 0, len(parts))
+	for prefix := range parts {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	m := Map{}
+	for _, prefix := range prefixes {
+		part := parts[prefix]
+		if rv := reflect.ValueOf(part); !rv.IsValid() || rv.Kind() == reflect.Ptr && rv.IsNil() {
+			continue
+		}
+
+		po := o
+		if o.Prefix != "" && prefix != "" {
+			po.Prefix = o.Prefix + o.withDefaults().Separator + prefix
+		} else if prefix != "" {
+			po.Prefix = prefix
+		}
+		if _, err := po.FlattenInto(part, m); err != nil {
+			return nil, err
 		}
 	}
+	return m, nil
+}
+
+// flattenValue is the shared implementation of the flattening entry points,
+// which adds the entries for rval to out.
+func flattenValue(rval reflect.Value, opts Options, out sink) error {
+	f := newFlattener(opts, out)
+	if m, ok := rootMap(rval); ok {
+		f.flattenMap(m, node{prefix: f.opts.rootPrefix()})
+		f.truncate(f.opts.rootPrefix())
+	} else {
+		rval, err := extractRoot("Flatten", rval, opts.CopyValues)
+		if err != nil {
+			return err
+		}
+		f.flatten(rval, f.opts.rootPrefix(), nil)
+	}
+	return f.err()
+}
+
+// err returns the error for the problems f found during the traversal, if any.
+func (f *flattener) err() error {
+	if f.selErr != nil {
+		return f.selErr
+	}
+	if f.limit.exceeded() && f.opts.OnLimit == LimitError {
+		e := newError("Flatten", ErrKeyLimit, "flatjson: more than %d keys, from %q on", f.opts.MaxKeys, f.limit.first)
+		e.Key = f.limit.first
+		return e
+	}
+	if f.takenTypeKey != "" {
+		return &Error{Op: "Flatten", Key: f.takenTypeKey, kind: ErrDuplicateKey, msg: fmt.Sprintf("flatjson: type key %q is also the key of a field", f.takenTypeKey)}
+	}
+	if len(f.invalidTags) > 0 {
+		return keyListError("Flatten", ErrInvalidTag, "invalid durfmt tag options", f.invalidTags)
+	}
+	if len(f.unsupported) > 0 && f.opts.RejectUnsupported {
+		return keyListError("Flatten", ErrUnsupportedKind, "fields of unsupported types", f.unsupported)
+	}
+	if len(f.invalidKeys) > 0 {
+		return invalidKeysError(f.invalidKeys)
+	}
+	if len(f.ambiguous) > 0 && f.opts.RejectAmbiguousFields {
+		return keyListError("Flatten", ErrAmbiguousField, "ambiguous fields", f.ambiguous)
+	}
+	if len(f.duplicates) > 0 && !f.opts.AllowDuplicateKeys {
+		if f.opts.sanitizing() {
+			return keyListError("Flatten", ErrDuplicateKey, "duplicate keys after sanitizing", f.duplicates)
+		}
+		return duplicateKeysError("Flatten", f.duplicates)
+	}
+	return nil
+}
+
+func duplicateKeysError(op string, keys []string) error {
+	return keyListError(op, ErrDuplicateKey, "duplicate keys", keys)
+}
+
+// keyListError returns an Error of the given kind for op describing keys,
+// which may contain repeats, listed in sorted order.
+func keyListError(op string, kind error, what string, keys []string) error {
+	sort.Strings(keys)
+
+	unique := keys[:0]
+	for i, key := range keys {
+		if i == 0 || key != keys[i-1] {
+			unique = append(unique, key)
+		}
+	}
+	return &Error{Op: op, Key: unique[0], kind: kind, msg: fmt.Sprintf("flatjson: %s: %s", what, strings.Join(unique, ", "))}
+}
+
+// rootMap returns the map held by rval, a value passed to one of the entry
+// points, through any number of pointers and interfaces.
+func rootMap(rval reflect.Value) (reflect.Value, bool) {
+	v := rval
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Map
+}
+
+// extractRoot unwraps the value passed to op, one of the entry points, which
+// must be a struct reached through at least one pointer so that the addresses
+// of its fields can be taken. If copyValues is set, a struct that isn't
+// addressable is copied instead.
+func extractRoot(op string, rval reflect.Value, copyValues bool) (reflect.Value, error) {
+	v := rval
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			if v.Kind() == reflect.Ptr {
+				return v, rootError(op, v.Type(), "flatjson: nil pointer %s", v.Type())
+			}
+			return v, rootError(op, v.Type(), "flatjson: nil interface")
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case !v.IsValid():
+		return v, rootError(op, nil, "flatjson: expected struct or pointer to struct, got nil")
+	case v.Kind() != reflect.Struct:
+		return v, rootError(op, rval.Type(), "flatjson: expected struct or pointer to struct, got %s", rval.Type())
+	case !v.CanInterface():
+		return v, rootError(op, v.Type(), "flatjson: struct %s was obtained through unexported fields", v.Type())
+	case !v.CanAddr() && copyValues:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		return c, nil
+	case !v.CanAddr():
+		return v, rootError(op, v.Type(), "flatjson: struct %s is not addressable, pass a pointer to it instead", v.Type())
+	}
+	return v, nil
+}
+
+// A sink receives the entries produced by a traversal. If an entry is added
+// under a key that is already present, it replaces the earlier one and add
+// reports true.
+type sink interface {
+	add(key string, value interface{}) (replaced bool)
+}
+
+// A haltingSink is a sink which may stop accepting entries, ending the
+// traversal early.
+type haltingSink interface {
+	sink
+	halted() bool
+}
+
+func (m Map) add(key string, value interface{}) bool {
+	_, replaced := m[key]
+	m[key] = value
+	return replaced
+}
+
+// flattener holds the state of a single traversal.
+type flattener struct {
+	output sink
+	opts   Options
+
+	// keepEmpty disables omitempty and omitzero, so that every field gets an
+	// entry. This is used when resolving fields to write into rather than to
+	// encode.
+	keepEmpty bool
+
+	// nilStructs, if non-nil, collects the nil pointer struct fields that
+	// could not be descended into.
+	nilStructs *[]nilStruct
+
+	// flattening counts the struct types currently being flattened, when nil
+	// pointers to structs are to be allocated.
+	flattening map[reflect.Type]int
+
+	// visiting holds the structs currently being flattened, to detect cycles.
+	visiting map[visit]bool
+
+	// duplicates collects the keys that were added more than once, and
+	// ambiguous the keys of promoted fields that were left out because no
+	// single field wins them.
+	duplicates []string
+	ambiguous  []string
+
+	// invalidTags collects the keys of fields with tag options that don't
+	// apply to them.
+	invalidTags []string
+
+	// unsupported collects the keys of fields that were left out because
+	// their values can't be encoded.
+	unsupported []string
+
+	// invalidKeys describes the keys which break the rules of StrictKeys.
+	invalidKeys []string
+
+	// plans holds the structPlans built for a SanitizeFunc.
+	plans map[reflect.Type]*structPlan
+
+	// sel, if non-nil, decides which keys are kept for Options.Include,
+	// Options.Exclude and Options.IgnoreFields, and selErr is the error for
+	// malformed patterns.
+	sel    *selector
+	selErr error
+
+	// takenTypeKey is the key of Options.TypeKey if a field has it too.
+	takenTypeKey string
+
+	// limit, if non-nil, enforces Options.MaxKeys.
+	limit *limitSink
+
+	// halt is the output, if it is a haltingSink.
+	halt haltingSink
+}
+
+// visit identifies a struct by address. The type is needed to tell a struct
+// apart from its first field, which has the same address.
+type visit struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+func newFlattener(opts Options, out sink) *flattener {
+	f := &flattener{
+		opts:     opts.withDefaults(),
+		visiting: map[visit]bool{},
+	}
+	if f.opts.NilStructs == NilStructAllocate {
+		f.flattening = map[reflect.Type]int{}
+	}
+	f.sel, f.selErr = newSelector(f.opts)
+	f.setOutput(out)
+	return f
+}
 
-	if field.Anonymous {
-		return "", true
+// setOutput makes f add its entries to out, or those Options.Include,
+// Options.Exclude and Options.IgnoreFields keep.
+func (f *flattener) setOutput(out sink) {
+	f.output = out
+	f.halt, _ = out.(haltingSink)
+	if f.opts.MaxKeys > 0 && out != nil {
+		f.limit = &limitSink{out: out, max: f.opts.MaxKeys}
+		f.output = f.limit
+	}
+	if f.sel != nil {
+		f.output = &selectSink{out, f.sel}
 	}
-	return field.Name, false
+}
+
+// done reports whether the traversal should end early, because Options.MaxKeys
+// was exceeded or the output stopped accepting entries.
+func (f *flattener) done() bool {
+	return f.limit.exceeded() || f.halt != nil && f.halt.halted()
+}
+
+// reset prepares f for another traversal adding its entries to out, keeping
+// the plans it built.
+func (f *flattener) reset(out sink) {
+	f.setOutput(out)
+	f.duplicates, f.ambiguous, f.invalidTags, f.unsupported, f.invalidKeys = nil, nil, nil, nil, nil
+	f.takenTypeKey = ""
+}
+
+// nilStruct records a field holding a nil pointer to a struct type, along
+// with the node it was flattened as.
+type nilStruct struct {
+	node
+	field reflect.Value // The pointer field.
+}
+
+// keyForField returns the key segment for field, or an empty string if the
+// field should be skipped, whether it is an embedded struct whose fields are
+// inlined, and the options from its tag. Like encoding/json, embedded structs
+// are inlined even if their type is unexported, while other embedded types are
+// treated as regular fields named after their type, as are embedded structs
+// tagged with noflatten.
+func (f *flattener) keyForField(field reflect.StructField) (key string, anonymous bool, opts tagOptions) {
+	name, opts, skip, ok := fieldTag(field, f.opts.TagNames)
+	if skip {
+		return "", false, ""
+	} else if ok && name != "" {
+		return f.opts.escape(f.opts.sanitize(name)), false, opts
+	}
+
+	if field.Anonymous && isInlined(field) && !opts.Contains("noflatten") {
+		return "", true, opts
+	}
+	return f.opts.escape(f.opts.sanitize(f.opts.KeyCase.apply(field.Name))), false, opts
+}
+
+// isInlined reports whether field, an embedded field, has its fields inlined
+// into the struct it is embedded in: fields of struct types, or pointers to
+// them, and of exported interface types, whose values are inlined if they hold
+// a struct.
+func isInlined(field reflect.StructField) bool {
+	if embeddedStruct(field.Type) != nil {
+		return true
+	}
+	return field.Type.Kind() == reflect.Interface && field.PkgPath == ""
+}
+
+// isInlineField reports whether field, a named field with tag options opts, is
+// a struct tagged with inline, whose fields are flattened as if it were
+// embedded. Unlike those of embedded structs, its fields are never hidden by
+// other fields producing the same keys; such keys are reported as duplicates.
+func isInlineField(field reflect.StructField, opts tagOptions) bool {
+	return opts.Contains("inline") && embeddedStruct(field.Type) != nil
 }
 
 func extractStruct(val, fallback reflect.Value) reflect.Value {
@@ -65,40 +488,737 @@ func extractStruct(val, fallback reflect.Value) reflect.Value {
 	}
 }
 
-func recursiveFlatten(val reflect.Value, prefix string, output Map) int {
+// flatten adds the entries for the fields of val, a top-level struct, with
+// prefix prepended to their keys.
+func (f *flattener) flatten(val reflect.Value, prefix string, src source) int {
+	n := f.flattenStruct(val, node{prefix: prefix, src: src})
+	if f.opts.TypeKey != "" {
+		n += f.addTypeKey(val, prefix)
+	}
+	return n + f.truncate(prefix)
+}
+
+// flattenStruct adds the entries for the fields of v, a struct described by n.
+func (f *flattener) flattenStruct(v reflect.Value, n node) int {
+	if f.canFlattenFast(v, n) {
+		if p := f.fastPlan(v.Type()); p != nil {
+			return f.flattenFast(v, n, p)
+		}
+	}
+	if !n.embedded {
+		n.fields, n.index = f.plan(v.Type()).promoted, nil
+	}
+	return f.flattenFields(v, n)
+}
+
+// flattenFields adds the entries for the fields of val, a struct described by
+// parent. Promoted fields hidden according to parent.fields are left out; a nil
+// fieldSet leaves nothing out.
+func (f *flattener) flattenFields(val reflect.Value, parent node) int {
 	valType := val.Type()
+	prefix, fields := parent.prefix, parent.fields
 	added := 0
 
-	for i := 0; i < val.NumField(); i++ {
-		child := val.Field(i)
-		childType := valType.Field(i)
-		childPrefix := prefix
+	if f.flattening != nil {
+		f.flattening[valType]++
+	}
+
+	var v visit
+	if val.CanAddr() {
+		v = visit{val.Addr().Pointer(), valType}
+		f.visiting[v] = true
+	}
+
+	for _, fp := range f.plan(valType).fields {
+		if f.done() {
+			break
+		}
+		child := val.Field(fp.index)
+		key, anonymous, inline := fp.key, fp.anonymous, fp.inline
+		omitEmpty := !f.keepEmpty && fp.omitEmpty
+		omitZero := !f.keepEmpty && fp.omitZero
+		childPrefix, nodeKey := prefix, ""
 
-		key, anonymous := keyForField(childType, child)
+		var childIndex []int
+		if fields != nil {
+			childIndex = append(parent.index[:len(parent.index):len(parent.index)], fp.index)
+		}
 
-		if !childType.Anonymous && (childType.PkgPath != "" || key == "") {
+		if fp.readOnly {
+			if f.opts.FieldFilter == nil || f.filterField(valType, fp, prefix, child) {
+				added += f.addUnexported(val, fp, prefix+key, parent)
+			}
+			continue
+		} else if fp.unexported && child.Kind() == reflect.Ptr && child.IsNil() {
+			// The pointer can't be allocated or encoded.
+			continue
+		} else if !anonymous && !inline && fields != nil && fields.hidden(key, childIndex) {
+			if fields.ambiguous[key] {
+				f.ambiguous = append(f.ambiguous, prefix+key)
+			}
+			continue
+		} else if f.sel != nil && !anonymous && !inline && f.sel.selects(prefix+key) == matchNone {
+			// Nothing under the field is kept, so it isn't walked.
+			continue
+		} else if f.opts.FieldFilter != nil && !f.filterField(valType, fp, prefix, child) {
+			continue
+		} else if omitEmpty && f.opts.EagerOmitEmpty && isEmptyValue(child) {
 			continue
-		} else if !anonymous {
-			childPrefix = prefix + key + "."
+		} else if omitZero && f.opts.EagerOmitEmpty && isZeroValue(child) {
+			continue
+		} else if !anonymous && !inline {
+			// The field's key is the prefix for its children without the
+			// separator, so that both take a single allocation.
+			childPrefix = prefix + key + f.opts.Separator
+			nodeKey = childPrefix[:len(childPrefix)-len(f.opts.Separator)]
+		} else {
+			nodeKey = prefix + key
+		}
+
+		n := node{
+			key:       nodeKey,
+			prefix:    childPrefix,
+			depth:     parent.depth + 1,
+			embedded:  anonymous,
+			inline:    inline,
+			leaf:      fp.noflatten,
+			omitEmpty: omitEmpty,
+			omitZero:  omitZero,
+			quoted:    fp.quoted,
+			stringer:  fp.stringer,
+			flatten:   fp.flatten,
+			durfmt:    fp.durfmt,
+			bytesfmt:  fp.bytesfmt,
+			redact:    parent.redact || fp.redact,
+			merge:     fp.merge,
+			dynamic:   fp.dynamic,
+			dynMap:    fp.dynMap,
+			group:     parent.group,
+			field:     parent.field,
+			src:       parent.src.field(fp.index),
+		}
+		if f.opts.StrictKeys {
+			n.field = fieldName(valType, valType.Field(fp.index).Name)
+		}
+		if f.opts.RecordMeta {
+			n.meta = parent.meta.child(valType.Field(fp.index), f.opts)
 		}
+		if anonymous || inline {
+			n.depth = parent.depth
+		}
+		if fp.embedded {
+			// Only embedded structs known from the type take part in
+			// resolving promoted fields, not those found in interfaces.
+			n.fields, n.index = fields, childIndex
+		}
+		added += f.flattenChild(child, n)
+	}
+
+	if f.flattening != nil {
+		f.flattening[valType]--
+	}
+
+	delete(f.visiting, v)
+
+	return added
+}
+
+// filterField reports whether Options.FieldFilter accepts the field of type t
+// described by fp, whose value is v, in a struct whose keys have prefix.
+func (f *flattener) filterField(t reflect.Type, fp fieldPlan, prefix string, v reflect.Value) bool {
+	path := prefix + fp.key
+	if fp.anonymous || fp.inline {
+		path = strings.TrimSuffix(prefix, f.opts.Separator)
+	}
+	return f.opts.FieldFilter(path, t.Field(fp.index), v)
+}
+
+// A node describes a value being flattened: a struct field, or a slice or map
+// element.
+type node struct {
+	key       string     // The key for the value's entry, if it ends up as a leaf.
+	prefix    string     // The prefix for the keys of the value's children.
+	depth     int        // The number of key segments, not counting Prefix.
+	embedded  bool       // Set for embedded fields, which are always inlined.
+	inline    bool       // Set for struct fields tagged with inline.
+	leaf      bool       // Set for fields tagged with noflatten.
+	omitEmpty bool       // Set for fields tagged with omitempty.
+	omitZero  bool       // Set for fields tagged with omitzero.
+	quoted    bool       // Set for fields tagged with string, if applicable.
+	stringer  bool       // Set for fields tagged with stringer.
+	flatten   bool       // Set for fields tagged with flatten.
+	durfmt    string     // The value of the durfmt tag option, if any.
+	bytesfmt  string     // The tag option choosing a BytesFormat, if any.
+	redact    bool       // Set for fields tagged with redact, and their children.
+	merge     bool       // Set for fields tagged with merge.
+	dynamic   bool       // Set for fields tagged with dynamic.
+	dynMap    bool       // Set for fields tagged with dynamicmap.
+	meta      *FieldMeta // The field the value comes from, with RecordMeta.
+	group     *omitGroup // The innermost enclosing struct tagged with omitempty or omitzero.
+	field     string     // The struct field the value comes from, with StrictKeys.
+	src       source     // Finds the value again if it isn't addressable.
 
-		child = extractStruct(child, child)
+	// For embedded structs, the promoted fields of the struct they are
+	// embedded in and their index path within it.
+	fields *fieldSet
+	index  []int
 
-		if child.Kind() == reflect.Struct {
-			childAdded := recursiveFlatten(child, childPrefix, output)
-			if childAdded != 0 {
-				added += childAdded
-				continue
+	// errorString is set for values of type error with ErrorStrings.
+	errorString bool
+}
+
+// inlined reports whether the children of the value described by n are added
+// with the prefix of the struct containing it.
+func (n *node) inlined() bool {
+	return n.embedded || n.inline
+}
+
+// flattenChild adds the entries for v, which is described by n.
+func (f *flattener) flattenChild(v reflect.Value, n node) int {
+	if f.done() {
+		return 0
+	}
+	if f.opts.ErrorStrings && !n.inlined() && v.Type() == errorType {
+		// Never flattened, since the value it holds is encoded as its
+		// message.
+		n.leaf, n.errorString = true, true
+	}
+	if (f.opts.DynamicInterfaces || n.dynamic) && v.Kind() == reflect.Interface && !n.leaf && !n.inlined() {
+		return f.flattenDynamic(v, n)
+	}
+	if n.dynMap && v.Kind() == reflect.Map && !n.leaf && !n.inlined() {
+		return f.flattenDynamic(v, n)
+	}
+
+	field := v
+	if !n.errorString {
+		v = extractStruct(v, v)
+	}
+	if n.embedded && field.Kind() == reflect.Interface && v.Kind() != reflect.Struct {
+		// Only a struct has fields to promote, and there's no key to add
+		// anything else under.
+		return 0
+	}
+
+	switch {
+	case v.CanAddr():
+		n.src = nil
+	case n.src != nil:
+		n.src = n.src.extract()
+	case field.CanAddr():
+		// A struct held by an interface, which is found again through the
+		// interface in case it is reassigned.
+		n.src = addressed(field).extract()
+	default:
+		// There's nothing to find the struct again from, so its current
+		// contents are flattened.
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+
+	info := infoFor(v.Type())
+	if info.lock && !f.opts.IncludeLocks {
+		return 0
+	}
+	if info.unwrap != nil {
+		return f.flattenUnwrapped(v, n, info.unwrap)
+	}
+	if !n.leaf && !n.inlined() && !n.flatten && f.isLeaf(info, v, field) {
+		n.leaf = true
+	}
+
+	if !n.leaf && !n.inlined() && isMergedMap(v, n) {
+		return f.flattenMerged(v.Convert(flatMapType).Interface().(Map), n)
+	}
+	if !n.leaf {
+		var fn func(prefix string, out Map)
+		if ff := info.flattenFunc; ff != nil {
+			fn = func(prefix string, out Map) { ff(prefix, v, out) }
+		} else if fl := asFlattener(v); fl != nil {
+			fn = func(prefix string, out Map) { fl.FlattenJSON(prefix, out) }
+		}
+
+		if fn != nil {
+			if n.omitEmpty && isEmptyValue(field) || n.omitZero && isZeroValue(field) {
+				// As with structs, evaluated at flatten time.
+				return 0
+			}
+			return f.flattenWith(n, fn)
+		}
+	}
+
+	switch {
+	case f.opts.NilStructs == NilStructSkip && isNilStructPointer(field):
+		// Including structs encoded as a whole, like *big.Int.
+		return 0
+	case !n.inlined() && !f.opts.FlattenMarshalers && info.marshaler:
+		// Encoded as a whole, the same way encoding/json would.
+	case !n.inlined() && info.atomic:
+		// Encoded as the value it holds.
+	case n.leaf, !n.inlined() && f.opts.MaxDepth > 0 && n.depth >= f.opts.MaxDepth:
+		// Encoded as a whole, as nested JSON if it has children.
+	case v.Kind() == reflect.Struct:
+		if v.CanAddr() && f.visiting[visit{v.Addr().Pointer(), v.Type()}] {
+			return 0
+		}
+		sn := n
+		if n.omitEmpty && !f.opts.EagerOmitEmpty {
+			// Left out when the Map is encoded while all of its entries
+			// are empty.
+			sn.group = &omitGroup{parent: n.group}
+		}
+		if n.omitZero && !f.opts.EagerOmitEmpty && field.Kind() == reflect.Struct {
+			// Left out when the Map is encoded while the struct is zero.
+			// Pointers and interfaces holding a struct are never zero,
+			// and a nil one doesn't get here.
+			sn.group = &omitGroup{parent: sn.group, zero: f.valueFor(v, n)}
+		}
+		if added := f.flattenStruct(v, sn); added != 0 || n.inlined() {
+			// Inlined structs never become entries, even if they add none.
+			return added
+		}
+		switch f.opts.EmptyStructs {
+		case EmptyStructSkip:
+			return 0
+		case EmptyStructLeafIfMarshaler:
+			if !info.marshaler {
+				return 0
 			}
 		}
+	case isNilStructPointer(field):
+		if added, ok := f.flattenNilStruct(field, n); ok {
+			return added
+		}
+	case f.opts.IndexSlices && isIndexable(v.Type()):
+		if added := f.flattenSlice(v, n); added != 0 || !f.opts.KeepEmptySlices {
+			return added
+		}
+	case f.opts.FlattenMaps && v.Kind() == reflect.Map:
+		return f.flattenMap(v, n)
+	}
 
-		output[prefix+key] = child.Addr().Interface()
-		added++
+	complexObject := f.opts.ComplexObjects && isComplex(v.Type())
+	if info.unsupported && !complexObject {
+		f.unsupported = append(f.unsupported, n.key)
+		return 0
 	}
 
+	value := f.valueFor(v, n)
+	if info.atomic {
+		value = &atomicValue{value}
+	}
+
+	var timeFormat string
+	if isTime(v.Type()) {
+		timeFormat = f.opts.TimeFormat
+	}
+	durationFormat := f.durationFormat(v.Type(), n)
+	bytesFormat := f.bytesFormat(v.Type(), n)
+	netText := isBuiltinTextType(v.Type()) || v.Kind() == reflect.Ptr && isBuiltinTextType(v.Type().Elem())
+	if netText {
+		bytesFormat = BytesBase64
+	}
+	stringer := !netText && !n.errorString && timeFormat == "" && durationFormat == DurationNanos && (n.stringer || f.opts.Stringers) && isStringer(v.Type())
+	var nonFinite NonFinitePolicy
+	var precision int
+	if !stringer && (isFloat(v.Type()) || info.atomic && loadsFloat(v.Type())) {
+		nonFinite, precision = f.opts.NonFinite, f.opts.FloatPrecision
+	}
+
+	var nilPointers NilPointerPolicy
+	if v.Kind() == reflect.Ptr {
+		nilPointers = f.opts.NilPointers
+	}
+
+	redact := n.redact || f.opts.RedactFunc != nil
+	keyValueFunc := f.opts.ValueFuncs[n.key]
+	n.group.join(value)
+
+	if n.omitEmpty || n.omitZero || n.quoted || stringer || netText || complexObject || timeFormat != "" || durationFormat != DurationNanos || bytesFormat != BytesBase64 || nonFinite != NonFiniteError || precision > 0 || nilPointers != NilPointerKeep || redact || n.group != nil || n.meta != nil || n.errorString ||
+		f.opts.ValueFunc != nil || keyValueFunc != nil {
+		value = &entry{
+			value:          value,
+			omitEmpty:      n.omitEmpty,
+			omitZero:       n.omitZero,
+			quoted:         n.quoted && !stringer && !netText && durationFormat == DurationNanos,
+			stringer:       stringer,
+			netText:        netText,
+			complex:        complexObject,
+			timeFormat:     timeFormat,
+			durationFormat: durationFormat,
+			bytesFormat:    bytesFormat,
+			nonFinite:      nonFinite,
+			precision:      precision,
+			nilPointers:    nilPointers,
+			redact:         n.redact,
+			redactFunc:     f.opts.RedactFunc,
+			key:            n.key,
+			valueFunc:      f.opts.ValueFunc,
+			keyValueFunc:   keyValueFunc,
+			group:          n.group,
+			meta:           n.meta,
+			errorString:    n.errorString,
+		}
+	}
+
+	if f.opts.StrictKeys {
+		f.checkKey(n.key, n)
+	}
+	if f.output.add(n.key, value) {
+		f.duplicates = append(f.duplicates, n.key)
+	}
+	return 1
+}
+
+// valueFor returns the Map value that finds v, which is described by n: a
+// pointer to it, or a lookup if it isn't addressable.
+func (f *flattener) valueFor(v reflect.Value, n node) interface{} {
+	if n.src != nil {
+		return &lookup{n.src}
+	}
+	return v.Addr().Interface()
+}
+
+// isLeaf reports whether v, whose typeInfo is info, or field, the value it
+// was extracted from, is of a leaf type.
+func (f *flattener) isLeaf(info *typeInfo, v, field reflect.Value) bool {
+	if info.leaf || isLeafType(v.Type(), f.opts.LeafTypes) {
+		return true
+	}
+	if field.Type() == v.Type() {
+		return false
+	}
+	return infoFor(field.Type()).leaf || isLeafType(field.Type(), f.opts.LeafTypes)
+}
+
+// durationFormat returns the DurationFormat for a leaf of type t, described by
+// n. Invalid durfmt tag options are recorded in f.invalidTags.
+func (f *flattener) durationFormat(t reflect.Type, n node) DurationFormat {
+	if n.durfmt == "" {
+		if isDuration(t) {
+			return f.opts.DurationFormat
+		}
+		return DurationNanos
+	}
+
+	format, ok := durationFormats[n.durfmt]
+	if !ok || !isInt64(t) {
+		f.invalidTags = append(f.invalidTags, n.key)
+	}
+	return format
+}
+
+// bytesFormat returns the BytesFormat for a leaf of type t, described by n.
+// Tag options choosing a format are ignored for other types than []byte.
+func (f *flattener) bytesFormat(t reflect.Type, n node) BytesFormat {
+	if !isBytes(t) {
+		return BytesBase64
+	}
+	if n.bytesfmt != "" {
+		return bytesFormats[n.bytesfmt]
+	}
+	return f.opts.BytesFormat
+}
+
+// flattenNilStruct handles field, a chain of pointers and interfaces which
+// ends in a nil pointer to a struct, according to the NilStructs option. It
+// returns false if the field should be added as a leaf instead, which is never
+// the case for inlined structs.
+func (f *flattener) flattenNilStruct(field reflect.Value, n node) (int, bool) {
+	// Only a chain of pointers can be allocated; the pointers held by an
+	// interface can't be set.
+	settable := field.CanSet() && structType(field.Type()).Kind() == reflect.Struct
+
+	switch f.opts.NilStructs {
+	case NilStructSkip:
+		return 0, true
+	case NilStructAllocate:
+		if settable && f.flattening[structType(field.Type())] == 0 {
+			allocateStruct(field)
+			return f.flattenChild(field, n), true
+		}
+	}
+
+	if f.nilStructs != nil && settable {
+		*f.nilStructs = append(*f.nilStructs, nilStruct{n, field})
+	}
+	if n.inlined() {
+		// An embedded or inline struct has no key of its own to add a null
+		// entry under, so like encoding/json, its fields are left out.
+		return 0, true
+	}
+	return 0, false
+}
+
+// flattenSlice adds the entries for each element of v, a slice or array
+// described by n, keyed by their index.
+func (f *flattener) flattenSlice(v reflect.Value, n node) int {
+	added := 0
+	for i := 0; i < v.Len() && !f.done(); i++ {
+		elemPrefix := n.key + f.opts.Separator + strconv.Itoa(i) + f.opts.Separator
+		added += f.flattenChild(v.Index(i), node{
+			key:    elemPrefix[:len(elemPrefix)-len(f.opts.Separator)],
+			prefix: elemPrefix,
+			depth:  n.depth + 1,
+			redact: n.redact,
+			group:  n.group,
+			field:  n.field,
+			meta:   n.meta,
+			src:    n.src.index(i),
+		})
+	}
+	return added
+}
+
+// flattenMap adds the entries for each element of v, a map described by n,
+// keyed by the formatted map key. Map elements aren't addressable, so their
+// entries look up the element again each time the Map is encoded.
+func (f *flattener) flattenMap(v reflect.Value, n node) int {
+	src := n.src
+	if src == nil {
+		// v is addressable, so it always refers to the map currently stored
+		// in the field.
+		src = func() reflect.Value { return v }
+	}
+
+	type element struct {
+		key  reflect.Value
+		name string
+	}
+	elems := make([]element, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		elems = append(elems, element{k, f.opts.escape(f.opts.sanitize(formatMapKey(k)))})
+	}
+	sort.Slice(elems, func(i, j int) bool { return elems[i].name < elems[j].name })
+
+	added := 0
+	for _, elem := range elems {
+		if f.done() {
+			break
+		}
+		elemPrefix := n.prefix + elem.name + f.opts.Separator
+		added += f.flattenChild(v.MapIndex(elem.key), node{
+			key:    elemPrefix[:len(elemPrefix)-len(f.opts.Separator)],
+			prefix: elemPrefix,
+			depth:  n.depth + 1,
+			redact: n.redact,
+			group:  n.group,
+			field:  n.field,
+			meta:   n.meta,
+			src:    src.mapIndex(elem.key),
+		})
+	}
 	return added
 }
 
+// formatMapKey returns the key segment for the map key k. Like encoding/json,
+// string keys are used directly and encoding.TextMarshalers are marshaled.
+// Otherwise fmt.Stringers are formatted with String, and anything else with
+// its default format, which is the natural representation of integers.
+func formatMapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+
+	switch k := k.Interface().(type) {
+	case encoding.TextMarshaler:
+		if text, err := k.MarshalText(); err == nil {
+			return string(text)
+		}
+	case fmt.Stringer:
+		return k.String()
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// isMarshaler reports whether t or a pointer to t implements json.Marshaler or
+// encoding.TextMarshaler.
+func isMarshaler(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(marshalerType) || t.Implements(textMarshalerType)
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// isStringer reports whether t or a pointer to t implements fmt.Stringer, and
+// isn't encoded by a marshaler instead.
+func isStringer(t reflect.Type) bool {
+	if isMarshaler(t) {
+		return false
+	}
+	return t.Implements(stringerType) || t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(stringerType)
+}
+
+// isQuotable reports whether the string tag option applies to fields of type
+// t. Like encoding/json, it does only for scalar types, and pointers to them,
+// which are encoded by the default encoder rather than a marshaler.
+func isQuotable(t reflect.Type) bool {
+	if t.Name() == "" && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isMarshaler(t) {
+		return false
+	}
+
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		return true
+	}
+	return false
+}
+
+// isIndexable reports whether t is a slice or array type whose elements should
+// be flattened individually when IndexSlices is set. That is the case when the
+// elements are structs, pointers to structs, interfaces that may hold structs,
+// or themselves indexable.
+func isIndexable(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+		return false
+	}
+
+	elem := t.Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	switch elem.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return true
+	}
+	return isIndexable(elem)
+}
+
+// isNilStructPointer reports whether v is a chain of pointers and interfaces
+// in which a nil pointer to a struct type is found before any other value.
+func isNilStructPointer(v reflect.Value) bool {
+	for {
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() {
+				return structType(v.Type()).Kind() == reflect.Struct
+			}
+		case reflect.Interface:
+			if v.IsNil() {
+				return false
+			}
+		default:
+			return false
+		}
+		v = v.Elem()
+	}
+}
+
+// allocateStruct allocates any nil pointers in the chain starting at v, and
+// returns the struct at the end of it.
+func allocateStruct(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// structType returns the type at the end of the chain of pointer types
+// starting at t.
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isEmptyValue reports whether v should be left out for the omitempty tag
+// option. It follows encoding/json, except that structs are empty when all of
+// their fields are zero, and complex numbers when they are zero.
 func isEmptyValue(v reflect.Value) bool {
-	return v.Interface() == reflect.Zero(v.Type()).Interface()
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.Interface, reflect.Ptr, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return v.IsNil()
+	case reflect.Struct:
+		return isZero(v)
+	}
+	return false
+}
+
+var isZeroerType = reflect.TypeOf((*interface{ IsZero() bool })(nil)).Elem()
+
+// isZeroValue reports whether v should be left out for the omitzero tag
+// option. Like encoding/json, it uses the IsZero method of v's type, or of a
+// pointer to it if v is addressable, and otherwise compares v to the zero
+// value of its type. A nil pointer is zero without calling IsZero.
+func isZeroValue(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(isZeroerType) {
+		if (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) && v.IsNil() {
+			return true
+		}
+		return v.Interface().(interface{ IsZero() bool }).IsZero()
+	}
+	if t.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(t).Implements(isZeroerType) {
+		return v.Addr().Interface().(interface{ IsZero() bool }).IsZero()
+	}
+	return isZero(v)
+}
+
+// isZero reports whether v is the zero value of its type, which unlike
+// comparing values also works for types that aren't comparable.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return math.Float64bits(v.Float()) == 0
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return math.Float64bits(real(c)) == 0 && math.Float64bits(imag(c)) == 0
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !isZero(v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !isZero(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return v.IsNil()
 }
@@ -2,8 +2,14 @@ package flatjson_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/pushrax/flatjson"
 )
@@ -110,6 +116,1285 @@ func TestInvalidInputs(t *testing.T) {
 	testPanic(t, "abc")
 }
 
+func TestFlattenE(t *testing.T) {
+	var nilChild *Child
+	var nilIface interface{}
+
+	tests := []struct {
+		val interface{}
+		err string
+	}{
+		{nil, "flatjson: expected struct or pointer to struct, got nil"},
+		{123, "flatjson: expected struct or pointer to struct, got int"},
+		{new(string), "flatjson: expected struct or pointer to struct, got *string"},
+		{nilChild, "flatjson: nil pointer *flatjson_test.Child"},
+		{&nilChild, "flatjson: nil pointer *flatjson_test.Child"},
+		{&nilIface, "flatjson: nil interface"},
+		{Child{}, "flatjson: struct flatjson_test.Child is not addressable, pass a pointer to it instead"},
+	}
+
+	for _, tt := range tests {
+		m, err := flatjson.FlattenE(tt.val)
+		if err == nil {
+			t.Errorf("Expected error for input %#v, got %#v", tt.val, m)
+		} else if err.Error() != tt.err {
+			t.Errorf("Unexpected error for input %#v:\n     got: %s\nexpected: %s", tt.val, err, tt.err)
+		}
+	}
+
+	m, err := flatjson.FlattenE(&Child{1, "2"})
+	if err != nil || len(m) != 2 {
+		t.Errorf("Unexpected result for valid input: %#v, %v", m, err)
+	}
+}
+
+func TestFlattenValue(t *testing.T) {
+	outer := &struct {
+		Child Child
+		kid   Child
+	}{Child: Child{1, "2"}}
+
+	// A field of another struct is addressable through the pointer.
+	m, err := flatjson.FlattenValue(reflect.ValueOf(outer).Elem().Field(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer.Child.C = 3
+	testEncoding(t, m, flatjson.Map{"CC": 3.0, "CD": "2"})
+
+	v := reflect.New(reflect.TypeOf(Child{}))
+	v.Elem().Field(1).SetString("x")
+	m, err = flatjson.Options{Prefix: "c"}.FlattenValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncoding(t, m, flatjson.Map{"c.CC": 0.0, "c.CD": "x"})
+
+	for _, test := range []struct {
+		val reflect.Value
+		err string
+	}{
+		{reflect.Value{}, "flatjson: expected struct or pointer to struct, got nil"},
+		{reflect.ValueOf(Child{}), "flatjson: struct flatjson_test.Child is not addressable, pass a pointer to it instead"},
+		{reflect.ValueOf(outer).Elem().Field(1), "flatjson: struct flatjson_test.Child was obtained through unexported fields"},
+		{reflect.ValueOf((*Child)(nil)), "flatjson: nil pointer *flatjson_test.Child"},
+	} {
+		if _, err := flatjson.FlattenValue(test.val); err == nil || err.Error() != test.err {
+			t.Errorf("Unexpected error for %v:\n     got: %v\nexpected: %s", test.val, err, test.err)
+		}
+	}
+}
+
+func TestTopLevelMaps(t *testing.T) {
+	db, cache := &Child{1, "a"}, &Child{2, "b"}
+	registry := map[string]*Child{"db": db, "cache": cache, "lb.eu": nil}
+	testFlattening(t, registry, flatjson.Map{
+		"db.CC":    1.0,
+		"db.CD":    "a",
+		"cache.CC": 2.0,
+		"cache.CD": "b",
+		"lb.eu":    nil,
+	})
+
+	// Entries for pointer elements point into the structs, and others
+	// look up their element again.
+	flat := flatjson.FlattenWithOptions(&registry, flatjson.Options{Prefix: "svc", EscapeSeparators: true})
+	counts := map[string]int{"a": 1}
+	flatCounts := flatjson.Flatten(counts)
+	db.C, counts["a"] = 3, 4
+	testEncoding(t, flat, flatjson.Map{
+		"svc.db.CC":    3.0,
+		"svc.db.CD":    "a",
+		"svc.cache.CC": 2.0,
+		"svc.cache.CD": "b",
+		`svc.lb\.eu`:   nil,
+	})
+	testEncoding(t, flatCounts, flatjson.Map{"a": 4.0})
+
+	// Structs held by interfaces are flattened too.
+	var nilMap map[string]int
+	mixed := map[string]interface{}{"child": Child{5, "c"}, "n": 6, "list": []int{7}}
+	testFlattening(t, mixed, flatjson.Map{"child.CC": 5.0, "child.CD": "c", "n": 6.0, "list": []interface{}{7.0}})
+	testFlattening(t, nilMap, flatjson.Map{})
+}
+
+func TestSeparator(t *testing.T) {
+	val := &struct {
+		TL0
+		Child
+		Other struct {
+			Child Child
+			Deep  *L0
+		}
+	}{}
+	val.A = "abc"
+	val.Other.Deep = &L0{}
+	val.Other.Deep.A = "def"
+
+	for _, sep := range []string{"/", "_", "::"} {
+		expected := flatjson.Map{
+			"L1" + sep + "L2" + sep + "A":        "abc",
+			"CC":                                 0.0,
+			"CD":                                 "",
+			"Other" + sep + "Child" + sep + "CC": 0.0,
+			"Other" + sep + "Child" + sep + "CD": "",
+			"Other" + sep + "Deep" + sep + "A":   "def",
+		}
+
+		testFlatteningWithOptions(t, val, flatjson.Options{Separator: sep}, expected)
+	}
+}
+
+type Point struct{ X, Y int }
+
+func TestIndexSlices(t *testing.T) {
+	val := &struct {
+		Points  []Point   `json:"points"`
+		Ptrs    []*Point  `json:"ptrs"`
+		Array   [2]Point  `json:"array"`
+		Grid    [][]Point `json:"grid"`
+		Tags    []string  `json:"tags"`
+		Empty   []Point   `json:"empty"`
+		NilElem []*Point  `json:"nilElem"`
+	}{
+		Points:  []Point{{1, 2}, {3, 4}},
+		Ptrs:    []*Point{{5, 6}},
+		Array:   [2]Point{{7, 8}},
+		Grid:    [][]Point{{{9, 10}}},
+		Tags:    []string{"a", "b"},
+		NilElem: []*Point{nil},
+	}
+
+	expected := flatjson.Map{
+		"points.0.X": 1.0,
+		"points.0.Y": 2.0,
+		"points.1.X": 3.0,
+		"points.1.Y": 4.0,
+		"ptrs.0.X":   5.0,
+		"ptrs.0.Y":   6.0,
+		"array.0.X":  7.0,
+		"array.0.Y":  8.0,
+		"array.1.X":  0.0,
+		"array.1.Y":  0.0,
+		"grid.0.0.X": 9.0,
+		"grid.0.0.Y": 10.0,
+		"tags":       []interface{}{"a", "b"},
+		"nilElem.0":  nil,
+	}
+
+	opts := flatjson.Options{IndexSlices: true}
+	testFlatteningWithOptions(t, val, opts, expected)
+
+	// Element entries are live.
+	flat := flatjson.FlattenWithOptions(val, opts)
+	val.Points[1].X = 30
+	if got := *flat["points.1.X"].(*int); got != 30 {
+		t.Errorf("Expected element entry to be live, got %d", got)
+	}
+
+	// Empty slices can be kept as a single entry.
+	opts.KeepEmptySlices = true
+	expected["empty"] = nil
+	expected["points.1.X"] = 30.0
+	testFlatteningWithOptions(t, val, opts, expected)
+
+	// Without IndexSlices every slice is a single entry.
+	flat = flatjson.Flatten(val)
+	if _, ok := flat["points"].(*[]Point); !ok || len(flat) != 7 {
+		t.Errorf("Unexpected entries without IndexSlices: %#v", flat)
+	}
+}
+
+type Pool struct {
+	Active int `json:"active"`
+	Idle   int `json:"idle"`
+}
+
+type State int
+
+func (s State) String() string { return [...]string{"off", "on"}[s] }
+
+func TestFlattenMaps(t *testing.T) {
+	val := &struct {
+		Counters map[string]int64 `json:"counters"`
+		Pools    map[string]Pool  `json:"pools"`
+		PoolPtrs map[string]*Pool `json:"poolPtrs"`
+		ByID     map[int]string   `json:"byID"`
+		ByState  map[State]bool   `json:"byState"`
+		Nested   map[string]map[string]int
+		Empty    map[string]int
+	}{
+		Counters: map[string]int64{"requests": 10, "errors": 1},
+		Pools:    map[string]Pool{"db": {3, 4}},
+		PoolPtrs: map[string]*Pool{"cache": {5, 6}},
+		ByID:     map[int]string{42: "answer"},
+		ByState:  map[State]bool{1: true},
+		Nested:   map[string]map[string]int{"a": {"b": 7}},
+	}
+
+	expected := flatjson.Map{
+		"counters.requests":     10.0,
+		"counters.errors":       1.0,
+		"pools.db.active":       3.0,
+		"pools.db.idle":         4.0,
+		"poolPtrs.cache.active": 5.0,
+		"poolPtrs.cache.idle":   6.0,
+		"byID.42":               "answer",
+		"byState.on":            true,
+		"Nested.a.b":            7.0,
+	}
+
+	opts := flatjson.Options{FlattenMaps: true}
+	testFlatteningWithOptions(t, val, opts, expected)
+
+	// Updated elements are reflected, deleted ones encode as null, and new
+	// ones are only picked up by flattening again.
+	flat := flatjson.FlattenWithOptions(val, opts)
+	val.Counters["requests"] = 11
+	delete(val.Counters, "errors")
+	val.Counters["new"] = 1
+	val.Pools["db"] = Pool{30, 40}
+	val.PoolPtrs["cache"].Idle = 60
+	val.Nested = map[string]map[string]int{"a": {"b": 70}}
+
+	expected["counters.requests"] = 11.0
+	expected["counters.errors"] = nil
+	expected["pools.db.active"] = 30.0
+	expected["pools.db.idle"] = 40.0
+	expected["poolPtrs.cache.idle"] = 60.0
+	expected["Nested.a.b"] = 70.0
+	testEncoding(t, flat, expected)
+
+	// Without FlattenMaps every map is a single entry.
+	flat = flatjson.Flatten(val)
+	if _, ok := flat["counters"].(*map[string]int64); !ok || len(flat) != 7 {
+		t.Errorf("Unexpected entries without FlattenMaps: %#v", flat)
+	}
+}
+
+// Decimal implements json.Marshaler with a value receiver.
+type Decimal struct {
+	Units int64
+	Exp   int
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%de%d"`, d.Units, d.Exp)), nil
+}
+
+// IP implements encoding.TextMarshaler with a pointer receiver.
+type IP struct {
+	Octets [4]byte
+}
+
+func (ip *IP) MarshalText() ([]byte, error) {
+	o := ip.Octets
+	return []byte(fmt.Sprintf("%d.%d.%d.%d", o[0], o[1], o[2], o[3])), nil
+}
+
+func TestMarshalerLeaves(t *testing.T) {
+	val := &struct {
+		Price   Decimal
+		Addr    IP
+		AddrPtr *IP
+		Started time.Time
+	}{
+		Price:   Decimal{15, -1},
+		Addr:    IP{[4]byte{10, 0, 0, 1}},
+		AddrPtr: &IP{[4]byte{10, 0, 0, 2}},
+	}
+
+	expected := flatjson.Map{
+		"Price":   "15e-1",
+		"Addr":    "10.0.0.1",
+		"AddrPtr": "10.0.0.2",
+		"Started": "0001-01-01T00:00:00Z",
+	}
+	testFlattening(t, val, expected)
+
+	expected = flatjson.Map{
+		"Price.Units":    15.0,
+		"Price.Exp":      -1.0,
+		"Addr.Octets":    []interface{}{10.0, 0.0, 0.0, 1.0},
+		"AddrPtr.Octets": []interface{}{10.0, 0.0, 0.0, 2.0},
+		"Started":        "0001-01-01T00:00:00Z",
+	}
+	testFlatteningWithOptions(t, val, flatjson.Options{FlattenMarshalers: true}, expected)
+}
+
+func TestEmbeddedMarshaler(t *testing.T) {
+	val := &struct {
+		Decimal
+		A int
+	}{Decimal{1, 2}, 3}
+
+	// Embedded fields are inlined, even though the value as a whole encodes
+	// through the promoted MarshalJSON method.
+	expected := flatjson.Map{"Units": 1.0, "Exp": 2.0, "A": 3.0}
+	testFlattening(t, val, expected)
+}
+
+func TestFlatjsonTag(t *testing.T) {
+	val := &struct {
+		Renamed  int   `json:"json_name" flatjson:"flat_name"`
+		JSONOnly int   `json:"json_only"`
+		FlatOnly int   `flatjson:"flat_only"`
+		Excluded int   `json:"included" flatjson:"-"`
+		Included int   `json:"-" flatjson:"included"`
+		Unnamed  int   `json:"json_unnamed" flatjson:",omitempty"`
+		Empty    int   `json:"json_empty,omitempty" flatjson:"flat_empty"`
+		Nested   Child `json:"json_nested" flatjson:"flat_nested"`
+	}{}
+
+	expected := flatjson.Map{
+		"flat_name":      0.0,
+		"json_only":      0.0,
+		"flat_only":      0.0,
+		"included":       0.0,
+		"flat_empty":     0.0,
+		"flat_nested.CC": 0.0,
+		"flat_nested.CD": "",
+	}
+	testFlattening(t, val, expected)
+
+	val.Unnamed = 1
+	expected["json_unnamed"] = 1.0
+	testFlattening(t, val, expected)
+}
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+func TestNilStructs(t *testing.T) {
+	type Inner struct{ A int }
+	type Outer struct{ Inner *Inner }
+
+	newVal := func() *struct {
+		Child  *Child
+		Double **Child
+		Chain  *Outer
+		Node   Node
+	} {
+		var child *Child
+		return &struct {
+			Child  *Child
+			Double **Child
+			Chain  *Outer
+			Node   Node
+		}{Double: &child, Node: Node{Name: "root"}}
+	}
+
+	testFlatteningWithOptions(t, newVal(), flatjson.Options{}, flatjson.Map{
+		"Child":     nil,
+		"Double":    nil,
+		"Chain":     nil,
+		"Node.Name": "root",
+		"Node.Next": nil,
+	})
+
+	testFlatteningWithOptions(t, newVal(), flatjson.Options{NilStructs: flatjson.NilStructSkip}, flatjson.Map{
+		"Node.Name": "root",
+	})
+
+	val := newVal()
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{NilStructs: flatjson.NilStructAllocate})
+
+	// Node.Next isn't allocated, since Node is already being flattened.
+	expected := flatjson.Map{
+		"Child.CC":      0.0,
+		"Child.CD":      "",
+		"Double.CC":     0.0,
+		"Double.CD":     "",
+		"Chain.Inner.A": 0.0,
+		"Node.Name":     "root",
+		"Node.Next":     nil,
+	}
+	testEncoding(t, flat, expected)
+
+	// The allocated structs are part of the original value, so the entries
+	// stay live.
+	val.Child.C = 1
+	(*val.Double).C = 2
+	val.Chain.Inner.A = 3
+
+	expected["Child.CC"] = 1.0
+	expected["Double.CC"] = 2.0
+	expected["Chain.Inner.A"] = 3.0
+	testEncoding(t, flat, expected)
+}
+
+type NilBase struct{ ID int }
+
+type NilEmbedder struct {
+	*NilBase
+	Name  string
+	Inner struct {
+		*NilBase
+		X int
+	}
+}
+
+func TestNilEmbeddedStructs(t *testing.T) {
+	for _, opts := range []flatjson.Options{{}, {Prefix: "p"}, {NilStructs: flatjson.NilStructSkip}} {
+		m := flatjson.FlattenWithOptions(&NilEmbedder{}, opts)
+		expected := flatjson.Map{"Name": "", "Inner.X": 0.0}
+		if opts.Prefix != "" {
+			expected = flatjson.Map{"p.Name": "", "p.Inner.X": 0.0}
+		}
+		testEncoding(t, m, expected)
+
+		// There's no entry keyed by the prefix of the embedding struct.
+		for key := range m {
+			if key == "" || strings.HasSuffix(key, ".") {
+				t.Errorf("Unexpected key %q with options %+v", key, opts)
+			}
+		}
+	}
+
+	// When allocated, the fields are promoted as usual.
+	val := &NilEmbedder{}
+	testFlatteningWithOptions(t, val, flatjson.Options{NilStructs: flatjson.NilStructAllocate}, flatjson.Map{
+		"ID":       0.0,
+		"Name":     "",
+		"Inner.ID": 0.0,
+		"Inner.X":  0.0,
+	})
+	if val.NilBase == nil || val.Inner.NilBase == nil {
+		t.Error("Expected the embedded pointers to be allocated")
+	}
+
+	// Decoding a promoted field allocates the pointer it is reached through.
+	val = &NilEmbedder{}
+	if err := flatjson.UnmarshalFlat([]byte(`{"ID":1,"Inner.ID":2}`), val); err != nil {
+		t.Fatal(err)
+	}
+	if val.NilBase == nil || val.ID != 1 || val.Inner.NilBase == nil || val.Inner.ID != 2 {
+		t.Errorf("Expected the promoted fields to be decoded, got %+v", val)
+	}
+}
+
+func TestPointerChains(t *testing.T) {
+	type Stats struct{ A int }
+	ptr := func(s *Stats) **Stats { return &s }
+	iface := func(v interface{}) *interface{} { return &v }
+
+	null := flatjson.Map{"F": nil}
+	live := flatjson.Map{"F.A": 1.0}
+	allocated := flatjson.Map{"F.A": 0.0}
+
+	for _, test := range []struct {
+		name                  string
+		val                   func() interface{}
+		null, skip, allocated flatjson.Map
+	}{
+		{"**T", func() interface{} { return &struct{ F **Stats }{ptr(&Stats{1})} }, live, live, live},
+		{"nil **T", func() interface{} { return &struct{ F **Stats }{} }, null, flatjson.Map{}, allocated},
+		{"**T to nil", func() interface{} { return &struct{ F **Stats }{ptr(nil)} }, null, flatjson.Map{}, allocated},
+		{"***int", func() interface{} { return &struct{ F ***int }{} }, null, null, null},
+		{"interface holding *T", func() interface{} { return &struct{ F interface{} }{&Stats{1}} }, live, live, live},
+		{"interface holding T", func() interface{} { return &struct{ F interface{} }{Stats{1}} }, live, live, live},
+		{"interface holding **T", func() interface{} { return &struct{ F interface{} }{ptr(&Stats{1})} }, live, live, live},
+		{"interface holding *interface", func() interface{} { return &struct{ F interface{} }{iface(&Stats{1})} }, live, live, live},
+		{"*interface holding *T", func() interface{} { return &struct{ F *interface{} }{iface(&Stats{1})} }, live, live, live},
+
+		// Pointers held by interfaces can't be allocated.
+		{"interface holding nil *T", func() interface{} { return &struct{ F interface{} }{(*Stats)(nil)} }, null, flatjson.Map{}, null},
+		{"interface holding nil **T", func() interface{} { return &struct{ F interface{} }{(**Stats)(nil)} }, null, flatjson.Map{}, null},
+		{"interface holding *interface holding nil *T", func() interface{} { return &struct{ F interface{} }{iface((*Stats)(nil))} }, null, flatjson.Map{}, null},
+		{"*interface holding nil *T", func() interface{} { return &struct{ F *interface{} }{iface((*Stats)(nil))} }, null, flatjson.Map{}, null},
+
+		// Without a struct type, there's nothing to skip or allocate.
+		{"nil interface", func() interface{} { return &struct{ F interface{} }{} }, null, null, null},
+		{"nil *interface", func() interface{} { return &struct{ F *interface{} }{} }, null, null, null},
+		{"interface holding *interface holding nil", func() interface{} { return &struct{ F interface{} }{iface(nil)} }, null, null, null},
+	} {
+		for _, policy := range []struct {
+			policy   flatjson.NilStructPolicy
+			expected flatjson.Map
+		}{
+			{flatjson.NilStructNull, test.null},
+			{flatjson.NilStructSkip, test.skip},
+			{flatjson.NilStructAllocate, test.allocated},
+		} {
+			flat, err := flatjson.Options{NilStructs: policy.policy}.Flatten(test.val())
+			if err != nil {
+				t.Errorf("Unexpected error for %s: %v", test.name, err)
+				continue
+			}
+			got := jsonView(t, flat)
+			if expected := jsonView(t, policy.expected); !reflect.DeepEqual(got, expected) {
+				t.Errorf("Unexpected result for %s with policy %d:\n     got: %v\nexpected: %v", test.name, policy.policy, got, expected)
+			}
+		}
+	}
+
+	// A struct held by an interface isn't addressable, so it is found again
+	// through the interface.
+	val := &struct{ F interface{} }{Stats{1}}
+	flat := flatjson.Flatten(val)
+	val.F = Stats{2}
+	testEncoding(t, flat, flatjson.Map{"F.A": 2.0})
+	val.F = nil
+	testEncoding(t, flat, flatjson.Map{"F.A": nil})
+}
+
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
+
+type Guarded struct {
+	noCopy noCopy
+	N      int
+}
+
+type Tracker struct {
+	noCopy noCopy
+	seen   map[string]bool
+}
+
+type LockedStats struct {
+	sync.Mutex
+	*sync.RWMutex
+	Mu      sync.Mutex
+	ReadMu  *sync.RWMutex
+	Once    sync.Once
+	WG      sync.WaitGroup
+	Tracker Tracker
+	Guarded Guarded
+	N       int
+	mu      sync.Mutex
+}
+
+func TestLocks(t *testing.T) {
+	val := &LockedStats{RWMutex: &sync.RWMutex{}, N: 1}
+	val.Guarded.N = 2
+
+	// Locks are skipped, while structs holding exported state alongside
+	// them are flattened.
+	testFlattening(t, val, flatjson.Map{"Guarded.N": 2.0, "N": 1.0})
+	testFlatteningWithOptions(t, val, flatjson.Options{IncludeUnexported: true}, flatjson.Map{"Guarded.N": 2.0, "N": 1.0})
+
+	testFlatteningWithOptions(t, val, flatjson.Options{IncludeLocks: true}, flatjson.Map{
+		"Mu":        map[string]interface{}{},
+		"ReadMu":    nil,
+		"Once":      map[string]interface{}{},
+		"WG":        map[string]interface{}{},
+		"Tracker":   map[string]interface{}{},
+		"Guarded.N": 2.0,
+		"N":         1.0,
+	})
+}
+
+func TestEmptyStructs(t *testing.T) {
+	type hidden struct {
+		n int
+	}
+	val := &struct {
+		Started time.Time
+		Marker  struct{}
+		Hidden  hidden
+		N       int
+	}{}
+
+	started := "0001-01-01T00:00:00Z"
+	for _, test := range []struct {
+		policy   flatjson.EmptyStructPolicy
+		expected flatjson.Map
+		flat     flatjson.Map
+	}{
+		{
+			flatjson.EmptyStructLeaf,
+			flatjson.Map{"Started": started, "Marker": map[string]interface{}{}, "Hidden": map[string]interface{}{}, "N": 0.0},
+			flatjson.Map{"Started": started, "Marker": map[string]interface{}{}, "Hidden": map[string]interface{}{}, "N": 0.0},
+		},
+		{
+			flatjson.EmptyStructSkip,
+			flatjson.Map{"Started": started, "N": 0.0},
+			flatjson.Map{"N": 0.0},
+		},
+		{
+			flatjson.EmptyStructLeafIfMarshaler,
+			flatjson.Map{"Started": started, "N": 0.0},
+			flatjson.Map{"Started": started, "N": 0.0},
+		},
+	} {
+		// Marshalers are encoded as a whole before the policy applies,
+		// unless they are flattened too.
+		opts := flatjson.Options{EmptyStructs: test.policy}
+		testFlatteningWithOptions(t, val, opts, test.expected)
+		opts.FlattenMarshalers = true
+		testFlatteningWithOptions(t, val, opts, test.flat)
+	}
+}
+
+func TestCopyValues(t *testing.T) {
+	opts := flatjson.Options{CopyValues: true}
+	val := Child{1, "2"}
+	expected := flatjson.Map{"CC": 1.0, "CD": "2"}
+
+	// A struct passed by value is copied, so the Map doesn't track changes.
+	flat, err := opts.Flatten(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val.C = 10
+	testEncoding(t, flat, expected)
+
+	// The same goes for a struct value stored in an interface.
+	var iface interface{} = val
+	flat, err = opts.Flatten(&iface)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val.C = 20
+	testEncoding(t, flat, flatjson.Map{"CC": 10.0, "CD": "2"})
+
+	// Pointers are still flattened in place.
+	flat, err = opts.Flatten(&val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val.C = 30
+	testEncoding(t, flat, flatjson.Map{"CC": 30.0, "CD": "2"})
+
+	// Without the option, values are an error rather than a reflect panic.
+	if _, err := flatjson.FlattenE(val); err == nil {
+		t.Error("Expected error for struct passed by value")
+	}
+}
+
+type Ring struct {
+	*Ring
+	Name string
+}
+
+func TestCycles(t *testing.T) {
+	// A self-pointing node.
+	self := &Node{Name: "self"}
+	self.Next = self
+	testFlattening(t, self, flatjson.Map{"Name": "self"})
+
+	// A two-node ring.
+	a := &Node{Name: "a"}
+	a.Next = &Node{Name: "b", Next: a}
+	testFlattening(t, a, flatjson.Map{"Name": "a", "Next.Name": "b"})
+
+	// A cycle through an interface.
+	iface := &struct {
+		Name string
+		Next interface{}
+	}{Name: "iface"}
+	iface.Next = iface
+	testFlattening(t, iface, flatjson.Map{"Name": "iface"})
+
+	// A cycle through an embedded field.
+	ring := &Ring{Name: "ring"}
+	ring.Ring = ring
+	testFlattening(t, ring, flatjson.Map{"Name": "ring"})
+
+	// Shared pointers that don't form a cycle are flattened each time.
+	shared := &Child{1, "2"}
+	testFlattening(t, &struct{ A, B *Child }{shared, shared}, flatjson.Map{
+		"A.CC": 1.0,
+		"A.CD": "2",
+		"B.CC": 1.0,
+		"B.CD": "2",
+	})
+}
+
+func TestPrefix(t *testing.T) {
+	val := &struct {
+		Child
+		*Node
+		Pool Pool
+	}{Child: Child{1, "2"}, Node: &Node{Name: "n"}}
+
+	testFlatteningWithOptions(t, val, flatjson.Options{Prefix: "db"}, flatjson.Map{
+		"db.CC":          1.0,
+		"db.CD":          "2",
+		"db.Name":        "n",
+		"db.Next":        nil,
+		"db.Pool.active": 0.0,
+		"db.Pool.idle":   0.0,
+	})
+
+	testFlatteningWithOptions(t, val, flatjson.Options{Prefix: "cache", Separator: "/"}, flatjson.Map{
+		"cache/CC":          1.0,
+		"cache/CD":          "2",
+		"cache/Name":        "n",
+		"cache/Next":        nil,
+		"cache/Pool/active": 0.0,
+		"cache/Pool/idle":   0.0,
+	})
+}
+
+func TestFlattenInto(t *testing.T) {
+	m := flatjson.Map{}
+	db := &Pool{1, 2}
+	cache := &Pool{3, 4}
+
+	if added, err := flatjson.FlattenInto(db, "db", m); added != 2 || err != nil {
+		t.Fatalf("Unexpected result: %d, %v", added, err)
+	}
+	if added, err := flatjson.FlattenInto(cache, "cache", m); added != 2 || err != nil {
+		t.Fatalf("Unexpected result: %d, %v", added, err)
+	}
+
+	expected := flatjson.Map{
+		"db.active":    1.0,
+		"db.idle":      2.0,
+		"cache.active": 3.0,
+		"cache.idle":   4.0,
+	}
+	testEncoding(t, m, expected)
+
+	// Overlapping keys are an error, and leave the Map unchanged.
+	overlap := &struct {
+		Pool  `json:"db"`
+		Other int `json:"other"`
+	}{}
+	added, err := flatjson.FlattenInto(overlap, "", m)
+	if added != 0 || err == nil {
+		t.Errorf("Expected error for overlapping keys, got %d, %v", added, err)
+	} else if err.Error() != "flatjson: duplicate keys: db.active, db.idle" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	testEncoding(t, m, expected)
+
+	// The entries still point into the original structs.
+	db.Active = 10
+	expected["db.active"] = 10.0
+	testEncoding(t, m, expected)
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	tagged := &struct {
+		A struct {
+			B int `json:"b"`
+		} `json:"a"`
+		AB int `json:"a.b"`
+	}{}
+	tagged.A.B = 1
+	tagged.AB = 2
+
+	renamed := &struct {
+		Count int
+		Total int `flatjson:"Count"`
+	}{}
+
+	for _, tt := range []struct {
+		val      interface{}
+		expected string
+	}{
+		{tagged, "flatjson: duplicate keys: a.b"},
+		{renamed, "flatjson: duplicate keys: Count"},
+	} {
+		if m, err := flatjson.FlattenE(tt.val); err == nil {
+			t.Errorf("Expected error for %#v, got %#v", tt.val, m)
+		} else if err.Error() != tt.expected {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		testPanic(t, tt.val)
+	}
+
+	// The keys only collide because of the separator.
+	opts := flatjson.Options{Separator: "_"}
+	testFlatteningWithOptions(t, tagged, opts, flatjson.Map{"a_b": 1.0, "a.b": 2.0})
+
+	// Later entries win when duplicates are allowed.
+	opts = flatjson.Options{AllowDuplicateKeys: true}
+	testFlatteningWithOptions(t, tagged, opts, flatjson.Map{"a.b": 2.0})
+}
+
+func TestUnsupportedFields(t *testing.T) {
+	type Callbacks struct {
+		OnEvent func()
+		Done    chan struct{}
+		Handle  unsafe.Pointer
+		Hooks   []func(int) error
+		Phase   complex128
+		Ratio   *complex64
+		Name    string
+	}
+	r := complex64(1 - 2i)
+	val := &Callbacks{OnEvent: func() {}, Done: make(chan struct{}), Phase: 3 + 4i, Ratio: &r, Name: "a"}
+
+	// The unsupported fields are left out, so the Map can be encoded.
+	flat := flatjson.Flatten(val)
+	if _, err := json.Marshal(flat); err != nil {
+		t.Fatalf("Expected the Map to be encodable, got %v", err)
+	}
+	testFlattening(t, val, flatjson.Map{"Name": "a"})
+
+	opts := flatjson.Options{ComplexObjects: true}
+	testFlatteningWithOptions(t, val, opts, flatjson.Map{
+		"Name":  "a",
+		"Phase": map[string]interface{}{"real": 3.0, "imag": 4.0},
+		"Ratio": map[string]interface{}{"real": 1.0, "imag": -2.0},
+	})
+	val.Ratio = nil
+	testFlatteningWithOptions(t, val, opts, flatjson.Map{
+		"Name":  "a",
+		"Phase": map[string]interface{}{"real": 3.0, "imag": 4.0},
+		"Ratio": nil,
+	})
+
+	opts = flatjson.Options{RejectUnsupported: true}
+	expected := "flatjson: fields of unsupported types: Done, Handle, Hooks, OnEvent, Phase, Ratio"
+	if m, err := opts.Flatten(val); err == nil {
+		t.Errorf("Expected error, got %#v", m)
+	} else if err.Error() != expected {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	opts.ComplexObjects = true
+	expected = "flatjson: fields of unsupported types: Done, Handle, Hooks, OnEvent"
+	if _, err := opts.Flatten(val); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Types with a marshaler are encoded by it.
+	marshaled := &struct {
+		Op  Op
+		Ops []Op
+	}{Op: opRead, Ops: []Op{opRead}}
+	opts = flatjson.Options{RejectUnsupported: true}
+	testFlatteningWithOptions(t, marshaled, opts, flatjson.Map{"Op": "read", "Ops": []interface{}{"read"}})
+}
+
+// Op is a function type with a marshaler.
+type Op func() string
+
+func (op Op) MarshalText() ([]byte, error) { return []byte(op()), nil }
+
+func opRead() string { return "read" }
+
+func TestFieldFilter(t *testing.T) {
+	type Pool struct {
+		Active int    `json:"active"`
+		Name   string `json:"name"`
+		Debug  bool   `json:"debug" metrics:"-"`
+	}
+	val := &struct {
+		Child
+		Pool     Pool    `json:"pool"`
+		Inline   Pool    `json:"inline" flatjson:",inline"`
+		Internal Pool    `json:"internal" metrics:"-"`
+		Ratio    float64 `json:"ratio"`
+	}{Child: Child{1, "a"}, Pool: Pool{Active: 2}, Ratio: 0.5}
+
+	var paths []string
+	byTag := func(path string, field reflect.StructField, v reflect.Value) bool {
+		paths = append(paths, path)
+		return field.Tag.Get("metrics") != "-"
+	}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{Prefix: "db", FieldFilter: byTag})
+	testEncoding(t, flat, flatjson.Map{
+		"db.CC":          1.0,
+		"db.CD":          "a",
+		"db.pool.active": 2.0,
+		"db.pool.name":   "",
+		"db.active":      0.0,
+		"db.name":        "",
+		"db.ratio":       0.5,
+	})
+
+	// Fields of excluded structs aren't visited.
+	expected := []string{
+		"db", "db.CC", "db.CD",
+		"db.pool", "db.pool.active", "db.pool.name", "db.pool.debug",
+		"db", "db.active", "db.name", "db.debug",
+		"db.internal", "db.ratio",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Unexpected paths:\n     got: %v\nexpected: %v", paths, expected)
+	}
+
+	// Structs have to be let through for their fields to be considered.
+	numeric := func(path string, field reflect.StructField, v reflect.Value) bool {
+		switch v.Kind() {
+		case reflect.Struct, reflect.Int, reflect.Float64:
+			return true
+		}
+		return false
+	}
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{FieldFilter: numeric})
+	testEncoding(t, flat, flatjson.Map{
+		"CC":              1.0,
+		"pool.active":     2.0,
+		"active":          0.0,
+		"internal.active": 0.0,
+		"ratio":           0.5,
+	})
+}
+
+// The types below mirror those encoding/json tests its embedded field
+// conflict resolution with.
+type BugA struct{ S string }
+type BugB struct {
+	BugA
+	S string
+}
+type BugC struct{ S string }
+type BugD struct {
+	XXX string `json:"S"`
+}
+
+type BugX struct {
+	A int
+	BugA
+	BugB
+}
+
+type BugY struct {
+	BugA
+	BugD
+}
+
+type BugZ struct {
+	BugA
+	BugC
+	BugY
+}
+
+type Hits struct{ Count int }
+type Misses struct{ Count int }
+type CacheHits struct{ Hits }
+type DiskHits struct{ Hits }
+
+type Chain struct {
+	*Chain
+	N int
+}
+
+func TestEmbeddedConflicts(t *testing.T) {
+	for _, val := range []interface{}{
+		// The shallower field wins.
+		&BugB{BugA{"A"}, "B"},
+		&struct {
+			*BugA
+			BugB
+		}{&BugA{"A"}, BugB{BugA{"BA"}, "B"}},
+		// Equally nested fields are dropped.
+		&BugX{1, BugA{"A"}, BugB{BugA{"BA"}, "B"}},
+		&struct {
+			Hits
+			Misses
+			Other int
+		}{Hits{1}, Misses{2}, 3},
+		// A tagged field wins over untagged ones.
+		&BugY{BugA{"A"}, BugD{"D"}},
+		// But not over shallower ones.
+		&BugZ{BugA{"A"}, BugC{"C"}, BugY{BugA{"YA"}, BugD{"YD"}}},
+		// The same type embedded twice conflicts with itself.
+		&struct {
+			CacheHits
+			DiskHits
+		}{CacheHits{Hits{1}}, DiskHits{Hits{2}}},
+		&struct {
+			CacheHits
+			DiskHits
+			Hits
+		}{CacheHits{Hits{1}}, DiskHits{Hits{2}}, Hits{3}},
+	} {
+		testMatchesEncodingJSON(t, val)
+	}
+
+	// A struct embedding a pointer to its own type only promotes the fields
+	// of the outer struct.
+	opts := flatjson.Options{NilStructs: flatjson.NilStructSkip}
+	testFlatteningWithOptions(t, &Chain{&Chain{nil, 2}, 1}, opts, flatjson.Map{"N": 1.0})
+
+	// Conflicts are resolved within the struct being flattened, so nested
+	// structs resolve their own.
+	testFlattening(t, &struct {
+		Hits
+		Nested BugX
+	}{Hits{1}, BugX{A: 2}}, flatjson.Map{"Count": 1.0, "Nested.A": 2.0})
+
+	// Dropped fields can be reported instead.
+	val := &struct {
+		Hits
+		Nested BugX
+	}{}
+	opts = flatjson.Options{RejectAmbiguousFields: true}
+	if m, err := opts.Flatten(val); err == nil {
+		t.Errorf("Expected error for %#v, got %#v", val, m)
+	} else if err.Error() != "flatjson: ambiguous fields: Nested.S" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+type metrics struct {
+	Hits   int
+	misses int
+}
+
+type level int
+
+func TestEmbeddedUnexported(t *testing.T) {
+	for _, val := range []interface{}{
+		&struct {
+			metrics
+			N int
+		}{metrics{1, 2}, 3},
+		&struct {
+			*metrics
+			N int
+		}{&metrics{1, 2}, 3},
+		&struct {
+			*metrics
+			N int
+		}{nil, 3},
+		&struct {
+			level
+			N int
+		}{1, 3},
+		&struct {
+			State
+			N int
+		}{1, 3},
+	} {
+		testMatchesEncodingJSON(t, val)
+	}
+
+	// Nil pointers can't be allocated through unexported fields.
+	opts := flatjson.Options{NilStructs: flatjson.NilStructAllocate}
+	testFlatteningWithOptions(t, &struct {
+		*metrics
+		N int
+	}{nil, 3}, opts, flatjson.Map{"N": 3.0})
+}
+
+type StatsProvider interface{}
+
+type PluggableServer struct {
+	StatsProvider
+	Name string `json:"name"`
+}
+
+func TestEmbeddedInterface(t *testing.T) {
+	for _, test := range []struct {
+		stats    StatsProvider
+		expected flatjson.Map
+	}{
+		{nil, flatjson.Map{"name": "a"}},
+		{Pool{1, 2}, flatjson.Map{"active": 1.0, "idle": 2.0, "name": "a"}},
+		{&Pool{3, 4}, flatjson.Map{"active": 3.0, "idle": 4.0, "name": "a"}},
+		{(*Pool)(nil), flatjson.Map{"name": "a"}},
+		{5, flatjson.Map{"name": "a"}},
+	} {
+		testFlattening(t, &PluggableServer{test.stats, "a"}, test.expected)
+	}
+
+	// The struct's fields are live, and a Refresh picks up another one.
+	pool := &Pool{1, 2}
+	val := &PluggableServer{pool, "a"}
+	flat := flatjson.Flatten(val)
+	pool.Idle = 3
+	testEncoding(t, flat, flatjson.Map{"active": 1.0, "idle": 3.0, "name": "a"})
+
+	val.StatsProvider = &Pool{4, 5}
+	testEncoding(t, flat, flatjson.Map{"active": 1.0, "idle": 3.0, "name": "a"})
+	flat.Refresh(val)
+	testEncoding(t, flat, flatjson.Map{"active": 4.0, "idle": 5.0, "name": "a"})
+
+	val.StatsProvider = nil
+	if added, removed := flat.Refresh(val); added != 0 || removed != 2 {
+		t.Errorf("Expected 2 keys to be removed, got %d added and %d removed", added, removed)
+	}
+	testEncoding(t, flat, flatjson.Map{"name": "a"})
+
+	val.StatsProvider = Child{6, "b"}
+	if added, removed := flat.Refresh(val); added != 2 || removed != 0 {
+		t.Errorf("Expected 2 keys to be added, got %d added and %d removed", added, removed)
+	}
+	testEncoding(t, flat, flatjson.Map{"CC": 6.0, "CD": "b", "name": "a"})
+}
+
+func TestMaxDepth(t *testing.T) {
+	val := &struct {
+		A     int
+		Child // Embedded fields don't add a level.
+		N     struct{ M struct{ V string } }
+		P     []Point
+	}{A: 1, Child: Child{2, "3"}, P: []Point{{4, 5}}}
+	val.N.M.V = "x"
+
+	// Values at the cutoff are encoded as nested JSON.
+	for _, test := range []struct {
+		depth    int
+		expected flatjson.Map
+	}{
+		{0, flatjson.Map{
+			"A":     1.0,
+			"CC":    2.0,
+			"CD":    "3",
+			"N.M.V": "x",
+			"P.0.X": 4.0,
+			"P.0.Y": 5.0,
+		}},
+		{1, flatjson.Map{
+			"A":  1.0,
+			"CC": 2.0,
+			"CD": "3",
+			"N":  map[string]interface{}{"M": map[string]interface{}{"V": "x"}},
+			"P":  []interface{}{map[string]interface{}{"X": 4.0, "Y": 5.0}},
+		}},
+		{2, flatjson.Map{
+			"A":   1.0,
+			"CC":  2.0,
+			"CD":  "3",
+			"N.M": map[string]interface{}{"V": "x"},
+			"P.0": map[string]interface{}{"X": 4.0, "Y": 5.0},
+		}},
+	} {
+		opts := flatjson.Options{IndexSlices: true, MaxDepth: test.depth}
+		testFlatteningWithOptions(t, val, opts, test.expected)
+	}
+
+	// The prefix doesn't count towards the depth.
+	opts := flatjson.Options{IndexSlices: true, MaxDepth: 2, Prefix: "p"}
+	testFlatteningWithOptions(t, val, opts, flatjson.Map{
+		"p.A":   1.0,
+		"p.CC":  2.0,
+		"p.CD":  "3",
+		"p.N.M": map[string]interface{}{"V": "x"},
+		"p.P.0": map[string]interface{}{"X": 4.0, "Y": 5.0},
+	})
+
+	// Values at the cutoff point into the struct, so later changes to
+	// them are encoded.
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{MaxDepth: 1})
+	val.N.M.V = "y"
+	val.P[0].X = 6
+	testEncoding(t, flat, flatjson.Map{
+		"A":  1.0,
+		"CC": 2.0,
+		"CD": "3",
+		"N":  map[string]interface{}{"M": map[string]interface{}{"V": "y"}},
+		"P":  []interface{}{map[string]interface{}{"X": 6.0, "Y": 5.0}},
+	})
+}
+
+func TestNoFlatten(t *testing.T) {
+	val := &struct {
+		Labels struct{ Env, Region string } `flatjson:"labels,noflatten"`
+		Child  `json:",noflatten"`
+		Pool   Pool
+		Points []Point `flatjson:",noflatten"`
+	}{Points: []Point{{1, 2}}}
+	val.Labels.Env = "prod"
+
+	opts := flatjson.Options{IndexSlices: true}
+	testFlatteningWithOptions(t, val, opts, flatjson.Map{
+		"labels":      map[string]interface{}{"Env": "prod", "Region": ""},
+		"Child":       map[string]interface{}{"CC": 0.0, "CD": ""},
+		"Pool.active": 0.0,
+		"Pool.idle":   0.0,
+		"Points":      []interface{}{map[string]interface{}{"X": 1.0, "Y": 2.0}},
+	})
+}
+
+type CommonStats struct {
+	Requests int
+	Errors   int  `json:",omitempty"`
+	Pool     Pool `flatjson:",inline"`
+}
+
+func TestInline(t *testing.T) {
+	val := &struct {
+		Common CommonStats  `flatjson:",inline"`
+		Extra  *CommonStats `json:"extra,inline,omitempty"`
+		Name   string
+	}{Name: "a"}
+	val.Common.Pool.Active = 1
+
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{
+		"Requests": 0.0,
+		"active":   1.0,
+		"idle":     0.0,
+		"Name":     "a",
+	})
+
+	// Omitted fields of inlined structs are evaluated at marshal time like
+	// any other.
+	val.Common.Errors = 2
+	testEncoding(t, flat, flatjson.Map{
+		"Requests": 0.0,
+		"Errors":   2.0,
+		"active":   1.0,
+		"idle":     0.0,
+		"Name":     "a",
+	})
+
+	// Keys from inlined structs can collide just like tagged ones.
+	val.Extra = &CommonStats{}
+	if m, err := flatjson.FlattenE(val); err == nil {
+		t.Errorf("Expected error for %#v, got %#v", val, m)
+	} else if err.Error() != "flatjson: duplicate keys: Errors, Requests, active, idle" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	db := &Pool{1, 2}
+	cache := &Pool{3, 4}
+	server := &Child{5, "6"}
+
+	m, err := flatjson.Compose(map[string]interface{}{
+		"db":     db,
+		"cache":  cache,
+		"":       server,
+		"absent": (*Pool)(nil),
+		"none":   nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := flatjson.Map{
+		"db.active":    1.0,
+		"db.idle":      2.0,
+		"cache.active": 3.0,
+		"cache.idle":   4.0,
+		"CC":           5.0,
+		"CD":           "6",
+	}
+	testEncoding(t, m, expected)
+
+	// The Map points into each of the parts.
+	cache.Idle = 10
+	expected["cache.idle"] = 10.0
+	testEncoding(t, m, expected)
+
+	// Options apply to every part.
+	opts := flatjson.Options{Prefix: "app", Separator: "_"}
+	m, err = opts.Compose(map[string]interface{}{"db": db, "": server})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncoding(t, m, flatjson.Map{"app_db_active": 1.0, "app_db_idle": 2.0, "app_CC": 5.0, "app_CD": "6"})
+
+	// Parts can't overlap.
+	overlap := &struct {
+		Active int `json:"db.active"`
+	}{}
+	if m, err := flatjson.Compose(map[string]interface{}{"db": db, "": overlap}); err == nil {
+		t.Errorf("Expected error for overlapping parts, got %#v", m)
+	} else if err.Error() != "flatjson: duplicate keys: db.active" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if m, err := flatjson.Compose(map[string]interface{}{"db": *db}); err == nil {
+		t.Errorf("Expected error for a struct value, got %#v", m)
+	}
+}
+
 func testPanic(t *testing.T, val interface{}) {
 	defer func() {
 		if recover() == nil {
@@ -121,8 +1406,14 @@ func testPanic(t *testing.T, val interface{}) {
 }
 
 func testFlattening(t *testing.T, val interface{}, expected flatjson.Map) {
-	flat := flatjson.Flatten(val)
+	testFlatteningWithOptions(t, val, flatjson.Options{}, expected)
+}
+
+func testFlatteningWithOptions(t *testing.T, val interface{}, opts flatjson.Options, expected flatjson.Map) {
+	testEncoding(t, flatjson.FlattenWithOptions(val, opts), expected)
+}
 
+func testEncoding(t *testing.T, flat flatjson.Map, expected flatjson.Map) {
 	enc, err := json.Marshal(flat)
 	if err != nil {
 		t.Fatal(err)
@@ -138,3 +1429,146 @@ func testFlattening(t *testing.T, val interface{}, expected flatjson.Map) {
 		t.Errorf("Unmarshalled to unexpected value:\n     got: %#v\nexpected: %#v\n", got, expected)
 	}
 }
+
+type ConnStats struct {
+	CommonStats
+	Remote   string `json:"remote"`
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+	Latency  struct {
+		Min, Max, Mean float64
+	} `json:"latency"`
+	Pools []Pool `json:"pools"`
+	Child *Child `json:"child,omitempty"`
+}
+
+func BenchmarkFlatten(b *testing.B) {
+	val := &ConnStats{Child: &Child{}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		flatjson.Flatten(val)
+	}
+}
+
+// DeepStats has 50 fields nested 4 levels deep.
+type DeepStats struct {
+	Read, Write DeepLevel2
+}
+
+type DeepLevel2 struct {
+	Hits, Misses DeepLevel3
+	A, B, C, D   int
+	Label        string
+}
+
+type DeepLevel3 struct {
+	Latency DeepLevel4
+	Count   int64
+	Errors  int64
+	Ratio   float64
+	Up      bool
+	Name    string `json:"name"`
+}
+
+type DeepLevel4 struct {
+	Min, Max, Mean, P50, P99 float64
+}
+
+func TestDeepKeys(t *testing.T) {
+	for _, sep := range []string{".", "::"} {
+		var expected []string
+		for _, a := range []string{"Read", "Write"} {
+			for _, b := range []string{"Hits", "Misses"} {
+				for _, c := range []string{"Min", "Max", "Mean", "P50", "P99"} {
+					expected = append(expected, a+sep+b+sep+"Latency"+sep+c)
+				}
+				for _, c := range []string{"Count", "Errors", "Ratio", "Up", "name"} {
+					expected = append(expected, a+sep+b+sep+c)
+				}
+			}
+			for _, b := range []string{"A", "B", "C", "D", "Label"} {
+				expected = append(expected, a+sep+b)
+			}
+		}
+		sort.Strings(expected)
+
+		flat := flatjson.FlattenWithOptions(&DeepStats{}, flatjson.Options{Separator: sep})
+		if keys := flat.Keys(""); !reflect.DeepEqual(keys, expected) {
+			t.Errorf("Unexpected keys with separator %q:\n     got: %q\nexpected: %q", sep, keys, expected)
+		}
+	}
+}
+
+func BenchmarkFlattenDeep(b *testing.B) {
+	val := &DeepStats{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		flatjson.Flatten(val)
+	}
+}
+
+func TestPlanCache(t *testing.T) {
+	type Fresh struct {
+		ConnStats
+		HTTPServer struct{ MaxConns int }
+		Next       *Fresh `json:",omitempty"`
+	}
+	val := &Fresh{}
+
+	// The first flattening of a type builds its plan, concurrently here, and
+	// later ones reuse it.
+	maps := make([]flatjson.Map, 8)
+	var wg sync.WaitGroup
+	for i := range maps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			maps[i] = flatjson.Flatten(val)
+		}(i)
+	}
+	wg.Wait()
+	maps = append(maps, flatjson.Flatten(val))
+
+	expected := flatjson.Map{
+		"Requests":            0.0,
+		"active":              0.0,
+		"idle":                0.0,
+		"remote":              "",
+		"bytes_in":            0.0,
+		"bytes_out":           0.0,
+		"latency.Min":         0.0,
+		"latency.Max":         0.0,
+		"latency.Mean":        0.0,
+		"pools":               nil,
+		"HTTPServer.MaxConns": 0.0,
+	}
+	for _, m := range maps {
+		testEncoding(t, m, expected)
+	}
+
+	// Options affecting the keys use their own plans.
+	testEncoding(t, flatjson.FlattenWithOptions(val, flatjson.Options{KeyCase: flatjson.KeyCaseSnake, Separator: "/"}), flatjson.Map{
+		"requests":              0.0,
+		"active":                0.0,
+		"idle":                  0.0,
+		"remote":                "",
+		"bytes_in":              0.0,
+		"bytes_out":             0.0,
+		"latency/min":           0.0,
+		"latency/max":           0.0,
+		"latency/mean":          0.0,
+		"pools":                 nil,
+		"http_server/max_conns": 0.0,
+	})
+
+	// Nil pointers are still followed once they are set.
+	val.Next = &Fresh{}
+	val.Child = &Child{}
+	flat := flatjson.Flatten(val)
+	if _, ok := flat["Next.HTTPServer.MaxConns"]; !ok {
+		t.Errorf("Missing entry for the nested struct: %v", flat)
+	}
+	if _, ok := flat["child.CC"]; !ok {
+		t.Errorf("Missing entry for the child: %v", flat)
+	}
+}
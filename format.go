@@ -0,0 +1,288 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Values for Options.TimeFormat which encode times as numbers.
+const (
+	TimeUnix      = "unix"      // Seconds since the Unix epoch.
+	TimeUnixMilli = "unixmilli" // Milliseconds since the Unix epoch.
+	TimeUnixNano  = "unixnano"  // Nanoseconds since the Unix epoch.
+)
+
+// A DurationFormat determines how time.Duration values are encoded.
+type DurationFormat int
+
+const (
+	// DurationNanos encodes durations as an integer number of nanoseconds.
+	DurationNanos DurationFormat = iota
+
+	// DurationString encodes durations as the string returned by
+	// time.Duration.String, like "1.5s".
+	DurationString
+
+	// DurationSeconds encodes durations as a floating point number of
+	// seconds.
+	DurationSeconds
+
+	// DurationMillis encodes durations as an integer number of milliseconds,
+	// truncated towards zero.
+	DurationMillis
+)
+
+// durationFormats maps the values of the durfmt tag option to formats.
+var durationFormats = map[string]DurationFormat{
+	"string": DurationString,
+	"s":      DurationSeconds,
+	"ms":     DurationMillis,
+	"ns":     DurationNanos,
+}
+
+// A BytesFormat determines how []byte values are encoded.
+type BytesFormat int
+
+const (
+	// BytesBase64 encodes bytes as a base64 string, as encoding/json does.
+	BytesBase64 BytesFormat = iota
+
+	// BytesHex encodes bytes as a string of lowercase hexadecimal digits.
+	BytesHex
+
+	// BytesString encodes bytes as a string holding them as they are. As
+	// with any other string, bytes that aren't valid UTF-8 are replaced by
+	// the replacement character U+FFFD, so such values don't round-trip.
+	BytesString
+)
+
+// bytesFormats maps the tag options choosing a BytesFormat to formats.
+var bytesFormats = map[string]BytesFormat{
+	"base64":    BytesBase64,
+	"hex":       BytesHex,
+	"rawstring": BytesString,
+}
+
+// bytesTag returns the tag option in opts choosing a BytesFormat, if any.
+func bytesTag(opts tagOptions) string {
+	for _, name := range []string{"hex", "rawstring", "base64"} {
+		if opts.Contains(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// isBytes reports whether t is a slice of bytes, or a pointer to one, which
+// encoding/json encodes as a base64 string.
+func isBytes(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && !isMarshaler(t) && !isMarshaler(t.Elem())
+}
+
+// formatBytes returns the encoding of v, a slice of bytes or a pointer to one,
+// according to format. A nil slice is encoded as null, and an empty one as an
+// empty string.
+func formatBytes(v reflect.Value, format BytesFormat) ([]byte, error) {
+	v = indirectValue(v)
+	if !v.IsValid() || v.IsNil() {
+		return []byte("null"), nil
+	}
+
+	switch format {
+	case BytesHex:
+		return json.Marshal(hex.EncodeToString(v.Bytes()))
+	case BytesString:
+		return json.Marshal(string(v.Bytes()))
+	}
+	return json.Marshal(v.Bytes())
+}
+
+// A NonFinitePolicy determines how NaN and infinite float values are encoded,
+// which have no JSON representation.
+type NonFinitePolicy int
+
+const (
+	// NonFiniteError fails to encode the Map, as encoding/json does.
+	NonFiniteError NonFinitePolicy = iota
+
+	// NonFiniteNull encodes the value as null.
+	NonFiniteNull
+
+	// NonFiniteZero encodes the value as 0.
+	NonFiniteZero
+
+	// NonFiniteString encodes the value as one of the strings "NaN", "+Inf"
+	// and "-Inf".
+	NonFiniteString
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// isTime reports whether t is time.Time or a pointer to it.
+func isTime(t reflect.Type) bool {
+	return t == timeType || t.Kind() == reflect.Ptr && t.Elem() == timeType
+}
+
+// isDuration reports whether t is time.Duration or a pointer to it.
+func isDuration(t reflect.Type) bool {
+	return t == durationType || t.Kind() == reflect.Ptr && t.Elem() == durationType
+}
+
+// isInt64 reports whether t has an int64 kind, or is a pointer to such a type.
+func isInt64(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Int64
+}
+
+// formatDuration returns the value d is encoded as according to format.
+func formatDuration(d time.Duration, format DurationFormat) interface{} {
+	switch format {
+	case DurationString:
+		return d.String()
+	case DurationSeconds:
+		return d.Seconds()
+	case DurationMillis:
+		return int64(d / time.Millisecond)
+	}
+	return int64(d)
+}
+
+// formatTime returns the value t is encoded as according to layout, a
+// TimeFormat.
+func formatTime(t time.Time, layout string) interface{} {
+	switch layout {
+	case TimeUnix:
+		return t.Unix()
+	case TimeUnixMilli:
+		return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+	case TimeUnixNano:
+		return t.UnixNano()
+	}
+	return t.Format(layout)
+}
+
+// isFloat reports whether t has a float kind, or is a pointer to such a type,
+// and is encoded by encoding/json as a number.
+func isFloat(t reflect.Type) bool {
+	if isMarshaler(t) {
+		return false
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+// formatFloat returns the encoding of v, a float or a pointer to one, rounded
+// to precision significant digits. The rounded value is encoded like any other
+// float, so it only uses an exponent if encoding/json would. It returns false
+// if v is nil, NaN or infinite.
+func formatFloat(v reflect.Value, precision int) ([]byte, bool) {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil, false
+	}
+
+	f, bits := v.Float(), v.Type().Bits()
+	var buf [32]byte
+	if r, err := strconv.ParseFloat(string(strconv.AppendFloat(buf[:0], f, 'g', precision, bits)), bits); err == nil {
+		f = r
+	}
+	return appendFloat(nil, f, bits)
+}
+
+// formatOptions are the rules for formatting values as text on which the
+// exporters differ. The zero value gives the rules most of them use.
+type formatOptions struct {
+	precision   int  // The significant digits floats are rounded to, if positive.
+	boolNumbers bool // Booleans are formatted as 1 and 0, for metric backends.
+}
+
+// textOptions returns the formatOptions for the Map value v, which round
+// floats to the Options.FloatPrecision it was flattened with, as its JSON
+// encoding does.
+func textOptions(v interface{}) formatOptions {
+	if e, ok := v.(*entry); ok {
+		return formatOptions{precision: e.precision}
+	}
+	return formatOptions{}
+}
+
+// formatValue formats v, a string, boolean or number, as text, the same way
+// for every exporter and for Strings, so that their output can be parsed the
+// same way. Integers and floats are never formatted with an exponent: floats
+// use as few digits as represent them exactly, so that 1e7 is formatted as
+// 10000000, after rounding them to o.precision significant digits if it is
+// set. Booleans are formatted as true and false unless o.boolNumbers is set.
+// It returns false for values of other kinds, including NaN and infinite
+// floats, whose form depends on the format.
+func formatValue(v reflect.Value, o formatOptions) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		switch {
+		case !o.boolNumbers:
+			return strconv.FormatBool(v.Bool()), true
+		case v.Bool():
+			return "1", true
+		}
+		return "0", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		f, bits := v.Float(), v.Type().Bits()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", false
+		}
+		if o.precision > 0 {
+			if r, err := strconv.ParseFloat(strconv.FormatFloat(f, 'g', o.precision, bits), bits); err == nil {
+				f = r
+			}
+		}
+		return strconv.FormatFloat(f, 'f', -1, bits), true
+	}
+	return "", false
+}
+
+// formatNonFinite returns the encoding of v, a float or a pointer to one,
+// according to policy if it is NaN or infinite. It returns false if v is
+// finite or nil, or if policy is NonFiniteError.
+func formatNonFinite(v reflect.Value, policy NonFinitePolicy) ([]byte, bool) {
+	v = indirectValue(v)
+	if policy == NonFiniteError || !v.IsValid() {
+		return nil, false
+	}
+
+	switch f := v.Float(); {
+	case !math.IsNaN(f) && !math.IsInf(f, 0):
+		return nil, false
+	case policy == NonFiniteNull:
+		return []byte("null"), true
+	case policy == NonFiniteZero:
+		return []byte("0"), true
+	case math.IsNaN(f):
+		return []byte(`"NaN"`), true
+	case f > 0:
+		return []byte(`"+Inf"`), true
+	}
+	return []byte(`"-Inf"`), true
+}
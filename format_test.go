@@ -0,0 +1,124 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+// textExporters return the values each text exporter writes for a Map, by
+// key, for the Maps of formatStats.
+var textExporters = map[string]func(m flatjson.Map) (map[string]string, error){
+	"Graphite": func(m flatjson.Map) (map[string]string, error) {
+		var buf bytes.Buffer
+		err := m.WriteGraphite(&buf, "", time.Unix(0, 0))
+		return splitLines(buf.String(), " ", func(line string) string { return strings.TrimSuffix(line, " 0") }), err
+	},
+	"Statsd": func(m flatjson.Map) (map[string]string, error) {
+		var buf bytes.Buffer
+		err := m.WriteStatsd(&buf, "")
+		return splitLines(buf.String(), ":", func(line string) string { return strings.TrimSuffix(line, "|g") }), err
+	},
+	"Prometheus": func(m flatjson.Map) (map[string]string, error) {
+		var buf bytes.Buffer
+		err := m.WritePrometheus(&buf, "")
+		return splitLines(buf.String(), " ", func(line string) string {
+			if strings.HasPrefix(line, "#") {
+				return ""
+			}
+			return line
+		}), err
+	},
+	"CSV": func(m flatjson.Map) (map[string]string, error) {
+		var buf bytes.Buffer
+		if err := flatjson.NewCSVWriter(&buf, m).WriteRow(); err != nil {
+			return nil, err
+		}
+		rows, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]string{}
+		for i, key := range rows[0] {
+			values[key] = rows[1][i]
+		}
+		return values, nil
+	},
+	"Env": func(m flatjson.Map) (map[string]string, error) {
+		var buf bytes.Buffer
+		err := m.WriteEnv(&buf, "")
+		return splitLines(strings.ToLower(buf.String()), "=", nil), err
+	},
+	"Query": func(m flatjson.Map) (map[string]string, error) {
+		values := map[string]string{}
+		for key, v := range m.QueryValues() {
+			values[key] = v[0]
+		}
+		return values, nil
+	},
+	"Logfmt": func(m flatjson.Map) (map[string]string, error) {
+		text, err := m.MarshalText()
+		return splitLines(strings.Replace(string(text), " ", "\n", -1), "=", nil), err
+	},
+	"Strings": func(m flatjson.Map) (map[string]string, error) {
+		return m.Strings(false), nil
+	},
+}
+
+// splitLines splits each line of text, after passing it through trim if it
+// isn't nil, into a key and a value at the first occurrence of sep.
+func splitLines(text, sep string, trim func(string) string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if trim != nil {
+			line = trim(line)
+		}
+		if i := strings.Index(line, sep); i >= 0 {
+			values[line[:i]] = line[i+len(sep):]
+		}
+	}
+	return values
+}
+
+type formatStats struct {
+	Big   float64 `json:"big"`
+	Count int64   `json:"count"`
+	Ratio float32 `json:"ratio"`
+	Tiny  float64 `json:"tiny"`
+	Third float64 `json:"third"`
+}
+
+func TestTextExportersAgree(t *testing.T) {
+	val := &formatStats{Big: 1e7, Count: 12345678901, Ratio: 0.25, Tiny: 1e-7, Third: 1.0 / 3}
+
+	tests := []struct {
+		opts     flatjson.Options
+		expected map[string]string
+	}{
+		{flatjson.Options{}, map[string]string{
+			"big": "10000000", "count": "12345678901", "ratio": "0.25", "tiny": "0.0000001", "third": "0.3333333333333333",
+		}},
+		{flatjson.Options{FloatPrecision: 3}, map[string]string{
+			"big": "10000000", "count": "12345678901", "ratio": "0.25", "tiny": "0.0000001", "third": "0.333",
+		}},
+	}
+
+	for _, tt := range tests {
+		flat := flatjson.FlattenWithOptions(val, tt.opts)
+		for name, export := range textExporters {
+			values, err := export(flat)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("%s with precision %d: unexpected values:\n     got: %v\nexpected: %v", name, tt.opts.FloatPrecision, values, tt.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+// Package gen generates Go source describing the Maps flatjson produces for a
+// struct type: a constant for each key, and optionally a function building
+// the Map without reflection. It is used by the flatjsongen command, which
+// runs it in a program importing the package declaring the type, since the
+// keys come from flattening the type itself, with the same rules as Flatten.
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pushrax/flatjson"
+)
+
+// Config describes the code to generate.
+type Config struct {
+	// Type is the struct type to generate the code for.
+	Type reflect.Type
+
+	// Options are the options the type is flattened with.
+	Options flatjson.Options
+
+	// Func, if set, generates a function named after the type, such as
+	// FlattenServer, taking a pointer to it and returning the same Map as
+	// FlattenWithOptions. This is only possible if every entry of the Map
+	// points at a field of the struct, so that flattening doesn't depend on
+	// the values: there must be no fields tagged with omitempty or other
+	// options affecting the entries, no pointers to structs, and no maps,
+	// slices or interfaces which would be flattened themselves.
+	Func bool
+
+	// Command is the command line recorded in the generated file's header.
+	Command string
+}
+
+// initialisms are the words written in upper case in constant names, as in
+// the names of Go identifiers.
+var initialisms = map[string]bool{
+	"API": true, "CPU": true, "DB": true, "DNS": true, "HTTP": true,
+	"HTTPS": true, "ID": true, "IO": true, "IP": true, "JSON": true,
+	"RPC": true, "SQL": true, "TCP": true, "TLS": true, "TTL": true,
+	"UDP": true, "UI": true, "URI": true, "URL": true, "UUID": true,
+}
+
+// Generate returns the gofmted source of a file in the package declaring
+// c.Type, holding the code described by c. An error is returned if the type
+// isn't a named struct type, if it can't be flattened, if two keys would get
+// the same constant name, or if c.Func is set and the Map can't be built
+// without reflection.
+func Generate(c Config) ([]byte, error) {
+	t := c.Type
+	if t == nil || t.Kind() != reflect.Struct || t.Name() == "" || t.PkgPath() == "" {
+		return nil, fmt.Errorf("gen: %v is not a named struct type", t)
+	}
+	pkg := strings.TrimSuffix(t.String(), "."+t.Name())
+
+	keys, err := c.Options.Keys(t)
+	if err != nil {
+		return nil, err
+	}
+	names, err := constNames(c.Options, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var selectors map[string]string
+	if c.Func {
+		if selectors, err = fieldSelectors(c.Options, t); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by %s; DO NOT EDIT.\n\n", c.Command)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if c.Func {
+		fmt.Fprintf(&buf, "import %q\n\n", "github.com/pushrax/flatjson")
+	}
+
+	fmt.Fprintf(&buf, "// The keys of the Maps produced by flattening %s values.\n", t.Name())
+	buf.WriteString("const (\n")
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s = %q\n", names[key], key)
+	}
+	buf.WriteString(")\n")
+
+	if c.Func {
+		fmt.Fprintf(&buf, "\n// Flatten%s returns the Map flattening v produces, without reflection.\n", t.Name())
+		fmt.Fprintf(&buf, "func Flatten%s(v *%s) flatjson.Map {\n", t.Name(), t.Name())
+		buf.WriteString("return flatjson.Map{\n")
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "%s: &v.%s,\n", names[key], selectors[key])
+		}
+		buf.WriteString("}\n}\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("gen: formatting the generated code: %v", err)
+	}
+	return src, nil
+}
+
+// constNames returns the names of the constants for keys: Key followed by the
+// words of the key's segments, each capitalized, so that db.pool.max_conns
+// becomes KeyDBPoolMaxConns.
+func constNames(opts flatjson.Options, keys []string) (map[string]string, error) {
+	names := map[string]string{}
+	byName := map[string]string{}
+	for _, key := range keys {
+		name := "Key"
+		for _, segment := range opts.SplitKey(key) {
+			for _, word := range strings.FieldsFunc(segment, isSeparator) {
+				name += capitalize(word)
+			}
+		}
+		if other, ok := byName[name]; ok {
+			return nil, fmt.Errorf("gen: keys %q and %q would both be named %s", other, key, name)
+		}
+		names[key], byName[name] = name, key
+	}
+	return names, nil
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// capitalize returns word with its first letter in upper case, or all of it
+// if it's an initialism.
+func capitalize(word string) string {
+	if upper := strings.ToUpper(word); initialisms[upper] {
+		return upper
+	}
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// fieldSelectors returns the selectors, relative to a value of t, of the fields
+// the entries for the keys of t point at, or an error listing the keys whose
+// entries don't point at fields.
+func fieldSelectors(opts flatjson.Options, t reflect.Type) (map[string]string, error) {
+	tks, err := opts.TypeKeys(t)
+	if err != nil {
+		return nil, err
+	}
+	val := reflect.New(t)
+	m, err := opts.Flatten(val.Interface())
+	if err != nil {
+		return nil, err
+	}
+	opts.RecordMeta = true
+	metas := flatjson.FlattenWithOptions(val.Interface(), opts).Metas()
+
+	selectors := map[string]string{}
+	var problems []string
+	for _, tk := range tks {
+		meta, ok := metas[tk.Key]
+		if tk.Optional || !ok || !pointsAtField(val.Elem(), meta, m[tk.Key]) {
+			problems = append(problems, tk.Key)
+			continue
+		}
+		selectors[tk.Key] = strings.Join(meta.Path, ".")
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("gen: can't flatten %s without reflection because of the entries for %s", t, strings.Join(problems, ", "))
+	}
+	return selectors, nil
+}
+
+// pointsAtField reports whether value, the entry in a Map flattened from v, is
+// a pointer to the field of v described by meta, which is reached without
+// going through any pointers.
+func pointsAtField(v reflect.Value, meta flatjson.FieldMeta, value interface{}) bool {
+	for _, i := range meta.Index {
+		if v.Kind() != reflect.Struct {
+			return false
+		}
+		v = v.Field(i)
+	}
+	ptr := reflect.ValueOf(value)
+	return ptr.Kind() == reflect.Ptr && ptr.Type() == reflect.PtrTo(v.Type()) && ptr.Pointer() == v.UnsafeAddr()
+}
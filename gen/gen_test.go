@@ -0,0 +1,136 @@
+package gen_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+	"github.com/pushrax/flatjson/gen"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+type Pool struct {
+	Active   int `json:"active"`
+	Idle     int `json:"idle"`
+	MaxConns int `json:"max_conns"`
+}
+
+type Common struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+type Server struct {
+	Common
+	Name string `json:"name"`
+	DB   struct {
+		Pool Pool
+		URL  string `json:"url"`
+	} `json:"db"`
+	Listen  Pool   `json:"listen" flatjson:"conns"`
+	Secret  string `json:"-"`
+	private int
+	Ignored int `flatjson:"-"`
+}
+
+type Optional struct {
+	Name  string `json:"name,omitempty"`
+	Pool  *Pool  `json:"pool"`
+	Count int    `json:"count"`
+}
+
+func TestGenerate(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		c    gen.Config
+	}{
+		{"server", gen.Config{Type: reflect.TypeOf(Server{}), Command: "flatjsongen -type Server"}},
+		{"server-func", gen.Config{Type: reflect.TypeOf(Server{}), Func: true, Command: "flatjsongen -type Server -func"}},
+		{"server-options", gen.Config{
+			Type:    reflect.TypeOf(Server{}),
+			Options: flatjson.Options{Prefix: "app", Separator: "/"},
+			Func:    true,
+			Command: "flatjsongen -type Server -func -sep / -prefix app",
+		}},
+		{"optional", gen.Config{Type: reflect.TypeOf(Optional{}), Command: "flatjsongen -type Optional"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src, err := gen.Generate(test.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, filepath.Join("testdata", test.name+".golden"), src)
+		})
+	}
+}
+
+// TestGenerateFuncMatches checks that the generated function builds the same
+// Map as flattening, by repeating the code in server-func.golden.
+func TestGenerateFuncMatches(t *testing.T) {
+	v := &Server{Name: "a"}
+	v.DB.Pool.Active = 2
+	static := flatjson.Map{
+		"conns.active":      &v.Listen.Active,
+		"conns.idle":        &v.Listen.Idle,
+		"conns.max_conns":   &v.Listen.MaxConns,
+		"db.Pool.active":    &v.DB.Pool.Active,
+		"db.Pool.idle":      &v.DB.Pool.Idle,
+		"db.Pool.max_conns": &v.DB.Pool.MaxConns,
+		"db.url":            &v.DB.URL,
+		"errors":            &v.Common.Errors,
+		"name":              &v.Name,
+		"requests":          &v.Common.Requests,
+	}
+	if flat := flatjson.Flatten(v); !reflect.DeepEqual(flat, static) {
+		t.Errorf("Unexpected Map %v, expected %v", flat, static)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, test := range []struct {
+		c   gen.Config
+		err string
+	}{
+		{gen.Config{Type: reflect.TypeOf(0)}, "not a named struct type"},
+		{gen.Config{Type: reflect.TypeOf(struct{ A int }{})}, "not a named struct type"},
+		{gen.Config{Type: reflect.TypeOf(Optional{}), Func: true}, "because of the entries for name, pool.active, pool.idle, pool.max_conns"},
+		{gen.Config{Type: reflect.TypeOf(Colliding{})}, `keys "a.b" and "a_b" would both be named KeyAB`},
+	} {
+		_, err := gen.Generate(test.c)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Expected error containing %q for %v, got %v", test.err, test.c.Type, err)
+		}
+	}
+}
+
+type Colliding struct {
+	AB int `json:"a_b"`
+	A  struct {
+		B int `json:"b"`
+	} `json:"a"`
+}
+
+// compareGolden compares got to the contents of the golden file at path,
+// which is written instead with -update.
+func compareGolden(t *testing.T, path string, got []byte) {
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Output differs from %s:\n     got: %s\nexpected: %s", path, got, expected)
+	}
+}
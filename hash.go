@@ -0,0 +1,141 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"math"
+	"reflect"
+)
+
+// Hash returns a 64-bit FNV-1a hash of the keys of m and their current values,
+// which can be compared with a previous hash to tell whether anything changed
+// without encoding the Map. The hash only depends on the values themselves, not
+// on where they are stored, so it is the same across calls and processes for
+// equal values, but it is not meant to be secure.
+//
+// Values are hashed by kind: strings, booleans and numbers by value, where all
+// NaNs hash the same and negative zero hashes like zero; pointers and
+// interfaces by what they hold; slices, arrays and structs, including their
+// unexported fields, element by element; and maps independently of their
+// iteration order. Channels, functions and unsafe pointers only contribute
+// whether they are nil. Pointers nested more than 100 levels deep, such as
+// those forming a cycle, aren't followed any further.
+func (m Map) Hash() uint64 {
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	h := newHasher()
+	for _, key := range *keys {
+		h.string(key)
+		h.value(resolve(m[key]), 0)
+	}
+	return uint64(h)
+}
+
+const maxHashDepth = 100
+
+// hasher is an FNV-1a hash, which is implemented here rather than with
+// hash/fnv so that no allocations are needed.
+type hasher uint64
+
+func newHasher() hasher {
+	return 14695981039346656037
+}
+
+func (h *hasher) byte(b byte) {
+	*h ^= hasher(b)
+	*h *= 1099511628211
+}
+
+func (h *hasher) uint64(u uint64) {
+	for i := 0; i < 8; i++ {
+		h.byte(byte(u))
+		u >>= 8
+	}
+}
+
+func (h *hasher) float64(f float64) {
+	switch {
+	case math.IsNaN(f):
+		f = math.NaN()
+	case f == 0:
+		f = 0
+	}
+	h.uint64(math.Float64bits(f))
+}
+
+func (h *hasher) string(s string) {
+	h.uint64(uint64(len(s)))
+	for i := 0; i < len(s); i++ {
+		h.byte(s[i])
+	}
+}
+
+func (h *hasher) value(v reflect.Value, depth int) {
+	if !v.IsValid() {
+		h.byte(0)
+		return
+	}
+	h.byte(byte(v.Kind()))
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.byte(1)
+		} else {
+			h.byte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		h.uint64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		h.uint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		h.float64(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		h.float64(real(v.Complex()))
+		h.float64(imag(v.Complex()))
+	case reflect.String:
+		h.string(v.String())
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			h.byte(0)
+		} else if depth < maxHashDepth {
+			h.byte(1)
+			h.value(v.Elem(), depth+1)
+		}
+
+	case reflect.Slice, reflect.Array:
+		h.uint64(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			h.value(v.Index(i), depth)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			h.value(v.Field(i), depth)
+		}
+
+	case reflect.Map:
+		// Sum the hashes of the elements so that their order doesn't matter.
+		var sum uint64
+		for _, k := range v.MapKeys() {
+			eh := newHasher()
+			eh.value(k, depth)
+			eh.value(v.MapIndex(k), depth)
+			sum += uint64(eh)
+		}
+		h.uint64(uint64(v.Len()))
+		h.uint64(sum)
+
+	default:
+		// Channels, functions and unsafe pointers.
+		if v.IsNil() {
+			h.byte(0)
+		} else {
+			h.byte(1)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package flatjson_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestHash(t *testing.T) {
+	val := &struct {
+		Hits   int
+		Ratio  float64
+		Name   string
+		Debug  bool
+		Tags   []string
+		Labels map[string]string
+		Child  *Child
+	}{Hits: 1, Ratio: 0.5, Name: "a", Tags: []string{"x"}, Labels: map[string]string{"a": "1", "b": "2"}}
+	flat := flatjson.Flatten(val)
+
+	hash := flat.Hash()
+	if h := flat.Hash(); h != hash {
+		t.Errorf("Hash changed without any changes: %x, then %x", hash, h)
+	}
+	if h := flatjson.Flatten(val).Hash(); h != hash {
+		t.Errorf("Hash differs between Maps of the same struct: %x, then %x", hash, h)
+	}
+
+	// Every single change produces a different hash.
+	seen := map[uint64]string{hash: "original"}
+	for _, change := range []struct {
+		name  string
+		apply func()
+	}{
+		{"Hits", func() { val.Hits = 2 }},
+		{"Ratio", func() { val.Ratio = math.NaN() }},
+		{"Name", func() { val.Name = "b" }},
+		{"Debug", func() { val.Debug = true }},
+		{"Tags", func() { val.Tags[0] = "y" }},
+		{"Tags length", func() { val.Tags = append(val.Tags, "z") }},
+		{"Labels", func() { val.Labels["b"] = "3" }},
+		{"Child", func() { val.Child = &Child{} }},
+		{"Child.CC", func() { val.Child.C = 1 }},
+	} {
+		change.apply()
+		h := flat.Hash()
+		if other, ok := seen[h]; ok {
+			t.Errorf("Changing %s produced the same hash as %s: %x", change.name, other, h)
+		}
+		seen[h] = change.name
+	}
+
+	// NaNs hash the same, as do both zeroes.
+	hash = flat.Hash()
+	val.Ratio = math.Float64frombits(math.Float64bits(math.NaN()) | 1)
+	if h := flat.Hash(); h != hash {
+		t.Errorf("NaNs hash differently: %x, then %x", hash, h)
+	}
+	val.Ratio = 0
+	hash = flat.Hash()
+	val.Ratio = math.Copysign(0, -1)
+	if h := flat.Hash(); h != hash {
+		t.Errorf("Zeroes hash differently: %x, then %x", hash, h)
+	}
+}
+
+func TestHashStable(t *testing.T) {
+	// The hash must not change between processes or releases, so that it can
+	// be stored.
+	flat := flatjson.Flatten(&struct {
+		A int
+		B string
+	}{1, "b"})
+	if h := flat.Hash(); h != 0x64821b76f75813f2 {
+		t.Errorf("Unexpected hash %#x", h)
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	a := flatjson.Flatten(&struct{ A, B int }{})
+	b := flatjson.Flatten(&struct{ A, C int }{})
+	if a.Hash() == b.Hash() {
+		t.Error("Maps with different keys have the same hash")
+	}
+}
+
+func TestHashAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are unreliable with the race detector")
+	}
+	flat := flatjson.Flatten(&struct {
+		Hits  int
+		Name  string
+		Point Point
+	}{})
+	if allocs := testing.AllocsPerRun(100, func() { flat.Hash() }); allocs >= 1 {
+		t.Errorf("Expected Hash not to allocate, got %v allocations per call", allocs)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A History keeps the most recent snapshots of the values in a Map, for an
+// in-process view of the last few minutes of stats without an external time
+// series database. Each snapshot is a Clone of the Map, so it doesn't share
+// anything with the flattened struct, and is encoded the same way as the Map
+// was at the time. At most the capacity given to NewHistory are kept, so the
+// memory used is bounded by the capacity times the number of entries.
+//
+// A History is safe for concurrent use, but Record reads the values of the Map
+// without synchronization, as Clone does, so it must not run while other
+// goroutines modify the flattened struct.
+type History struct {
+	m Map
+
+	mu        sync.Mutex
+	snapshots []snapshotAt // A ring buffer, with the oldest at start.
+	start     int
+}
+
+// snapshotAt is a snapshot recorded by a History.
+type snapshotAt struct {
+	Time   time.Time `json:"time"`
+	Values Map       `json:"values"`
+}
+
+// NewHistory returns a History recording snapshots of m, keeping the capacity
+// most recent. It panics if capacity is less than 1.
+func NewHistory(m Map, capacity int) *History {
+	if capacity < 1 {
+		panic("flatjson: NewHistory capacity must be at least 1")
+	}
+	return &History{m: m, snapshots: make([]snapshotAt, 0, capacity)}
+}
+
+// Record takes a snapshot of the current values of the Map, recorded as taken
+// at t, replacing the oldest one if the History is full.
+func (h *History) Record(t time.Time) {
+	s := snapshotAt{t, h.m.Clone()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.snapshots) < cap(h.snapshots) {
+		h.snapshots = append(h.snapshots, s)
+		return
+	}
+	h.snapshots[h.start] = s
+	h.start = (h.start + 1) % len(h.snapshots)
+}
+
+// Len returns the number of snapshots kept.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.snapshots)
+}
+
+// At returns the time and the values of the snapshot i, counting from the
+// oldest one kept, as by Values. It panics if i is out of range.
+func (h *History) At(i int) (time.Time, map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < 0 || i >= len(h.snapshots) {
+		panic(fmt.Sprintf("flatjson: History index %d out of range with length %d", i, len(h.snapshots)))
+	}
+	s := h.at(i)
+	return s.Time, s.Values.Values()
+}
+
+// Series returns the times of the snapshots holding key, oldest first, and
+// the numeric values key had in them, converted as by GetFloat64. An error is
+// returned if no snapshot holds key, or if one holds a value that isn't a
+// number.
+func (h *History) Series(key string) ([]time.Time, []float64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var times []time.Time
+	var values []float64
+	for i := range h.snapshots {
+		s := h.at(i)
+		if _, ok := s.Values[key]; !ok {
+			continue
+		}
+		f, ok := s.Values.GetFloat64(key)
+		if !ok {
+			return nil, nil, &Error{Op: "Series", Key: key, kind: ErrTypeMismatch, msg: fmt.Sprintf("flatjson: key %q doesn't hold a number at %s", key, s.Time.Format(time.RFC3339Nano))}
+		}
+		times, values = append(times, s.Time), append(values, f)
+	}
+	if times == nil {
+		return nil, nil, &Error{Op: "Series", Key: key, kind: ErrKeyNotFound, msg: fmt.Sprintf("flatjson: unknown key %q", key)}
+	}
+	return times, values, nil
+}
+
+// MarshalJSON encodes the snapshots as an array, oldest first, of objects
+// holding the time of each in the member time, and its values encoded the same
+// way as by Map.MarshalJSON in the member values.
+func (h *History) MarshalJSON() ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ordered := make([]snapshotAt, len(h.snapshots))
+	for i := range ordered {
+		ordered[i] = h.at(i)
+	}
+	return json.Marshal(ordered)
+}
+
+// at returns the snapshot i, counting from the oldest one.
+func (h *History) at(i int) snapshotAt {
+	return h.snapshots[(h.start+i)%len(h.snapshots)]
+}
@@ -0,0 +1,71 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestHistory(t *testing.T) {
+	val := &struct {
+		Pool  Pool     `json:"pool"`
+		Name  string   `json:"name"`
+		Peers []string `json:"peers"`
+	}{Name: "a", Peers: []string{"x"}}
+	h := flatjson.NewHistory(flatjson.Flatten(val), 3)
+
+	start := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		val.Pool.Active = i
+		val.Peers[0] = string('a' + rune(i))
+		h.Record(start.Add(time.Duration(i) * time.Minute))
+	}
+	val.Pool.Active, val.Peers[0] = 10, "z"
+
+	// Only the last 3 are kept, and they don't follow the struct.
+	if h.Len() != 3 {
+		t.Fatalf("Expected 3 snapshots, got %d", h.Len())
+	}
+	times, values, err := h.Series("pool.active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTimes := []time.Time{start.Add(2 * time.Minute), start.Add(3 * time.Minute), start.Add(4 * time.Minute)}
+	if !reflect.DeepEqual(times, expectedTimes) || !reflect.DeepEqual(values, []float64{2, 3, 4}) {
+		t.Errorf("Unexpected series %v, %v", times, values)
+	}
+
+	at, snapshot := h.At(0)
+	if !at.Equal(start.Add(2*time.Minute)) || snapshot["pool.active"] != 2 || !reflect.DeepEqual(snapshot["peers"], []string{"c"}) {
+		t.Errorf("Unexpected snapshot at %v: %v", at, snapshot)
+	}
+	snapshot["peers"].([]string)[0] = "changed"
+	if _, again := h.At(0); !reflect.DeepEqual(again["peers"], []string{"c"}) {
+		t.Errorf("Expected the snapshot to be unchanged, got %v", again)
+	}
+
+	enc, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []struct {
+		Time   time.Time
+		Values map[string]interface{}
+	}
+	if err := json.Unmarshal(enc, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 3 || !decoded[2].Time.Equal(start.Add(4*time.Minute)) || decoded[2].Values["pool.active"] != 4.0 || decoded[2].Values["name"] != "a" {
+		t.Errorf("Unexpected encoding %s", enc)
+	}
+
+	if _, _, err := h.Series("name"); err == nil {
+		t.Error("Expected an error for a string")
+	}
+	if _, _, err := h.Series("missing"); err == nil {
+		t.Error("Expected an error for an unknown key")
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A FlattenFunc adds the entries for v to out, with prefix prepended to their
+// keys, and returns the number of entries added. The prefix already ends with
+// the separator. To keep the entries live, like the ones Flatten adds, the
+// values stored in out should be pointers into v, which is addressable unless
+// it was reached through something that isn't, like a map element.
+type FlattenFunc func(prefix string, v reflect.Value, out Map) int
+
+var flattenFuncs struct {
+	sync.RWMutex
+	m map[reflect.Type]FlattenFunc
+}
+
+// RegisterFlattener makes fn responsible for flattening values of type t,
+// instead of the generic flattening of structs, slices and maps. It takes
+// precedence over json.Marshaler and encoding.TextMarshaler implementations,
+// but not over the noflatten tag option. Fields tagged with omitempty are left
+// out if they are empty when they are flattened. Registering a type again
+// replaces its FlattenFunc, and registering a nil fn removes it.
+// RegisterFlattener is safe for concurrent use, and is typically called from
+// init functions.
+func RegisterFlattener(t reflect.Type, fn FlattenFunc) {
+	flattenFuncs.Lock()
+	defer flattenFuncs.Unlock()
+
+	atomic.AddUint64(&registrations, 1)
+	if fn == nil {
+		delete(flattenFuncs.m, t)
+		return
+	}
+	if flattenFuncs.m == nil {
+		flattenFuncs.m = map[reflect.Type]FlattenFunc{}
+	}
+	flattenFuncs.m[t] = fn
+}
+
+var leafTypes struct {
+	sync.RWMutex
+	types []reflect.Type
+}
+
+// RegisterLeafType makes values of type t, or of types assignable to it if t
+// is an interface type, always be added as a single entry rather than being
+// flattened further, wherever they appear. Options.LeafTypes does the same for
+// a single flattening. The flatten tag option, as in flatjson:",flatten",
+// overrides this for a single field. Embedded fields are still inlined.
+// json.Number and the math/big number types are always leaves, so that they
+// are encoded with their full precision, and so are net.IPNet,
+// net.HardwareAddr and url.URL, which are encoded as the strings their String
+// methods return, with their zero values encoded as empty strings. Like net.IP
+// and the net/netip types, which encode themselves as text, they are left out
+// with omitempty while they are zero. RegisterLeafType is safe for concurrent
+// use, and is typically called from init functions.
+func RegisterLeafType(t reflect.Type) {
+	leafTypes.Lock()
+	defer leafTypes.Unlock()
+
+	for _, lt := range leafTypes.types {
+		if lt == t {
+			return
+		}
+	}
+	leafTypes.types = append(leafTypes.types, t)
+	atomic.AddUint64(&registrations, 1)
+}
+
+// builtinLeafTypes are always added as a single entry, as if registered with
+// RegisterLeafType. They are numbers encoded through their own methods, which
+// keep their full precision, while their fields would only flatten to empty
+// objects. builtinTextTypes are leaves too.
+var builtinLeafTypes = []reflect.Type{
+	numberType,
+	reflect.TypeOf(big.Int{}),
+	reflect.TypeOf(big.Float{}),
+	reflect.TypeOf(big.Rat{}),
+}
+
+// isRegisteredLeafType reports whether t is one of the registered or builtin
+// leaf types, or assignable to one of them.
+func isRegisteredLeafType(t reflect.Type) bool {
+	if isLeafType(t, builtinLeafTypes) || isBuiltinTextType(t) {
+		return true
+	}
+
+	leafTypes.RLock()
+	defer leafTypes.RUnlock()
+	return isLeafType(t, leafTypes.types)
+}
+
+// isLeafType reports whether t is one of types, or assignable to one of them.
+func isLeafType(t reflect.Type, types []reflect.Type) bool {
+	for _, lt := range types {
+		if t.AssignableTo(lt) {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredFlattener returns the FlattenFunc registered for t, if any.
+func registeredFlattener(t reflect.Type) FlattenFunc {
+	flattenFuncs.RLock()
+	defer flattenFuncs.RUnlock()
+	return flattenFuncs.m[t]
+}
+
+// An UnwrapFunc returns the value held by v, a value of a container type like
+// an optional, and whether v holds one. The inner value is returned even if it
+// is absent, such as the zero value of the field that would hold it, so that
+// its type is known. The v passed is addressable, and inner may be one of its
+// fields, including unexported ones, which keeps the entries for it live.
+type UnwrapFunc func(v reflect.Value) (inner reflect.Value, present bool)
+
+var unwrapFuncs struct {
+	sync.RWMutex
+	m map[string]UnwrapFunc // Keyed by typeFamily.
+}
+
+// RegisterUnwrap makes values of the named type t, and of every other
+// instantiation of the same generic type if t is one, such as Optional[string]
+// for Optional[int], be flattened as the values fn returns for them. A present
+// value is flattened as if the field held it, so an Optional[int] is added as
+// an int and the fields of an Optional[Stats] are flattened under the key of
+// the field, with the tag options of the field applying to it. An absent value
+// is treated as a nil pointer to the inner type: it is left out with omitempty
+// and otherwise follows Options.NilPointers, or Options.NilStructs for structs.
+// Whether a value is present is decided when it is flattened, as for nil
+// pointers, and picked up again by Refresh.
+//
+// fn takes precedence over a FlattenFunc and over the methods of t. Registering
+// a family again replaces its UnwrapFunc, and registering a nil fn removes it.
+// RegisterUnwrap panics if t isn't a named type. It is safe for concurrent use,
+// and is typically called from init functions.
+func RegisterUnwrap(t reflect.Type, fn UnwrapFunc) {
+	if t.Name() == "" {
+		panic("flatjson: RegisterUnwrap of unnamed type " + t.String())
+	}
+
+	unwrapFuncs.Lock()
+	defer unwrapFuncs.Unlock()
+
+	atomic.AddUint64(&registrations, 1)
+	if fn == nil {
+		delete(unwrapFuncs.m, typeFamily(t))
+		return
+	}
+	if unwrapFuncs.m == nil {
+		unwrapFuncs.m = map[string]UnwrapFunc{}
+	}
+	unwrapFuncs.m[typeFamily(t)] = fn
+}
+
+// typeFamily returns the name t shares with the other instantiations of its
+// generic type, if it is one: its package path and its name without the type
+// arguments. reflect has no way to get at the generic type itself, but the
+// name of an instantiation, like "Optional[int]", starts with the name of the
+// generic type, and no other type name contains a bracket.
+func typeFamily(t reflect.Type) string {
+	name := t.Name()
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	return t.PkgPath() + "." + name
+}
+
+// registeredUnwrap returns the UnwrapFunc registered for the family of t, if
+// any.
+func registeredUnwrap(t reflect.Type) UnwrapFunc {
+	if t.Name() == "" {
+		return nil
+	}
+
+	unwrapFuncs.RLock()
+	defer unwrapFuncs.RUnlock()
+	return unwrapFuncs.m[typeFamily(t)]
+}
+
+// flattenUnwrapped adds the entries for v, a value of a type registered with
+// RegisterUnwrap that is described by n, as if it were the value fn returns
+// for it.
+func (f *flattener) flattenUnwrapped(v reflect.Value, n node, fn UnwrapFunc) int {
+	if !v.CanAddr() {
+		// Reached through something that isn't addressable, so its current
+		// contents are flattened.
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+	n.src = nil
+
+	inner, present := fn(v)
+	switch {
+	case !inner.IsValid():
+		return 0
+	case !present:
+		// Flattened as a nil pointer, which is kept apart from v so that
+		// allocating it with NilStructAllocate doesn't touch v.
+		inner = reflect.New(reflect.PtrTo(inner.Type())).Elem()
+	case inner.CanAddr():
+		// Readable even if it is an unexported field.
+		inner = reflect.NewAt(inner.Type(), unsafe.Pointer(inner.UnsafeAddr())).Elem()
+	case inner.CanInterface():
+		c := reflect.New(inner.Type()).Elem()
+		c.Set(inner)
+		inner = c
+	default:
+		return 0
+	}
+	return f.flattenChild(inner, n)
+}
+
+// A Flattener is a type that flattens itself. Like a FlattenFunc, FlattenJSON
+// adds the entries for the value to out, with prefix, which already ends with
+// the separator, prepended to their keys, and returns the number added.
+//
+// FlattenJSON is called instead of flattening the value generically if it is
+// implemented by the value or, if the value is addressable, by a pointer to
+// it. Values are addressable unless they were reached through something that
+// isn't, like a map element, so a method with a pointer receiver can store
+// pointers to the value's fields in out to keep the entries live. A value
+// receiver only gets a copy. A FlattenFunc registered for the type takes
+// precedence.
+type Flattener interface {
+	FlattenJSON(prefix string, out Map) int
+}
+
+var flattenerType = reflect.TypeOf((*Flattener)(nil)).Elem()
+
+// asFlattener returns the Flattener for v, if it implements the interface.
+func asFlattener(v reflect.Value) Flattener {
+	if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(flattenerType) {
+		return v.Addr().Interface().(Flattener)
+	}
+	if v.Type().Implements(flattenerType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		return v.Interface().(Flattener)
+	}
+	return nil
+}
+
+// flattenWith adds the entries fn produces for the value described by n, in
+// sorted key order.
+func (f *flattener) flattenWith(n node, fn func(prefix string, out Map)) int {
+	out := Map{}
+	fn(n.prefix, out)
+
+	keys := make([]string, 0, len(out))
+	for key := range out {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if f.opts.StrictKeys {
+			f.checkKey(key, n)
+		}
+		if f.output.add(key, f.hookValue(key, out[key], n)) {
+			f.duplicates = append(f.duplicates, key)
+		}
+	}
+	return len(keys)
+}
+
+// hookValue returns the Map value to add for value, which a hook added under
+// key for the value described by n. It is wrapped in an entry if it has to be
+// redacted, transformed or left out while empty.
+func (f *flattener) hookValue(key string, value interface{}, n node) interface{} {
+	n.group.join(value)
+	keyValueFunc := f.opts.ValueFuncs[key]
+	if !n.redact && f.opts.RedactFunc == nil && n.group == nil && n.meta == nil && f.opts.ValueFunc == nil && keyValueFunc == nil {
+		return value
+	}
+	return &entry{value: value, key: key, redact: n.redact, redactFunc: f.opts.RedactFunc, group: n.group, meta: n.meta,
+		valueFunc: f.opts.ValueFunc, keyValueFunc: keyValueFunc}
+}
@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+package flatjson_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+// Optional holds a value that may be absent, in unexported fields.
+type Optional[T any] struct {
+	value T
+	set   bool
+}
+
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{value: v, set: true}
+}
+
+func init() {
+	// A single registration covers every instantiation.
+	flatjson.RegisterUnwrap(reflect.TypeOf(Optional[struct{}]{}), func(v reflect.Value) (reflect.Value, bool) {
+		return v.Field(0), v.Field(1).Bool()
+	})
+}
+
+func TestRegisterUnwrap(t *testing.T) {
+	val := &struct {
+		Hits    Optional[int]    `json:"hits"`
+		Name    Optional[string] `json:"name,omitempty"`
+		Missing Optional[int]    `json:"missing"`
+		Empty   Optional[Child]  `json:"empty,omitempty"`
+		Child   Optional[Child]  `json:"child"`
+		Whole   Optional[Point]  `json:"whole" flatjson:",noflatten"`
+	}{
+		Hits:  Some(3),
+		Name:  Some("a"),
+		Child: Some(Child{1, "x"}),
+		Whole: Some(Point{1, 2}),
+	}
+
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{
+		"hits":     3.0,
+		"name":     "a",
+		"missing":  nil,
+		"child.CC": 1.0,
+		"child.CD": "x",
+		"whole":    map[string]interface{}{"X": 1.0, "Y": 2.0},
+	})
+
+	// The entries point into the values held.
+	val.Hits.value = 4
+	val.Child.value.C = 2
+	if v, ok := flat.GetInt64("hits"); !ok || v != 4 {
+		t.Errorf("Expected the entry to be live, got %v, %v", v, ok)
+	}
+	if v, ok := flat.GetInt64("child.CC"); !ok || v != 2 {
+		t.Errorf("Expected the struct entry to be live, got %v, %v", v, ok)
+	}
+	if err := flat.Set("name", "b"); err != nil || val.Name.value != "b" {
+		t.Errorf("Expected Set to write the value held, got %v, %q", err, val.Name.value)
+	}
+
+	// Absent values follow the nil policies.
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{NilPointers: flatjson.NilPointerOmit})
+	if data, err := flat.MarshalJSON(); err != nil || strings.Contains(string(data), "missing") {
+		t.Errorf("Expected the absent value to be left out with NilPointerOmit, got %s, %v", data, err)
+	}
+	val.Missing = Some(5)
+	flat.Refresh(val)
+	if v, ok := flat.GetInt64("missing"); !ok || v != 5 {
+		t.Errorf("Expected Refresh to add the value once present, got %v, %v", v, ok)
+	}
+}
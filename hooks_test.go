@@ -0,0 +1,248 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+// Histogram keeps its samples private, and exposes percentiles computed by
+// Update.
+type Histogram struct {
+	samples  []float64
+	p50, p99 float64
+}
+
+func (h *Histogram) Update() {
+	sorted := append([]float64(nil), h.samples...)
+	sort.Float64s(sorted)
+	h.p50 = sorted[len(sorted)*50/100]
+	h.p99 = sorted[len(sorted)*99/100]
+}
+
+func init() {
+	flatjson.RegisterFlattener(reflect.TypeOf(Histogram{}), func(prefix string, v reflect.Value, out flatjson.Map) int {
+		h := v.Addr().Interface().(*Histogram)
+		out[prefix+"p50"] = &h.p50
+		out[prefix+"p99"] = &h.p99
+		return 2
+	})
+}
+
+func TestRegisterFlattener(t *testing.T) {
+	val := &struct {
+		Latency Histogram `json:"latency"`
+		DB      struct {
+			Query Histogram `json:"query"`
+		} `json:"db"`
+		Raw Histogram `json:"raw" flatjson:",noflatten"`
+	}{}
+	val.Latency.samples = []float64{3, 1, 2}
+	val.Latency.Update()
+
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{
+		"latency.p50":  2.0,
+		"latency.p99":  3.0,
+		"db.query.p50": 0.0,
+		"db.query.p99": 0.0,
+		"raw":          map[string]interface{}{},
+	})
+
+	// The entries point into the histograms.
+	val.DB.Query.samples = []float64{5}
+	val.DB.Query.Update()
+	if v, ok := flat.GetFloat64("db.query.p99"); !ok || v != 5 {
+		t.Errorf("Unexpected value after update: %v, %v", v, ok)
+	}
+
+	ordered := flatjson.FlattenOrdered(val)
+	var keys []string
+	ordered.Range(func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	expected := []string{"latency.p50", "latency.p99", "db.query.p50", "db.query.p99", "raw"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected key order: %v", keys)
+	}
+}
+
+// Window flattens itself into its total and the last sample.
+type Window struct {
+	samples []int
+	total   int
+}
+
+func (w *Window) Add(n int) {
+	w.samples = append(w.samples, n)
+	w.total += n
+}
+
+func (w *Window) FlattenJSON(prefix string, out flatjson.Map) int {
+	out[prefix+"total"] = &w.total
+	out[prefix+"count"] = len(w.samples)
+	return 2
+}
+
+type WindowStats struct {
+	Writes Window `json:"writes"`
+}
+
+func TestFlattenerInterface(t *testing.T) {
+	val := &struct {
+		Reads Window  `json:"reads"`
+		Ptr   *Window `json:"ptr"`
+		Nil   *Window `json:"nil"`
+		Empty *Window `json:"empty,omitempty"`
+		WindowStats
+	}{Ptr: &Window{}}
+	val.Reads.Add(2)
+	val.Reads.Add(3)
+
+	flat := flatjson.Flatten(val)
+	testEncoding(t, flat, flatjson.Map{
+		"reads.total":  5.0,
+		"reads.count":  2.0,
+		"ptr.total":    0.0,
+		"ptr.count":    0.0,
+		"nil":          nil,
+		"writes.total": 0.0,
+		"writes.count": 0.0,
+	})
+
+	// Pointers stored by FlattenJSON keep the entries live.
+	val.Writes.Add(4)
+	val.Ptr.Add(1)
+	testEncoding(t, flat, flatjson.Map{
+		"reads.total":  5.0,
+		"reads.count":  2.0,
+		"ptr.total":    1.0,
+		"ptr.count":    0.0,
+		"nil":          nil,
+		"writes.total": 4.0,
+		"writes.count": 0.0,
+	})
+}
+
+// UUID is a struct that should be encoded as a whole.
+type UUID struct {
+	Hi, Lo uint64
+}
+
+type Versioned interface {
+	Version() int
+}
+
+type Schema struct {
+	V int
+}
+
+func (s Schema) Version() int { return s.V }
+
+func init() {
+	flatjson.RegisterLeafType(reflect.TypeOf(UUID{}))
+}
+
+func TestRegisterLeafType(t *testing.T) {
+	val := &struct {
+		ID     UUID
+		Ptr    *UUID
+		Nested struct {
+			Deeper struct {
+				ID UUID
+			}
+		}
+		Expanded UUID `flatjson:",flatten"`
+		Schema   Schema
+	}{ID: UUID{1, 2}, Ptr: &UUID{3, 4}}
+
+	id := map[string]interface{}{"Hi": 0.0, "Lo": 0.0}
+	testFlattening(t, val, flatjson.Map{
+		"ID":               map[string]interface{}{"Hi": 1.0, "Lo": 2.0},
+		"Ptr":              map[string]interface{}{"Hi": 3.0, "Lo": 4.0},
+		"Nested.Deeper.ID": id,
+		"Expanded.Hi":      0.0,
+		"Expanded.Lo":      0.0,
+		"Schema.V":         0.0,
+	})
+
+	opts := flatjson.Options{LeafTypes: []reflect.Type{reflect.TypeOf((*Versioned)(nil)).Elem()}}
+	testEncoding(t, flatjson.FlattenWithOptions(val, opts), flatjson.Map{
+		"ID":               map[string]interface{}{"Hi": 1.0, "Lo": 2.0},
+		"Ptr":              map[string]interface{}{"Hi": 3.0, "Lo": 4.0},
+		"Nested.Deeper.ID": id,
+		"Expanded.Hi":      0.0,
+		"Expanded.Lo":      0.0,
+		"Schema":           map[string]interface{}{"V": 0.0},
+	})
+}
+
+type Ledger struct {
+	Balance big.Int     `json:"balance"`
+	Limit   *big.Int    `json:"limit"`
+	Missing *big.Int    `json:"missing"`
+	Rate    *big.Float  `json:"rate"`
+	Ratio   *big.Rat    `json:"ratio"`
+	Raw     json.Number `json:"raw"`
+}
+
+func TestBigNumbers(t *testing.T) {
+	val := &Ledger{Raw: "123456789012345678901234567890.5"}
+	val.Balance.SetString("98765432109876543210987654321", 10)
+	val.Limit = new(big.Int).Lsh(big.NewInt(1), 100)
+	val.Rate, _ = new(big.Float).SetPrec(200).SetString("1.000000000000000000000000001")
+	val.Ratio = big.NewRat(1, 3)
+
+	expected := `{"balance":98765432109876543210987654321,"limit":1267650600228229401496703205376,` +
+		`"missing":null,"rate":"1.000000000000000000000000001","ratio":"1/3","raw":123456789012345678901234567890.5}`
+
+	// Options that would otherwise flatten the structs don't apply.
+	for _, opts := range []flatjson.Options{{}, {FlattenMarshalers: true}, {FloatPrecision: 3}} {
+		flat := flatjson.FlattenWithOptions(val, opts)
+		if enc, err := flat.MarshalJSON(); err != nil || string(enc) != expected {
+			t.Errorf("Unexpected encoding with %+v:\n     got: %s (%v)\nexpected: %s", opts, enc, err, expected)
+		}
+		var buf bytes.Buffer
+		if err := flat.MarshalTo(&buf); err != nil || buf.String() != expected {
+			t.Errorf("Unexpected MarshalTo output with %+v:\n     got: %s (%v)\nexpected: %s", opts, buf.Bytes(), err, expected)
+		}
+	}
+
+	// Values are encoded as they are at the time.
+	flat := flatjson.Flatten(val)
+	val.Balance.Add(&val.Balance, big.NewInt(1))
+	val.Limit.Neg(val.Limit)
+	if enc, _ := flat.MarshalJSON(); !bytes.Contains(enc, []byte(`"balance":98765432109876543210987654322,"limit":-1267650600228229401496703205376,`)) {
+		t.Errorf("Expected the updated values, got %s", enc)
+	}
+
+	// Nil pointers follow the NilStructs policy, but aren't allocated.
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{NilStructs: flatjson.NilStructSkip})
+	if _, ok := flat["missing"]; ok {
+		t.Error("Expected the nil pointer to be skipped")
+	}
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{NilStructs: flatjson.NilStructAllocate})
+	if v, ok := flat["missing"]; !ok || val.Missing != nil {
+		t.Errorf("Expected a null entry for the nil pointer, got %v", v)
+	}
+
+	// The values survive decoding them again.
+	enc, _ := flatjson.Flatten(val).MarshalJSON()
+	// A big.Float decodes with the precision it already has.
+	decoded := &Ledger{Rate: new(big.Float).SetPrec(200)}
+	if err := flatjson.UnmarshalFlat(enc, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Balance.Cmp(&val.Balance) != 0 || decoded.Limit.Cmp(val.Limit) != 0 || decoded.Raw != val.Raw {
+		t.Errorf("Expected no loss of precision, got %+v", decoded)
+	}
+	if decoded.Rate.Text('g', 30) != val.Rate.Text('g', 30) {
+		t.Errorf("Expected the rate to keep its digits, got %s", decoded.Rate.Text('g', 30))
+	}
+}
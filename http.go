@@ -0,0 +1,81 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ServeHTTP serves the JSON encoding of m, as a Handler without a Locker does.
+func (m Map) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	Handler{Map: m}.ServeHTTP(w, r)
+}
+
+// A Handler serves the JSON encoding of a Map over HTTP, with its keys in
+// sorted order. The prefix query parameter restricts the response to the keys
+// starting with its value, so ?prefix=db. serves just the db subtree, and the
+// pretty query parameter, if true, indents the response with two spaces, or
+// with Indent if it is set.
+//
+// The values are read while the Map is encoded, so if they are modified by
+// other goroutines in the meantime, the response can mix old and new values,
+// or worse, race with the modifications. Set Locker to a lock held by those
+// goroutines to prevent that; the values are then copied under the lock, as by
+// LockedMap, and encoded after releasing it.
+type Handler struct {
+	Map    Map
+	Locker sync.Locker // Held while the values are copied, if non-nil.
+
+	// Indent, if non-empty, indents every response with it, as by
+	// Map.MarshalIndent, whatever the pretty query parameter says.
+	Indent string
+
+	// NoEscapeHTML leaves <, > and & in strings unescaped, as
+	// EncodeOptions.NoEscapeHTML does.
+	NoEscapeHTML bool
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	m := h.Map
+	if prefix := query.Get("prefix"); prefix != "" {
+		m = Map{}
+		for key, value := range h.Map {
+			if strings.HasPrefix(key, prefix) {
+				m[key] = value
+			}
+		}
+	}
+
+	if h.Locker != nil {
+		m = m.WithLock(h.Locker).Snapshot()
+	}
+
+	var ind indentation
+	if h.Indent != "" {
+		ind = indentation{"", h.Indent, true}
+	} else if pretty, _ := strconv.ParseBool(query.Get("pretty")); pretty {
+		ind = indentation{"", "  ", true}
+	}
+
+	var buf bytes.Buffer
+	if err := m.writeIndentedJSON(&buf, ind); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := buf.Bytes()
+	if h.NoEscapeHTML {
+		body, _ = unescapeHTML(nil, body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
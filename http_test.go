@@ -0,0 +1,109 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestServeHTTP(t *testing.T) {
+	val := &struct {
+		DB  Pool `json:"db"`
+		DBX Pool `json:"dbx"`
+		N   int  `json:"n"`
+	}{DB: Pool{1, 2}, N: 3}
+	flat := flatjson.Flatten(val)
+
+	for _, tt := range []struct {
+		query    string
+		expected string
+	}{
+		{"", `{"db.active":1,"db.idle":2,"dbx.active":0,"dbx.idle":0,"n":3}`},
+		{"?prefix=db.", `{"db.active":1,"db.idle":2}`},
+		{"?prefix=db", `{"db.active":1,"db.idle":2,"dbx.active":0,"dbx.idle":0}`},
+		{"?prefix=missing", `{}`},
+		{"?prefix=db.&pretty=1", "{\n  \"db.active\": 1,\n  \"db.idle\": 2\n}"},
+		{"?pretty=0&prefix=n", `{"n":3}`},
+	} {
+		w := httptest.NewRecorder()
+		flat.ServeHTTP(w, httptest.NewRequest("GET", "/vars"+tt.query, nil))
+
+		if w.Code != 200 {
+			t.Errorf("Unexpected status %d for %q", w.Code, tt.query)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Unexpected Content-Type %q for %q", ct, tt.query)
+		}
+		if body := w.Body.String(); body != tt.expected {
+			t.Errorf("Unexpected response for %q:\n     got: %s\nexpected: %s", tt.query, body, tt.expected)
+		}
+	}
+}
+
+func TestHandlerLocker(t *testing.T) {
+	var mu sync.Mutex
+	val := &Pool{}
+	h := flatjson.Handler{Map: flatjson.Flatten(val), Locker: &mu}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			mu.Lock()
+			val.Active++
+			val.Idle++
+			mu.Unlock()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		var got Pool
+		if err := json.Unmarshal(w.Body.Bytes(), &struct {
+			Active *int `json:"active"`
+			Idle   *int `json:"idle"`
+		}{&got.Active, &got.Idle}); err != nil {
+			t.Fatal(err)
+		}
+		if got.Active != got.Idle {
+			t.Fatalf("Response mixes values: %s", w.Body)
+		}
+	}
+	wg.Wait()
+}
+
+func TestHandlerIndent(t *testing.T) {
+	h := flatjson.Handler{Map: flatjson.Flatten(&Pool{1, 2}), Indent: "\t"}
+	for _, query := range []string{"", "?pretty=1", "?pretty=0"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/"+query, nil))
+		if expected := "{\n\t\"active\": 1,\n\t\"idle\": 2\n}"; w.Body.String() != expected {
+			t.Errorf("Unexpected response for %q:\n     got: %s\nexpected: %s", query, w.Body, expected)
+		}
+	}
+}
+
+func TestHandlerNoEscapeHTML(t *testing.T) {
+	flat := flatjson.Flatten(&struct {
+		Link string `json:"link"`
+	}{`<a href="?x=1&y=2">`})
+	for _, test := range []struct {
+		h        flatjson.Handler
+		expected string
+	}{
+		{flatjson.Handler{Map: flat}, `{"link":"\u003ca href=\"?x=1\u0026y=2\"\u003e"}`},
+		{flatjson.Handler{Map: flat, NoEscapeHTML: true}, `{"link":"<a href=\"?x=1&y=2\">"}`},
+	} {
+		w := httptest.NewRecorder()
+		test.h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Body.String() != test.expected {
+			t.Errorf("Unexpected response:\n     got: %s\nexpected: %s", w.Body, test.expected)
+		}
+	}
+}
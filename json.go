@@ -0,0 +1,168 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FlattenJSON decodes the JSON document in data and returns its Map
+// representation. Nested objects produce dotted keys the same way nested
+// structs do, and array elements are keyed by their index, so
+// {"items": [{"name": "a"}]} becomes {"items.0.name": "a"}.
+//
+// Unlike Flatten, the values in the returned Map are the decoded values
+// themselves rather than pointers. Numbers are decoded as json.Number so no
+// precision is lost, and empty objects and arrays are kept as leaves so that
+// they still appear in the output.
+//
+// The document must be an object or an array; a top-level array is flattened
+// with its indices as the first key segment. Any other document, and any
+// invalid JSON, results in an error.
+func FlattenJSON(data []byte) (Map, error) {
+	return Options{}.FlattenJSON(data)
+}
+
+// FlattenJSON is like the package-level FlattenJSON, but joins key segments
+// with o.Separator, escaping them if o.EscapeSeparators is set, and prepends
+// o.Prefix to the keys. If an object has the same member more than once, the
+// last one wins. If members with different names get the same key, as "a.b"
+// and "b" inside "a" do without o.EscapeSeparators, an error with kind
+// ErrDuplicateKey listing the keys is returned instead.
+func (o Options) FlattenJSON(data []byte) (Map, error) {
+	pairs, err := o.FlattenJSONPairs(data)
+	if err != nil {
+		return nil, err
+	}
+	return pairs.Map(), nil
+}
+
+// FlattenJSONPairs is like Options.FlattenJSON, but returns the entries in
+// the order they appear in the document.
+func (o Options) FlattenJSONPairs(data []byte) (Pairs, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	if _, ok := tok.(json.Delim); !ok {
+		return nil, newError("FlattenJSON", ErrTypeMismatch, "flatjson: expected JSON object or array, got %s", jsonKind(tok))
+	}
+
+	d := documentFlattener{dec: dec, opts: o.withDefaults(), paths: map[string]string{}}
+	if err := d.value(tok, "", "", true); err != nil {
+		return nil, syntaxError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, newError("FlattenJSON", nil, "flatjson: invalid data after top-level JSON value")
+	}
+	if len(d.duplicates) > 0 {
+		return nil, duplicateKeysError("FlattenJSON", d.duplicates)
+	}
+	return d.out, nil
+}
+
+// syntaxError returns the Error for err, returned by the decoder of a JSON
+// document.
+func syntaxError(err error) error {
+	e := newError("FlattenJSON", nil, "flatjson: %v", err)
+	e.Err = err
+	return e
+}
+
+// documentFlattener holds the state of flattening a JSON document.
+type documentFlattener struct {
+	dec  *json.Decoder
+	opts Options
+	out  Pairs
+
+	// paths holds the path of the members each key was added for, and
+	// duplicates the keys added for more than one path.
+	paths      map[string]string
+	duplicates []string
+}
+
+// value adds the entries for the JSON value starting with tok, under key.
+// Path identifies the value by the unescaped names of the members it is
+// nested in. The root value has no key of its own.
+func (d *documentFlattener) value(tok json.Token, key, path string, root bool) error {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		d.add(key, path, tok)
+		return nil
+	}
+
+	empty := true
+	for i := 0; d.dec.More(); i++ {
+		segment := strconv.Itoa(i)
+		name := segment
+		if delim == '{' {
+			tok, err := d.dec.Token()
+			if err != nil {
+				return err
+			}
+			name = tok.(string)
+			segment = d.opts.escape(name)
+		}
+
+		child, err := d.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := d.value(child, d.childKey(key, segment, root), path+strconv.Quote(name), false); err != nil {
+			return err
+		}
+		empty = false
+	}
+	if _, err := d.dec.Token(); err != nil {
+		return err
+	}
+
+	switch {
+	case !empty || root:
+	case delim == '{':
+		d.add(key, path, map[string]interface{}{})
+	default:
+		d.add(key, path, []interface{}{})
+	}
+	return nil
+}
+
+// add adds the entry for the value at path under key, recording key as a
+// duplicate if another path has it too.
+func (d *documentFlattener) add(key, path string, value interface{}) {
+	if p, ok := d.paths[key]; ok && p != path {
+		d.duplicates = append(d.duplicates, key)
+	}
+	d.paths[key] = path
+	d.out = append(d.out, Pair{key, value})
+}
+
+func (d *documentFlattener) childKey(key, segment string, root bool) string {
+	if !root {
+		return key + d.opts.Separator + segment
+	}
+	return d.opts.rootPrefix() + segment
+}
+
+func jsonKind(doc interface{}) string {
+	switch doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", doc)
+}
@@ -0,0 +1,122 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestFlattenJSON(t *testing.T) {
+	data := `{
+		"a": {"b": {"c": 1}},
+		"big": 12345678901234567890,
+		"items": [{"name": "x"}, {"name": "y", "tags": ["t"]}],
+		"empty": {},
+		"none": [],
+		"null": null,
+		"ok": true
+	}`
+
+	expected := flatjson.Map{
+		"a.b.c":          json.Number("1"),
+		"big":            json.Number("12345678901234567890"),
+		"items.0.name":   "x",
+		"items.1.name":   "y",
+		"items.1.tags.0": "t",
+		"empty":          map[string]interface{}{},
+		"none":           []interface{}{},
+		"null":           nil,
+		"ok":             true,
+	}
+
+	testFlattenJSON(t, data, expected)
+}
+
+func TestFlattenJSONTopLevel(t *testing.T) {
+	testFlattenJSON(t, `[{"a": 1}, 2]`, flatjson.Map{
+		"0.a": json.Number("1"),
+		"1":   json.Number("2"),
+	})
+	testFlattenJSON(t, `{}`, flatjson.Map{})
+	testFlattenJSON(t, `[]`, flatjson.Map{})
+}
+
+func TestFlattenJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`{`,
+		`{"a": 1} {"b": 2}`,
+		`"abc"`,
+		`123`,
+		`null`,
+	} {
+		if m, err := flatjson.FlattenJSON([]byte(data)); err == nil {
+			t.Errorf("Expected error for %q, got %#v", data, m)
+		}
+	}
+}
+
+func TestFlattenJSONDuplicateKeys(t *testing.T) {
+	// A member repeated in the same object replaces the earlier one.
+	m, err := flatjson.FlattenJSON([]byte(`{"a": {"b": 1}, "a": {"b": 2}}`))
+	if err != nil || !reflect.DeepEqual(m, flatjson.Map{"a.b": json.Number("2")}) {
+		t.Errorf("Expected the last member to win, got %v, %v", m, err)
+	}
+
+	// Different members with the same key are an error.
+	data := []byte(`{"a.b": 1, "a": {"b": 2}}`)
+	_, err = flatjson.FlattenJSON(data)
+	if e, ok := err.(*flatjson.Error); !ok || !e.Is(flatjson.ErrDuplicateKey) || e.Key != "a.b" {
+		t.Errorf("Expected a duplicate key error for a.b, got %v", err)
+	}
+	if _, err := (flatjson.Options{}).FlattenJSONPairs(data); err == nil {
+		t.Error("Expected a duplicate key error from FlattenJSONPairs")
+	}
+
+	// Escaping keeps them apart.
+	m, err = flatjson.Options{EscapeSeparators: true}.FlattenJSON(data)
+	if err != nil || len(m) != 2 {
+		t.Errorf("Expected two entries with EscapeSeparators, got %v, %v", m, err)
+	}
+}
+
+func TestFlattenJSONOptions(t *testing.T) {
+	data := []byte(`{"z": {"a/b": 1, "c": []}, "a": [true, {}], "m": null}`)
+	opts := flatjson.Options{Separator: "/", Prefix: "doc", EscapeSeparators: true}
+
+	pairs, err := opts.FlattenJSONPairs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := flatjson.Pairs{
+		{`doc/z/a\/b`, json.Number("1")},
+		{"doc/z/c", []interface{}{}},
+		{"doc/a/0", true},
+		{"doc/a/1", map[string]interface{}{}},
+		{"doc/m", nil},
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Unexpected pairs:\n     got: %#v\nexpected: %#v", pairs, expected)
+	}
+
+	m, err := opts.FlattenJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, expected.Map()) {
+		t.Errorf("Flattened to unexpected value: %#v", m)
+	}
+}
+
+func testFlattenJSON(t *testing.T, data string, expected flatjson.Map) {
+	got, err := flatjson.FlattenJSON([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Flattened to unexpected value:\n     got: %#v\nexpected: %#v\n", got, expected)
+	}
+}
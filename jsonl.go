@@ -0,0 +1,98 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A LineWriter appends snapshots of a Map to an io.Writer in the JSON Lines
+// format, one compact JSON object per line, such as for keeping a history of
+// metrics in a file. It is safe for concurrent use.
+type LineWriter struct {
+	m Map
+	w io.Writer
+
+	timeKey    string
+	timeFormat string
+
+	mu  sync.Mutex // Guards buf.
+	buf bytes.Buffer
+}
+
+// A LineOption configures a LineWriter.
+type LineOption func(*LineWriter)
+
+// LineTimestamp adds the time of each line to it under key, formatted
+// according to layout, which is a layout for time.Time.Format or one of the
+// TimeFormat values for Unix times, like TimeUnixMilli. An empty layout
+// formats it as RFC 3339 with nanoseconds. The timestamp replaces any entry of
+// the Map under the same key.
+func LineTimestamp(key, layout string) LineOption {
+	return func(lw *LineWriter) {
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		lw.timeKey, lw.timeFormat = key, layout
+	}
+}
+
+// NewLineWriter returns a LineWriter appending the values of m to w.
+func NewLineWriter(m Map, w io.Writer, opts ...LineOption) *LineWriter {
+	lw := &LineWriter{m: m, w: w}
+	for _, opt := range opts {
+		opt(lw)
+	}
+	return lw
+}
+
+// Append writes the current values of the Map to the writer as a single line,
+// encoded the same way as by Map.MarshalTo and followed by a newline. The line
+// is written with a single call to Write, so lines appended by several
+// LineWriters to the same file opened with os.O_APPEND don't interleave. If an
+// entry can't be encoded, the error is returned and nothing is written.
+func (lw *LineWriter) Append() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	m := lw.m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	var now interface{}
+	if lw.timeKey != "" {
+		switch v := formatTime(time.Now().Round(0), lw.timeFormat).(type) {
+		case string:
+			now = &v
+		case int64:
+			now = &v
+		}
+		if i := sort.SearchStrings(*keys, lw.timeKey); i == len(*keys) || (*keys)[i] != lw.timeKey {
+			*keys = append(*keys, "")
+			copy((*keys)[i+1:], (*keys)[i:])
+			(*keys)[i] = lw.timeKey
+		}
+	}
+
+	lw.buf.Reset()
+	err := streamEntries(&lw.buf, indentation{}, len(*keys), func(i int) (string, interface{}) {
+		key := (*keys)[i]
+		if now != nil && key == lw.timeKey {
+			return key, now
+		}
+		return key, m[key]
+	})
+	if err != nil {
+		return err
+	}
+	lw.buf.WriteByte('\n')
+
+	_, err = lw.w.Write(lw.buf.Bytes())
+	return err
+}
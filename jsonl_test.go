@@ -0,0 +1,101 @@
+package flatjson_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+// countingWriter records each call to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestLineWriter(t *testing.T) {
+	val := &Pool{Active: 1}
+	var w countingWriter
+	lw := flatjson.NewLineWriter(flatjson.Flatten(val), &w)
+
+	for i := 0; i < 3; i++ {
+		if err := lw.Append(); err != nil {
+			t.Fatal(err)
+		}
+		val.Active++
+	}
+	if w.writes != 3 {
+		t.Errorf("Expected a single write per line, got %d writes", w.writes)
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&w)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	expected := []map[string]interface{}{
+		{"active": 1.0, "idle": 0.0},
+		{"active": 2.0, "idle": 0.0},
+		{"active": 3.0, "idle": 0.0},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected lines:\n     got: %v\nexpected: %v", lines, expected)
+	}
+}
+
+func TestLineWriterTimestamp(t *testing.T) {
+	val := &Pool{Active: 1}
+	flat := flatjson.Flatten(val)
+	flat["idle"] = "replaced"
+
+	var buf bytes.Buffer
+	before := time.Now()
+	for _, lw := range []*flatjson.LineWriter{
+		flatjson.NewLineWriter(flat, &buf, flatjson.LineTimestamp("ts", "")),
+		flatjson.NewLineWriter(flat, &buf, flatjson.LineTimestamp("idle", flatjson.TimeUnixNano)),
+	} {
+		if err := lw.Append(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", lines)
+	}
+
+	var first struct {
+		Active int
+		Idle   string
+		TS     time.Time
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first.Active != 1 || first.Idle != "replaced" || first.TS.Before(before.Round(0)) || first.TS.After(time.Now()) {
+		t.Errorf("Unexpected line %s", lines[0])
+	}
+
+	// The timestamp replaces the entry with the same key.
+	var second map[string]int64
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if ns := second["idle"]; len(second) != 2 || ns < before.UnixNano() || ns > time.Now().UnixNano() {
+		t.Errorf("Unexpected line %s", lines[1])
+	}
+}
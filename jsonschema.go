@@ -0,0 +1,169 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// SchemaJSON returns a JSON Schema, following draft 2020-12, describing the
+// JSON encoding of the Map Flatten produces for values of the same struct
+// type as val, which may be a pointer to the struct. It is Options.SchemaJSON
+// with the zero Options.
+func SchemaJSON(val interface{}) ([]byte, error) {
+	return Options{}.SchemaJSON(val)
+}
+
+// SchemaJSON returns a JSON Schema, following draft 2020-12, describing the
+// JSON encoding of the Map flattening according to o produces for values of
+// the same struct type as val, which may be a pointer to the struct.
+//
+// The schema describes an object with a property for each key listed by
+// Options.Keys, whose type is inferred from the field's type and the options
+// affecting its encoding: integer, number, string, boolean, array or object,
+// with a date-time format for times encoded as RFC 3339 strings. Types that
+// may encode as null, like pointers and slices, also allow null, and types
+// implementing json.Marshaler allow any value. The keys that aren't optional,
+// as reported by TypeKeys, are required. Keys for nil pointers to structs,
+// which are only present while the pointer is nil, are allowed as null.
+func (o Options) SchemaJSON(val interface{}) ([]byte, error) {
+	all, base, err := o.typeEntries(reflect.TypeOf(val))
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]interface{}, len(all))
+	required := []string{}
+	for key, value := range all {
+		properties[key] = valueSchema(value)
+		if !isOptional(base, key) {
+			required = append(required, key)
+		}
+	}
+	for key := range base {
+		if _, ok := all[key]; !ok {
+			// The null entry for a nil pointer to a struct.
+			properties[key] = jsonSchema{"type": "null"}
+		}
+	}
+	sort.Strings(required)
+
+	return json.Marshal(map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	})
+}
+
+// jsonSchema is the JSON Schema for a value.
+type jsonSchema map[string]interface{}
+
+// valueSchema returns the schema for the encoding of the Map value v.
+func valueSchema(v interface{}) jsonSchema {
+	var t reflect.Type
+	switch v := v.(type) {
+	case *entry:
+		if s := entrySchema(v); s != nil {
+			return s
+		}
+		return valueSchema(v.value)
+	case *atomicValue:
+		load, _ := reflect.PtrTo(resolve(v.value).Type()).MethodByName("Load")
+		t = load.Type.Out(0)
+	case *computed:
+		return valueSchema(v.fn())
+	case *lookup:
+		src := v.src()
+		if !src.IsValid() {
+			return jsonSchema{}
+		}
+		t = src.Type()
+	case nil:
+		return jsonSchema{}
+	default:
+		// Usually a pointer to the field, but values added by a
+		// FlattenFunc or Flattener can be anything.
+		t = reflect.TypeOf(v)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	return typeSchema(t)
+}
+
+// entrySchema returns the schema for an entry whose tag options or formats
+// change its encoding, or nil if they don't.
+func entrySchema(e *entry) jsonSchema {
+	switch {
+	case e.stringer, e.quoted:
+		return nullable(jsonSchema{"type": "string"})
+	case e.timeFormat == TimeUnix, e.timeFormat == TimeUnixMilli, e.timeFormat == TimeUnixNano:
+		return nullable(jsonSchema{"type": "integer"})
+	case e.timeFormat == time.RFC3339, e.timeFormat == time.RFC3339Nano:
+		return nullable(jsonSchema{"type": "string", "format": "date-time"})
+	case e.timeFormat != "":
+		return nullable(jsonSchema{"type": "string"})
+	case e.durationFormat == DurationString:
+		return nullable(jsonSchema{"type": "string"})
+	case e.durationFormat == DurationSeconds:
+		return nullable(jsonSchema{"type": "number"})
+	case e.durationFormat == DurationMillis:
+		return nullable(jsonSchema{"type": "integer"})
+	}
+	return nil
+}
+
+// typeSchema returns the schema for the encoding/json encoding of values of
+// type t.
+func typeSchema(t reflect.Type) jsonSchema {
+	if t == timeType {
+		return jsonSchema{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return jsonSchema{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return jsonSchema{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return jsonSchema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonSchema{"type": "number"}
+	case reflect.String:
+		return jsonSchema{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(t.Elem()).Implements(marshalerType) {
+			return nullable(jsonSchema{"type": "string", "contentEncoding": "base64"})
+		}
+		return nullable(jsonSchema{"type": "array", "items": typeSchema(t.Elem())})
+	case reflect.Array:
+		return jsonSchema{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return nullable(jsonSchema{"type": "object", "additionalProperties": typeSchema(t.Elem())})
+	case reflect.Struct:
+		return jsonSchema{"type": "object"}
+	case reflect.Ptr:
+		return nullable(typeSchema(t.Elem()))
+	}
+	return jsonSchema{}
+}
+
+// nullable returns s, changed to also allow null.
+func nullable(s jsonSchema) jsonSchema {
+	if typ, ok := s["type"].(string); ok {
+		s["type"] = []string{typ, "null"}
+	}
+	return s
+}
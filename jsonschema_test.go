@@ -0,0 +1,144 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type SchemaDoc struct {
+	ID      int64     `json:"id"`
+	Ratio   float64   `json:"ratio"`
+	Name    string    `json:"name"`
+	Up      bool      `json:"up"`
+	Started time.Time `json:"started"`
+	Retries *int      `json:"retries"`
+	Tags    []string  `json:"tags"`
+	Labels  map[string]int
+	Note    string        `json:"note,omitempty"`
+	Timeout time.Duration `json:"timeout"`
+	Count   int           `json:"count,string"`
+	Price   Decimal       `json:"price"`
+	TLS     *struct {
+		Cert string `json:"cert"`
+	} `json:"tls"`
+	Pool
+}
+
+func TestSchemaJSON(t *testing.T) {
+	enc, err := flatjson.Options{DurationFormat: flatjson.DurationString}.SchemaJSON(SchemaDoc{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Schema     string `json:"$schema"`
+		Type       string
+		Properties map[string]map[string]interface{}
+		Required   []string
+	}
+	if err := json.Unmarshal(enc, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	types := map[string]interface{}{}
+	for key, prop := range schema.Properties {
+		types[key] = prop["type"]
+	}
+	expectedTypes := map[string]interface{}{
+		"id":       "integer",
+		"ratio":    "number",
+		"name":     "string",
+		"up":       "boolean",
+		"started":  "string",
+		"retries":  []interface{}{"integer", "null"},
+		"tags":     []interface{}{"array", "null"},
+		"Labels":   []interface{}{"object", "null"},
+		"note":     "string",
+		"timeout":  []interface{}{"string", "null"},
+		"count":    []interface{}{"string", "null"},
+		"price":    nil,
+		"tls.cert": "string",
+		"tls":      "null",
+		"active":   "integer",
+		"idle":     "integer",
+	}
+	if !reflect.DeepEqual(types, expectedTypes) {
+		t.Errorf("Unexpected property types:\n     got: %v\nexpected: %v", types, expectedTypes)
+	}
+	if format := schema.Properties["started"]["format"]; format != "date-time" {
+		t.Errorf("Unexpected format for started: %v", format)
+	}
+
+	expectedRequired := []string{"Labels", "active", "count", "id", "idle", "name", "price", "ratio", "retries", "started", "tags", "timeout", "up"}
+	if schema.Type != "object" || !reflect.DeepEqual(schema.Required, expectedRequired) {
+		t.Errorf("Unexpected schema: %s", enc)
+	}
+
+	// An encoded Map conforms to the schema.
+	val := &SchemaDoc{ID: 1, Tags: []string{"a"}, Note: "n", Timeout: time.Second}
+	flatEnc, err := json.Marshal(flatjson.FlattenWithOptions(val, flatjson.Options{DurationFormat: flatjson.DurationString}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(flatEnc, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range doc {
+		prop, ok := schema.Properties[key]
+		if !ok {
+			t.Errorf("Key %s is not in the schema", key)
+			continue
+		}
+		if !matchesType(value, prop["type"]) {
+			t.Errorf("Value %v for %s doesn't match type %v", value, key, prop["type"])
+		}
+	}
+	for _, key := range schema.Required {
+		if _, ok := doc[key]; !ok {
+			t.Errorf("Required key %s is missing", key)
+		}
+	}
+
+	if _, err := flatjson.SchemaJSON(0); err == nil {
+		t.Error("Expected an error for a non-struct value")
+	}
+}
+
+// matchesType reports whether the decoded JSON value v matches the JSON Schema
+// type typ, which is a type name, a list of them, or nil for any type.
+func matchesType(v interface{}, typ interface{}) bool {
+	switch typ := typ.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		for _, t := range typ {
+			if matchesType(v, t) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return typ == "null"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || typ == "integer" && v == math.Trunc(v)
+	case string:
+		return typ == "string"
+	case []interface{}:
+		return typ == "array"
+	case map[string]interface{}:
+		return typ == "object"
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const escapeChar = '\\'
+
+// A KeyFormat is a way of joining key segments into keys.
+type KeyFormat int
+
+const (
+	// KeyFormatSeparated joins segments with Options.Separator, escaping
+	// them if Options.EscapeSeparators is set: servers.0.port.
+	KeyFormatSeparated KeyFormat = iota
+
+	// KeyFormatJSONPointer produces RFC 6901 JSON Pointers: each segment is
+	// preceded by a slash, and the characters ~ and / within segments are
+	// escaped as ~0 and ~1, so that the key for a port field of the first
+	// element of servers is /servers/0/port. Options.Prefix, if set, is
+	// the first segment; it isn't escaped.
+	KeyFormatJSONPointer
+)
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// rootPrefix returns the prefix for the keys of top-level values.
+func (o Options) rootPrefix() string {
+	switch {
+	case o.KeyFormat == KeyFormatJSONPointer && o.Prefix != "":
+		return "/" + o.Prefix + "/"
+	case o.KeyFormat == KeyFormatJSONPointer:
+		return "/"
+	case o.Prefix != "":
+		return o.Prefix + o.withDefaults().Separator
+	}
+	return ""
+}
+
+// escape returns name escaped for use as a key segment, if o.EscapeSeparators
+// is set or o.KeyFormat is KeyFormatJSONPointer. Escaping the first character
+// of the separator rather than the whole separator keeps keys unambiguous when
+// a segment ends with part of a separator longer than one character.
+func (o Options) escape(name string) string {
+	if o.KeyFormat == KeyFormatJSONPointer {
+		return pointerEscaper.Replace(name)
+	}
+	if !o.EscapeSeparators {
+		return name
+	}
+
+	first, _ := utf8.DecodeRuneInString(o.Separator)
+	if !strings.ContainsRune(name, escapeChar) && !strings.ContainsRune(name, first) {
+		return name
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		if r == escapeChar || r == first {
+			b.WriteRune(escapeChar)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// JoinKey joins segments into a key the way they are joined when flattening
+// with o, escaping them if o.EscapeSeparators is set or o.KeyFormat is
+// KeyFormatJSONPointer.
+func (o Options) JoinKey(segments ...string) string {
+	o = o.withDefaults()
+
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = o.escape(segment)
+	}
+	if o.KeyFormat == KeyFormatJSONPointer {
+		return "/" + strings.Join(escaped, o.Separator)
+	}
+	return strings.Join(escaped, o.Separator)
+}
+
+// SplitKey splits a key produced by flattening with o into its segments. If
+// o.EscapeSeparators is set, or o.KeyFormat is KeyFormatJSONPointer, escaped
+// characters don't split the key, and are unescaped in the returned segments.
+func (o Options) SplitKey(key string) []string {
+	o = o.withDefaults()
+	if o.KeyFormat == KeyFormatJSONPointer {
+		segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+		for i, segment := range segments {
+			segments[i] = pointerUnescaper.Replace(segment)
+		}
+		return segments
+	}
+	if !o.EscapeSeparators {
+		return strings.Split(key, o.Separator)
+	}
+
+	var segments []string
+	var b strings.Builder
+	for i := 0; i < len(key); {
+		switch {
+		case key[i] == escapeChar && i+1 < len(key):
+			r, size := utf8.DecodeRuneInString(key[i+1:])
+			b.WriteRune(r)
+			i += 1 + size
+		case strings.HasPrefix(key[i:], o.Separator):
+			segments = append(segments, b.String())
+			b.Reset()
+			i += len(o.Separator)
+		default:
+			b.WriteByte(key[i])
+			i++
+		}
+	}
+	return append(segments, b.String())
+}
@@ -0,0 +1,141 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestEscapeSeparators(t *testing.T) {
+	val := &struct {
+		Disk struct {
+			Usage int `json:"usage"`
+		} `json:"disk"`
+		DiskUsage int            `json:"disk.usage"`
+		Path      string         `json:"C:\\temp"`
+		Counters  map[string]int `json:"counters"`
+	}{Counters: map[string]int{"a.b": 1, "": 2}}
+
+	opts := flatjson.Options{FlattenMaps: true, EscapeSeparators: true}
+	testFlatteningWithOptions(t, val, opts, flatjson.Map{
+		`disk.usage`:    0.0,
+		`disk\.usage`:   0.0,
+		`C:\\temp`:      "",
+		`counters.a\.b`: 1.0,
+		`counters.`:     2.0,
+	})
+
+	// Without the option, the keys collide.
+	if m, err := (flatjson.Options{}).Flatten(val); err == nil {
+		t.Errorf("Expected error for %#v, got %#v", val, m)
+	}
+
+	opts = flatjson.Options{Separator: "::", EscapeSeparators: true}
+	testFlatteningWithOptions(t, &struct {
+		A int `json:"a::b"`
+		B int `json:"a:b"`
+	}{}, opts, flatjson.Map{`a\:\:b`: 0.0, `a\:b`: 0.0})
+}
+
+func TestSplitKey(t *testing.T) {
+	for _, opts := range []flatjson.Options{
+		{EscapeSeparators: true},
+		{EscapeSeparators: true, Separator: "::"},
+		{EscapeSeparators: true, Separator: "/"},
+		{KeyFormat: flatjson.KeyFormatJSONPointer},
+	} {
+		for _, segments := range [][]string{
+			{"a"},
+			{"disk.usage", "total"},
+			{`C:\temp`, `\`, `\\`},
+			{"a::b", ":", "a/b"},
+			{"", "a", ""},
+			{""},
+		} {
+			key := opts.JoinKey(segments...)
+			if got := opts.SplitKey(key); !reflect.DeepEqual(got, segments) {
+				t.Errorf("Split %q with separator %q into %q, expected %q", key, opts.Separator, got, segments)
+			}
+		}
+	}
+
+	// Without escaping, keys are split at every separator.
+	if got := (flatjson.Options{}).SplitKey(`a\.b.c`); !reflect.DeepEqual(got, []string{`a\`, "b", "c"}) {
+		t.Errorf("Unexpected segments %q", got)
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	val := &struct {
+		Servers []struct {
+			Port int `json:"port"`
+		} `json:"servers"`
+		Rate   float64        `json:"req/s"`
+		Approx int            `json:"~n"`
+		Both   string         `json:"a~/b"`
+		Labels map[string]int `json:"labels"`
+	}{Both: "x", Labels: map[string]int{"k/v": 1, "~": 2}}
+	val.Servers = append(val.Servers, struct {
+		Port int `json:"port"`
+	}{80})
+
+	opts := flatjson.Options{KeyFormat: flatjson.KeyFormatJSONPointer, IndexSlices: true, FlattenMaps: true}
+	expected := flatjson.Map{
+		"/servers/0/port": 80.0,
+		"/req~1s":         0.0,
+		"/~0n":            0.0,
+		"/a~0~1b":         "x",
+		"/labels/k~1v":    1.0,
+		"/labels/~0":      2.0,
+	}
+	testFlatteningWithOptions(t, val, opts, expected)
+
+	// Expand parses the keys back into the document they came from.
+	flat := flatjson.FlattenWithOptions(val, opts)
+	expanded, err := opts.Expand(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{
+		"servers": map[string]interface{}{"0": map[string]interface{}{"port": 80}},
+		"req/s":   0.0,
+		"~n":      0,
+		"a~/b":    "x",
+		"labels":  map[string]interface{}{"k/v": 1, "~": 2},
+	}
+	if !reflect.DeepEqual(expanded, doc) {
+		t.Errorf("Unexpected expansion:\n     got: %#v\nexpected: %#v", expanded, doc)
+	}
+
+	// UnmarshalFlat matches the keys to fields the same way.
+	type Scalars struct {
+		Rate   float64 `json:"req/s"`
+		Approx int     `json:"~n"`
+		Both   string  `json:"a~/b"`
+	}
+	scalars := &Scalars{1.5, 2, "y"}
+	enc, _ := json.Marshal(flatjson.FlattenWithOptions(scalars, opts))
+	got := &Scalars{}
+	if err := opts.UnmarshalFlat(enc, got); err != nil {
+		t.Fatal(err)
+	}
+	if *got != *scalars {
+		t.Errorf("Unexpected result from %s: %+v", enc, got)
+	}
+
+	// The prefix is the first segment, and documents are flattened the
+	// same way.
+	opts.Prefix = "cfg"
+	m, err := opts.FlattenJSON([]byte(`{"a/b":{"~":[1]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (flatjson.Map{"/cfg/a~1b/~0/0": json.Number("1")}); !reflect.DeepEqual(m, expected) {
+		t.Errorf("Unexpected document keys: %v", m)
+	}
+	if key := opts.JoinKey("a/b", "~"); key != "/a~1b/~0" {
+		t.Errorf("Unexpected joined key %q", key)
+	}
+}
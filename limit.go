@@ -0,0 +1,52 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+// Len returns the number of entries in m.
+func (m Map) Len() int {
+	return len(m)
+}
+
+// A limitSink passes on entries to out until Options.MaxKeys of them have been
+// added, and records the key of the first entry beyond that.
+type limitSink struct {
+	out   sink
+	max   int
+	added int
+	first string // The key of the first entry left out, if any.
+	over  bool
+}
+
+func (s *limitSink) add(key string, value interface{}) bool {
+	if s.added >= s.max {
+		if !s.over {
+			s.first, s.over = key, true
+		}
+		return false
+	}
+
+	replaced := s.out.add(key, value)
+	if !replaced {
+		s.added++
+	}
+	return replaced
+}
+
+// exceeded reports whether an entry was left out because of the limit. It may
+// be called on a nil limitSink.
+func (s *limitSink) exceeded() bool {
+	return s != nil && s.over
+}
+
+// truncate adds the entry marking the Map as truncated under prefix joined
+// with TruncatedKey, if entries were left out with LimitTruncate, and returns
+// the number of entries added.
+func (f *flattener) truncate(prefix string) int {
+	if !f.limit.exceeded() || f.opts.OnLimit != LimitTruncate {
+		return 0
+	}
+	f.limit.out.add(prefix+TruncatedKey, true)
+	return 1
+}
@@ -0,0 +1,70 @@
+package flatjson_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+// visitedFlattener records whether it was flattened.
+type visitedFlattener struct {
+	visited bool
+}
+
+func (v *visitedFlattener) FlattenJSON(prefix string, out flatjson.Map) int {
+	v.visited = true
+	out[prefix+"visited"] = &v.visited
+	return 1
+}
+
+type registry struct {
+	Name  string         `json:"name"`
+	Peers map[string]int `json:"peers"`
+	Late  visitedFlattener
+}
+
+func TestMaxKeys(t *testing.T) {
+	val := &registry{Name: "r", Peers: map[string]int{}}
+	for i := 0; i < 1000; i++ {
+		val.Peers["p"+strconv.Itoa(1000+i)] = i
+	}
+	opts := flatjson.Options{FlattenMaps: true, MaxKeys: 3}
+
+	_, err := opts.Flatten(val)
+	if e, ok := err.(*flatjson.Error); !ok || e.Key != "peers.p1002" {
+		t.Errorf("Expected an error naming the first key left out, got %#v", err)
+	}
+	if val.Late.visited {
+		t.Error("Expected the traversal to stop at the limit")
+	}
+
+	opts.OnLimit = flatjson.LimitTruncate
+	flat, err := opts.Flatten(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncoding(t, flat, flatjson.Map{
+		"name":                "r",
+		"peers.p1000":         0.0,
+		"peers.p1001":         1.0,
+		flatjson.TruncatedKey: true,
+	})
+	if flat.Len() != 4 {
+		t.Errorf("Expected 4 entries, got %d", flat.Len())
+	}
+	if val.Late.visited {
+		t.Error("Expected the traversal to stop at the limit when truncating")
+	}
+
+	// Under the limit, nothing changes.
+	opts.Prefix = "app"
+	flat, err = opts.Flatten(&registry{Name: "r", Peers: map[string]int{"p1000": 0}})
+	if err != nil || flat.Len() != 3 {
+		t.Errorf("Unexpected result under the limit: %v, %v", flat, err)
+	}
+	flat, err = opts.Flatten(&registry{Name: "r", Peers: map[string]int{"p1000": 0, "p1001": 1}})
+	if err != nil || flat["app."+flatjson.TruncatedKey] != true {
+		t.Errorf("Expected the truncation entry under the prefix, got %v, %v", flat, err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"sync"
+)
+
+// A LockedMap reads the values of a Map while holding a lock, for structs that
+// are modified by other goroutines holding the same lock. The lock is held
+// only while the values are copied, not while they are encoded or passed to
+// callbacks.
+type LockedMap struct {
+	Map    Map
+	Locker sync.Locker
+}
+
+// WithLock returns a LockedMap reading the values of m while holding l.
+func (m Map) WithLock(l sync.Locker) LockedMap {
+	return LockedMap{m, l}
+}
+
+// Snapshot returns a Map holding copies of the current values, taken under the
+// lock, as by Map.Values. Unlike the values returned by Values, the entries are
+// encoded the same way as those of the original Map, so omitempty and the
+// other tag options and formats still apply.
+func (lm LockedMap) Snapshot() Map {
+	lm.Locker.Lock()
+	defer lm.Locker.Unlock()
+	return lm.Map.snapshot()
+}
+
+// Values returns a snapshot of the current values, taken under the lock, as by
+// Map.Values.
+func (lm LockedMap) Values() map[string]interface{} {
+	lm.Locker.Lock()
+	defer lm.Locker.Unlock()
+	return lm.Map.Values()
+}
+
+// MarshalJSON encodes a Snapshot, the same way Map.MarshalJSON does.
+func (lm LockedMap) MarshalJSON() ([]byte, error) {
+	return lm.Snapshot().MarshalJSON()
+}
+
+// Walk calls fn for each entry of a Snapshot, as by Map.Walk. The lock isn't
+// held while fn runs.
+func (lm LockedMap) Walk(fn func(key string, value interface{}) error) error {
+	return lm.Snapshot().Walk(fn)
+}
+
+// snapshot returns a Map whose values point at deep copies of the current
+// values in m, keeping the entries that affect their encoding.
+func (m Map) snapshot() Map {
+	s := make(Map, len(m))
+	copied := map[visit]reflect.Value{}
+
+	for key, value := range m {
+		s[key] = snapshotValue(value, copied)
+	}
+	return s
+}
+
+// snapshotValue returns a Map value pointing at a copy of the current value of
+// the Map value v.
+func snapshotValue(v interface{}, copied map[visit]reflect.Value) interface{} {
+	if e, ok := v.(*entry); ok {
+		c := *e
+		c.value = snapshotValue(e.value, copied)
+		return &c
+	}
+
+	rv := resolve(v)
+	if !rv.IsValid() {
+		return nil
+	}
+	p := reflect.New(rv.Type())
+	p.Elem().Set(deepCopy(rv, copied))
+	return p.Interface()
+}
@@ -0,0 +1,67 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestWithLock(t *testing.T) {
+	var mu sync.Mutex
+	val := &struct {
+		Requests int
+		Tags     []string
+		Note     string `json:",omitempty"`
+	}{Tags: []string{"a"}}
+	locked := flatjson.Flatten(val).WithLock(&mu)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				mu.Lock()
+				val.Requests++
+				val.Tags = append(val.Tags[:0], "a")
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		enc, err := json.Marshal(locked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(enc, &m); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m["Note"]; ok {
+			t.Fatalf("Empty field wasn't omitted: %s", enc)
+		}
+
+		locked.Values()
+		locked.Walk(func(key string, value interface{}) error { return nil })
+	}
+	close(done)
+	wg.Wait()
+
+	// A snapshot doesn't change along with the struct.
+	snapshot := locked.Snapshot()
+	mu.Lock()
+	requests := val.Requests
+	val.Requests++
+	val.Note = "n"
+	mu.Unlock()
+	testEncoding(t, snapshot, flatjson.Map{"Requests": float64(requests), "Tags": []interface{}{"a"}})
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// WriteLogfmt writes the values in m to w as a single logfmt line of
+// key=value pairs separated by spaces, in sorted key order, followed by a
+// newline: server.port=8080 db.pool.active=3 msg="hello world".
+//
+// Values are formatted the same way as by CSVWriter. Those which are empty,
+// or contain spaces, equals signs, double quotes, or characters that aren't
+// printable, are quoted as Go string literals, and nil pointers are written as
+// the key alone, without an equals sign. Entries which are currently omitted
+// because of omitempty or omitzero are left out, as by MarshalJSON. Characters
+// of keys that logfmt doesn't allow in them, which are the same as those that
+// cause values to be quoted, are replaced by underscores.
+func (m Map) WriteLogfmt(w io.Writer) error {
+	text, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(text, '\n'))
+	return err
+}
+
+// MarshalText encodes m as a logfmt line, as WriteLogfmt does, but without the
+// trailing newline.
+func (m Map) MarshalText() ([]byte, error) {
+	m = m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	var buf bytes.Buffer
+	for _, key := range *keys {
+		value := m[key]
+		if e, ok := value.(*entry); ok && e.omit() {
+			continue
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(strings.Map(logfmtRune, key))
+
+		v := indirectValue(resolve(value))
+		if !v.IsValid() {
+			continue
+		}
+		text, err := formatText(v, textOptions(value))
+		if err != nil {
+			return nil, keyError("MarshalText", key, err)
+		}
+		buf.WriteByte('=')
+		buf.WriteString(quoteLogfmt(text))
+	}
+	return buf.Bytes(), nil
+}
+
+// logfmtRune maps the characters that can't appear in logfmt keys to
+// underscores.
+func logfmtRune(r rune) rune {
+	if needsLogfmtQuote(r) {
+		return '_'
+	}
+	return r
+}
+
+// quoteLogfmt quotes value if logfmt requires it.
+func quoteLogfmt(value string) string {
+	if value == "" || strings.IndexFunc(value, needsLogfmtQuote) >= 0 {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func needsLogfmtQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar || !unicode.IsPrint(r)
+}
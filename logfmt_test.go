@@ -0,0 +1,58 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+var _ encoding.TextMarshaler = flatjson.Map{}
+
+func TestWriteLogfmt(t *testing.T) {
+	val := &struct {
+		Server struct {
+			Port int `json:"port"`
+		} `json:"server"`
+		Msg    string   `json:"msg"`
+		Quote  string   `json:"quote"`
+		Eq     string   `json:"eq"`
+		Line   string   `json:"line"`
+		Empty  string   `json:"empty"`
+		Uni    string   `json:"uni"`
+		Ratio  float64  `json:"ratio"`
+		Up     bool     `json:"up"`
+		Nil    *int     `json:"nil"`
+		Tags   []string `json:"tags"`
+		Gone   int      `json:"gone,omitempty"`
+		Spaced int      `json:"a b=c"`
+	}{Msg: "hello world", Quote: `say "hi"`, Eq: "a=b", Line: "a\nb", Uni: "héllo", Ratio: 0.25, Up: true, Tags: []string{"x"}}
+	val.Server.Port = 8080
+	flat := flatjson.Flatten(val)
+
+	var buf bytes.Buffer
+	if err := flat.WriteLogfmt(&buf); err != nil {
+		t.Fatal(err)
+	}
+	const expected = `a_b_c=0 empty="" eq="a=b" line="a\nb" msg="hello world" nil quote="say \"hi\"" ` +
+		`ratio=0.25 server.port=8080 tags="[\"x\"]" uni=héllo up=true` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n     got: %s\nexpected: %s", buf.String(), expected)
+	}
+
+	text, err := flat.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text)+"\n" != expected {
+		t.Errorf("Unexpected text: %s", text)
+	}
+
+	// Values are read each time.
+	val.Gone, val.Ratio = 3, 1e21
+	text, _ = flatjson.Map{"gone": flat["gone"], "ratio": flat["ratio"]}.MarshalText()
+	if string(text) != "gone=3 ratio=1000000000000000000000" {
+		t.Errorf("Unexpected text: %s", text)
+	}
+}
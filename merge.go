@@ -0,0 +1,64 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"sort"
+)
+
+var flatMapType = reflect.TypeOf(Map(nil))
+
+// isMergedMap reports whether v, described by n, holds a Map whose entries
+// are merged into the one being built: it is either a Map, or another map
+// type with the same underlying type whose field is tagged with merge.
+func isMergedMap(v reflect.Value, n node) bool {
+	if v.Kind() != reflect.Map || !v.CanInterface() {
+		return false
+	}
+	return v.Type() == flatMapType || n.merge && v.Type().ConvertibleTo(flatMapType)
+}
+
+// flattenMerged adds the entries of m, the Map held by the value described by
+// n, with n's prefix prepended to their keys. The values are added as they
+// are, so entries pointing into another struct stay live. Values which are
+// Maps themselves are merged the same way, under their key.
+func (f *flattener) flattenMerged(m Map, n node) int {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	added := 0
+	for _, key := range keys {
+		full := n.prefix + key
+		value := m[key]
+		switch v := value.(type) {
+		case Map:
+			sn := n
+			sn.prefix = full + f.opts.Separator
+			added += f.flattenMerged(v, sn)
+			continue
+		case *dynamic:
+			// Expanded under the merged key, as it is found in the output.
+			d := *v
+			d.node.key = full
+			d.node.prefix = n.prefix + v.node.prefix
+			value = &d
+		default:
+			value = f.hookValue(full, value, n)
+		}
+
+		if f.opts.StrictKeys {
+			f.checkKey(full, n)
+		}
+		if f.output.add(full, value) {
+			f.duplicates = append(f.duplicates, full)
+		}
+		added++
+	}
+	return added
+}
@@ -0,0 +1,84 @@
+package flatjson_test
+
+import (
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestMergeMaps(t *testing.T) {
+	child := &Child{1, "a"}
+	inner := &struct {
+		Child flatjson.Map `json:"child"`
+		N     int          `json:"n"`
+	}{Child: flatjson.Flatten(child), N: 2}
+
+	val := &struct {
+		Inner  flatjson.Map           `json:"inner"`
+		Extra  map[string]interface{} `json:"extra,merge"`
+		Plain  map[string]interface{} `json:"plain"`
+		Nested flatjson.Map           `json:"nested"`
+		Nil    flatjson.Map           `json:"nil"`
+	}{
+		Inner:  flatjson.Flatten(inner),
+		Extra:  map[string]interface{}{"x": &child.C},
+		Plain:  map[string]interface{}{"y": 3},
+		Nested: flatjson.Map{"deeper": flatjson.Map{"z": 4}},
+	}
+
+	flat := flatjson.Flatten(val)
+	expected := flatjson.Map{
+		"inner.child.CC":  1.0,
+		"inner.child.CD":  "a",
+		"inner.n":         2.0,
+		"extra.x":         1.0,
+		"plain":           map[string]interface{}{"y": 3.0},
+		"nested.deeper.z": 4.0,
+	}
+	testEncoding(t, flat, expected)
+
+	// The merged entries still point into the structs they came from.
+	child.C, inner.N = 5, 6
+	expected["inner.child.CC"], expected["inner.n"], expected["extra.x"] = 5.0, 6.0, 5.0
+	testEncoding(t, flat, expected)
+
+	// Entries added to a merged Map later don't appear.
+	val.Inner["late"] = 7
+	testEncoding(t, flat, expected)
+}
+
+func TestMergeMapsDuplicateKeys(t *testing.T) {
+	val := &struct {
+		Stats flatjson.Map `json:"stats"`
+		N     int          `json:"stats.n"`
+	}{Stats: flatjson.Map{"n": 1}}
+
+	if m, err := flatjson.FlattenE(val); err == nil {
+		t.Errorf("Expected an error for colliding keys, got %v", m)
+	}
+	opts := flatjson.Options{AllowDuplicateKeys: true}
+	if _, err := opts.Flatten(val); err != nil {
+		t.Error(err)
+	}
+
+	// Tagged with noflatten, the Map is a single entry.
+	testFlattening(t, &struct {
+		Stats flatjson.Map `json:"stats" flatjson:",noflatten"`
+	}{flatjson.Map{"n": 1}}, flatjson.Map{"stats": map[string]interface{}{"n": 1.0}})
+}
+
+func TestMergeDynamicMaps(t *testing.T) {
+	inner := &struct {
+		Any interface{} `json:"any"`
+	}{Child{1, "a"}}
+	opts := flatjson.Options{DynamicInterfaces: true}
+	val := &struct {
+		Inner flatjson.Map `json:"inner"`
+	}{flatjson.FlattenWithOptions(inner, opts)}
+
+	flat := flatjson.FlattenWithOptions(val, opts)
+	testEncoding(t, flat, flatjson.Map{"inner.any.CC": 1.0, "inner.any.CD": "a"})
+
+	inner.Any = 2
+	testEncoding(t, flat, flatjson.Map{"inner.any": 2.0})
+}
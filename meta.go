@@ -0,0 +1,120 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// FieldMeta describes the struct field an entry of a Map was flattened from,
+// for exporters that need more than the value, like help text from a struct
+// tag. It is recorded with Options.RecordMeta.
+type FieldMeta struct {
+	// Field is the struct field, as declared in its struct type, with its
+	// Name, Tag and Type. For the elements of slices and maps, and the fields
+	// of the structs they hold, it is the field they are nested in, up to
+	// the nearest struct field.
+	Field reflect.StructField
+
+	// Path holds the names of the struct fields leading to the field from
+	// the flattened struct, including embedded ones, and Index their indexes
+	// in their structs. Slice and map elements, and the values held by
+	// interfaces, don't add to them.
+	Path  []string
+	Index []int
+
+	// Unit and Help are the values of the field's tags named by
+	// Options.UnitTag and Options.HelpTag, if it has them.
+	Unit, Help string
+}
+
+// child returns the FieldMeta for field, a field of the struct described by
+// m, or of the flattened struct if m is nil, which is being flattened
+// according to opts.
+func (m *FieldMeta) child(field reflect.StructField, opts Options) *FieldMeta {
+	unitTag, helpTag := opts.UnitTag, opts.HelpTag
+	if unitTag == "" {
+		unitTag = "unit"
+	}
+	if helpTag == "" {
+		helpTag = "help"
+	}
+
+	c := &FieldMeta{Field: field, Unit: field.Tag.Get(unitTag), Help: field.Tag.Get(helpTag)}
+	if m != nil {
+		c.Path = append(c.Path, m.Path...)
+		c.Index = append(c.Index, m.Index...)
+	}
+	c.Path = append(c.Path, field.Name)
+	c.Index = append(c.Index, field.Index...)
+	return c
+}
+
+// Meta returns the FieldMeta recorded for the entry under key when the Map
+// was flattened with Options.RecordMeta. It returns false if there is no such
+// entry, or no FieldMeta was recorded for it, as for entries added by Add.
+func (m Map) Meta(key string) (FieldMeta, bool) {
+	if meta := metaOf(m[key]); meta != nil {
+		return *meta, true
+	}
+	return FieldMeta{}, false
+}
+
+// Metas returns the FieldMetas recorded for the entries of m, by key, as by
+// Meta.
+func (m Map) Metas() map[string]FieldMeta {
+	metas := map[string]FieldMeta{}
+	for key, value := range m {
+		if meta := metaOf(value); meta != nil {
+			metas[key] = *meta
+		}
+	}
+	return metas
+}
+
+// keyMeta is the description of a key in the document returned by MetaJSON.
+type keyMeta struct {
+	Unit string `json:"unit,omitempty"`
+	Help string `json:"help,omitempty"`
+	Type string `json:"type,omitempty"`
+}
+
+// MetaJSON returns a JSON object describing each key of m, for publishing
+// alongside the values, as in {"rss":{"unit":"bytes","help":"resident set
+// size","type":"uint64"}}. The unit and help members hold the FieldMeta.Unit
+// and FieldMeta.Help recorded for the entry, so they are only there if the Map
+// was flattened with Options.RecordMeta and the field has the tags, and type
+// is the Go type of the entry's current value, left out if it has none, like
+// a nil interface. The keys are those the Map has when it is encoded, with the
+// entries of interface fields flattened with Options.DynamicInterfaces
+// described as they currently are.
+func (m Map) MetaJSON() ([]byte, error) {
+	m = m.expandDynamic()
+	doc := make(map[string]keyMeta, len(m))
+	for key, value := range m {
+		var km keyMeta
+		if meta := metaOf(value); meta != nil {
+			km.Unit, km.Help = meta.Unit, meta.Help
+		}
+		if v := resolve(value); v.IsValid() {
+			km.Type = v.Type().String()
+		}
+		doc[key] = km
+	}
+	return json.Marshal(doc)
+}
+
+// metaOf returns the innermost FieldMeta recorded for the Map value v, which
+// for entries merged from another Map is the one recorded there.
+func metaOf(v interface{}) *FieldMeta {
+	var meta *FieldMeta
+	for e, ok := v.(*entry); ok; e, ok = e.value.(*entry) {
+		if e.meta != nil {
+			meta = e.meta
+		}
+	}
+	return meta
+}
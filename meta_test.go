@@ -0,0 +1,123 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type HelpStats struct {
+	Uptime int `json:"uptime" help:"Seconds since start."`
+}
+
+type HelpServer struct {
+	HelpStats
+	Port   int            `json:"listen_port" help:"The port to listen on."`
+	Pools  []Pool         `json:"pools"`
+	Limits map[string]int `json:"limits"`
+	Inner  struct {
+		Depth int `help:"Nesting depth."`
+	} `json:"inner"`
+	hidden int `help:"Unexported."`
+}
+
+func TestMeta(t *testing.T) {
+	val := &HelpServer{Pools: []Pool{{}}, Limits: map[string]int{"a": 1}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{RecordMeta: true, IndexSlices: true, FlattenMaps: true, IncludeUnexported: true})
+	testEncoding(t, flat, flatjson.Map{
+		"uptime":         0.0,
+		"listen_port":    0.0,
+		"pools.0.active": 0.0,
+		"pools.0.idle":   0.0,
+		"limits.a":       1.0,
+		"inner.Depth":    0.0,
+		"hidden":         0.0,
+	})
+
+	for _, test := range []struct {
+		key   string
+		name  string
+		help  string
+		path  []string
+		index []int
+	}{
+		{"uptime", "Uptime", "Seconds since start.", []string{"HelpStats", "Uptime"}, []int{0, 0}},
+		{"listen_port", "Port", "The port to listen on.", []string{"Port"}, []int{1}},
+		{"pools.0.idle", "Idle", "", []string{"Pools", "Idle"}, []int{2, 1}},
+		{"limits.a", "Limits", "", []string{"Limits"}, []int{3}},
+		{"inner.Depth", "Depth", "Nesting depth.", []string{"Inner", "Depth"}, []int{4, 0}},
+		{"hidden", "hidden", "Unexported.", []string{"hidden"}, []int{5}},
+	} {
+		meta, ok := flat.Meta(test.key)
+		if !ok {
+			t.Errorf("Expected metadata for %q", test.key)
+			continue
+		}
+		if meta.Field.Name != test.name || meta.Field.Tag.Get("help") != test.help ||
+			!reflect.DeepEqual(meta.Path, test.path) || !reflect.DeepEqual(meta.Index, test.index) {
+			t.Errorf("Unexpected metadata for %q: %+v", test.key, meta)
+		}
+	}
+
+	if meta, _ := flat.Meta("listen_port"); meta.Field.Type != reflect.TypeOf(0) {
+		t.Errorf("Unexpected type %v", meta.Field.Type)
+	}
+	if metas := flat.Metas(); len(metas) != len(flat) {
+		t.Errorf("Expected metadata for every entry, got %v", metas)
+	}
+
+	// Entries still point into the struct, and accessors see through them.
+	val.Port = 80
+	if port, ok := flat.GetInt64("listen_port"); !ok || port != 80 {
+		t.Errorf("Unexpected port %d", port)
+	}
+
+	// Without the option, or for added entries, nothing is recorded.
+	if _, ok := flatjson.Flatten(val).Meta("listen_port"); ok {
+		t.Error("Expected no metadata without RecordMeta")
+	}
+	flat.Add("extra", &val.Port)
+	if _, ok := flat.Meta("extra"); ok {
+		t.Error("Expected no metadata for an added entry")
+	}
+	if _, ok := flat.Meta("missing"); ok {
+		t.Error("Expected no metadata for a missing key")
+	}
+}
+
+func TestMetaJSON(t *testing.T) {
+	val := &struct {
+		RSS     uint64  `json:"rss" unit:"bytes" help:"Resident set size."`
+		Load    float64 `desc:"Load average." u:"1"`
+		Name    string
+		Latency struct {
+			Max int64 `unit:"ms"`
+		} `json:"latency"`
+	}{}
+
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{RecordMeta: true})
+	flat.AddFunc("uptime", func() interface{} { return 1.5 })
+	enc, err := flat.MetaJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Load":{"type":"float64"},"Name":{"type":"string"},"latency.Max":{"unit":"ms","type":"int64"},"rss":{"unit":"bytes","help":"Resident set size.","type":"uint64"},"uptime":{"type":"float64"}}`
+	if string(enc) != expected {
+		t.Errorf("Unexpected metadata:\n     got: %s\nexpected: %s", enc, expected)
+	}
+
+	// The tag names can be changed, and without RecordMeta there are just
+	// the types.
+	flat = flatjson.FlattenWithOptions(val, flatjson.Options{RecordMeta: true, UnitTag: "u", HelpTag: "desc"})
+	if meta, _ := flat.Meta("Load"); meta.Unit != "1" || meta.Help != "Load average." {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+	if meta, _ := flat.Meta("rss"); meta.Unit != "" || meta.Help != "" {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+	enc, _ = flatjson.Flatten(val).MetaJSON()
+	if expected := `{"Load":{"type":"float64"},"Name":{"type":"string"},"latency.Max":{"type":"int64"},"rss":{"type":"uint64"}}`; string(enc) != expected {
+		t.Errorf("Unexpected metadata without RecordMeta: %s", enc)
+	}
+}
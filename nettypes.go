@@ -0,0 +1,54 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+)
+
+// builtinTextTypes are network types which are always added as a single entry,
+// like builtinLeafTypes, and encoded as the string their String method
+// returns. encoding/json would encode the fields of the structs, and the
+// bytes of a net.HardwareAddr in base64. net.IP and the net/netip types
+// don't need to be listed, since they are encoded through their MarshalText
+// methods already.
+var builtinTextTypes = []reflect.Type{
+	reflect.TypeOf(net.IPNet{}),
+	reflect.TypeOf(net.HardwareAddr(nil)),
+	reflect.TypeOf(url.URL{}),
+}
+
+// isBuiltinTextType reports whether t is one of builtinTextTypes.
+func isBuiltinTextType(t reflect.Type) bool {
+	for _, tt := range builtinTextTypes {
+		if t == tt {
+			return true
+		}
+	}
+	return false
+}
+
+// netText returns the text of v, after dereferencing pointers, if it is a
+// value of one of builtinTextTypes: the result of its String method, or an
+// empty string for the zero value, which String formats as "<nil>" for a
+// net.IPNet.
+func netText(v reflect.Value) (string, bool) {
+	v = indirectValue(v)
+	if !v.IsValid() || !isBuiltinTextType(v.Type()) {
+		return "", false
+	}
+	if isZero(v) {
+		return "", true
+	}
+	if !v.CanAddr() {
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		v = c
+	}
+	return v.Addr().Interface().(fmt.Stringer).String(), true
+}
@@ -0,0 +1,45 @@
+//go:build go1.18
+// +build go1.18
+
+package flatjson_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestNetipTypes(t *testing.T) {
+	val := &struct {
+		Addr       netip.Addr     `json:"addr"`
+		Prefix     netip.Prefix   `json:"prefix"`
+		AddrPort   netip.AddrPort `json:"addr_port"`
+		ZeroAddr   netip.Addr     `json:"zero_addr"`
+		ZeroPrefix netip.Prefix   `json:"zero_prefix"`
+		OmitAddr   netip.Addr     `json:"omit_addr,omitempty"`
+		OmitPrefix netip.Prefix   `json:"omit_prefix,omitempty"`
+	}{
+		Addr:     netip.MustParseAddr("::1"),
+		Prefix:   netip.MustParsePrefix("10.0.0.0/8"),
+		AddrPort: netip.MustParseAddrPort("10.0.0.1:80"),
+	}
+
+	flat := flatjson.Flatten(val)
+	expected := flatjson.Map{
+		"addr":        "::1",
+		"prefix":      "10.0.0.0/8",
+		"addr_port":   "10.0.0.1:80",
+		"zero_addr":   "",
+		"zero_prefix": "",
+	}
+	testEncoding(t, flat, expected)
+
+	val.OmitAddr = netip.MustParseAddr("10.0.0.2")
+	expected["omit_addr"] = "10.0.0.2"
+	testEncoding(t, flat, expected)
+
+	if s := flat.Strings(false); s["prefix"] != "10.0.0.0/8" || s["zero_addr"] != "" {
+		t.Errorf("Unexpected strings: %v", s)
+	}
+}
@@ -0,0 +1,80 @@
+package flatjson_test
+
+import (
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestNetTypes(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	mac, _ := net.ParseMAC("00:11:22:33:44:55")
+	endpoint, _ := url.Parse("https://example.com/metrics?x=1")
+
+	val := &struct {
+		IP       net.IP           `json:"ip"`
+		Network  net.IPNet        `json:"network"`
+		MAC      net.HardwareAddr `json:"mac"`
+		URL      url.URL          `json:"url"`
+		Endpoint *url.URL         `json:"endpoint"`
+		NetPtr   *net.IPNet       `json:"net_ptr"`
+
+		ZeroIP      net.IP           `json:"zero_ip"`
+		ZeroNetwork net.IPNet        `json:"zero_network"`
+		ZeroMAC     net.HardwareAddr `json:"zero_mac"`
+		ZeroURL     url.URL          `json:"zero_url"`
+		NilURL      *url.URL         `json:"nil_url"`
+
+		OmitNetwork net.IPNet        `json:"omit_network,omitempty"`
+		OmitMAC     net.HardwareAddr `json:"omit_mac,omitempty"`
+		OmitURL     url.URL          `json:"omit_url,omitempty"`
+		OmitPtr     *url.URL         `json:"omit_ptr,omitempty"`
+	}{
+		IP:       net.IPv4(10, 0, 0, 1),
+		Network:  *network,
+		MAC:      mac,
+		URL:      *endpoint,
+		Endpoint: endpoint,
+		NetPtr:   network,
+	}
+
+	flat := flatjson.Flatten(val)
+	expected := flatjson.Map{
+		"ip":           "10.0.0.1",
+		"network":      "10.0.0.0/8",
+		"mac":          "00:11:22:33:44:55",
+		"url":          "https://example.com/metrics?x=1",
+		"endpoint":     "https://example.com/metrics?x=1",
+		"net_ptr":      "10.0.0.0/8",
+		"zero_ip":      "",
+		"zero_network": "",
+		"zero_mac":     "",
+		"zero_url":     "",
+		"nil_url":      nil,
+	}
+	testEncoding(t, flat, expected)
+
+	// Values are formatted when the Map is encoded.
+	val.Endpoint.Path = "/other"
+	val.OmitURL.Host = "b"
+	expected["endpoint"] = "https://example.com/other?x=1"
+	expected["omit_url"] = "//b"
+	testEncoding(t, flat, expected)
+
+	strs := flat.Strings(false)
+	for key, s := range map[string]string{"network": "10.0.0.0/8", "mac": "00:11:22:33:44:55", "url": "https://example.com/metrics?x=1", "zero_network": ""} {
+		if strs[key] != s {
+			t.Errorf("Unexpected string for %q: %q, expected %q", key, strs[key], s)
+		}
+	}
+
+	// The flatten tag option still flattens the fields.
+	flat = flatjson.Flatten(&struct {
+		URL url.URL `json:"url" flatjson:",flatten"`
+	}{url.URL{Scheme: "http", Host: "a"}})
+	if s, ok := flat.GetString("url.Host"); !ok || s != "a" {
+		t.Errorf("Expected the fields of the URL to be flattened, got %v", flat)
+	}
+}
@@ -0,0 +1,554 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// Options controls how a struct is flattened. The zero value produces the same
+// Map as Flatten.
+type Options struct {
+	// Separator is inserted between the key segments of nested fields. It
+	// defaults to ".", and is ignored with KeyFormatJSONPointer.
+	Separator string
+
+	// KeyFormat chooses how key segments are joined into keys. By default
+	// they are joined with Separator.
+	KeyFormat KeyFormat
+
+	// Prefix is prepended to every key, followed by the separator, so a
+	// Prefix of "db" produces keys like db.Pool.Active. The prefix should
+	// not end with the separator itself.
+	Prefix string
+
+	// IndexSlices causes slices and arrays of structs to be flattened element
+	// by element, with each element's index as a key segment, so a Points
+	// []Point field produces Points.0.X, Points.1.X and so on. Slices of other
+	// element types are still added as a single entry.
+	//
+	// The element entries point into the slice's backing array as it was at
+	// flatten time, so changes to the elements are reflected when the Map is
+	// encoded but changes to the slice itself are not: appending elements won't
+	// add entries, and if the slice is reallocated the entries keep pointing at
+	// the old array. Flatten again after changing the length of such a slice.
+	IndexSlices bool
+
+	// KeepEmptySlices causes an empty slice or array to be added as a single
+	// entry when IndexSlices is set, rather than producing no entries at all.
+	KeepEmptySlices bool
+
+	// FlattenMaps causes maps to be flattened element by element, with each
+	// element's key as a key segment, so a Counters map[string]int64 field
+	// produces Counters.requests, Counters.errors and so on. Struct elements
+	// are flattened further. Keys that aren't strings are formatted with
+	// MarshalText or String if they implement those methods, and with their
+	// default format otherwise.
+	//
+	// Map elements aren't addressable, so rather than pointers, their entries
+	// look the element up again each time the Map is encoded: updating the
+	// value stored under a key is reflected, and a key that has since been
+	// deleted encodes as null. The set of entries is fixed at flatten time,
+	// though, so keys added to the map later won't appear until it is
+	// flattened again, and an empty map produces no entries at all. Elements
+	// that are pointers to structs are dereferenced at flatten time, as with
+	// struct fields.
+	FlattenMaps bool
+
+	// FlattenMarshalers causes types implementing json.Marshaler or
+	// encoding.TextMarshaler to be flattened like any other type. By default
+	// they are added as a single entry, so that they are encoded the same way
+	// encoding/json would encode them. Embedded fields are always flattened.
+	FlattenMarshalers bool
+
+	// Stringers causes values implementing fmt.Stringer, like time.Duration
+	// or enums with a String method, to be encoded as the string returned by
+	// String rather than as their underlying value. As with omitempty, String
+	// is called each time the Map is encoded, so later changes are reflected.
+	// Types that also implement json.Marshaler or encoding.TextMarshaler are
+	// still encoded by those methods, and nil pointers encode as null. The
+	// stringer tag option, as in flatjson:",stringer", has the same effect
+	// for a single field.
+	Stringers bool
+
+	// ErrorStrings causes fields of type error, and other values whose
+	// static type is error, like the elements of an []error, to be added as
+	// single entries encoded as the message returned by the current error's
+	// Error method, or as null while it is nil. Errors implementing
+	// json.Marshaler or encoding.TextMarshaler are still encoded by those
+	// methods. By default, error fields are encoded the way encoding/json
+	// encodes the value they hold, which for most error types is {}.
+	ErrorStrings bool
+
+	// TimeFormat controls how time.Time values, and pointers to them, are
+	// encoded when the Map is encoded. It is either one of TimeUnix,
+	// TimeUnixMilli and TimeUnixNano, which encode the time as an integer
+	// number of seconds, milliseconds or nanoseconds since the Unix epoch, or
+	// a layout for time.Time.Format, like time.RFC3339, which encodes it as a
+	// string. By default times are encoded by their MarshalJSON method, as
+	// encoding/json would. When a TimeFormat is set, fields tagged with
+	// omitempty are also left out while they hold the zero time.
+	TimeFormat string
+
+	// DurationFormat controls how time.Duration values, and pointers to
+	// them, are encoded when the Map is encoded. By default they are encoded
+	// as an integer number of nanoseconds, as encoding/json would. The
+	// durfmt tag option, as in flatjson:",durfmt=ms", sets the format for a
+	// single field, taking precedence over DurationFormat; its value is one
+	// of string, s, ms or ns. The tag option also applies to fields of other
+	// types with an int64 kind, such as named types defined as
+	// time.Duration, which can't be told apart from other integers.
+	DurationFormat DurationFormat
+
+	// LeafTypes lists types whose values are added as a single entry rather
+	// than being flattened further, in addition to those registered with
+	// RegisterLeafType. Values of types assignable to an interface type in
+	// the list are too.
+	LeafTypes []reflect.Type
+
+	// NilStructs controls what happens to fields holding a nil pointer to a
+	// struct, including through any number of pointers and interfaces, such
+	// as a nil **T or an interface holding a nil *T. By default they are
+	// added as a single entry which encodes as null. Interfaces holding no
+	// value at all are always added that way.
+	NilStructs NilStructPolicy
+
+	// NilPointers controls how entries holding a pointer, such as those for
+	// *int fields, are encoded while the pointer is nil. It is evaluated each
+	// time the Map is encoded, so an entry follows the pointer as it is set
+	// and reset. Pointers to structs that aren't nil when flattening are
+	// flattened, or encoded as the struct they point to, so the policy only
+	// applies to them if they are nil at that point; see NilStructs.
+	NilPointers NilPointerPolicy
+
+	// EmptyStructs controls what happens to nested struct fields which add no
+	// entries of their own when flattened, because the struct has no fields,
+	// or none that are exported, or all of them are skipped. By default they
+	// are added as a single entry encoding the whole struct, which is often
+	// just {}.
+	EmptyStructs EmptyStructPolicy
+
+	// CopyValues allows a struct to be flattened when it is passed by value
+	// rather than by pointer, by flattening a copy of it instead. The Map
+	// then points into the copy, so it is only useful for encoding the
+	// struct as it was when it was flattened: later changes to the original
+	// are not reflected. Without this option, passing a struct by value is
+	// an error.
+	CopyValues bool
+
+	// KeyCase converts keys derived from field names to a different case.
+	// Names given explicitly in struct tags are used as they are.
+	KeyCase KeyCase
+
+	// TagNames lists the struct tags field names and tag options are read
+	// from, in order of precedence: the first of them present on a field is
+	// used, and the others are ignored, so that structs tagged for other
+	// encodings, like yaml or mapstructure, keep the same names. It defaults
+	// to json alone. A flatjson tag still takes precedence over all of them.
+	TagNames []string
+
+	// EagerOmitEmpty evaluates omitempty tag options when the struct is
+	// flattened, leaving out fields which are empty at that point for good.
+	// By default, entries for fields tagged with omitempty are kept, and are
+	// left out whenever the Map is encoded while their value is empty.
+	//
+	// By default, a nested struct tagged with omitempty has all of its
+	// entries left out while every one of them is empty, and included again
+	// once any of them is set. With EagerOmitEmpty, the struct as a whole is
+	// compared to its zero value at flatten time instead. Fields flattened by
+	// a FlattenFunc or a Flattener are always evaluated when the struct is
+	// flattened.
+	//
+	// Values are empty the way encoding/json defines it: false, 0, nil
+	// pointers and interfaces, and arrays, slices, maps and strings of length
+	// zero. Unlike encoding/json, which never leaves out structs, structs are
+	// empty when all of their fields are zero. That applies to structs encoded
+	// as a whole, like time.Time, as well as to nested structs with
+	// EagerOmitEmpty.
+	//
+	// The omitzero tag option, which leaves out fields holding the zero value
+	// of their type or whose IsZero method reports true, is evaluated the same
+	// way, at flatten time with EagerOmitEmpty and otherwise whenever the Map
+	// is encoded.
+	EagerOmitEmpty bool
+
+	// AllowDuplicateKeys lets a field replace the entry of an earlier field
+	// that produced the same key, such as a field tagged json:"a.b" and a
+	// field B nested under A. By default, flattening fails with an error
+	// listing the duplicate keys.
+	AllowDuplicateKeys bool
+
+	// RejectAmbiguousFields causes flattening to fail when fields promoted
+	// from embedded structs are left out because they are ambiguous. Like
+	// encoding/json, when several fields would produce the same key, the
+	// least nested one is used, preferring one whose name comes from a tag;
+	// if there is no single such field, all of them are left out.
+	RejectAmbiguousFields bool
+
+	// MaxDepth limits how many key segments a key can have, not counting
+	// Prefix. A struct, slice or map that would be flattened beyond that
+	// depth is added as a single entry instead, so that it is encoded as
+	// nested JSON; like other entries, it points at the field, so the
+	// nested JSON follows later changes to it. Fields of embedded structs are
+	// at the same depth as the fields of the struct they are embedded in.
+	// Zero means no limit.
+	MaxDepth int
+
+	// IncludeLocks adds entries for fields holding locks, like sync.Mutex,
+	// sync.RWMutex and sync.Once, or pointers to them, and for structs that
+	// hold nothing but locks and unexported state, such as those with a
+	// noCopy field. By default they are skipped, since their contents are
+	// unexported and they would only be encoded as {}. Structs which embed
+	// a lock alongside exported fields are flattened either way.
+	IncludeLocks bool
+
+	// IncludeUnexported adds entries for unexported fields too, which is
+	// useful for inspecting internal state while debugging. Unlike other
+	// entries, these hold a copy of the field's value made when the struct
+	// is flattened, so they are snapshots: later changes to the field aren't
+	// encoded, and they can't be written with Set or Zero, even when they
+	// hold pointers. The values are added as
+	// leaves, without flattening them further, and only their exported
+	// contents are encoded, as by encoding/json. Fields of types
+	// encoding/json can't encode, like channels, are left out, as are locks
+	// unless IncludeLocks is set. Embedded fields of unexported types are
+	// handled as they are without it.
+	IncludeUnexported bool
+
+	// Unsafe speeds up flattening structs whose fields, including those of
+	// structs nested in them by value, all have predeclared boolean,
+	// numeric or string types and no tag options, by recording the offsets
+	// of their fields the first time the type is seen and adding the
+	// entries straight from them, using package unsafe. The Map is the same
+	// as without it. Other structs, such as those with pointer, interface
+	// or embedded fields, and those flattened with options checked for
+	// every field, like FieldFilter or RedactFunc, are flattened as usual,
+	// though structs nested in them may still take the fast path.
+	Unsafe bool
+
+	// EscapeSeparators escapes occurrences of the separator in key segments
+	// taken from field names, tags and map keys, so that a field tagged
+	// json:"disk.usage" can be told apart from a field usage nested under a
+	// field disk. Each backslash and each occurrence of the separator's first
+	// character is preceded by a backslash, so the key for the tagged field
+	// becomes disk\.usage. Use SplitKey to split such keys back into
+	// segments. The separator must not contain a backslash itself.
+	EscapeSeparators bool
+
+	// RejectUnsupported causes flattening to fail when a field is left out
+	// because encoding/json can't encode its type. Fields of function,
+	// channel, unsafe.Pointer and complex types, and of pointer, slice, array
+	// and map types built from them, are left out by default, so that a
+	// single such field doesn't make every encoding of the Map fail. Types
+	// implementing json.Marshaler or encoding.TextMarshaler are encoded as
+	// usual.
+	RejectUnsupported bool
+
+	// NonFinite controls how NaN and infinite values of float fields, and
+	// pointers to them, are encoded. By default, as with encoding/json, such
+	// a value makes encoding the Map fail. The other policies replace it in
+	// the entry of the field alone, each time the Map is encoded, so that
+	// every other entry can still be encoded. Floats inside entries holding
+	// slices, maps or structs are not replaced.
+	NonFinite NonFinitePolicy
+
+	// BytesFormat determines how fields of []byte types, and of types based
+	// on []byte, are encoded, each time the Map is encoded. It can be
+	// overridden for a field with the hex, rawstring and base64 tag options,
+	// as in json:"hash,hex". In each format, a nil slice is encoded as null
+	// and an empty one as an empty string.
+	BytesFormat BytesFormat
+
+	// FloatPrecision rounds the values of float fields, and pointers to
+	// them, to this many significant digits each time the Map is encoded, so
+	// that 1.0/3 is encoded as 0.333 with a precision of 3. Rounded values are
+	// encoded like any other float, without an exponent unless encoding/json
+	// would use one, so a whole number stays one as long as it has no more
+	// digits than the precision; 12345 becomes 12300 with a precision of 3.
+	// Values are rounded according to their own size, float32 or float64.
+	// Floats inside entries holding slices, maps or structs are not rounded.
+	// The text exporters, like CSVWriter and WriteGraphite, and Strings round
+	// them the same way. By default, floats are encoded with as many digits
+	// as it takes to tell them apart from any other float.
+	FloatPrecision int
+
+	// KeySanitizer rewrites key segments to follow the naming rules of a
+	// metrics backend, like SanitizePrometheus. Fields whose keys become
+	// the same once rewritten are reported as duplicate keys.
+	KeySanitizer KeySanitizer
+
+	// SanitizeFunc, if set, rewrites key segments in the same way as
+	// KeySanitizer, which it takes precedence over.
+	SanitizeFunc func(segment string) string
+
+	// StrictKeys causes flattening to fail if a key has an empty segment,
+	// such as one produced by a tag like json:"a..b", or a segment holding
+	// whitespace, control characters or invalid UTF-8, or if KeyPattern is
+	// set and the key doesn't match it. The error names the struct field
+	// each bad key comes from. Use Validate to check the keys of a type once,
+	// at startup.
+	StrictKeys bool
+
+	// KeyPattern, if set, is the pattern every key must match when
+	// StrictKeys is set, such as ^[a-z_.]+$. Keys include Prefix.
+	KeyPattern *regexp.Regexp
+
+	// IgnoreUnknownKeys causes UnmarshalFlat and UnmarshalMap to skip keys
+	// that don't match a field or an entry without returning an error.
+	IgnoreUnknownKeys bool
+
+	// FieldFilter, if set, is called for each field before it is added or
+	// flattened further. If it returns false, the field is left out along
+	// with everything nested under it. The path is the key the field would
+	// be added under, which the keys nested under it start with, for
+	// example db.pool; for embedded structs and fields tagged with inline,
+	// whose fields are added without a key segment of their own, it is the
+	// key of the struct containing them, or Prefix at the top level. The
+	// value is the field's value at flatten time.
+	FieldFilter func(path string, field reflect.StructField, v reflect.Value) bool
+
+	// Include and Exclude, if set, restrict the keys of the Map to those
+	// matching one of the Include patterns, or all keys if there are none,
+	// which don't match any of the Exclude patterns, so that Exclude wins.
+	// Patterns are matched against keys, including Prefix, segment by
+	// segment, with each pattern segment matching a key segment as by
+	// path.Match, such as * for any segment, except that ** matches any
+	// number of segments. A key also matches a pattern if it is nested under
+	// a key that does, so db keeps everything under db, as does db.*, and
+	// **.password leaves out every field named password along with anything
+	// nested under it. Fields whose keys can't lead to a kept key, like
+	// those under internal for an Exclude pattern of internal, aren't
+	// flattened at all. An error is returned if a pattern is malformed.
+	Include, Exclude []string
+
+	// IgnoreFields lists the keys of fields that are left out along with
+	// everything nested under them, like Meta.BuildInfo or db.credentials,
+	// for structs from other packages whose tags can't be changed. Each is
+	// a whole key, including Prefix and with the key segments the tags of
+	// the fields give them, matched exactly rather than as a pattern. The
+	// fields aren't flattened at all. Validate reports the keys that don't
+	// name a field, so that typos don't go unnoticed.
+	IgnoreFields []string
+
+	// ValueFunc, if set, is called with the key and current value of each
+	// entry each time the Map is encoded or exported, as by MarshalTo,
+	// Values or WritePrometheus, and the value it returns is used in its
+	// place, for last-mile transforms like rounding a duration to whole
+	// seconds. ValueFuncs holds functions doing the same for the entries
+	// under particular keys, including Prefix, which are called before
+	// ValueFunc if both apply. The fields themselves are never modified, and
+	// accessors like Get and Set still use them, but the functions must not
+	// modify what they are passed either, such as the elements of a slice.
+	// The values they return are encoded as encoding/json encodes them, so
+	// options like durfmt no longer apply, while omitempty still looks at the
+	// field.
+	//
+	// Validate reports the keys of ValueFuncs no field is flattened under.
+	ValueFunc  func(key string, v interface{}) interface{}
+	ValueFuncs map[string]func(v interface{}) interface{}
+
+	// RedactFunc, if set, is called with the key and current value of each
+	// entry each time the Map is encoded, and can hide the value by returning
+	// a replacement to encode instead, such as Redacted for keys containing
+	// "secret". Fields tagged with the redact option, as in
+	// flatjson:",redact" or json:"password,redact", are always hidden: their
+	// value is encoded as Redacted if it is a string and as null otherwise,
+	// and the same goes for the fields nested under them. The struct itself
+	// is never modified, and other exports, like Walk and Strings, still see
+	// the actual values.
+	RedactFunc RedactFunc
+
+	// RecordMeta records a FieldMeta describing the struct field each entry
+	// comes from, such as its tag, which Map.Meta returns. The entries hold
+	// on to them, so the Map takes more memory.
+	RecordMeta bool
+
+	// UnitTag and HelpTag name the struct tags holding the unit and the
+	// description of a field, which RecordMeta records as FieldMeta.Unit and
+	// FieldMeta.Help, as in unit:"bytes" help:"resident set size". They
+	// default to unit and help.
+	UnitTag, HelpTag string
+
+	// ComplexObjects causes complex numbers, and pointers to them, to be
+	// encoded as a JSON object holding the real and imaginary parts, as in
+	// {"real":1,"imag":-2}, rather than being left out.
+	ComplexObjects bool
+
+	// DynamicInterfaces causes fields of interface types to be flattened
+	// again, according to the value they hold at the time, each time the Map
+	// is encoded with MarshalJSON, WriteTo or MarshalTo, by a DeltaEncoder or
+	// one of the text exporters other than CSVWriter, whose columns are fixed,
+	// or copied with Values. That way a struct assigned to the field after
+	// flattening has its fields added, and a struct replaced by another value
+	// has its entries replaced too. The keys in the output can therefore
+	// differ between encodings and snapshots of the same Map. Everything else,
+	// like Get, sees the field as a single entry holding the interface's
+	// current value.
+	//
+	// By default, an interface field holding a struct when it is flattened
+	// has its fields flattened once, and any other interface field, including
+	// a nil one, is added as a single entry which is encoded as the value the
+	// interface holds at the time.
+	//
+	// A single interface field can be flattened this way by tagging it with
+	// dynamic, as in flatjson:",dynamic". Interface fields of the structs it
+	// holds are then only flattened again if they are tagged too.
+	DynamicInterfaces bool
+
+	// MapLocker, if set, is held while the elements of map fields tagged
+	// with dynamicmap are read, each time the Map is encoded, for maps that
+	// other goroutines modify while holding it.
+	//
+	// A map field tagged with dynamicmap, as in flatjson:",dynamicmap", is
+	// flattened the way Options.FlattenMaps flattens maps, but again each time
+	// the Map is encoded, in sorted key order, so that the entries of an
+	// element added to the map after flattening appear and those of a
+	// removed one vanish without calling Refresh. Only the map is read under
+	// MapLocker: an element held by value is looked up in the map again when
+	// its entries are encoded, so a map modified concurrently should hold
+	// pointers to structs, whose fields are then read without the lock.
+	// Like an interface field with Options.DynamicInterfaces, the field is a
+	// single entry for everything but encoding and snapshots.
+	MapLocker sync.Locker
+
+	// TypeKey, if set, adds an entry under this key, such as "_type", whose
+	// value names the type of the flattened struct, so that consumers of
+	// streams carrying several types can tell them apart. Like the keys of
+	// the fields, the key has Prefix prepended, so each part of Compose has
+	// its own. The name is the one the struct gives itself if it implements
+	// TypeNamer, and is otherwise formatted according to TypeNames. An error
+	// is returned if a field has the same key. UnmarshalFlat and UnmarshalMap
+	// skip the key.
+	TypeKey string
+
+	// TypeNames determines how the names of types are formatted for
+	// TypeKey.
+	TypeNames TypeNameFormat
+
+	// MaxKeys, if positive, limits the number of entries a flattening adds,
+	// to guard consumers against structs whose maps or slices produce more
+	// keys than they can handle. The traversal stops as soon as the limit is
+	// exceeded, so the rest of the struct isn't visited, and OnLimit decides
+	// what happens then. Each part of Compose and each element of FlattenEach
+	// has its own limit. Interfaces flattened with DynamicInterfaces and map
+	// fields tagged with dynamicmap count as a single entry, since they are
+	// only expanded when the Map is encoded.
+	MaxKeys int
+
+	// OnLimit determines what happens when MaxKeys is exceeded.
+	OnLimit LimitPolicy
+}
+
+// An EmptyStructPolicy determines how struct fields which add no entries are
+// flattened.
+type EmptyStructPolicy int
+
+const (
+	// EmptyStructLeaf adds the field as a single entry pointing at the
+	// struct, which is encoded the way encoding/json would encode it.
+	EmptyStructLeaf EmptyStructPolicy = iota
+
+	// EmptyStructSkip leaves the field out of the Map entirely.
+	EmptyStructSkip
+
+	// EmptyStructLeafIfMarshaler adds the field as a single entry if its type
+	// implements json.Marshaler or encoding.TextMarshaler, which only gets
+	// here with FlattenMarshalers, and leaves it out otherwise. That keeps
+	// marker structs and those holding only unexported state out of the Map.
+	EmptyStructLeafIfMarshaler
+)
+
+// A NilStructPolicy determines how nil pointer to struct fields are flattened.
+type NilStructPolicy int
+
+const (
+	// NilStructNull adds the field as a single entry pointing at the nil
+	// pointer, which encodes as null. The struct's fields won't appear even
+	// if the pointer is assigned later. Embedded structs, and those tagged
+	// with inline, have no key of their own, so they are left out instead.
+	NilStructNull NilStructPolicy = iota
+
+	// NilStructSkip leaves the field out of the Map entirely. This includes
+	// pointers to structs encoded as a whole, like *time.Time and *big.Int.
+	NilStructSkip
+
+	// NilStructAllocate allocates the struct, and any intermediate pointers,
+	// and flattens it like any other. This modifies the flattened value, but
+	// the struct's fields appear in the Map and stay live as long as the
+	// pointer isn't replaced. To keep self-referential types from being
+	// allocated forever, a pointer isn't allocated if its struct type is
+	// already being flattened further up; it is added as a null entry
+	// instead. Pointers that aren't addressable, like those stored in maps,
+	// can't be allocated either, and neither can those held by interfaces.
+	// Pointers to structs encoded as a whole, like *time.Time and *big.Int,
+	// aren't allocated; they are added as null entries.
+	NilStructAllocate
+)
+
+// A NilPointerPolicy determines how entries holding a nil pointer are encoded.
+type NilPointerPolicy int
+
+const (
+	// NilPointerKeep encodes the entry as null.
+	NilPointerKeep NilPointerPolicy = iota
+
+	// NilPointerOmit leaves the entry out while the pointer is nil.
+	NilPointerOmit
+
+	// NilPointerZero encodes the entry as the zero value of the type the
+	// pointer points to, as if it pointed to one, with the same options.
+	NilPointerZero
+)
+
+// A TypeNameFormat determines how the names of types are formatted for
+// Options.TypeKey.
+type TypeNameFormat int
+
+const (
+	// TypeNameString formats names as reflect.Type.String does, with the
+	// name of the package, as in "flatjson.Options".
+	TypeNameString TypeNameFormat = iota
+
+	// TypeNameQualified formats names with the full import path of the
+	// package, as in "github.com/pushrax/flatjson.Options", which tells
+	// types of packages with the same name apart.
+	TypeNameQualified
+)
+
+// A LimitPolicy determines what happens when flattening would add more entries
+// than Options.MaxKeys.
+type LimitPolicy int
+
+const (
+	// LimitError aborts flattening with an error of kind ErrKeyLimit, which
+	// Flatten panics with.
+	LimitError LimitPolicy = iota
+
+	// LimitTruncate keeps the entries added before the limit was exceeded,
+	// in the order they were added: the order the fields are declared in,
+	// and sorted key order for map elements. An entry holding true is added
+	// under TruncatedKey, with Options.Prefix prepended, in addition to them.
+	LimitTruncate
+)
+
+// TruncatedKey is the key of the entry marking a Map truncated with
+// LimitTruncate.
+const TruncatedKey = "_truncated"
+
+// withDefaults returns a copy of o with unset fields replaced by their
+// default values.
+func (o Options) withDefaults() Options {
+	if o.KeyFormat == KeyFormatJSONPointer {
+		o.Separator, o.EscapeSeparators = "/", false
+	} else if o.Separator == "" {
+		o.Separator = "."
+	}
+	if o.TagNames == nil {
+		o.TagNames = []string{"json"}
+	}
+	return o
+}
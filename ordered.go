@@ -0,0 +1,127 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"reflect"
+)
+
+// An OrderedMap is the flattened representation of a struct, like a Map, which
+// keeps its entries in the order the fields are declared in. The fields of an
+// embedded struct appear where the embedded field is declared.
+type OrderedMap struct {
+	entries []orderedEntry
+	index   map[string]int
+}
+
+type orderedEntry struct {
+	key   string
+	value interface{}
+}
+
+// FlattenOrdered returns the OrderedMap representation of val, which must be a
+// pointer to a struct. It panics if val can't be flattened; see
+// Options.FlattenOrdered.
+func FlattenOrdered(val interface{}) *OrderedMap {
+	m, err := Options{}.FlattenOrdered(val)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// FlattenOrdered returns the OrderedMap representation of val, flattened
+// according to o. It fails in the same cases as Options.Flatten.
+func (o Options) FlattenOrdered(val interface{}) (*OrderedMap, error) {
+	m := &OrderedMap{index: map[string]int{}}
+	if err := flattenValue(reflect.ValueOf(val), o, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// add appends an entry. If the key is already present, its value is replaced
+// but the entry keeps its position.
+func (m *OrderedMap) add(key string, value interface{}) bool {
+	if i, ok := m.index[key]; ok {
+		m.entries[i].value = value
+		return true
+	}
+
+	m.index[key] = len(m.entries)
+	m.entries = append(m.entries, orderedEntry{key, value})
+	return false
+}
+
+// Get returns the value stored under key, as it would be stored in a Map.
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	i, ok := m.index[key]
+	if !ok {
+		return nil, false
+	}
+	return m.entries[i].value, true
+}
+
+// Len returns the number of entries in m.
+func (m *OrderedMap) Len() int {
+	return len(m.entries)
+}
+
+// Range calls fn for each entry in m, in order, until fn returns false.
+func (m *OrderedMap) Range(fn func(key string, value interface{}) bool) {
+	for _, e := range m.entries {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Index returns the position of each key of m in its order, which is the
+// column index of the key in the rows returned by Row. Since it follows the
+// order the fields are declared in, it is the same for every struct of the
+// same type, and stays the same across restarts as long as the struct
+// definition, the keys of flattened maps and the lengths of flattened slices
+// don't change. Fields added to the end of a struct are added after
+// the keys of the fields before them, which keep their indexes, and fields
+// added within are added among them, without reordering them.
+func (m *OrderedMap) Index() map[string]int {
+	index := make(map[string]int, len(m.index))
+	for key, i := range m.index {
+		index[key] = i
+	}
+	return index
+}
+
+// Row returns the current values in m, in order, for use as a row of a
+// columnar store. Pointers are dereferenced, so nil pointers are returned as
+// nil, and entries for fields tagged with omitempty are included even if they
+// are currently empty.
+func (m *OrderedMap) Row() []interface{} {
+	row := make([]interface{}, len(m.entries))
+	for i, e := range m.entries {
+		if rv := indirectValue(resolve(e.value)); rv.IsValid() {
+			row[i] = rv.Interface()
+		}
+	}
+	return row
+}
+
+// MarshalJSON encodes m as a JSON object with its entries in order. Like a
+// Map, entries for fields tagged with omitempty are left out if the field's
+// current value is empty.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	ow := objectWriter{w: &buf}
+	ow.begin()
+	for _, e := range m.entries {
+		ow.entry(e.key, e.value)
+	}
+	if err := ow.end(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,127 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestFlattenOrdered(t *testing.T) {
+	val := &struct {
+		Z     int
+		Child        // Embedded.
+		A     string `json:"a,omitempty"`
+		Other Child
+	}{Z: 1, Child: Child{2, "3"}}
+
+	flat := flatjson.FlattenOrdered(val)
+
+	var keys []string
+	flat.Range(func(key string, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	expected := []string{"Z", "CC", "CD", "a", "Other.CC", "Other.CD"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected key order:\n     got: %v\nexpected: %v", keys, expected)
+	}
+	if flat.Len() != len(expected) {
+		t.Errorf("Expected Len %d, got %d", len(expected), flat.Len())
+	}
+
+	testOrderedEncoding(t, flat, `{"Z":1,"CC":2,"CD":"3","Other.CC":0,"Other.CD":""}`)
+
+	// Entries stay live, like those of a Map.
+	val.A = "x"
+	val.Other.C = 4
+	testOrderedEncoding(t, flat, `{"Z":1,"CC":2,"CD":"3","a":"x","Other.CC":4,"Other.CD":""}`)
+
+	if v, ok := flat.Get("Other.CC"); !ok || v != &val.Other.C {
+		t.Errorf("Expected Get to return a pointer to the field, got %#v", v)
+	}
+	if _, ok := flat.Get("missing"); ok {
+		t.Error("Expected Get to report a missing key")
+	}
+
+	var n int
+	flat.Range(func(key string, value interface{}) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Errorf("Expected Range to stop after 2 entries, got %d", n)
+	}
+}
+
+func TestFlattenOrderedErrors(t *testing.T) {
+	if m, err := (flatjson.Options{}).FlattenOrdered(Child{}); err == nil {
+		t.Errorf("Expected error for struct value, got %#v", m)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected FlattenOrdered to panic for nil")
+		}
+	}()
+	flatjson.FlattenOrdered(nil)
+}
+
+func testOrderedEncoding(t *testing.T, flat *flatjson.OrderedMap, expected string) {
+	enc, err := json.Marshal(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(enc) != expected {
+		t.Errorf("Encoded to unexpected value:\n     got: %s\nexpected: %s", enc, expected)
+	}
+}
+
+func TestOrderedIndex(t *testing.T) {
+	type columns struct {
+		Z     int
+		Child // Embedded.
+		Ptr   *int
+		Other Child `json:"other,omitempty"`
+	}
+	val := &columns{Z: 1, Child: Child{2, "3"}}
+
+	index := flatjson.FlattenOrdered(val).Index()
+	expected := map[string]int{"Z": 0, "CC": 1, "CD": 2, "Ptr": 3, "other.CC": 4, "other.CD": 5}
+	if !reflect.DeepEqual(index, expected) {
+		t.Errorf("Unexpected index:\n     got: %v\nexpected: %v", index, expected)
+	}
+
+	// The same for another value of the type.
+	if again := flatjson.FlattenOrdered(&columns{Other: Child{C: 1}}).Index(); !reflect.DeepEqual(again, index) {
+		t.Errorf("Expected the same index for another value, got %v", again)
+	}
+
+	// Keys of fields added to the end keep their indexes.
+	extended := flatjson.FlattenOrdered(&struct {
+		columns
+		Added string
+	}{}).Index()
+	for key, i := range index {
+		if extended[key] != i {
+			t.Errorf("Expected %q to keep index %d, got %d", key, i, extended[key])
+		}
+	}
+
+	flat := flatjson.FlattenOrdered(val)
+	row := flat.Row()
+	if !reflect.DeepEqual(row, []interface{}{1, 2, "3", nil, 0, ""}) {
+		t.Errorf("Unexpected row: %#v", row)
+	}
+
+	n := 7
+	val.Ptr, val.Other.C, val.Child.D = &n, 4, "x"
+	row = flat.Row()
+	if !reflect.DeepEqual(row, []interface{}{1, 2, "x", 7, 4, ""}) {
+		t.Errorf("Unexpected row after changes: %#v", row)
+	}
+	if row[index["other.CC"]] != 4 {
+		t.Errorf("Expected the row to be ordered by the index, got %#v", row)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+)
+
+// A Pair is a single entry of the flattened representation of a struct. Value
+// holds the same value a Map would store under Key.
+type Pair struct {
+	Key   string
+	Value interface{}
+}
+
+// Pairs is the flattened representation of a struct as a slice, in the order
+// the fields are declared in, like an OrderedMap. A slice is cheaper to build
+// and iterate over than a Map, and can be reused across calls to AppendPairs.
+type Pairs []Pair
+
+// FlattenPairs returns the Pairs representation of val, which must be a
+// pointer to a struct. It panics if val can't be flattened; see
+// Options.AppendPairs.
+func FlattenPairs(val interface{}) Pairs {
+	return AppendPairs(nil, val)
+}
+
+// AppendPairs appends the Pairs representation of val to dst and returns the
+// extended slice, so that the slice can be pooled. It panics if val can't be
+// flattened; see Options.AppendPairs.
+func AppendPairs(dst Pairs, val interface{}) Pairs {
+	p, err := Options{}.AppendPairs(dst, val)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// AppendPairs appends the Pairs representation of val, flattened according to
+// o, to dst and returns the extended slice. It fails in the same cases as
+// Options.Flatten, in which case dst is returned unchanged. Only the pairs
+// appended are checked for duplicate keys, not those already in dst.
+func (o Options) AppendPairs(dst Pairs, val interface{}) (Pairs, error) {
+	s := &pairSink{pairs: dst, start: len(dst)}
+	if err := flattenValue(reflect.ValueOf(val), o, s); err != nil {
+		return dst[:s.start], err
+	}
+	return s.pairs, nil
+}
+
+// pairSinkScan is the number of pairs a pairSink searches linearly for a
+// repeated key before it indexes them in a map.
+const pairSinkScan = 32
+
+// pairSink is the sink for AppendPairs. Most structs produce few enough
+// entries that scanning them is cheaper than maintaining an index.
+type pairSink struct {
+	pairs Pairs
+	start int
+	index map[string]int
+}
+
+// add appends a pair. If the key is already present, its value is replaced
+// but the pair keeps its position.
+func (s *pairSink) add(key string, value interface{}) bool {
+	if i, ok := s.find(key); ok {
+		s.pairs[i].Value = value
+		return true
+	}
+
+	if s.index != nil {
+		s.index[key] = len(s.pairs)
+	}
+	s.pairs = append(s.pairs, Pair{key, value})
+	return false
+}
+
+func (s *pairSink) find(key string) (int, bool) {
+	added := s.pairs[s.start:]
+	if s.index == nil && len(added) >= pairSinkScan {
+		s.index = make(map[string]int, 2*len(added))
+		for i, p := range added {
+			s.index[p.Key] = s.start + i
+		}
+	}
+
+	if s.index != nil {
+		i, ok := s.index[key]
+		return i, ok
+	}
+	for i := range added {
+		if added[i].Key == key {
+			return s.start + i, true
+		}
+	}
+	return 0, false
+}
+
+// Map returns a Map holding the same entries as p, so that the methods of Map
+// can be used with it. If a key appears more than once, the last value wins.
+func (p Pairs) Map() Map {
+	m := make(Map, len(p))
+	for _, pair := range p {
+		m[pair.Key] = pair.Value
+	}
+	return m
+}
+
+// MarshalJSON encodes p as a JSON object with its entries in order. Like a
+// Map, entries for fields tagged with omitempty are left out if the field's
+// current value is empty.
+func (p Pairs) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	ow := objectWriter{w: &buf}
+	ow.begin()
+	for _, pair := range p {
+		ow.entry(pair.Key, pair.Value)
+	}
+	if err := ow.end(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalTo writes the same encoding of p as MarshalJSON to w, avoiding most
+// of its allocations in the same way as Map.MarshalTo.
+func (p Pairs) MarshalTo(w io.Writer) error {
+	return streamEntries(w, indentation{}, len(p), func(i int) (string, interface{}) {
+		return p[i].Key, p[i].Value
+	})
+}
@@ -0,0 +1,165 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestFlattenPairs(t *testing.T) {
+	val := &ConnStats{Remote: "10.0.0.1", BytesIn: 5, Child: &Child{2, "3"}}
+	val.Latency.Max = 1.5
+
+	pairs := flatjson.FlattenPairs(val)
+	flat := flatjson.Flatten(val)
+
+	if got := pairs.Map(); !reflect.DeepEqual(got, flat) {
+		t.Errorf("Pairs differ from the Map:\n     got: %v\nexpected: %v", got, flat)
+	}
+	if len(pairs) != len(flat) {
+		t.Errorf("Expected %d pairs, got %d", len(flat), len(pairs))
+	}
+
+	// Pairs are in declaration order, like an OrderedMap.
+	ordered := flatjson.FlattenOrdered(val)
+	i := 0
+	ordered.Range(func(key string, value interface{}) bool {
+		if i >= len(pairs) || pairs[i].Key != key {
+			t.Errorf("Expected pair %d to have key %q, got %v", i, key, pairs)
+			return false
+		}
+		i++
+		return true
+	})
+
+	enc, err := json.Marshal(pairs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oenc, _ := json.Marshal(ordered)
+	if string(enc) != string(oenc) {
+		t.Errorf("Encoded to unexpected value:\n     got: %s\nexpected: %s", enc, oenc)
+	}
+
+	var buf bytes.Buffer
+	if err := pairs.MarshalTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(enc) {
+		t.Errorf("MarshalTo differs from MarshalJSON:\n     got: %s\nexpected: %s", buf.String(), enc)
+	}
+
+	// Entries stay live, like those of a Map.
+	val.BytesIn = 7
+	if enc, _ := json.Marshal(pairs); !bytes.Contains(enc, []byte(`"bytes_in":7`)) {
+		t.Errorf("Expected the updated field to be encoded, got %s", enc)
+	}
+}
+
+func TestAppendPairs(t *testing.T) {
+	a := &Child{1, "a"}
+	b := &struct{ Other Child }{Child{2, "b"}}
+
+	buf := make(flatjson.Pairs, 0, 8)
+	pairs := flatjson.AppendPairs(buf, a)
+	pairs = flatjson.AppendPairs(pairs, b)
+
+	expected := flatjson.Pairs{
+		{"CC", &a.C}, {"CD", &a.D},
+		{"Other.CC", &b.Other.C}, {"Other.CD", &b.Other.D},
+	}
+	if !reflect.DeepEqual(pairs, expected) {
+		t.Errorf("Unexpected pairs:\n     got: %v\nexpected: %v", pairs, expected)
+	}
+	if &pairs[0] != &buf[:1][0] {
+		t.Error("Expected the pairs to be appended to the given slice")
+	}
+
+	// Reusing the buffer.
+	pairs = flatjson.AppendPairs(pairs[:0], a)
+	if len(pairs) != 2 || pairs[0].Value != &a.C {
+		t.Errorf("Unexpected pairs after reuse: %v", pairs)
+	}
+}
+
+func TestAppendPairsErrors(t *testing.T) {
+	dst := flatjson.Pairs{{"x", 1}}
+	val := &struct {
+		A int
+		B int `flatjson:"A"`
+	}{}
+
+	pairs, err := flatjson.Options{}.AppendPairs(dst, val)
+	if err == nil {
+		t.Errorf("Expected duplicate key error, got %v", pairs)
+	}
+	if !reflect.DeepEqual(pairs, dst) {
+		t.Errorf("Expected dst to be returned unchanged, got %v", pairs)
+	}
+
+	// A replaced key keeps its position.
+	pairs, err = flatjson.Options{AllowDuplicateKeys: true}.AppendPairs(nil, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 || pairs[0].Value != &val.B {
+		t.Errorf("Expected the later field to replace the earlier one, got %v", pairs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected FlattenPairs to panic for nil")
+		}
+	}()
+	flatjson.FlattenPairs(nil)
+}
+
+func TestAppendPairsManyFields(t *testing.T) {
+	// Enough entries that duplicates are found through an index.
+	fields := make([]reflect.StructField, 0, 41)
+	for i := 0; i < 40; i++ {
+		fields = append(fields, reflect.StructField{Name: fmt.Sprintf("F%d", i), Type: reflect.TypeOf(0)})
+	}
+	fields = append(fields, reflect.StructField{
+		Name: "Dup",
+		Type: reflect.TypeOf(0),
+		Tag:  `flatjson:"F35"`,
+	})
+	val := reflect.New(reflect.StructOf(fields)).Interface()
+
+	if _, err := (flatjson.Options{}).AppendPairs(flatjson.Pairs{{"F1", 0}}, val); err == nil {
+		t.Error("Expected duplicate key error")
+	}
+
+	fields = fields[:40]
+	val = reflect.New(reflect.StructOf(fields)).Interface()
+	pairs, err := flatjson.Options{}.AppendPairs(nil, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pairs.Map(), flatjson.Flatten(val)) {
+		t.Error("Pairs differ from the Map")
+	}
+}
+
+func BenchmarkAppendPairs(b *testing.B) {
+	val := &ConnStats{Child: &Child{}}
+	var pairs flatjson.Pairs
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pairs = flatjson.AppendPairs(pairs[:0], val)
+	}
+}
+
+func BenchmarkPairsMarshalTo(b *testing.B) {
+	pairs := flatjson.FlattenPairs(&ConnStats{Child: &Child{}})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		pairs.MarshalTo(ioutil.Discard)
+	}
+}
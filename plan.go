@@ -0,0 +1,179 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A structPlan holds what flattening a struct type needs to know about its
+// fields that doesn't depend on their values, so that tags are parsed and keys
+// are built only the first time the type is flattened with a given key
+// format. Everything that depends on values, like nil pointers, interfaces,
+// omitempty and the length of slices, is still decided while flattening.
+type structPlan struct {
+	fields []fieldPlan
+
+	// promoted holds the promoted fields of the struct, or nil if it has no
+	// embedded structs.
+	promoted *fieldSet
+}
+
+// A fieldPlan describes one field of a struct type. Fields which never
+// produce entries, like unexported ones without IncludeUnexported, are left
+// out of the plan.
+type fieldPlan struct {
+	index      int
+	key        string // The key segment, escaped and converted as configured.
+	anonymous  bool   // Set for embedded fields which are inlined.
+	unexported bool
+	inline     bool // Set for struct fields tagged with inline.
+	embedded   bool // Set if anonymous and the field's type is a struct.
+	readOnly   bool // Set for unexported fields with IncludeUnexported.
+
+	// The tag options that apply to the field.
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool
+	noflatten bool
+	stringer  bool
+	flatten   bool
+	durfmt    string
+	bytesfmt  string
+	redact    bool
+	merge     bool
+	dynamic   bool
+	dynMap    bool
+}
+
+// A planKey identifies a struct type along with the options that affect the
+// keys produced for its fields.
+type planKey struct {
+	typ        reflect.Type
+	separator  string
+	keyCase    KeyCase
+	escape     bool
+	keyFormat  KeyFormat
+	sanitizer  KeySanitizer
+	tagNames   string // The TagNames, joined by commas.
+	unexported bool   // IncludeUnexported.
+}
+
+// plans caches the structPlans built so far, keyed by planKey.
+var plans sync.Map
+
+// plan returns the structPlan for t, building it the first time t is seen with
+// the key format of f.opts. Plans for a SanitizeFunc, which can't be told
+// apart from other functions, are only kept for the traversal.
+func (f *flattener) plan(t reflect.Type) *structPlan {
+	if f.opts.SanitizeFunc != nil {
+		p, ok := f.plans[t]
+		if !ok {
+			if f.plans == nil {
+				f.plans = map[reflect.Type]*structPlan{}
+			}
+			p = f.buildPlan(t)
+			f.plans[t] = p
+		}
+		return p
+	}
+
+	key := f.planKeyFor(t)
+	if p, ok := plans.Load(key); ok {
+		return p.(*structPlan)
+	}
+
+	p, _ := plans.LoadOrStore(key, f.buildPlan(t))
+	return p.(*structPlan)
+}
+
+// planKeyFor returns the planKey for t with the key format of f.opts.
+func (f *flattener) planKeyFor(t reflect.Type) planKey {
+	return planKey{t, f.opts.Separator, f.opts.KeyCase, f.opts.EscapeSeparators, f.opts.KeyFormat, f.opts.KeySanitizer, strings.Join(f.opts.TagNames, ","), f.opts.IncludeUnexported}
+}
+
+func (f *flattener) buildPlan(t reflect.Type) *structPlan {
+	p := &structPlan{promoted: f.promotedFields(t)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, anonymous, opts := f.keyForField(field)
+		readOnly := !anonymous && field.PkgPath != "" && f.opts.IncludeUnexported
+		if !anonymous && (field.PkgPath != "" && !readOnly || key == "") {
+			continue
+		}
+
+		p.fields = append(p.fields, fieldPlan{
+			index:      i,
+			key:        key,
+			anonymous:  anonymous,
+			unexported: field.PkgPath != "",
+			inline:     !anonymous && isInlineField(field, opts),
+			embedded:   anonymous && embeddedStruct(field.Type) != nil,
+			readOnly:   readOnly,
+			omitEmpty:  opts.Contains("omitempty"),
+			omitZero:   opts.Contains("omitzero"),
+			quoted:     opts.Contains("string") && isQuotable(field.Type),
+			noflatten:  opts.Contains("noflatten"),
+			stringer:   opts.Contains("stringer"),
+			flatten:    opts.Contains("flatten"),
+			durfmt:     opts.Get("durfmt"),
+			bytesfmt:   bytesTag(opts),
+			redact:     opts.Contains("redact"),
+			merge:      opts.Contains("merge"),
+			dynamic:    opts.Contains("dynamic"),
+			dynMap:     opts.Contains("dynamicmap"),
+		})
+	}
+	return p
+}
+
+// A typeInfo caches facts about a type that are checked for every value
+// flattened, including the hooks registered for it.
+type typeInfo struct {
+	flattenFunc FlattenFunc
+	unwrap      UnwrapFunc
+	leaf        bool // Registered with RegisterLeafType.
+	marshaler   bool
+	atomic      bool
+	lock        bool
+	unsupported bool // Can't be encoded by encoding/json.
+}
+
+type typeKey struct {
+	typ        reflect.Type
+	generation uint64
+}
+
+var (
+	typeInfos sync.Map // Keyed by typeKey.
+
+	// registrations counts the calls to RegisterFlattener, RegisterLeafType
+	// and RegisterUnwrap, so that typeInfos built before one of them aren't
+	// used.
+	registrations uint64
+)
+
+// infoFor returns the typeInfo for t.
+func infoFor(t reflect.Type) *typeInfo {
+	key := typeKey{t, atomic.LoadUint64(&registrations)}
+	if info, ok := typeInfos.Load(key); ok {
+		return info.(*typeInfo)
+	}
+
+	info, _ := typeInfos.LoadOrStore(key, &typeInfo{
+		flattenFunc: registeredFlattener(t),
+		unwrap:      registeredUnwrap(t),
+		leaf:        isRegisteredLeafType(t),
+		marshaler:   isMarshaler(t),
+		atomic:      isAtomic(t),
+		lock:        isLock(t),
+		unsupported: isUnsupported(t),
+	})
+	return info.(*typeInfo)
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// PrometheusOptions controls how a Map is written in the Prometheus text
+// format.
+type PrometheusOptions struct {
+	// Help holds the HELP text for the metrics, keyed by the Map keys they
+	// are produced from.
+	Help map[string]string
+
+	// Strings causes string values to be written as info-style metrics with
+	// an _info suffix, a value of 1 and the string as the value label, rather
+	// than being skipped.
+	Strings bool
+}
+
+// WritePrometheus writes the numeric values in m to w as gauges in the
+// Prometheus text exposition format, in sorted key order. It is
+// WritePrometheusWithOptions with the zero PrometheusOptions.
+func (m Map) WritePrometheus(w io.Writer, namespace string) error {
+	return m.WritePrometheusWithOptions(w, namespace, PrometheusOptions{})
+}
+
+// WritePrometheusWithOptions writes the numeric values in m to w as gauges in
+// the Prometheus text exposition format, in sorted key order. The metric names
+// are the keys, prefixed with namespace and an underscore if namespace isn't
+// empty, with each character not allowed in metric names, such as the
+// separator, replaced by an underscore. An underscore is prepended to names
+// that would start with a digit.
+//
+// Integers, floats and booleans, as 0 or 1, are written, along with strings
+// if opts.Strings is set. Entries of other kinds and nil pointers are
+// skipped. An error is returned, before anything is written, if two keys
+// produce the same metric name.
+func (m Map) WritePrometheusWithOptions(w io.Writer, namespace string, opts PrometheusOptions) error {
+	m = m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	type metric struct {
+		key, name, sample string
+	}
+	var metrics []metric
+	names := map[string]string{}
+
+	for _, key := range *keys {
+		v := resolve(m[key])
+		name := prometheusName(namespace, key)
+
+		var sample string
+		if value, ok := formatPrometheusValue(v, textOptions(m[key])); ok {
+			sample = name + " " + value
+		} else if s, ok := stringValue(v); ok && opts.Strings {
+			name += "_info"
+			sample = name + `{value="` + prometheusEscaper.Replace(s) + `"} 1`
+		} else {
+			continue
+		}
+
+		if other, ok := names[name]; ok {
+			return &Error{Op: "WritePrometheus", Key: other, kind: ErrDuplicateKey, msg: fmt.Sprintf("flatjson: keys %q and %q produce the same metric name %s", other, key, name)}
+		}
+		names[name] = key
+		metrics = append(metrics, metric{key, name, sample})
+	}
+
+	for _, metric := range metrics {
+		var text string
+		if help, ok := opts.Help[metric.key]; ok {
+			text = "# HELP " + metric.name + " " + prometheusHelpEscaper.Replace(help) + "\n"
+		}
+		text += "# TYPE " + metric.name + " gauge\n" + metric.sample + "\n"
+
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	prometheusEscaper     = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	prometheusHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// prometheusName returns the metric name for key.
+func prometheusName(namespace, key string) string {
+	name := key
+	if namespace != "" {
+		name = namespace + "_" + key
+	}
+
+	name = strings.Map(prometheusRune, name)
+
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// prometheusRune replaces the characters not allowed in metric names with an
+// underscore.
+func prometheusRune(r rune) rune {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return r
+	case r == '_' || r == ':':
+		return r
+	}
+	return '_'
+}
+
+// formatPrometheusValue is like formatNumber, but formats non-finite floats
+// the way Prometheus expects them.
+func formatPrometheusValue(v reflect.Value, o formatOptions) (string, bool) {
+	if value, ok := formatNumber(v, o); ok {
+		return value, true
+	}
+
+	v = indirectValue(v)
+	if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+		return "", false
+	}
+	switch f := v.Float(); {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "+Inf", true
+	default:
+		return "-Inf", true
+	}
+}
+
+// stringValue returns v, after dereferencing pointers, if it is a string.
+func stringValue(v reflect.Value) (string, bool) {
+	v = indirectValue(v)
+	if v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
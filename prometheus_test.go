@@ -0,0 +1,129 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+var (
+	metricName    = `[a-zA-Z_:][a-zA-Z0-9_:]*`
+	prometheusRes = []*regexp.Regexp{
+		regexp.MustCompile(`^# HELP ` + metricName + ` .*$`),
+		regexp.MustCompile(`^# TYPE ` + metricName + ` gauge$`),
+		regexp.MustCompile(`^` + metricName + `(\{[a-zA-Z_][a-zA-Z0-9_]*="([^"\\]|\\[\\"n])*"\})? ([-+]?[0-9.]+|NaN|[-+]Inf)$`),
+	}
+)
+
+// testPrometheusFormat checks that every line of output follows the text
+// exposition format.
+func testPrometheusFormat(t *testing.T, output string) {
+	if !strings.HasSuffix(output, "\n") {
+		t.Errorf("Output doesn't end with a newline:\n%s", output)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		valid := false
+		for _, re := range prometheusRes {
+			valid = valid || re.MatchString(line)
+		}
+		if !valid {
+			t.Errorf("Invalid line %q", line)
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	val := &struct {
+		Requests int     `json:"requests"`
+		Ratio    float64 `json:"ratio"`
+		Up       bool    `json:"up"`
+		Version  string  `json:"version"`
+		Nil      *int    `json:"nil"`
+		Pool     Pool    `json:"db.pool"`
+		Buckets  struct {
+			P99 float64 `json:"99th-percentile"`
+		}
+	}{Requests: 5, Ratio: math.NaN(), Up: true, Version: "1.\"2\"\n"}
+	val.Buckets.P99 = math.Inf(1)
+	flat := flatjson.Flatten(val)
+
+	var buf bytes.Buffer
+	if err := flat.WritePrometheus(&buf, "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = `# TYPE app_Buckets_99th_percentile gauge
+app_Buckets_99th_percentile +Inf
+# TYPE app_db_pool_active gauge
+app_db_pool_active 0
+# TYPE app_db_pool_idle gauge
+app_db_pool_idle 0
+# TYPE app_ratio gauge
+app_ratio NaN
+# TYPE app_requests gauge
+app_requests 5
+# TYPE app_up gauge
+app_up 1
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+	testPrometheusFormat(t, buf.String())
+
+	buf.Reset()
+	opts := flatjson.PrometheusOptions{
+		Help:    map[string]string{"requests": "Requests served,\nin total.", "version": `The \ version.`},
+		Strings: true,
+	}
+	if err := flat.Filter("requests").WritePrometheusWithOptions(&buf, "", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := flat.Filter("version").WritePrometheusWithOptions(&buf, "", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	const expectedWithOptions = `# HELP requests Requests served,\nin total.
+# TYPE requests gauge
+requests 5
+# HELP version_info The \\ version.
+# TYPE version_info gauge
+version_info{value="1.\"2\"\n"} 1
+`
+	if buf.String() != expectedWithOptions {
+		t.Errorf("Unexpected output with options:\n%s", buf.String())
+	}
+	testPrometheusFormat(t, buf.String())
+}
+
+func TestWritePrometheusNames(t *testing.T) {
+	val := &struct {
+		First int `json:"1st"`
+	}{}
+
+	var buf bytes.Buffer
+	if err := flatjson.Flatten(val).WritePrometheus(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "# TYPE _1st gauge\n_1st 0\n" {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+	testPrometheusFormat(t, buf.String())
+
+	// Names can collide once sanitized.
+	collide := &struct {
+		A int `json:"a.b"`
+		B int `json:"a_b"`
+	}{}
+	buf.Reset()
+	if err := flatjson.Flatten(collide).WritePrometheus(&buf, ""); err == nil {
+		t.Error("Expected error for colliding metric names")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got:\n%s", buf.String())
+	}
+}
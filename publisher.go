@@ -0,0 +1,158 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// A Publisher periodically writes the JSON encoding of a Map to an io.Writer,
+// one newline-terminated document per write.
+type Publisher struct {
+	m        Map
+	w        io.Writer
+	interval time.Duration
+
+	skipUnchanged bool
+	timestampKey  string
+	onError       func(error)
+	locker        sync.Locker
+
+	mu        sync.Mutex // Serializes publishing.
+	published bool
+	lastHash  uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// A PublishOption configures a Publisher.
+type PublishOption func(*Publisher)
+
+// PublishSkipUnchanged skips writing a document if the values haven't changed
+// since the last one written, as determined by Map.Hash.
+func PublishSkipUnchanged() PublishOption {
+	return func(p *Publisher) { p.skipUnchanged = true }
+}
+
+// PublishTimestamp adds the time of each write to the document under key, as
+// an RFC 3339 string. It is ignored when checking for unchanged values.
+func PublishTimestamp(key string) PublishOption {
+	return func(p *Publisher) { p.timestampKey = key }
+}
+
+// PublishErrors sets the function called with the errors from writes made by
+// the Publisher's goroutine. By default they are dropped, and the Publisher
+// tries again on the next tick either way.
+func PublishErrors(fn func(error)) PublishOption {
+	return func(p *Publisher) { p.onError = fn }
+}
+
+// PublishLocker makes the Publisher copy the values while holding l, as
+// LockedMap does.
+func PublishLocker(l sync.Locker) PublishOption {
+	return func(p *Publisher) { p.locker = l }
+}
+
+// NewPublisher returns a Publisher writing m to w every interval, once it is
+// started.
+func NewPublisher(m Map, w io.Writer, interval time.Duration, opts ...PublishOption) *Publisher {
+	p := &Publisher{m: m, w: w, interval: interval}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Start starts writing the Map every interval from a new goroutine, until Stop
+// is called. Calling Start on a running Publisher does nothing.
+func (p *Publisher) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+
+	p.stop, p.done = make(chan struct{}), make(chan struct{})
+	go p.run(p.stop, p.done)
+}
+
+// Stop stops the goroutine started by Start and waits for it to exit. Calling
+// Stop on a Publisher that isn't running does nothing.
+func (p *Publisher) Stop() {
+	p.mu.Lock()
+	stop, done := p.stop, p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (p *Publisher) run(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := p.Publish(); err != nil && p.onError != nil {
+				p.onError(err)
+			}
+		}
+	}
+}
+
+// Publish writes the Map immediately, unless it is unchanged and the
+// Publisher skips unchanged values. It returns the error from encoding or
+// writing the document.
+func (p *Publisher) Publish() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := p.m
+	if p.locker != nil {
+		m = m.WithLock(p.locker).Snapshot()
+	}
+
+	var hash uint64
+	if p.skipUnchanged {
+		hash = m.Hash()
+		if p.published && hash == p.lastHash {
+			return nil
+		}
+	}
+
+	if p.timestampKey != "" {
+		stamped := make(Map, len(m)+1)
+		for key, value := range m {
+			stamped[key] = value
+		}
+		now := time.Now().Round(0)
+		stamped[p.timestampKey] = &now
+		m = stamped
+	}
+
+	var buf bytes.Buffer
+	if err := m.writeJSON(&buf); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	p.published, p.lastHash = true, hash
+	return nil
+}
@@ -0,0 +1,132 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestPublisher(t *testing.T) {
+	val := &struct{ Requests int }{}
+	var buf bytes.Buffer
+	p := flatjson.NewPublisher(flatjson.Flatten(val), &buf, time.Hour, flatjson.PublishSkipUnchanged())
+
+	for i := 0; i < 3; i++ {
+		if err := p.Publish(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	val.Requests++
+	if err := p.Publish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(); err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = "{\"Requests\":0}\n{\"Requests\":1}\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n     got: %q\nexpected: %q", buf.String(), expected)
+	}
+}
+
+func TestPublisherTimestamp(t *testing.T) {
+	var buf bytes.Buffer
+	before := time.Now().Add(-time.Second)
+	p := flatjson.NewPublisher(flatjson.Flatten(&struct{ A int }{}), &buf, time.Hour,
+		flatjson.PublishTimestamp("ts"), flatjson.PublishSkipUnchanged())
+
+	// The timestamp doesn't count as a change.
+	p.Publish()
+	p.Publish()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Unexpected output: %q", buf.String())
+	}
+	var doc struct {
+		A  int
+		TS time.Time `json:"ts"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.TS.Before(before) || doc.TS.After(time.Now()) {
+		t.Errorf("Unexpected timestamp: %v", doc.TS)
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestPublisherStartStop(t *testing.T) {
+	var mu sync.Mutex
+	val := &struct{ Requests int }{}
+	var buf syncBuffer
+	p := flatjson.NewPublisher(flatjson.Flatten(val), &buf, time.Millisecond,
+		flatjson.PublishSkipUnchanged(), flatjson.PublishLocker(&mu))
+
+	p.Start()
+	p.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 1; i <= 3; i++ {
+		mu.Lock()
+		val.Requests = i
+		mu.Unlock()
+		for !strings.Contains(buf.String(), `{"Requests":`+strconv.Itoa(i)+"}\n") {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %d, got %q", i, buf.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	p.Stop()
+	p.Stop()
+
+	// Unchanged values were written once each.
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if strings.Count(buf.String(), line+"\n") != 1 {
+			t.Errorf("Line %s written more than once: %q", line, buf.String())
+		}
+	}
+
+	errs := make(chan error, 1)
+	p = flatjson.NewPublisher(flatjson.Flatten(val), failingWriter{}, time.Millisecond,
+		flatjson.PublishErrors(func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}))
+	p.Start()
+	if err := <-errs; err == nil || err.Error() != "write failed" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	p.Stop()
+}
@@ -0,0 +1,32 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import "net/url"
+
+// QueryValues returns the current values in m as URL query parameters, one per
+// key. Values are formatted the same way as by CSVWriter, and nil pointers are
+// left out. A value that can't be formatted is replaced by the error message,
+// as by String.
+func (m Map) QueryValues() url.Values {
+	q := make(url.Values, len(m))
+	for key, value := range m {
+		v := indirectValue(resolve(value))
+		if !v.IsValid() {
+			continue
+		}
+		s, err := formatText(v, textOptions(value))
+		if err != nil {
+			s = err.Error()
+		}
+		q.Set(key, s)
+	}
+	return q
+}
+
+// Encode returns the values in m encoded as a URL query string, sorted by key.
+func (m Map) Encode() string {
+	return m.QueryValues().Encode()
+}
@@ -0,0 +1,57 @@
+package flatjson_test
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestQueryValues(t *testing.T) {
+	val := &struct {
+		Count   int
+		Ratio   float64
+		On      bool
+		Query   string `json:"q&a"`
+		Started time.Time
+		Tags    []string
+		Ptr     *int
+		Nested  struct{ B, A int }
+	}{
+		Count:   3,
+		Ratio:   0.5,
+		On:      true,
+		Query:   "a=b c/d?",
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Tags:    []string{"x"},
+	}
+	flat := flatjson.Flatten(val)
+
+	expected := url.Values{
+		"Count":    {"3"},
+		"Ratio":    {"0.5"},
+		"On":       {"true"},
+		"q&a":      {"a=b c/d?"},
+		"Started":  {"2015-06-01T12:00:00Z"},
+		"Tags":     {`["x"]`},
+		"Nested.A": {"0"},
+		"Nested.B": {"0"},
+	}
+	if q := flat.QueryValues(); !reflect.DeepEqual(q, expected) {
+		t.Errorf("Unexpected values:\n     got: %v\nexpected: %v", q, expected)
+	}
+
+	const encoded = "Count=3&Nested.A=0&Nested.B=0&On=true&Ratio=0.5&Started=2015-06-01T12%3A00%3A00Z&Tags=%5B%22x%22%5D&q%26a=a%3Db+c%2Fd%3F"
+	for i := 0; i < 10; i++ {
+		if s := flat.Encode(); s != encoded {
+			t.Fatalf("Unexpected encoding:\n     got: %s\nexpected: %s", s, encoded)
+		}
+	}
+
+	q, err := url.ParseQuery(encoded)
+	if err != nil || !reflect.DeepEqual(q, expected) {
+		t.Errorf("Encoding doesn't round trip: %v, %v", q, err)
+	}
+}
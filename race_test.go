@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package flatjson_test
+
+// sync.Pool randomly drops items under the race detector, so allocation
+// counts aren't meaningful.
+const raceEnabled = true
@@ -0,0 +1,44 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Redacted is the string that the values of redacted string fields are
+// encoded as.
+const Redacted = "[REDACTED]"
+
+// A RedactFunc decides whether the current value v of the entry stored under
+// key should be hidden when the Map is encoded. If it returns true, the
+// returned value is encoded in place of v.
+type RedactFunc func(key string, v interface{}) (interface{}, bool)
+
+// redactedJSON returns the encoding of v, the current value of a field tagged
+// with redact: Redacted for strings and null for anything else.
+func redactedJSON(v reflect.Value) []byte {
+	if v = indirectValue(v); v.IsValid() && v.Kind() == reflect.String {
+		return []byte(`"` + Redacted + `"`)
+	}
+	return []byte("null")
+}
+
+// marshalRedacted returns the encoding of the entry's replacement value if
+// its redact function hides the value.
+func (e *entry) marshalRedacted() ([]byte, bool, error) {
+	var current interface{}
+	if rv := resolve(e.value); rv.IsValid() {
+		current = rv.Interface()
+	}
+
+	replacement, ok := e.redactFunc(e.key, current)
+	if !ok {
+		return nil, false, nil
+	}
+	enc, err := json.Marshal(replacement)
+	return enc, true, err
+}
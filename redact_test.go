@@ -0,0 +1,205 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type DBConfig struct {
+	Host     string `json:"host"`
+	User     string `json:"user"`
+	Password string `json:"password,redact"`
+	Port     *int   `json:"port,omitempty,redact"`
+}
+
+type AppConfig struct {
+	Name   string            `json:"name"`
+	DB     DBConfig          `json:"db"`
+	Tokens map[string]string `json:"tokens" flatjson:",redact"`
+	Keys   struct {
+		Public  string `json:"public"`
+		Private string `json:"private"`
+	} `json:"keys" flatjson:",redact"`
+	APISecret string `json:"api_secret"`
+	Timeout   int    `json:"timeout"`
+}
+
+func TestRedactTag(t *testing.T) {
+	port := 5432
+	cfg := &AppConfig{
+		Name:      "app",
+		DB:        DBConfig{Host: "db.local", User: "admin", Password: "hunter2", Port: &port},
+		Tokens:    map[string]string{"github": "ghp_x"},
+		APISecret: "s3cret",
+		Timeout:   30,
+	}
+	cfg.Keys.Public, cfg.Keys.Private = "pub", "priv"
+	flat := flatjson.Flatten(cfg)
+
+	testEncoding(t, flat, flatjson.Map{
+		"name":         "app",
+		"db.host":      "db.local",
+		"db.user":      "admin",
+		"db.password":  flatjson.Redacted,
+		"db.port":      nil,
+		"tokens":       nil,
+		"keys.public":  flatjson.Redacted,
+		"keys.private": flatjson.Redacted,
+		"api_secret":   "s3cret",
+		"timeout":      30.0,
+	})
+
+	// The struct isn't modified, and the actual values are still available.
+	if cfg.DB.Password != "hunter2" {
+		t.Errorf("Expected the field to be unchanged, got %q", cfg.DB.Password)
+	}
+	if s, _ := flat.GetString("db.password"); s != "hunter2" {
+		t.Errorf("Expected GetString to return the actual value, got %q", s)
+	}
+
+	// Tag options still apply.
+	cfg.DB.Port = nil
+	enc, err := flat.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(enc), "db.port") {
+		t.Errorf("Expected the empty redacted field to be omitted, got %s", enc)
+	}
+
+	// Flattening maps keeps redacting their elements.
+	flat = flatjson.FlattenWithOptions(cfg, flatjson.Options{FlattenMaps: true})
+	if enc, _ := flat.MarshalJSON(); strings.Contains(string(enc), "ghp_x") || !strings.Contains(string(enc), `"tokens.github":"[REDACTED]"`) {
+		t.Errorf("Expected the map element to be redacted, got %s", enc)
+	}
+}
+
+func TestRedactFunc(t *testing.T) {
+	port := 5432
+	cfg := &AppConfig{
+		Name:      "app",
+		DB:        DBConfig{Host: "db.local", User: "admin", Password: "hunter2", Port: &port},
+		Tokens:    map[string]string{"github": "ghp_x"},
+		APISecret: "s3cret",
+		Timeout:   30,
+	}
+	var keys []string
+	opts := flatjson.Options{
+		Prefix: "cfg",
+		RedactFunc: func(key string, v interface{}) (interface{}, bool) {
+			keys = append(keys, key)
+			if strings.Contains(key, "secret") || strings.HasSuffix(key, ".user") {
+				return flatjson.Redacted, true
+			}
+			if n, ok := v.(int); ok && n > 10 {
+				return 10, true
+			}
+			return nil, false
+		},
+	}
+	flat := flatjson.FlattenWithOptions(cfg, opts)
+
+	testEncoding(t, flat, flatjson.Map{
+		"cfg.name":         "app",
+		"cfg.db.host":      "db.local",
+		"cfg.db.user":      flatjson.Redacted,
+		"cfg.db.password":  flatjson.Redacted,
+		"cfg.db.port":      nil,
+		"cfg.tokens":       nil,
+		"cfg.keys.public":  flatjson.Redacted,
+		"cfg.keys.private": flatjson.Redacted,
+		"cfg.api_secret":   flatjson.Redacted,
+		"cfg.timeout":      10.0,
+	})
+
+	// The function is called when the Map is encoded, with the current
+	// value of fields that aren't tagged.
+	keys = nil
+	cfg.Timeout = 5
+	testEncoding(t, flat, flatjson.Map{
+		"cfg.name":         "app",
+		"cfg.db.host":      "db.local",
+		"cfg.db.user":      flatjson.Redacted,
+		"cfg.db.password":  flatjson.Redacted,
+		"cfg.db.port":      nil,
+		"cfg.tokens":       nil,
+		"cfg.keys.public":  flatjson.Redacted,
+		"cfg.keys.private": flatjson.Redacted,
+		"cfg.api_secret":   flatjson.Redacted,
+		"cfg.timeout":      5.0,
+	})
+	if len(keys) != 5 {
+		t.Errorf("Expected the function to be called for the 5 untagged keys, got %v", keys)
+	}
+}
+
+func TestRedactFlattener(t *testing.T) {
+	val := &struct {
+		Window Window `flatjson:",redact"`
+	}{}
+	val.Window.Add(3)
+
+	// Entries added by a Flattener are redacted too.
+	testFlattening(t, val, flatjson.Map{"Window.total": nil, "Window.count": nil})
+}
+
+type ReportedStats struct {
+	Uptime time.Duration `json:"uptime"`
+	State  string        `json:"state"`
+	Bytes  uint64        `json:"bytes"`
+	Peer   string        `json:"peer,omitempty"`
+}
+
+func TestValueFuncs(t *testing.T) {
+	val := &ReportedStats{Uptime: 90*time.Second + 400*time.Millisecond, State: "Running", Bytes: 3 << 20}
+	opts := flatjson.Options{
+		ValueFuncs: map[string]func(v interface{}) interface{}{
+			"uptime": func(v interface{}) interface{} { return v.(time.Duration).Round(time.Second).Seconds() },
+			"state":  func(v interface{}) interface{} { return strings.ToLower(v.(string)) },
+		},
+		ValueFunc: func(key string, v interface{}) interface{} {
+			if key == "bytes" {
+				return float64(v.(uint64)) / (1 << 20)
+			}
+			return v
+		},
+	}
+	flat := flatjson.FlattenWithOptions(val, opts)
+	testEncoding(t, flat, flatjson.Map{"uptime": 90.0, "state": "running", "bytes": 3.0})
+
+	// The funcs are called with the current values, which the exporters
+	// see too, while the fields are left as they are.
+	val.State, val.Bytes = "Stopped", 1<<19
+	testEncoding(t, flat, flatjson.Map{"uptime": 90.0, "state": "stopped", "bytes": 0.5})
+	if s, ok := flat.GetString("state"); !ok || s != "Stopped" {
+		t.Errorf("Expected GetString to return the field's value, got %q", s)
+	}
+	var buf bytes.Buffer
+	if err := flat.WritePrometheus(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "bytes 0.5\n") {
+		t.Errorf("Expected the transformed value in:\n%s", buf.String())
+	}
+	if val.State != "Stopped" || val.Bytes != 1<<19 || val.Uptime != 90*time.Second+400*time.Millisecond {
+		t.Errorf("Expected the fields to be left as they are, got %+v", val)
+	}
+
+	// Like Get, Set uses the field itself.
+	if err := flat.Set("state", "Idle"); err != nil || val.State != "Idle" {
+		t.Errorf("Expected Set to write the field, got %q, %v", val.State, err)
+	}
+
+	if err := opts.Validate(val); err != nil {
+		t.Errorf("Unexpected error for known keys: %v", err)
+	}
+	opts.ValueFuncs["uptim"] = opts.ValueFuncs["uptime"]
+	expected := "flatjson: value funcs for unknown keys: uptim"
+	if err := opts.Validate(val); err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
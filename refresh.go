@@ -0,0 +1,158 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Refresh flattens val again, which should be the struct m was flattened
+// from, and updates m to match: keys for fields that became reachable, like
+// those of a nil pointer to a struct which has since been allocated, are
+// added, and keys that are no longer produced, like those under a pointer that
+// was set back to nil, are removed. Entries that still point at the same field
+// are left as they are, so consumers holding them aren't affected, and so are
+// entries added with Add and AddFunc. It returns the number of keys added and
+// removed, and panics if val can't be flattened, as Flatten does.
+//
+// Refresh modifies m, so it must not run concurrently with other uses of m.
+// It is Options.Refresh with the zero Options; pass the Options m was
+// flattened with to Options.Refresh instead if there were any.
+func (m Map) Refresh(val interface{}) (added, removed int) {
+	return Options{}.Refresh(m, val)
+}
+
+// Refresh is like Map.Refresh, but flattens val according to o.
+func (o Options) Refresh(m Map, val interface{}) (added, removed int) {
+	fresh := FlattenWithOptions(val, o)
+
+	for key, value := range m {
+		if _, ok := fresh[key]; !ok && !isAdded(value) {
+			delete(m, key)
+			removed++
+		}
+	}
+
+	for key, value := range fresh {
+		old, ok := m[key]
+		switch {
+		case ok && isAdded(old):
+		case !ok:
+			m[key] = value
+			added++
+		case !sameEntry(old, value):
+			m[key] = value
+		}
+	}
+	return added, removed
+}
+
+// Rebind points the entries of m at the fields of newVal, a new instance of
+// the struct type m was flattened from, such as a configuration struct that
+// was replaced wholesale on reload, so that m follows the new instance rather
+// than the one it was flattened from. The keys of m stay the same; entries
+// added with Add and AddFunc are kept as they are. An error is returned, and m
+// is left unchanged, if newVal can't be flattened, if an entry's value doesn't
+// have the same type in newVal, which is how a struct of a different type is
+// detected, or if newVal has no field for one of the keys, such as one under a
+// pointer that is nil in newVal.
+//
+// Rebind modifies m, so it must not run concurrently with other uses of m.
+// It is Options.Rebind with the zero Options; pass the Options m was
+// flattened with to Options.Rebind instead if there were any.
+func (m Map) Rebind(newVal interface{}) error {
+	return Options{}.Rebind(m, newVal)
+}
+
+// Rebind is like Map.Rebind, but flattens newVal according to o.
+func (o Options) Rebind(m Map, newVal interface{}) error {
+	o.EagerOmitEmpty = false
+	fresh, err := o.Flatten(newVal)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for key, value := range m {
+		if isAdded(value) {
+			continue
+		}
+		newValue, ok := fresh[key]
+		if !ok {
+			missing = append(missing, key)
+		} else if !sameType(value, newValue) {
+			return &Error{Op: "Rebind", Key: key, Type: reflect.TypeOf(newVal), kind: ErrTypeMismatch, msg: fmt.Sprintf("flatjson: %T doesn't match the struct the Map was flattened from: key %q", newVal, key)}
+		}
+	}
+	if len(missing) > 0 {
+		return keyListError("Rebind", ErrKeyNotFound, "keys missing from the new value", missing)
+	}
+
+	for key, value := range m {
+		if newValue, ok := fresh[key]; ok && !isAdded(value) {
+			m[key] = newValue
+		}
+	}
+	return nil
+}
+
+// sameType reports whether the Map values a and b find values of the same
+// type in the same way.
+func sameType(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *entry:
+		b, ok := b.(*entry)
+		return ok && sameType(a.value, b.value)
+	case *atomicValue:
+		b, ok := b.(*atomicValue)
+		return ok && sameType(a.value, b.value)
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+// sameEntry reports whether the Map values a and b refer to the same field
+// and are encoded the same way. Lookups find their value again each time, so
+// any two are considered the same.
+func sameEntry(a, b interface{}) bool {
+	switch a := a.(type) {
+	case *entry:
+		b, ok := b.(*entry)
+		return ok && a.omitEmpty == b.omitEmpty && a.omitZero == b.omitZero && a.quoted == b.quoted && a.stringer == b.stringer &&
+			a.timeFormat == b.timeFormat && a.durationFormat == b.durationFormat && sameEntry(a.value, b.value) &&
+			sameGroup(a.group, b.group)
+	case *atomicValue:
+		b, ok := b.(*atomicValue)
+		return ok && sameEntry(a.value, b.value)
+	case *lookup:
+		_, ok := b.(*lookup)
+		return ok
+	}
+
+	// Values added by a FlattenFunc or Flattener may not be pointers, in
+	// which case they hold a copy that should be replaced.
+	return reflect.ValueOf(a).Kind() == reflect.Ptr && a == b
+}
+
+// sameGroup reports whether the omitGroups a and b, and the groups enclosing
+// them, hold the same entries. A group that gained entries, because a field
+// nested under it became reachable, has to be replaced along with the entries
+// it holds.
+func sameGroup(a, b *omitGroup) bool {
+	for ; a != nil && b != nil; a, b = a.parent, b.parent {
+		if len(a.members) != len(b.members) || (a.zero == nil) != (b.zero == nil) {
+			return false
+		}
+		if a.zero != nil && !sameEntry(a.zero, b.zero) {
+			return false
+		}
+		for i := range a.members {
+			if !sameEntry(a.members[i], b.members[i]) {
+				return false
+			}
+		}
+	}
+	return a == nil && b == nil
+}
@@ -0,0 +1,139 @@
+package flatjson_test
+
+import (
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type TLSConfig struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+func TestRefresh(t *testing.T) {
+	val := &struct {
+		Port int        `json:"port"`
+		TLS  *TLSConfig `json:"tls"`
+	}{Port: 80}
+	flat := flatjson.Flatten(val)
+	port := flat["port"]
+
+	val.TLS = &TLSConfig{Cert: "c"}
+	if added, removed := flat.Refresh(val); added != 2 || removed != 1 {
+		t.Errorf("Unexpected counts after allocating: %d added, %d removed", added, removed)
+	}
+	testEncoding(t, flat, flatjson.Map{"port": 80.0, "tls.cert": "c", "tls.key": ""})
+	if flat["port"] != port {
+		t.Error("Unchanged entry was replaced")
+	}
+
+	// Refreshing again changes nothing.
+	cert := flat["tls.cert"]
+	if added, removed := flat.Refresh(val); added != 0 || removed != 0 {
+		t.Errorf("Unexpected counts for an unchanged struct: %d added, %d removed", added, removed)
+	}
+	if flat["tls.cert"] != cert {
+		t.Error("Unchanged entry was replaced")
+	}
+
+	// Entries for a replaced struct point at the new one.
+	val.TLS = &TLSConfig{Cert: "d"}
+	flat.Refresh(val)
+	testEncoding(t, flat, flatjson.Map{"port": 80.0, "tls.cert": "d", "tls.key": ""})
+
+	val.TLS = nil
+	if added, removed := flat.Refresh(val); added != 1 || removed != 2 {
+		t.Errorf("Unexpected counts after clearing: %d added, %d removed", added, removed)
+	}
+	testEncoding(t, flat, flatjson.Map{"port": 80.0, "tls": nil})
+
+	opts := flatjson.Options{Prefix: "srv", NilStructs: flatjson.NilStructSkip}
+	flat = flatjson.FlattenWithOptions(val, opts)
+	val.TLS = &TLSConfig{}
+	if added, removed := opts.Refresh(flat, val); added != 2 || removed != 0 {
+		t.Errorf("Unexpected counts with options: %d added, %d removed", added, removed)
+	}
+	testEncoding(t, flat, flatjson.Map{"srv.port": 80.0, "srv.tls.cert": "", "srv.tls.key": ""})
+}
+
+type ServerConfig struct {
+	Port    int                   `json:"port"`
+	Name    string                `json:"name,omitempty"`
+	TLS     *TLSConfig            `json:"tls"`
+	Limits  map[string]int        `json:"limits"`
+	Backend struct{ Addr string } `json:"backend"`
+}
+
+func TestRebind(t *testing.T) {
+	opts := flatjson.Options{FlattenMaps: true}
+	old := &ServerConfig{Port: 80, TLS: &TLSConfig{Cert: "a"}, Limits: map[string]int{"conns": 1}}
+	flat := flatjson.FlattenWithOptions(old, opts)
+	uptime := 0
+	flat.AddFunc("uptime", func() interface{} { return uptime })
+
+	cfg := &ServerConfig{Port: 81, Name: "b", TLS: &TLSConfig{Cert: "c"}, Limits: map[string]int{"conns": 2, "rps": 3}}
+	cfg.Backend.Addr = "d"
+	if err := opts.Rebind(flat, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key set stays the same, and the values follow the new struct.
+	expected := flatjson.Map{"port": 81.0, "name": "b", "tls.cert": "c", "tls.key": "", "limits.conns": 2.0, "backend.Addr": "d", "uptime": 0.0}
+	testEncoding(t, flat, expected)
+	cfg.Port, cfg.Limits["conns"], uptime = 82, 4, 5
+	old.Port = 90
+	expected["port"], expected["limits.conns"], expected["uptime"] = 82.0, 4.0, 5.0
+	testEncoding(t, flat, expected)
+
+	for _, test := range []struct {
+		val interface{}
+		err string
+	}{
+		{&ServerConfig{Limits: map[string]int{"conns": 1}}, "flatjson: keys missing from the new value: tls.cert, tls.key"},
+		{&ServerConfig{TLS: &TLSConfig{}}, "flatjson: keys missing from the new value: limits.conns"},
+		{&struct {
+			Port string `json:"port"`
+		}{}, `flatjson: *struct { Port string "json:\"port\"" } doesn't match the struct the Map was flattened from: key "port"`},
+		{ServerConfig{}, "flatjson: struct flatjson_test.ServerConfig is not addressable, pass a pointer to it instead"},
+	} {
+		if err := opts.Rebind(flat, test.val); err == nil || err.Error() != test.err {
+			t.Errorf("Unexpected error for %T:\n     got: %v\nexpected: %s", test.val, err, test.err)
+		}
+	}
+
+	// Failing leaves the Map as it was.
+	testEncoding(t, flat, expected)
+}
+
+func TestRebindAdded(t *testing.T) {
+	old := &ServerConfig{Port: 80, TLS: &TLSConfig{}}
+	flat := flatjson.Flatten(old)
+	extra := 7
+	if err := flat.Add("extra", &extra); err != nil {
+		t.Fatal(err)
+	}
+	hits, err := flat.Counter("hits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits.Add(2)
+
+	cfg := &ServerConfig{Port: 81, TLS: &TLSConfig{}}
+	if err := flat.Rebind(cfg); err != nil {
+		t.Fatal(err)
+	}
+	expected := flatjson.Map{"port": 81.0, "tls.cert": "", "tls.key": "", "limits": nil, "backend.Addr": "", "extra": 7.0, "hits": 2.0}
+	testEncoding(t, flat, expected)
+
+	// Refresh keeps them too.
+	extra, cfg.TLS = 8, nil
+	if added, removed := flat.Refresh(cfg); added != 1 || removed != 2 {
+		t.Errorf("Expected 1 key added and 2 removed, got %d and %d", added, removed)
+	}
+	hits.Add(1)
+	delete(expected, "tls.cert")
+	delete(expected, "tls.key")
+	expected["tls"], expected["extra"], expected["hits"] = nil, 8.0, 3.0
+	testEncoding(t, flat, expected)
+}
@@ -0,0 +1,58 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import "strings"
+
+// A KeySanitizer rewrites key segments to follow the naming rules of a metrics
+// backend. It is applied to each segment taken from a field name, a tag or a
+// map key, after KeyCase and before the segment is escaped, so that a segment
+// shared by several keys is rewritten the same way in each of them. Slice
+// indices are left as they are.
+type KeySanitizer int
+
+const (
+	// SanitizeNone leaves key segments unchanged.
+	SanitizeNone KeySanitizer = iota
+
+	// SanitizePrometheus replaces each character not allowed in Prometheus
+	// metric names, [a-zA-Z0-9_:], with an underscore, and prepends an
+	// underscore to segments starting with a digit, so that keys are valid
+	// metric names whichever segment they start with. Use it with a
+	// separator of "_" or ":".
+	SanitizePrometheus
+
+	// SanitizeGraphite replaces each character other than ASCII letters,
+	// digits, dashes and underscores with an underscore, including dots, so
+	// that segments don't add levels to the Graphite metric path.
+	SanitizeGraphite
+)
+
+func (s KeySanitizer) apply(segment string) string {
+	switch s {
+	case SanitizePrometheus:
+		segment = strings.Map(prometheusRune, segment)
+		if segment != "" && '0' <= segment[0] && segment[0] <= '9' {
+			segment = "_" + segment
+		}
+	case SanitizeGraphite:
+		segment = strings.Map(graphiteRune, segment)
+	}
+	return segment
+}
+
+// sanitize returns segment rewritten by Options.SanitizeFunc if it is set, and
+// by Options.KeySanitizer otherwise.
+func (o Options) sanitize(segment string) string {
+	if o.SanitizeFunc != nil {
+		return o.SanitizeFunc(segment)
+	}
+	return o.KeySanitizer.apply(segment)
+}
+
+// sanitizing reports whether o rewrites key segments.
+func (o Options) sanitizing() bool {
+	return o.SanitizeFunc != nil || o.KeySanitizer != SanitizeNone
+}
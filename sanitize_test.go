@@ -0,0 +1,111 @@
+package flatjson_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestKeySanitizer(t *testing.T) {
+	val := &struct {
+		Requests int `json:"http-requests"`
+		Usage    int `json:"disk.usage"`
+		Errors   int `json:"5xx"`
+		Upstream struct {
+			Latency int `json:"p99 latency"`
+			Retries int
+		} `json:"up-stream"`
+		Codes map[string]int `json:"codes"`
+	}{Requests: 1, Usage: 2, Errors: 3, Codes: map[string]int{"2xx": 5, "not found": 6}}
+	val.Upstream.Latency = 4
+
+	for _, test := range []struct {
+		opts     flatjson.Options
+		expected flatjson.Map
+	}{
+		{
+			flatjson.Options{KeySanitizer: flatjson.SanitizeNone, FlattenMaps: true},
+			flatjson.Map{
+				"http-requests":         1.0,
+				"disk.usage":            2.0,
+				"5xx":                   3.0,
+				"up-stream.p99 latency": 4.0,
+				"up-stream.Retries":     0.0,
+				"codes.2xx":             5.0,
+				"codes.not found":       6.0,
+			},
+		},
+		{
+			flatjson.Options{KeySanitizer: flatjson.SanitizePrometheus, FlattenMaps: true, Separator: "_"},
+			flatjson.Map{
+				"http_requests":         1.0,
+				"disk_usage":            2.0,
+				"_5xx":                  3.0,
+				"up_stream_p99_latency": 4.0,
+				"up_stream_Retries":     0.0,
+				"codes__2xx":            5.0,
+				"codes_not_found":       6.0,
+			},
+		},
+		{
+			flatjson.Options{KeySanitizer: flatjson.SanitizeGraphite, FlattenMaps: true},
+			flatjson.Map{
+				"http-requests":         1.0,
+				"disk_usage":            2.0,
+				"5xx":                   3.0,
+				"up-stream.p99_latency": 4.0,
+				"up-stream.Retries":     0.0,
+				"codes.2xx":             5.0,
+				"codes.not_found":       6.0,
+			},
+		},
+		{
+			flatjson.Options{SanitizeFunc: strings.ToUpper, KeySanitizer: flatjson.SanitizeGraphite, FlattenMaps: true},
+			flatjson.Map{
+				"HTTP-REQUESTS":         1.0,
+				"DISK.USAGE":            2.0,
+				"5XX":                   3.0,
+				"UP-STREAM.P99 LATENCY": 4.0,
+				"UP-STREAM.RETRIES":     0.0,
+				"CODES.2XX":             5.0,
+				"CODES.NOT FOUND":       6.0,
+			},
+		},
+	} {
+		testFlatteningWithOptions(t, val, test.opts, test.expected)
+	}
+
+	// The sanitizer is applied before escaping.
+	opts := flatjson.Options{SanitizeFunc: strings.ToUpper, EscapeSeparators: true}
+	testFlatteningWithOptions(t, &struct {
+		A int `json:"a.b"`
+	}{}, opts, flatjson.Map{`A\.B`: 0.0})
+}
+
+func TestKeySanitizerCollisions(t *testing.T) {
+	val := &struct {
+		Dash  int `json:"a-b"`
+		Space int `json:"a b"`
+		Under int `json:"a_c"`
+		Dot   int `json:"a.c"`
+	}{}
+
+	opts := flatjson.Options{KeySanitizer: flatjson.SanitizePrometheus}
+	expected := "flatjson: duplicate keys after sanitizing: a_b, a_c"
+	if m, err := opts.Flatten(val); err == nil {
+		t.Errorf("Expected error, got %#v", m)
+	} else if err.Error() != expected {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Map keys that collide are reported too.
+	labels := &struct {
+		Labels map[string]int
+	}{map[string]int{"a b": 1, "a.b": 2}}
+	opts = flatjson.Options{KeySanitizer: flatjson.SanitizeGraphite, FlattenMaps: true}
+	expected = "flatjson: duplicate keys after sanitizing: Labels.a_b"
+	if _, err := opts.Flatten(labels); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package flatjson
+
+import (
+	"reflect"
+)
+
+// A Schema flattens values of the struct type T. The type is inspected once,
+// when the Schema is created, so flattening doesn't have to parse tags again
+// and errors that only depend on the type, like duplicate keys, are reported
+// up front. A Schema is safe for concurrent use.
+type Schema[T any] struct {
+	keys []string
+}
+
+// NewSchema returns a Schema for T. An error is returned if T isn't a struct,
+// or if flattening it fails.
+func NewSchema[T any]() (*Schema[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, rootError("NewSchema", t, "flatjson: %s is not a struct", t)
+	}
+
+	keys, err := Keys(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema[T]{keys: keys}, nil
+}
+
+// Flatten returns the Map representation of v, as by Flatten. It panics if v
+// is nil.
+func (s *Schema[T]) Flatten(v *T) Map {
+	return Flatten(v)
+}
+
+// Keys returns the keys produced for T in sorted order, as by the
+// package-level Keys.
+func (s *Schema[T]) Keys() []string {
+	return append([]string(nil), s.keys...)
+}
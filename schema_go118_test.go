@@ -0,0 +1,59 @@
+//go:build go1.18
+// +build go1.18
+
+package flatjson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type Counted[K any] struct {
+	Key   K
+	Count int
+}
+
+type SchemaStats struct {
+	Counted[string]
+	Name  string `json:"name"`
+	Child *Child `json:"child"`
+}
+
+func TestSchema(t *testing.T) {
+	s, err := flatjson.NewSchema[SchemaStats]()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"Count", "Key", "child.CC", "child.CD", "name"}
+	if keys := s.Keys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	for i := 0; i < 10; i++ {
+		val := &SchemaStats{Name: "n"}
+		val.Count = i
+		val.Key = "k"
+		testEncoding(t, s.Flatten(val), flatjson.Map{
+			"Count": float64(i),
+			"Key":   "k",
+			"name":  "n",
+			"child": nil,
+		})
+	}
+
+	if _, err := flatjson.NewSchema[int](); err == nil {
+		t.Error("Expected an error for a non-struct type")
+	}
+	if _, err := flatjson.NewSchema[*SchemaStats](); err == nil {
+		t.Error("Expected an error for a pointer type")
+	}
+	if _, err := flatjson.NewSchema[struct {
+		A int `json:"a"`
+		B int `flatjson:"a"`
+	}](); err == nil {
+		t.Error("Expected an error for duplicate keys")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"path"
+)
+
+// A selector decides which keys are kept according to Options.Include and
+// Options.Exclude, with the patterns split into key segments, and
+// Options.IgnoreFields.
+type selector struct {
+	opts    Options
+	include [][]string
+	exclude [][]string
+
+	ignore []string
+	found  map[string]bool // The paths of ignore that named a field.
+}
+
+// newSelector returns the selector for the patterns and ignored fields of o,
+// or nil if there are none, or an error if one of the patterns is malformed.
+func newSelector(o Options) (*selector, error) {
+	if len(o.Include) == 0 && len(o.Exclude) == 0 && len(o.IgnoreFields) == 0 {
+		return nil, nil
+	}
+
+	s := &selector{opts: o, ignore: o.IgnoreFields, found: map[string]bool{}}
+	var err error
+	if s.include, err = splitPatterns(o, o.Include); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = splitPatterns(o, o.Exclude); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func splitPatterns(o Options, patterns []string) ([][]string, error) {
+	split := make([][]string, len(patterns))
+	for i, p := range patterns {
+		split[i] = o.SplitKey(p)
+		for _, segment := range split[i] {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, &Error{Op: "Flatten", Key: p, Err: err, kind: ErrInvalidKey, msg: fmt.Sprintf("flatjson: invalid key pattern %q", p)}
+			}
+		}
+	}
+	return split, nil
+}
+
+// A patternMatch is how well a pattern matches a key, in increasing order.
+type patternMatch int
+
+const (
+	matchNone    patternMatch = iota
+	matchPartial              // The key could still be extended into a match.
+	matchFull                 // The key, or a key it is nested under, matches.
+)
+
+// match returns how well the pattern made up of segments p matches the key
+// made up of segments k.
+func match(p, k []string) patternMatch {
+	switch {
+	case len(p) == 0:
+		return matchFull
+	case p[0] == "**":
+		// Any number of segments, including none.
+		best := match(p[1:], k)
+		if best != matchFull && len(k) > 0 {
+			if m := match(p, k[1:]); m > best {
+				best = m
+			}
+		}
+		return best
+	case len(k) == 0:
+		return matchPartial
+	}
+	if ok, _ := path.Match(p[0], k[0]); !ok {
+		return matchNone
+	}
+	return match(p[1:], k[1:])
+}
+
+// best returns the best match of any of patterns for the key made up of
+// segments k.
+func best(patterns [][]string, k []string) patternMatch {
+	result := matchNone
+	for _, p := range patterns {
+		if m := match(p, k); m > result {
+			result = m
+			if m == matchFull {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// selects returns how well key is selected: matchFull if its entry is kept,
+// matchPartial if only some of the keys nested under it are, and matchNone if
+// none of them are.
+func (s *selector) selects(key string) patternMatch {
+	if s.ignores(key) {
+		return matchNone
+	}
+	if len(s.include) == 0 && len(s.exclude) == 0 {
+		return matchFull
+	}
+
+	k := s.opts.SplitKey(key)
+	if best(s.exclude, k) == matchFull {
+		return matchNone
+	}
+	if len(s.include) == 0 {
+		return matchFull
+	}
+	return best(s.include, k)
+}
+
+// ignores reports whether key is one of the paths of Options.IgnoreFields, or
+// is nested under one, and records the path if it is key itself.
+func (s *selector) ignores(key string) bool {
+	for _, p := range s.ignore {
+		if p != "" && s.opts.under(key, p) {
+			if key == p {
+				s.found[p] = true
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// unknownError returns the error for the paths of Options.IgnoreFields that
+// didn't name a field, if any. It may be called on a nil selector.
+func (s *selector) unknownError() error {
+	if s == nil {
+		return nil
+	}
+	var unknown []string
+	for _, p := range s.ignore {
+		if !s.found[p] {
+			unknown = append(unknown, p)
+		}
+	}
+	if len(unknown) > 0 {
+		return keyListError("Validate", ErrKeyNotFound, "unknown ignored fields", unknown)
+	}
+	return nil
+}
+
+// A selectSink passes on the entries a selector keeps to out.
+type selectSink struct {
+	out sink
+	sel *selector
+}
+
+func (s *selectSink) add(key string, value interface{}) bool {
+	m := s.sel.selects(key)
+	if _, ok := value.(*dynamic); ok && m == matchPartial {
+		// Flattened again with the same patterns when expanded.
+		m = matchFull
+	}
+	if m != matchFull {
+		return false
+	}
+	return s.out.add(key, value)
+}
@@ -0,0 +1,128 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type SelectedServer struct {
+	DB       Pool `json:"db"`
+	HTTP     Pool `json:"http"`
+	Cache    Pool `json:"cache"`
+	Internal struct {
+		Hook  func() `json:"hook"`
+		Depth int    `json:"depth"`
+	} `json:"internal"`
+	Users []struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	} `json:"users"`
+	Password string `json:"password"`
+}
+
+func TestIncludeExclude(t *testing.T) {
+	val := &SelectedServer{}
+	val.Users = make([]struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}, 1)
+
+	for _, test := range []struct {
+		opts     flatjson.Options
+		expected []string
+		internal bool // Whether the internal struct has to be walked.
+	}{
+		{
+			flatjson.Options{Include: []string{"db.*", "http"}},
+			[]string{"db.active", "db.idle", "http.active", "http.idle"},
+			false,
+		},
+		{
+			flatjson.Options{Include: []string{"*.active"}},
+			[]string{"cache.active", "db.active", "http.active"},
+			true,
+		},
+		{
+			flatjson.Options{Exclude: []string{"internal", "**.password", "cache.?dle"}, IndexSlices: true},
+			[]string{"cache.active", "db.active", "db.idle", "http.active", "http.idle", "users.0.name"},
+			false,
+		},
+		{
+			// Exclude wins over Include.
+			flatjson.Options{Include: []string{"db", "http"}, Exclude: []string{"http.idle", "db"}},
+			[]string{"http.active"},
+			false,
+		},
+		{
+			flatjson.Options{Include: []string{"app.users.*.name"}, Prefix: "app", IndexSlices: true},
+			[]string{"app.users.0.name"},
+			false,
+		},
+		{
+			flatjson.Options{Include: []string{"db/act*"}, Separator: "/"},
+			[]string{"db/active"},
+			false,
+		},
+	} {
+		// The func field would be rejected if it were flattened.
+		test.opts.RejectUnsupported = true
+		var filtered []string
+		test.opts.FieldFilter = func(path string, field reflect.StructField, v reflect.Value) bool {
+			filtered = append(filtered, path)
+			return true
+		}
+
+		m, err := test.opts.Flatten(val)
+		if err != nil {
+			t.Errorf("Unexpected error with %v and %v: %v", test.opts.Include, test.opts.Exclude, err)
+			continue
+		}
+		if keys := m.Keys(""); !reflect.DeepEqual(keys, test.expected) {
+			t.Errorf("Unexpected keys with %v and %v: %q, expected %q", test.opts.Include, test.opts.Exclude, keys, test.expected)
+		}
+		for _, path := range filtered {
+			if path == "internal.hook" || path == "internal" && !test.internal {
+				t.Errorf("Expected %s not to be walked with %v and %v", path, test.opts.Include, test.opts.Exclude)
+			}
+		}
+	}
+
+	if _, err := (flatjson.Options{Include: []string{"db.[a"}}).Flatten(val); err == nil {
+		t.Error("Expected an error for a malformed pattern")
+	}
+}
+
+func TestIgnoreFields(t *testing.T) {
+	val := &SelectedServer{}
+	opts := flatjson.Options{IgnoreFields: []string{"internal", "db.idle", "password"}, RejectUnsupported: true}
+
+	// The func field would be rejected if internal were flattened.
+	m, err := opts.Flatten(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cache.active", "cache.idle", "db.active", "http.active", "http.idle", "users"}
+	if keys := m.Keys(""); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected keys %q, expected %q", keys, expected)
+	}
+	if err := opts.Validate(val); err != nil {
+		t.Errorf("Unexpected error for known fields: %v", err)
+	}
+
+	// Keys are matched after tags and separators are applied.
+	opts = flatjson.Options{IgnoreFields: []string{"app/http", "app/DB", "app/db.active", "app/users/password"}, Prefix: "app", Separator: "/"}
+	m, err = opts.Flatten(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"app/cache/active", "app/cache/idle", "app/db/active", "app/db/idle", "app/internal/depth", "app/password", "app/users"}
+	if keys := m.Keys(""); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected keys %q, expected %q", keys, expected)
+	}
+	expectedErr := "flatjson: unknown ignored fields: app/DB, app/db.active, app/users/password"
+	if err := opts.Validate(val); err == nil || err.Error() != expectedErr {
+		t.Errorf("Expected error %q, got %v", expectedErr, err)
+	}
+}
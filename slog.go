@@ -0,0 +1,111 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package flatjson
+
+import (
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+// LogValue implements slog.LogValuer, logging m as a group holding the
+// attributes returned by Attrs. The values are read when the record is
+// handled, so they are current.
+func (m Map) LogValue() slog.Value {
+	return slog.GroupValue(m.Attrs()...)
+}
+
+// Attrs returns an attribute for each entry in m, in sorted key order, holding
+// its current value. Numbers, strings, booleans, time.Time and time.Duration
+// values are stored as the matching slog.Kind; anything else is stored with
+// slog.AnyValue. Nil pointers are logged as nil.
+func (m Map) Attrs() []slog.Attr {
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	attrs := make([]slog.Attr, len(*keys))
+	for i, key := range *keys {
+		attrs[i] = slog.Attr{Key: key, Value: logValue(resolve(m[key]))}
+	}
+	return attrs
+}
+
+// GroupedAttrs is like Attrs, but splits the keys into segments and nests the
+// entries in a group per segment: db.pool.active becomes an active attribute
+// in a pool group in a db group. The separator is assumed to be the default
+// one; see Options.GroupedAttrs.
+func (m Map) GroupedAttrs() []slog.Attr {
+	return Options{}.GroupedAttrs(m)
+}
+
+// GroupedAttrs is like Map.GroupedAttrs, but splits keys as by o.SplitKey.
+func (o Options) GroupedAttrs(m Map) []slog.Attr {
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	entries := make([]logEntry, len(*keys))
+	for i, key := range *keys {
+		entries[i] = logEntry{o.SplitKey(key), logValue(resolve(m[key]))}
+	}
+	return groupAttrs(entries)
+}
+
+type logEntry struct {
+	segments []string
+	value    slog.Value
+}
+
+// groupAttrs nests entries into groups by their first segment. Entries sharing
+// a first segment must be adjacent, which they are in sorted key order.
+func groupAttrs(entries []logEntry) []slog.Attr {
+	var attrs []slog.Attr
+	for i := 0; i < len(entries); {
+		e := entries[i]
+		if len(e.segments) == 1 {
+			attrs = append(attrs, slog.Attr{Key: e.segments[0], Value: e.value})
+			i++
+			continue
+		}
+
+		var group []logEntry
+		for ; i < len(entries) && len(entries[i].segments) > 1 && entries[i].segments[0] == e.segments[0]; i++ {
+			group = append(group, logEntry{entries[i].segments[1:], entries[i].value})
+		}
+		attrs = append(attrs, slog.Attr{Key: e.segments[0], Value: slog.GroupValue(groupAttrs(group)...)})
+	}
+	return attrs
+}
+
+// logValue returns the slog.Value for v, after dereferencing pointers.
+func logValue(v reflect.Value) slog.Value {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return slog.AnyValue(nil)
+	}
+
+	switch v.Type() {
+	case timeType:
+		return slog.TimeValue(v.Interface().(time.Time))
+	case durationType:
+		return slog.DurationValue(time.Duration(v.Int()))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return slog.StringValue(v.String())
+	case reflect.Bool:
+		return slog.BoolValue(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return slog.Int64Value(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return slog.Uint64Value(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return slog.Float64Value(v.Float())
+	}
+	return slog.AnyValue(v.Interface())
+}
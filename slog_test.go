@@ -0,0 +1,71 @@
+//go:build go1.21
+// +build go1.21
+
+package flatjson_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestLogValue(t *testing.T) {
+	val := &struct {
+		Name    string
+		Latency time.Duration
+		Ratio   float32
+		Nil     *int
+		DB      struct {
+			Pool struct{ Active, Idle int } `json:"pool"`
+			Up   bool                       `json:"up"`
+		} `json:"db"`
+	}{Name: "a b", Latency: time.Second, Ratio: 0.5}
+	flat := flatjson.Flatten(val)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	logger.Info("stats", "stats", flat)
+	val.DB.Pool.Active = 3
+	val.DB.Up = true
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "stats", flat.Attrs()...)
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "stats", flat.GroupedAttrs()...)
+
+	expected := `level=INFO msg=stats stats.Latency=1s stats.Name="a b" stats.Nil=<nil> stats.Ratio=0.5 stats.db.pool.Active=0 stats.db.pool.Idle=0 stats.db.up=false
+level=INFO msg=stats Latency=1s Name="a b" Nil=<nil> Ratio=0.5 db.pool.Active=3 db.pool.Idle=0 db.up=true
+level=INFO msg=stats Latency=1s Name="a b" Nil=<nil> Ratio=0.5 db.pool.Active=3 db.pool.Idle=0 db.up=true
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	attrs := flat.GroupedAttrs()
+	if len(attrs) != 5 || attrs[4].Key != "db" || attrs[4].Value.Kind() != slog.KindGroup {
+		t.Fatalf("Unexpected grouped attributes: %v", attrs)
+	}
+	if db := attrs[4].Value.Group(); len(db) != 2 || db[0].Key != "pool" || db[0].Value.Kind() != slog.KindGroup {
+		t.Errorf("Unexpected db group: %v", db)
+	}
+
+	for key, kind := range map[string]slog.Kind{
+		"Latency": slog.KindDuration, "Name": slog.KindString, "Ratio": slog.KindFloat64,
+		"db.pool.Active": slog.KindInt64, "db.up": slog.KindBool,
+	} {
+		for _, a := range flat.Attrs() {
+			if a.Key == key && a.Value.Kind() != kind {
+				t.Errorf("Unexpected kind for %s: %v", key, a.Value.Kind())
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import "reflect"
+
+// Values returns a snapshot of the current values in m, keyed the same way.
+// Unlike the values in m, which point into the flattened struct, the values in
+// the snapshot are copies: slices, maps, arrays and pointed-to values are
+// copied deeply, so later changes to the struct aren't reflected in the
+// snapshot. Unexported fields of struct values are copied shallowly.
+//
+// Entries for fields tagged with omitempty are included even if they are
+// currently empty, and entries for map elements which have since been deleted
+// have nil values. With Options.DynamicInterfaces, interface fields are
+// flattened again for the snapshot.
+func (m Map) Values() map[string]interface{} {
+	m = m.expandDynamic()
+	values := make(map[string]interface{}, len(m))
+	copied := map[visit]reflect.Value{}
+
+	for key, value := range m {
+		var current interface{}
+		if rv := resolve(value); rv.IsValid() {
+			current = deepCopy(rv, copied).Interface()
+		}
+		values[key] = current
+	}
+	return values
+}
+
+// Clone returns a copy of m which is detached from the flattened struct. Each
+// value is replaced by a pointer to a deep copy of its current value, made the
+// same way as by Values, so later changes to the struct don't affect the
+// clone, and changes made through the clone, such as with Set, don't affect
+// the struct. Unlike a snapshot from Values, the clone is encoded the same way
+// as m, including the tag options of its entries, and can be used anywhere m
+// can.
+//
+// Interface fields flattened with Options.DynamicInterfaces are expanded
+// according to their current values, and their entries are copied.
+func (m Map) Clone() Map {
+	if m == nil {
+		return nil
+	}
+	m = m.expandDynamic()
+
+	c := cloner{
+		copied: map[visit]reflect.Value{},
+		values: map[interface{}]interface{}{},
+		groups: map[*omitGroup]*omitGroup{},
+	}
+	clone := make(Map, len(m))
+	for key, value := range m {
+		clone[key] = c.value(value)
+	}
+	return clone
+}
+
+// A cloner copies the values of a Map for Clone. Values and groups shared by
+// several entries are copied once, so they stay shared in the clone.
+type cloner struct {
+	copied map[visit]reflect.Value
+	values map[interface{}]interface{}
+	groups map[*omitGroup]*omitGroup
+}
+
+// value returns a copy of v, a Map value.
+func (c *cloner) value(v interface{}) interface{} {
+	e, ok := v.(*entry)
+	if !ok {
+		return c.leaf(v)
+	}
+
+	ce := *e
+	ce.value = c.leaf(e.value)
+	ce.group = c.group(e.group)
+	return &ce
+}
+
+// leaf returns a copy of v, a Map value other than an entry. Pointers, lookups
+// and atomics are replaced by a pointer to a copy of their current value.
+func (c *cloner) leaf(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr {
+		if !rv.IsValid() {
+			return nil
+		}
+		return deepCopy(rv, c.copied).Interface()
+	}
+	if rv.IsNil() {
+		return v
+	}
+	if cv, ok := c.values[v]; ok {
+		return cv
+	}
+
+	var cv interface{}
+	if current := resolve(v); current.IsValid() {
+		p := reflect.New(current.Type())
+		p.Elem().Set(deepCopy(current, c.copied))
+		cv = p.Interface()
+	}
+	c.values[v] = cv
+	return cv
+}
+
+// group returns a copy of g whose members are the copies of g's members.
+func (c *cloner) group(g *omitGroup) *omitGroup {
+	if g == nil {
+		return nil
+	}
+	if cg, ok := c.groups[g]; ok {
+		return cg
+	}
+
+	cg := &omitGroup{parent: c.group(g.parent)}
+	c.groups[g] = cg
+	for _, m := range g.members {
+		cg.members = append(cg.members, c.leaf(m))
+	}
+	if g.zero != nil {
+		cg.zero = c.leaf(g.zero)
+	}
+	return cg
+}
+
+// deepCopy returns a copy of v which shares no memory with it, apart from the
+// unexported fields of structs. Pointers that were already copied, as recorded
+// in copied, are copied again to the same pointer, so that cycles terminate
+// and shared values stay shared.
+func deepCopy(v reflect.Value, copied map[visit]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		p := visit{v.Pointer(), v.Type()}
+		if c, ok := copied[p]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copied[p] = c
+		c.Elem().Set(deepCopy(v.Elem(), copied))
+		return c
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem(), copied))
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copied))
+		}
+		return c
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, deepCopy(v.MapIndex(k), copied))
+		}
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i), copied))
+			}
+		}
+		return c
+	}
+
+	return v
+}
@@ -0,0 +1,167 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestValues(t *testing.T) {
+	type Ring struct {
+		Name string
+		Next *Ring
+	}
+	ring := &Ring{Name: "a"}
+	ring.Next = ring
+
+	val := &struct {
+		Name   string
+		Tags   []string
+		Counts map[string][]int
+		Child  *Child
+		Grid   [2][]int
+		Points []Point `flatjson:",noflatten"`
+		Ring   *Ring   `flatjson:",noflatten"`
+		Nil    *Child
+	}{
+		Name:   "a",
+		Tags:   []string{"x", "y"},
+		Counts: map[string][]int{"a": {1}},
+		Child:  &Child{1, "2"},
+		Grid:   [2][]int{{1}, {2}},
+		Points: []Point{{1, 2}},
+		Ring:   ring,
+	}
+
+	flat := flatjson.Flatten(val)
+	values := flat.Values()
+
+	expected := map[string]interface{}{
+		"Name":     "a",
+		"Tags":     []string{"x", "y"},
+		"Counts":   map[string][]int{"a": {1}},
+		"Child.CC": 1,
+		"Child.CD": "2",
+		"Grid":     [2][]int{{1}, {2}},
+		"Points":   []Point{{1, 2}},
+		"Ring":     *ring,
+		"Nil":      (*Child)(nil),
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Unexpected values:\n     got: %#v\nexpected: %#v", values, expected)
+	}
+
+	// Changes to the struct, including through slices and maps, don't affect
+	// the snapshot.
+	val.Name = "b"
+	val.Tags[0] = "z"
+	val.Counts["a"][0] = 2
+	val.Child.C = 3
+	val.Grid[0][0] = 3
+	val.Points[0].X = 3
+	val.Ring.Name = "b"
+	val.Nil = &Child{}
+
+	copied := &Ring{Name: "a"}
+	copied.Next = copied
+	expected["Ring"] = Ring{Name: "a", Next: copied}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Snapshot changed:\n     got: %#v\nexpected: %#v", values, expected)
+	}
+
+	// The copy of the ring still forms a cycle.
+	if r := values["Ring"].(Ring).Next; r.Next != r {
+		t.Error("Expected the copied ring to point to itself")
+	}
+}
+
+func TestClone(t *testing.T) {
+	val := &struct {
+		Name   string   `json:"name"`
+		Count  int      `json:"count,omitempty"`
+		Tags   []string `json:"tags"`
+		Child  Child    `json:"child" flatjson:",noflatten"`
+		Nested struct {
+			Ratio float64 `json:"ratio,string"`
+		} `json:"nested"`
+		Labels map[string]int `json:"labels"`
+	}{
+		Name:   "a",
+		Tags:   []string{"x", "y"},
+		Child:  Child{1, "2"},
+		Labels: map[string]int{"k": 1},
+	}
+	val.Nested.Ratio = 0.5
+
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{FlattenMaps: true})
+	clone := flat.Clone()
+
+	expected := flatjson.Map{
+		"name":         "a",
+		"tags":         []interface{}{"x", "y"},
+		"child":        map[string]interface{}{"CC": 1.0, "CD": "2"},
+		"nested.ratio": "0.5",
+		"labels.k":     1.0,
+	}
+	testEncoding(t, clone, expected)
+
+	// Changes to the struct, including through slices, don't affect the
+	// clone...
+	val.Name = "b"
+	val.Count = 3
+	val.Tags[0] = "z"
+	val.Child.D = "3"
+	val.Nested.Ratio = 2
+	val.Labels["k"] = 2
+	testEncoding(t, clone, expected)
+
+	// ...while the original Map still sees them.
+	if n, _ := flat.GetInt64("count"); n != 3 {
+		t.Errorf("Expected the original Map to stay live, got %d", n)
+	}
+
+	// Changes made through the clone don't affect the struct, and tag
+	// options still apply.
+	if err := clone.Set("count", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.SetString("name", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if val.Count != 3 || val.Name != "b" {
+		t.Errorf("Expected the struct to be unaffected by the clone, got %+v", val)
+	}
+	expected["count"] = 7.0
+	expected["name"] = "c"
+	testEncoding(t, clone, expected)
+
+	if err := clone.Set("count", 0); err != nil {
+		t.Fatal(err)
+	}
+	delete(expected, "count")
+	testEncoding(t, clone, expected)
+
+	if flatjson.Map(nil).Clone() != nil {
+		t.Error("Expected a nil clone of a nil Map")
+	}
+}
+
+func TestCloneGroups(t *testing.T) {
+	val := &struct {
+		TLS struct {
+			Cert string `json:"cert"`
+			Key  string `json:"key"`
+		} `json:"tls,omitempty"`
+	}{}
+
+	clone := flatjson.Flatten(val).Clone()
+	val.TLS.Cert = "x"
+	testEncoding(t, clone, flatjson.Map{})
+
+	// The group of the clone follows the cloned values.
+	if err := clone.SetString("tls.key", "y"); err != nil {
+		t.Fatal(err)
+	}
+	testEncoding(t, clone, flatjson.Map{"tls.cert": "", "tls.key": "y"})
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// A source finds a value that isn't addressable, such as a map element, so
+// that its current contents can be read each time the Map is encoded. A nil
+// source means the value is addressable and doesn't need one.
+type source func() reflect.Value
+
+// addressed returns the source for v, an addressable value, which finds its
+// contents at the time it is called.
+func addressed(v reflect.Value) source {
+	return func() reflect.Value { return v }
+}
+
+// field returns the source for field i of the struct found by s.
+func (s source) field(i int) source {
+	if s == nil {
+		return nil
+	}
+	return func() reflect.Value {
+		v := s()
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		return v.Field(i)
+	}
+}
+
+// index returns the source for element i of the array found by s. Slice
+// elements are always addressable, so they don't need a source.
+func (s source) index(i int) source {
+	if s == nil {
+		return nil
+	}
+	return func() reflect.Value {
+		v := s()
+		if v.Kind() != reflect.Array {
+			return reflect.Value{}
+		}
+		return v.Index(i)
+	}
+}
+
+// mapIndex returns the source for the element of the map found by s that is
+// stored under key.
+func (s source) mapIndex(key reflect.Value) source {
+	return func() reflect.Value {
+		v := s()
+		if v.Kind() != reflect.Map {
+			return reflect.Value{}
+		}
+		return v.MapIndex(key)
+	}
+}
+
+// extract returns a source that unwraps the value found by s the same way the
+// traversal does.
+func (s source) extract() source {
+	if s == nil {
+		return nil
+	}
+	return func() reflect.Value {
+		v := s()
+		return extractStruct(v, v)
+	}
+}
+
+// A lookup is the entry for a value that isn't addressable. Rather than
+// pointing at the value, it finds it again each time it is encoded.
+type lookup struct {
+	src source
+}
+
+func (l *lookup) MarshalJSON() ([]byte, error) {
+	v := l.src()
+	if !v.IsValid() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(v.Interface())
+}
@@ -0,0 +1,264 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// MarshalTo writes the same encoding of m as MarshalJSON to w. Booleans,
+// numbers and strings, and pointers to them, are encoded directly into a
+// reused buffer rather than through encoding/json, which avoids most of the
+// allocations MarshalJSON makes; other values are encoded with json.Marshal.
+// The output is written in chunks, so if an entry can't be encoded, the
+// error is returned and the output written so far is incomplete.
+func (m Map) MarshalTo(w io.Writer) error {
+	if m == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+	return m.streamTo(w, indentation{})
+}
+
+// MarshalIndentTo writes the same encoding of m as MarshalIndent to w, in the
+// same way as MarshalTo.
+func (m Map) MarshalIndentTo(w io.Writer, prefix, indent string) error {
+	if m == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+	return m.streamTo(w, indentation{prefix, indent, true})
+}
+
+func (m Map) streamTo(w io.Writer, ind indentation) error {
+	m = m.expandDynamic()
+	keys := m.sortedKeys()
+	defer putKeys(keys)
+
+	return streamEntries(w, ind, len(*keys), func(i int) (string, interface{}) {
+		key := (*keys)[i]
+		return key, m[key]
+	})
+}
+
+// streamEntries writes a JSON object holding the n entries returned by next
+// to w, indented according to ind, the way MarshalTo does.
+func streamEntries(w io.Writer, ind indentation, n int, next func(i int) (key string, value interface{})) error {
+	bp := scratchPool.Get().(*[]byte)
+	defer scratchPool.Put(bp)
+	buf := append((*bp)[:0], '{')
+
+	first := true
+	for i := 0; i < n; i++ {
+		key, value := next(i)
+		if e, ok := value.(*entry); ok && e.omit() {
+			continue
+		}
+
+		if !first {
+			buf = append(buf, ',')
+		}
+		first = false
+		buf = ind.appendNewline(buf, 1)
+		buf = appendString(buf, key)
+		buf = ind.appendColon(buf)
+
+		start := len(buf)
+		var err error
+		if buf, err = appendValue(buf, value); err != nil {
+			*bp = buf
+			return err
+		}
+		if ind.enabled && len(buf) > start && (buf[start] == '{' || buf[start] == '[') {
+			enc := append([]byte(nil), buf[start:]...)
+			buf = ind.appendNested(buf[:start], enc)
+		}
+
+		if len(buf) >= scratchFlushSize {
+			if _, err := w.Write(buf); err != nil {
+				*bp = buf
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+
+	if !first {
+		buf = ind.appendNewline(buf, 0)
+	}
+	buf = append(buf, '}')
+	*bp = buf
+	_, err := w.Write(buf)
+	return err
+}
+
+// scratchFlushSize is the size at which MarshalTo writes out its buffer.
+const scratchFlushSize = 4096
+
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, scratchFlushSize+512)
+		return &b
+	},
+}
+
+// appendValue appends the JSON encoding of the Map value v to buf.
+func appendValue(buf []byte, v interface{}) ([]byte, error) {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if b, ok := appendScalar(buf, rv.Elem()); ok {
+			return b, nil
+		}
+	}
+
+	enc, err := json.Marshal(v)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, enc...), nil
+}
+
+var numberType = reflect.TypeOf(json.Number(""))
+
+// appendScalar appends the encoding/json encoding of v to buf, if v is a
+// boolean, number or string without a marshaler, or a pointer to one. It
+// returns false if v has to be encoded by encoding/json instead.
+func appendScalar(buf []byte, v reflect.Value) ([]byte, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return append(buf, "null"...), true
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+	default:
+		return buf, false
+	}
+	if v.Type().Name() != "" && v.Type().PkgPath() != "" && (infoFor(v.Type()).marshaler || v.Type() == numberType) {
+		// Encoded by encoding/json, which writes a json.Number as a
+		// number.
+		return buf, false
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.AppendBool(buf, v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(buf, v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.AppendUint(buf, v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return appendFloat(buf, v.Float(), v.Type().Bits())
+	}
+	return appendString(buf, v.String()), true
+}
+
+// appendFloat appends f the way encoding/json formats floats: like ES6, using
+// exponents only for very large and very small values. It returns false for
+// NaN and infinities, which have no encoding.
+func appendFloat(buf []byte, f float64, bits int) ([]byte, bool) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return buf, false
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	buf = strconv.AppendFloat(buf, f, format, -1, bits)
+
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		if n := len(buf); n >= 4 && buf[n-4] == 'e' && buf[n-3] == '-' && buf[n-2] == '0' {
+			buf[n-2] = buf[n-1]
+			buf = buf[:n-1]
+		}
+	}
+	return buf, true
+}
+
+const hexDigits = "0123456789abcdef"
+
+// shortControlEscapes is whether json.Marshal escapes backspace and form feed
+// as \b and \f, which it does since Go 1.22, rather than as \u0008 and
+// \u000c.
+var shortControlEscapes = func() bool {
+	enc, _ := json.Marshal("\b")
+	return string(enc) == `"\b"`
+}()
+
+// appendString appends s as a JSON string, escaped the same way json.Marshal
+// escapes it, including the HTML characters <, > and &, U+2028 and U+2029, and
+// backspace and form feed, whose escapes depend on the Go version. Strings
+// that aren't valid UTF-8 are encoded by json.Marshal, since how it replaces
+// invalid bytes depends on the Go version.
+func appendString(buf []byte, s string) []byte {
+	if !utf8.ValidString(s) {
+		enc, _ := json.Marshal(s)
+		return append(buf, enc...)
+	}
+
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= ' ' && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			case '\b':
+				if shortControlEscapes {
+					buf = append(buf, '\\', 'b')
+				} else {
+					buf = append(buf, '\\', 'u', '0', '0', '0', '8')
+				}
+			case '\f':
+				if shortControlEscapes {
+					buf = append(buf, '\\', 'f')
+				} else {
+					buf = append(buf, '\\', 'u', '0', '0', '0', 'c')
+				}
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
@@ -0,0 +1,30 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+// Strings returns the current values in m formatted as strings. Types
+// implementing encoding.TextMarshaler, such as time.Time in RFC 3339 format,
+// format themselves, strings are used as is, booleans and numbers are
+// formatted with the strconv package, and anything else is encoded as JSON.
+// Floats are formatted without an exponent, so large values like 1e6 come out
+// as 1000000. A value that can't be formatted is replaced by the error
+// message, as by String.
+//
+// Nil pointers are mapped to an empty string, or left out if skipNil is set.
+func (m Map) Strings(skipNil bool) map[string]string {
+	strs := make(map[string]string, len(m))
+	for key, value := range m {
+		v := indirectValue(resolve(value))
+		if !v.IsValid() && skipNil {
+			continue
+		}
+		s, err := formatText(v, textOptions(value))
+		if err != nil {
+			s = err.Error()
+		}
+		strs[key] = s
+	}
+	return strs
+}
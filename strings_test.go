@@ -0,0 +1,70 @@
+package flatjson_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestStrings(t *testing.T) {
+	n := -7
+	val := &struct {
+		Int     int
+		Ptr     *int
+		Nil     *int
+		Uint    uint8
+		Large   float64
+		Small   float32
+		On      bool
+		Name    string
+		Started time.Time
+		IP      net.IP
+		Tags    []string
+		Labels  map[string]int
+		Latency time.Duration
+		Broken  interface{} // Holds a value encoding/json can't encode.
+	}{
+		Int:     3,
+		Ptr:     &n,
+		Uint:    255,
+		Large:   1234567,
+		Small:   0.1,
+		On:      true,
+		Name:    "a b",
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		IP:      net.IPv4(10, 0, 0, 1),
+		Tags:    []string{"x", "y"},
+		Labels:  map[string]int{"a": 1},
+		Latency: time.Second,
+		Broken:  func() {},
+	}
+	flat := flatjson.Flatten(val)
+
+	expected := map[string]string{
+		"Int":     "3",
+		"Ptr":     "-7",
+		"Nil":     "",
+		"Uint":    "255",
+		"Large":   "1234567",
+		"Small":   "0.1",
+		"On":      "true",
+		"Name":    "a b",
+		"Started": "2015-06-01T12:00:00Z",
+		"IP":      "10.0.0.1",
+		"Tags":    `["x","y"]`,
+		"Labels":  `{"a":1}`,
+		"Latency": "1000000000",
+		"Broken":  "json: unsupported type: func()",
+	}
+	if strs := flat.Strings(false); !reflect.DeepEqual(strs, expected) {
+		t.Errorf("Unexpected strings:\n     got: %v\nexpected: %v", strs, expected)
+	}
+
+	delete(expected, "Nil")
+	if strs := flat.Strings(true); !reflect.DeepEqual(strs, expected) {
+		t.Errorf("Unexpected strings with skipNil:\n     got: %v\nexpected: %v", strs, expected)
+	}
+}
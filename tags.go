@@ -0,0 +1,83 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"strings"
+)
+
+// fieldTag returns the name and options from the tag controlling field, and
+// whether the field is skipped. A flatjson tag takes precedence over the first
+// of tagNames present on the field, so that flattened names can differ from
+// the regular encoding; if it doesn't specify a name, the other tag's name is
+// still used, but whether the field is skipped depends only on the flatjson
+// tag. The last return value is false if the field has neither tag.
+func fieldTag(field reflect.StructField, tagNames []string) (name string, opts tagOptions, skip, ok bool) {
+	var tag string
+	for _, tagName := range tagNames {
+		var present bool
+		if tag, present = field.Tag.Lookup(tagName); present {
+			break
+		}
+	}
+	name, opts, skip = parseTag(tag)
+
+	if flatTag := field.Tag.Get("flatjson"); flatTag != "" {
+		var flatName string
+		flatName, opts, skip = parseTag(flatTag)
+
+		if flatName != "" {
+			name = flatName
+		}
+		return name, opts, skip, true
+	}
+
+	return name, opts, skip, tag != ""
+}
+
+// parseTag splits a struct tag into its name and options. Like encoding/json,
+// a tag of exactly "-" skips the field, while "-," names it "-".
+func parseTag(tag string) (name string, opts tagOptions, skip bool) {
+	if tag == "-" {
+		return "", "", true
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tagOptions(tag[i+1:]), false
+	}
+	return tag, "", false
+}
+
+// tagOptions is the comma-separated list of options following the name in a
+// struct tag.
+type tagOptions string
+
+// Get returns the value of the option name, given as name=value, or an empty
+// string if opts doesn't contain it.
+func (opts tagOptions) Get(name string) string {
+	for _, option := range strings.Split(string(opts), ",") {
+		if strings.HasPrefix(option, name+"=") {
+			return option[len(name)+1:]
+		}
+	}
+	return ""
+}
+
+// Contains reports whether opts contains the option name.
+func (opts tagOptions) Contains(name string) bool {
+	s := string(opts)
+	for s != "" {
+		var option string
+		if i := strings.Index(s, ","); i >= 0 {
+			option, s = s[:i], s[i+1:]
+		} else {
+			option, s = s, ""
+		}
+		if option == name {
+			return true
+		}
+	}
+	return false
+}
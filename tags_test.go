@@ -0,0 +1,82 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+func TestTagNames(t *testing.T) {
+	for _, test := range []struct {
+		tag      reflect.StructTag
+		expected flatjson.Map
+	}{
+		{`json:"-"`, flatjson.Map{}},
+		{`json:"-,"`, flatjson.Map{"-": 1.0}},
+		{`json:"-,omitempty"`, flatjson.Map{"-": 1.0}},
+		{`json:"name,-"`, flatjson.Map{"name": 1.0}},
+		{`json:""`, flatjson.Map{"Field": 1.0}},
+		{`json:",omitempty"`, flatjson.Map{"Field": 1.0}},
+		{`flatjson:"-"`, flatjson.Map{}},
+		{`flatjson:"-,"`, flatjson.Map{"-": 1.0}},
+		{`json:"-" flatjson:"-,"`, flatjson.Map{"-": 1.0}},
+		{`json:"-," flatjson:",omitempty"`, flatjson.Map{"-": 1.0}},
+		{`json:"name" flatjson:"-"`, flatjson.Map{}},
+	} {
+		typ := reflect.StructOf([]reflect.StructField{{Name: "Field", Type: reflect.TypeOf(0), Tag: test.tag}})
+		val := reflect.New(typ)
+		val.Elem().Field(0).SetInt(1)
+
+		testFlattening(t, val.Interface(), test.expected)
+
+		// Without a flatjson tag, the key is the name encoding/json uses.
+		if test.tag.Get("flatjson") == "" {
+			enc, err := json.Marshal(val.Interface())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fromJSON flatjson.Map
+			json.Unmarshal(enc, &fromJSON)
+			if !reflect.DeepEqual(fromJSON, test.expected) {
+				t.Errorf("Expected encoding/json to agree for tag %s, got %s", test.tag, enc)
+			}
+		}
+	}
+}
+
+type SharedConfig struct {
+	Listen  string `json:"listen_addr" yaml:"listen"`
+	Workers int    `yaml:"workers,omitempty" mapstructure:"num_workers"`
+	Debug   bool   `mapstructure:"debug"`
+	Secret  string `json:"secret" yaml:"-"`
+	Plain   int
+}
+
+func TestTagPrecedence(t *testing.T) {
+	val := &SharedConfig{Listen: ":80", Secret: "s", Plain: 1}
+
+	for _, test := range []struct {
+		tagNames []string
+		expected flatjson.Map
+	}{
+		{nil, flatjson.Map{"listen_addr": ":80", "Workers": 0.0, "Debug": false, "secret": "s", "Plain": 1.0}},
+		{[]string{"json", "yaml"}, flatjson.Map{"listen_addr": ":80", "Debug": false, "secret": "s", "Plain": 1.0}},
+		{[]string{"yaml", "json"}, flatjson.Map{"listen": ":80", "Debug": false, "Plain": 1.0}},
+		{[]string{"mapstructure", "yaml"}, flatjson.Map{"listen": ":80", "num_workers": 0.0, "debug": false, "Plain": 1.0}},
+	} {
+		flat := flatjson.FlattenWithOptions(val, flatjson.Options{TagNames: test.tagNames})
+		testEncoding(t, flat, test.expected)
+	}
+
+	// The names of the winning tag are used when decoding too.
+	opts := flatjson.Options{TagNames: []string{"mapstructure", "yaml"}}
+	got := &SharedConfig{}
+	if err := opts.UnmarshalFlat([]byte(`{"listen":":81","num_workers":4,"debug":true}`), got); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (SharedConfig{Listen: ":81", Workers: 4, Debug: true}); *got != expected {
+		t.Errorf("Unexpected result: %+v", got)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"sort"
+)
+
+// A TypeKey describes a key produced by flattening a struct type.
+type TypeKey struct {
+	Key string
+
+	// Optional is set if the key's presence depends on the values: for
+	// fields tagged with omitempty, and for fields reached through a pointer
+	// to a struct, which only appear once the pointer is set.
+	Optional bool
+}
+
+// Keys returns the keys Flatten produces for values of the struct type t, or
+// of a pointer to it, in sorted order. It is Options.Keys with the zero
+// Options.
+func Keys(t reflect.Type) ([]string, error) {
+	return Options{}.Keys(t)
+}
+
+// Keys returns the keys flattening according to o produces for values of the
+// struct type t, or of a pointer to it, in sorted order. The keys are those of
+// a value with every pointer to a struct allocated and every field included
+// regardless of omitempty; see TypeKeys to tell which of them depend on the
+// values. Maps and slices which would be flattened element by element have no
+// elements, so they produce no keys. An error is returned if t isn't a struct
+// type, or if its values can't be flattened.
+func (o Options) Keys(t reflect.Type) ([]string, error) {
+	tks, err := o.TypeKeys(t)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(tks))
+	for i, tk := range tks {
+		keys[i] = tk.Key
+	}
+	return keys, nil
+}
+
+// TypeKeys is like Keys, but also reports which of the keys are optional.
+func (o Options) TypeKeys(t reflect.Type) ([]TypeKey, error) {
+	all, base, err := o.typeEntries(t)
+	if err != nil {
+		return nil, err
+	}
+
+	tks := make([]TypeKey, 0, len(all))
+	for key := range all {
+		tks = append(tks, TypeKey{key, isOptional(base, key)})
+	}
+	sort.Slice(tks, func(i, j int) bool { return tks[i].Key < tks[j].Key })
+	return tks, nil
+}
+
+// typeEntries returns the entries for a value of the struct type t, or of a
+// pointer to it, as described by Keys, along with the entries for its zero
+// value.
+func (o Options) typeEntries(t reflect.Type) (all, base Map, err error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil, rootError("TypeKeys", t, "flatjson: %s is not a struct", t)
+	}
+
+	// The keys a zero value always produces, which also checks for errors.
+	o.EagerOmitEmpty = false
+	base, err = o.Flatten(reflect.New(t).Interface())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all = Map{}
+	o.NilStructs = NilStructAllocate
+	f := newFlattener(o, all)
+	f.keepEmpty = true
+	f.flatten(reflect.New(t).Elem(), f.opts.rootPrefix(), nil)
+	return all, base, nil
+}
+
+// isOptional reports whether key, one of the keys for a type, is optional,
+// given the entries for the type's zero value.
+func isOptional(base Map, key string) bool {
+	v, ok := base[key]
+	e, isEntry := v.(*entry)
+	return !ok || isEntry && (e.omitEmpty || e.omitZero || e.group != nil)
+}
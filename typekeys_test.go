@@ -0,0 +1,67 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type KeyedStats struct {
+	CommonStats
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+	Skipped int    `json:"-"`
+	hidden  int
+	TLS     *struct {
+		Cert string `json:"cert"`
+	} `json:"tls"`
+	Child Child `json:"child,omitempty"`
+}
+
+func TestKeys(t *testing.T) {
+	keys, err := flatjson.Keys(reflect.TypeOf(KeyedStats{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fully populated value produces the same keys.
+	val := &KeyedStats{Name: "n", Comment: "c", Skipped: 1, hidden: 2, Child: Child{1, "2"}}
+	val.Errors = 1
+	val.TLS = &struct {
+		Cert string `json:"cert"`
+	}{"x"}
+
+	var expected []string
+	for key := range flatjson.Flatten(val) {
+		expected = append(expected, key)
+	}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Unexpected keys:\n     got: %v\nexpected: %v", keys, expected)
+	}
+
+	tks, err := flatjson.Options{Prefix: "conn"}.TypeKeys(reflect.TypeOf(&KeyedStats{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedKeys := []flatjson.TypeKey{
+		{"conn.Errors", true},
+		{"conn.Requests", false},
+		{"conn.active", false},
+		{"conn.child.CC", true},
+		{"conn.child.CD", true},
+		{"conn.comment", true},
+		{"conn.idle", false},
+		{"conn.name", false},
+		{"conn.tls.cert", true},
+	}
+	if !reflect.DeepEqual(tks, expectedKeys) {
+		t.Errorf("Unexpected type keys:\n     got: %v\nexpected: %v", tks, expectedKeys)
+	}
+
+	if _, err := flatjson.Keys(reflect.TypeOf(0)); err == nil {
+		t.Error("Expected an error for a non-struct type")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import "reflect"
+
+// A TypeNamer is a struct type that gives the name Options.TypeKey adds for
+// it, such as a name that stays the same when the type is renamed or moved.
+// TypeName is called when the struct is flattened, on a pointer to it if the
+// struct is addressable.
+type TypeNamer interface {
+	TypeName() string
+}
+
+var typeNamerType = reflect.TypeOf((*TypeNamer)(nil)).Elem()
+
+// addTypeKey adds the entry for Options.TypeKey naming the type of val, a
+// top-level struct, with prefix prepended to its key, and returns the number
+// of entries added.
+func (f *flattener) addTypeKey(val reflect.Value, prefix string) int {
+	key := prefix + f.opts.TypeKey
+	if f.output.add(key, typeName(val, f.opts.TypeNames)) {
+		f.takenTypeKey = key
+	}
+	return 1
+}
+
+// typeName returns the name of the type of val, formatted according to format
+// unless the type implements TypeNamer.
+func typeName(val reflect.Value, format TypeNameFormat) string {
+	if val.CanAddr() && val.Addr().Type().Implements(typeNamerType) {
+		return val.Addr().Interface().(TypeNamer).TypeName()
+	}
+	if val.Type().Implements(typeNamerType) {
+		return val.Interface().(TypeNamer).TypeName()
+	}
+
+	t := val.Type()
+	if format == TypeNameQualified && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
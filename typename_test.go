@@ -0,0 +1,70 @@
+package flatjson_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type CacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// QueueStats names itself, so that its name doesn't depend on the package.
+type QueueStats struct {
+	Depth int `json:"depth"`
+}
+
+func (*QueueStats) TypeName() string { return "queue" }
+
+func TestTypeKey(t *testing.T) {
+	cache := &CacheStats{Hits: 3}
+	queue := &QueueStats{Depth: 2}
+	opts := flatjson.Options{TypeKey: "_type"}
+
+	flat, err := opts.Compose(map[string]interface{}{"cache": cache, "queue": queue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEncoding(t, flat, flatjson.Map{
+		"cache._type":  "flatjson_test.CacheStats",
+		"cache.hits":   3.0,
+		"cache.misses": 0.0,
+		"queue._type":  "queue",
+		"queue.depth":  2.0,
+	})
+
+	// The entries take part in the text exporters too.
+	text, err := flat.MarshalText()
+	if err != nil || !strings.Contains(string(text), "cache._type=flatjson_test.CacheStats") || !strings.Contains(string(text), "queue._type=queue") {
+		t.Errorf("Expected the type keys in the logfmt output, got %s, %v", text, err)
+	}
+	if s := flat.Strings(false); s["queue._type"] != "queue" {
+		t.Errorf("Unexpected string for the type key: %q", s["queue._type"])
+	}
+
+	opts.TypeNames = flatjson.TypeNameQualified
+	if flat = flatjson.FlattenWithOptions(cache, opts); flat["_type"] != "github.com/pushrax/flatjson_test.CacheStats" {
+		t.Errorf("Unexpected qualified type name: %#v", flat["_type"])
+	}
+
+	// The key is skipped when unmarshaling.
+	var decoded CacheStats
+	if err := opts.UnmarshalFlat([]byte(`{"_type":"CacheStats","hits":5}`), &decoded); err != nil || decoded.Hits != 5 {
+		t.Errorf("Unexpected UnmarshalFlat result: %+v, %v", decoded, err)
+	}
+
+	// A field can't have the same key.
+	_, err = flatjson.Options{TypeKey: "hits"}.Flatten(cache)
+	if e, ok := err.(*flatjson.Error); !ok || e.Key != "hits" || !strings.Contains(err.Error(), `type key "hits"`) {
+		t.Errorf("Expected an error for the colliding type key, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := flatjson.FlattenWithOptions(queue, flatjson.Options{TypeKey: "_type", Prefix: "q"}).WriteEnv(&buf, ""); err != nil || !strings.Contains(buf.String(), "Q_TYPE=queue") {
+		t.Errorf("Expected the type key in the env output, got %q, %v", buf.String(), err)
+	}
+}
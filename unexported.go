@@ -0,0 +1,50 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// addUnexported adds the entry for the unexported field of val described by
+// fp, with Options.IncludeUnexported, under key. The entry holds a copy of
+// the field's current value, which settable refuses, even when it is a
+// pointer. Parent describes val.
+func (f *flattener) addUnexported(val reflect.Value, fp fieldPlan, key string, parent node) int {
+	field := val.Field(fp.index)
+	if info := infoFor(field.Type()); info.unsupported || info.lock && !f.opts.IncludeLocks {
+		return 0
+	}
+
+	if !val.CanAddr() {
+		c := reflect.New(val.Type()).Elem()
+		c.Set(val)
+		field = c.Field(fp.index)
+	}
+	// Reading an unexported field through reflect requires going around
+	// the reflect package's checks, with a Value made from its address.
+	readable := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+	value := deepCopy(readable, map[visit]reflect.Value{}).Interface()
+
+	var meta *FieldMeta
+	if f.opts.RecordMeta {
+		meta = parent.meta.child(val.Type().Field(fp.index), f.opts)
+	}
+	e := &entry{
+		value:        value,
+		redact:       parent.redact || fp.redact,
+		redactFunc:   f.opts.RedactFunc,
+		key:          key,
+		meta:         meta,
+		valueFunc:    f.opts.ValueFunc,
+		keyValueFunc: f.opts.ValueFuncs[key],
+		snapshot:     true,
+	}
+	if f.output.add(key, e) {
+		f.duplicates = append(f.duplicates, key)
+	}
+	return 1
+}
@@ -0,0 +1,138 @@
+package flatjson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type Internals struct {
+	Public int
+	count  int
+	label  string `flatjson:"name"`
+	cache  map[string]int
+	order  []string
+	child  Child
+	secret string `flatjson:",redact"`
+	skip   int    `flatjson:"-"`
+	ch     chan int
+}
+
+func TestIncludeUnexported(t *testing.T) {
+	val := &Internals{
+		Public: 1,
+		count:  2,
+		label:  "a",
+		cache:  map[string]int{"x": 1},
+		order:  []string{"x"},
+		child:  Child{3, "4"},
+		secret: "s",
+		skip:   5,
+	}
+	testFlattening(t, val, flatjson.Map{"Public": 1.0})
+
+	opts := flatjson.Options{IncludeUnexported: true}
+	flat := flatjson.FlattenWithOptions(val, opts)
+	expected := flatjson.Map{
+		"Public": 1.0,
+		"count":  2.0,
+		"name":   "a",
+		"cache":  map[string]interface{}{"x": 1.0},
+		"order":  []interface{}{"x"},
+		"child":  map[string]interface{}{"CC": 3.0, "CD": "4"},
+		"secret": flatjson.Redacted,
+	}
+	testEncoding(t, flat, expected)
+
+	// The unexported values are snapshots, while exported ones are live.
+	val.Public, val.count = 6, 7
+	val.cache["x"] = 8
+	val.order[0] = "y"
+	expected["Public"] = 6.0
+	testEncoding(t, flat, expected)
+
+	if err := flat.Set("count", 9); err == nil {
+		t.Error("Expected an error setting an unexported field")
+	}
+	if err := flat.SetString("name", "b"); err == nil {
+		t.Error("Expected an error setting an unexported field")
+	}
+
+	// Flattening never changes the struct, even through the copies.
+	flat = flatjson.FlattenWithOptions(val, opts)
+	values := flat.Values()
+	values["cache"].(map[string]int)["x"] = 10
+	values["order"].([]string)[0] = "z"
+	flat.Values()["cache"].(map[string]int)["y"] = 11
+	if !reflect.DeepEqual(val.cache, map[string]int{"x": 8}) || !reflect.DeepEqual(val.order, []string{"y"}) {
+		t.Errorf("Expected the struct to be unchanged, got %+v", val)
+	}
+}
+
+func TestIncludeUnexportedPointers(t *testing.T) {
+	n := 1
+	val := &struct {
+		Public int
+		ptr    *int
+		sub    *Child
+	}{2, &n, &Child{3, "4"}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{IncludeUnexported: true})
+
+	// The copies of pointers aren't written through either.
+	for _, set := range []func() error{
+		func() error { return flat.Set("ptr", 5) },
+		func() error { return flat.SetString("ptr", "6") },
+		func() error { return flat.Set("sub", &Child{9, "x"}) },
+	} {
+		if err := set(); err == nil {
+			t.Error("Expected an error setting an unexported pointer field")
+		}
+	}
+
+	err := flat.Zero()
+	if e, ok := err.(*flatjson.Error); !ok || !e.Is(flatjson.ErrNotSettable) {
+		t.Errorf("Expected ErrNotSettable zeroing the unexported fields, got %v", err)
+	} else if expected := "flatjson: keys that can't be zeroed: ptr, sub"; err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+	testEncoding(t, flat, flatjson.Map{
+		"Public": 0.0,
+		"ptr":    1.0,
+		"sub":    map[string]interface{}{"CC": 3.0, "CD": "4"},
+	})
+	if n != 1 || val.sub.C != 3 {
+		t.Errorf("Expected the struct to be unchanged, got %+v", val)
+	}
+}
+
+func TestIncludeUnexportedNested(t *testing.T) {
+	val := &struct {
+		Inner *Internals `json:"inner"`
+		list  []int
+	}{&Internals{
+		Public: 1,
+		count:  2,
+		label:  "a",
+		cache:  map[string]int{"x": 1},
+		order:  []string{"x"},
+		child:  Child{3, "4"},
+		secret: "s",
+	}, []int{1}}
+
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{
+		IncludeUnexported: true,
+		FieldFilter: func(path string, field reflect.StructField, v reflect.Value) bool {
+			return path != "inner.cache"
+		},
+	})
+	testEncoding(t, flat, flatjson.Map{
+		"inner.Public": 1.0,
+		"inner.count":  2.0,
+		"inner.name":   "a",
+		"inner.order":  []interface{}{"x"},
+		"inner.child":  map[string]interface{}{"CC": 3.0, "CD": "4"},
+		"inner.secret": flatjson.Redacted,
+		"list":         []interface{}{1.0},
+	})
+}
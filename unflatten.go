@@ -0,0 +1,207 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Unflatten writes the values in m into the struct pointed to by dst. The keys
+// of m are interpreted the same way Flatten generates them, so a Map produced
+// by Flatten (or decoded from its JSON encoding) can be written back into a
+// struct of the same type. Nil pointers to structs are allocated as needed.
+//
+// Values in m may be pointers, as generated by Flatten, or plain values. An
+// error is returned for unknown keys and for values that can't be converted to
+// the type of the corresponding field, in which case dst may have been
+// partially updated.
+func Unflatten(m Map, dst interface{}) error {
+	rval, err := extractRoot("Unflatten", reflect.ValueOf(dst), false)
+	if err != nil {
+		return err
+	}
+
+	var nilStructs []nilStruct
+	targets := Map{}
+	f := newFlattener(Options{}, targets)
+	f.keepEmpty = true
+	f.nilStructs = &nilStructs
+	f.flatten(rval, "", nil)
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		target, ok := f.resolve(targets, key)
+		if !ok {
+			return &Error{Op: "Unflatten", Key: key, kind: ErrKeyNotFound, msg: fmt.Sprintf("flatjson: unknown key %q", key)}
+		}
+
+		dst, store, _ := settable(target)
+		if err := assignValue(dst, m[key]); err != nil {
+			return keyError("Unflatten", key, err)
+		}
+		if err := store(); err != nil {
+			return keyError("Unflatten", key, err)
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the entry for key in targets, the output of f, allocating
+// nil pointer structs along the way if that makes the key available.
+func (f *flattener) resolve(targets Map, key string) (interface{}, bool) {
+	for {
+		if target, ok := targets[key]; ok {
+			return target, true
+		}
+
+		// Find the most deeply nested nil struct the key could belong to.
+		best := -1
+		for i, ns := range *f.nilStructs {
+			if strings.HasPrefix(key, ns.prefix) && (best < 0 || len(ns.prefix) > len((*f.nilStructs)[best].prefix)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return nil, false
+		}
+
+		ns := (*f.nilStructs)[best]
+		*f.nilStructs = append((*f.nilStructs)[:best], (*f.nilStructs)[best+1:]...)
+
+		delete(targets, ns.key)
+		f.flattenStruct(allocateStruct(ns.field), ns.node)
+	}
+}
+
+// assignValue sets dst to src, converting between compatible types.
+func assignValue(dst reflect.Value, src interface{}) error {
+	sval := reflect.ValueOf(unwrap(src))
+
+	for {
+		if !sval.IsValid() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if sval.Type().AssignableTo(dst.Type()) {
+			dst.Set(sval)
+			return nil
+		}
+		if sval.Kind() != reflect.Ptr && sval.Kind() != reflect.Interface {
+			break
+		}
+		sval = sval.Elem()
+	}
+
+	if ok, err := convertValue(dst, sval); ok {
+		return err
+	}
+
+	// Fall back to a JSON round trip, which handles values that were decoded
+	// from JSON into a more generic form, like time.Time as a string.
+	enc, err := json.Marshal(sval.Interface())
+	if err == nil {
+		err = json.Unmarshal(enc, dst.Addr().Interface())
+	}
+	if err != nil {
+		return typeError(dst.Type(), "cannot assign %s to %s", sval.Type(), dst.Type())
+	}
+	return nil
+}
+
+// convertValue handles conversions between numeric kinds, making sure the
+// value is representable in the destination type, and between string kinds.
+// The first return value is false if the conversion isn't applicable.
+func convertValue(dst, src reflect.Value) (bool, error) {
+	mismatch := typeError(dst.Type(), "cannot assign %s to %s", src.Type(), dst.Type())
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.OverflowInt(src.Int()) {
+				return true, typeError(dst.Type(), "value %d overflows %s", src.Int(), dst.Type())
+			}
+			dst.SetInt(src.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if src.Uint() > math.MaxInt64 || dst.OverflowInt(int64(src.Uint())) {
+				return true, typeError(dst.Type(), "value %d overflows %s", src.Uint(), dst.Type())
+			}
+			dst.SetInt(int64(src.Uint()))
+		case reflect.Float32, reflect.Float64:
+			f := src.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || dst.OverflowInt(int64(f)) {
+				return true, typeError(dst.Type(), "value %v is not representable as %s", f, dst.Type())
+			}
+			dst.SetInt(int64(f))
+		default:
+			return true, mismatch
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if src.Int() < 0 || dst.OverflowUint(uint64(src.Int())) {
+				return true, typeError(dst.Type(), "value %d overflows %s", src.Int(), dst.Type())
+			}
+			dst.SetUint(uint64(src.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if dst.OverflowUint(src.Uint()) {
+				return true, typeError(dst.Type(), "value %d overflows %s", src.Uint(), dst.Type())
+			}
+			dst.SetUint(src.Uint())
+		case reflect.Float32, reflect.Float64:
+			f := src.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || dst.OverflowUint(uint64(f)) {
+				return true, typeError(dst.Type(), "value %v is not representable as %s", f, dst.Type())
+			}
+			dst.SetUint(uint64(f))
+		default:
+			return true, mismatch
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch src.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			dst.SetFloat(float64(src.Int()))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			dst.SetFloat(float64(src.Uint()))
+		case reflect.Float32, reflect.Float64:
+			if dst.OverflowFloat(src.Float()) {
+				return true, typeError(dst.Type(), "value %v overflows %s", src.Float(), dst.Type())
+			}
+			dst.SetFloat(src.Float())
+		default:
+			return true, mismatch
+		}
+
+	case reflect.String:
+		if src.Kind() != reflect.String {
+			return true, mismatch
+		}
+		dst.SetString(src.String())
+
+	case reflect.Bool:
+		if src.Kind() != reflect.Bool {
+			return true, mismatch
+		}
+		dst.SetBool(src.Bool())
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
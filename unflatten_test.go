@@ -0,0 +1,151 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type Config struct {
+	Child
+	Name    string
+	Port    uint16    `json:"port"`
+	Ratio   float64   `json:"ratio,omitempty"`
+	Tags    []string  `json:"tags"`
+	Started time.Time `json:"started"`
+	Other   *Child    `json:"other"`
+	Deep    **Child
+	Skipped int `json:"-"`
+}
+
+func TestUnflatten(t *testing.T) {
+	val := &Config{}
+
+	err := flatjson.Unflatten(flatjson.Map{
+		"CC":       10.0,
+		"CD":       "str",
+		"Name":     "name",
+		"port":     8080,
+		"ratio":    0.5,
+		"tags":     []interface{}{"a", "b"},
+		"started":  "2015-06-01T12:00:00Z",
+		"other.CC": 3,
+		"Deep.CD":  "deep",
+	}, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deep := &Child{D: "deep"}
+	expected := &Config{
+		Child:   Child{10, "str"},
+		Name:    "name",
+		Port:    8080,
+		Ratio:   0.5,
+		Tags:    []string{"a", "b"},
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Other:   &Child{C: 3},
+		Deep:    &deep,
+	}
+
+	if !reflect.DeepEqual(val, expected) {
+		t.Errorf("Unflattened to unexpected value:\n     got: %#v\nexpected: %#v\n", val, expected)
+	}
+}
+
+func TestUnflattenRoundTrip(t *testing.T) {
+	deep := &Child{5, "6"}
+	src := &Config{
+		Child:   Child{1, "2"},
+		Name:    "name",
+		Port:    443,
+		Tags:    []string{"x"},
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Other:   &Child{3, "4"},
+		Deep:    &deep,
+	}
+
+	// Directly from the pointers in a Map.
+	dst := &Config{}
+	if err := flatjson.Unflatten(flatjson.Flatten(src), dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Errorf("Unflattened to unexpected value:\n     got: %#v\nexpected: %#v\n", dst, src)
+	}
+
+	// Through the Map's JSON encoding.
+	enc, err := json.Marshal(flatjson.Flatten(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := flatjson.Map{}
+	if err := json.Unmarshal(enc, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	dst = &Config{}
+	if err := flatjson.Unflatten(decoded, dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dst, src) {
+		t.Errorf("Unflattened to unexpected value:\n     got: %#v\nexpected: %#v\n", dst, src)
+	}
+}
+
+func TestUnflattenEmbeddedPointer(t *testing.T) {
+	val := &struct {
+		*Child
+		A int
+	}{}
+
+	if err := flatjson.Unflatten(flatjson.Map{"CC": 1, "A": 2}, val); err != nil {
+		t.Fatal(err)
+	}
+	if val.Child == nil || val.C != 1 || val.A != 2 {
+		t.Errorf("Unflattened to unexpected value: %#v", val)
+	}
+}
+
+func TestUnflattenEmbeddedConflict(t *testing.T) {
+	// S is resolved through the nil embedded pointer once it is allocated,
+	// to BugB's own field rather than the one it embeds.
+	val := &struct {
+		*BugB
+		A int `json:"a"`
+	}{}
+
+	if err := flatjson.Unflatten(flatjson.Map{"S": "outer", "a": 1}, val); err != nil {
+		t.Fatal(err)
+	}
+	if val.BugB == nil || val.BugB.S != "outer" || val.BugA.S != "" {
+		t.Errorf("Unflattened to unexpected value: %#v", val)
+	}
+}
+
+func TestUnflattenErrors(t *testing.T) {
+	tests := []struct {
+		m   flatjson.Map
+		dst interface{}
+	}{
+		{flatjson.Map{"Bogus": 1}, &Config{}},
+		{flatjson.Map{"Skipped": 1}, &Config{}},
+		{flatjson.Map{"Name": 1}, &Config{}},
+		{flatjson.Map{"port": -1}, &Config{}},
+		{flatjson.Map{"port": 70000}, &Config{}},
+		{flatjson.Map{"port": 1.5}, &Config{}},
+		{flatjson.Map{"tags": "a"}, &Config{}},
+		{flatjson.Map{"Name": "a"}, Config{}},
+		{flatjson.Map{"Name": "a"}, (*Config)(nil)},
+		{flatjson.Map{}, new(int)},
+	}
+
+	for _, tt := range tests {
+		if err := flatjson.Unflatten(tt.m, tt.dst); err == nil {
+			t.Errorf("Expected error for %#v into %T", tt.m, tt.dst)
+		}
+	}
+}
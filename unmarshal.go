@@ -0,0 +1,252 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnmarshalFlat decodes data, a JSON object with flattened keys like the
+// encoding of a Map, into the struct pointed to by dst. It is
+// Options.UnmarshalFlat with the zero Options.
+func UnmarshalFlat(data []byte, dst interface{}) error {
+	return Options{}.UnmarshalFlat(data, dst)
+}
+
+// UnmarshalFlat decodes data, a JSON object whose keys are those flattening
+// dst according to o produces, into the struct pointed to by dst. Keys are
+// matched to fields by the same tag and embedding rules Flatten uses, and nil
+// pointers to structs are allocated as needed. Each value is decoded into its
+// field by encoding/json, so numbers are converted to the field's kind and
+// fields tagged with the string option are unquoted first.
+//
+// Keys that don't match a field are skipped, and once the others have been
+// decoded, an *UnknownKeysError listing them is returned, unless
+// o.IgnoreUnknownKeys is set. An error naming the key is returned for a value
+// that can't be decoded into its field, in which case dst may have been
+// partially updated. Redacted fields, and fields encoded in a form that can't
+// be decoded, are handled as by UnmarshalMap.
+func (o Options) UnmarshalFlat(data []byte, dst interface{}) error {
+	doc, err := decodeObject("UnmarshalFlat", data)
+	if err != nil {
+		return err
+	}
+
+	rval, err := extractRoot("UnmarshalFlat", reflect.ValueOf(dst), false)
+	if err != nil {
+		return err
+	}
+
+	var nilStructs []nilStruct
+	targets := Map{}
+	f := newFlattener(o, targets)
+	f.keepEmpty = true
+	f.nilStructs = &nilStructs
+	f.flatten(rval, f.opts.rootPrefix(), nil)
+
+	return o.decodeKeys("UnmarshalFlat", doc, func(key string) (interface{}, bool) {
+		return f.resolve(targets, key)
+	})
+}
+
+// UnmarshalJSON decodes data, a JSON object like the encoding of m, and writes
+// the value of each of its keys through m's entry for the key, so that the
+// fields the entries point to are updated, as by Options.UnmarshalMap with
+// the zero Options. Together with ServeHTTP, that allows a Map to serve as
+// both ends of a configuration endpoint.
+//
+// A Map without any entries, such as a new or nil one, is filled with the
+// decoded values instead, the same way encoding/json fills a
+// map[string]interface{}, so decoding a Map from scratch works as before. As
+// with any json.Unmarshaler, options of a json.Decoder, like UseNumber, don't
+// apply.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	if len(*m) > 0 {
+		return Options{}.UnmarshalMap(*m, data)
+	}
+	if string(data) == "null" {
+		return nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(Map, len(values))
+	}
+	for key, value := range values {
+		(*m)[key] = value
+	}
+	return nil
+}
+
+// UnmarshalMap decodes data, a JSON object like the encoding of m, and writes
+// the value of each of its keys through m's entry for the key. Each value is
+// decoded into its field the same way as by UnmarshalFlat, so numbers are
+// converted to the field's kind, and an error naming the key is returned if it
+// can't be. Entries whose keys are missing from data are left as they are.
+//
+// Keys that m has no entry for are skipped, and once the others have been
+// decoded, an *UnknownKeysError listing them is returned, unless
+// o.IgnoreUnknownKeys is set. An error is also returned for keys whose entries
+// can't be written through, like those for map elements or added by AddFunc.
+// After an error, some of the fields may have been updated.
+//
+// Keys of redacted entries, those of fields tagged with redact and those the
+// RedactFunc of the entry hides, are skipped, so that the Map's own encoding
+// can be sent back without writing Redacted into them. An error of kind
+// ErrNotSettable is returned for entries whose values are encoded in a form
+// that can't be decoded into their fields: those formatted with TimeFormat,
+// DurationFormat, BytesFormat, Stringers or ComplexObjects, and the strings of
+// net.IPNet, net.HardwareAddr and url.URL fields.
+func (o Options) UnmarshalMap(m Map, data []byte) error {
+	doc, err := decodeObject("UnmarshalMap", data)
+	if err != nil {
+		return err
+	}
+	return o.decodeKeys("UnmarshalMap", doc, func(key string) (interface{}, bool) {
+		target, ok := m[key]
+		return target, ok
+	})
+}
+
+// decodeObject decodes data, which must be a JSON object, into the raw values
+// of its keys. Errors are reported for op.
+func decodeObject(op string, data []byte) (map[string]json.RawMessage, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			e := newError(op, ErrTypeMismatch, "flatjson: expected a JSON object, got %s", te.Value)
+			e.Err = err
+			return nil, e
+		}
+		e := newError(op, nil, "flatjson: %v", err)
+		e.Err = err
+		return nil, e
+	}
+	if doc == nil {
+		return nil, newError(op, ErrTypeMismatch, "flatjson: expected a JSON object, got null")
+	}
+	return doc, nil
+}
+
+// decodeKeys decodes the values of doc, in sorted key order, into the fields
+// of the Map values find returns for their keys, reporting errors for op. The
+// key of Options.TypeKey is skipped, since it names the type rather than a
+// field.
+func (o Options) decodeKeys(op string, doc map[string]json.RawMessage, find func(key string) (interface{}, bool)) error {
+	typeKey := ""
+	if o.TypeKey != "" {
+		typeKey = o.rootPrefix() + o.TypeKey
+	}
+
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		if typeKey == "" || key != typeKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var unknown []string
+	for _, key := range keys {
+		target, ok := find(key)
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+
+		if e, ok := target.(*entry); ok {
+			if e.redacted() {
+				continue
+			}
+			if !e.decodable() {
+				return &Error{Op: op, Key: key, kind: ErrNotSettable, msg: fmt.Sprintf("flatjson: key %q is encoded in a form that can't be decoded", key)}
+			}
+		}
+
+		field, store, ok := settable(target)
+		if !ok {
+			return &Error{Op: op, Key: key, kind: ErrNotSettable, msg: fmt.Sprintf("flatjson: key %q can't be set", key)}
+		}
+		if err := decodeValue(field, doc[key], target); err != nil {
+			return keyError(op, key, err)
+		}
+		if err := store(); err != nil {
+			return keyError(op, key, err)
+		}
+	}
+
+	if len(unknown) > 0 && !o.IgnoreUnknownKeys {
+		return &UnknownKeysError{Keys: unknown}
+	}
+	return nil
+}
+
+// redacted reports whether the entry's current value is hidden when it is
+// encoded.
+func (e *entry) redacted() bool {
+	if e.redact {
+		return true
+	}
+	if e.redactFunc == nil {
+		return false
+	}
+	var current interface{}
+	if rv := resolve(e.value); rv.IsValid() {
+		current = rv.Interface()
+	}
+	_, ok := e.redactFunc(e.key, current)
+	return ok
+}
+
+// decodable reports whether the encoding of the entry's value can be decoded
+// back into its field by encoding/json.
+func (e *entry) decodable() bool {
+	return e.timeFormat == "" && e.durationFormat == DurationNanos && e.bytesFormat == BytesBase64 &&
+		!e.stringer && !e.complex && !e.netText
+}
+
+// decodeValue decodes raw into dst, the field for the Map value target.
+func decodeValue(dst reflect.Value, raw json.RawMessage, target interface{}) error {
+	if e, ok := target.(*entry); ok && e.quoted && string(raw) != "null" {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return typeError(dst.Type(), "expected a quoted value for %s, got %s", dst.Type(), raw)
+		}
+		raw = json.RawMessage(s)
+	}
+
+	if err := json.Unmarshal(raw, dst.Addr().Interface()); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok {
+			e := typeError(dst.Type(), "cannot decode %s into %s", te.Value, dst.Type())
+			e.Err = err
+			return e
+		}
+		return err
+	}
+	return nil
+}
+
+// An UnknownKeysError is returned by UnmarshalFlat for keys that don't match
+// a field of the destination struct, and by UnmarshalMap for keys the Map has
+// no entry for. It is of the kind ErrKeyNotFound.
+type UnknownKeysError struct {
+	Keys []string // In sorted order.
+}
+
+func (e *UnknownKeysError) Error() string {
+	return "flatjson: unknown keys: " + strings.Join(e.Keys, ", ")
+}
+
+// Is reports whether target is ErrKeyNotFound.
+func (e *UnknownKeysError) Is(target error) bool {
+	return target == ErrKeyNotFound
+}
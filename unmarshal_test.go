@@ -0,0 +1,222 @@
+package flatjson_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type FlatServer struct {
+	CommonStats
+	Name    string    `json:"name"`
+	Port    uint16    `json:"port"`
+	Weight  float32   `json:"weight"`
+	Count   int64     `json:"count,string"`
+	Started time.Time `json:"started"`
+	Tags    []string  `json:"tags"`
+	TLS     *struct {
+		Cert string `json:"cert"`
+	} `json:"tls"`
+	Backup *FlatServer `json:"backup,omitempty"`
+}
+
+func TestUnmarshalFlatRoundTrip(t *testing.T) {
+	val := &FlatServer{
+		Name:    "a",
+		Port:    8080,
+		Weight:  0.5,
+		Count:   1 << 40,
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Tags:    []string{"x", "y"},
+		Backup:  &FlatServer{Name: "b", Port: 9090},
+	}
+	val.Requests = 7
+	val.TLS = &struct {
+		Cert string `json:"cert"`
+	}{"c"}
+
+	enc, err := json.Marshal(flatjson.Flatten(val))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nil pointers along the way are allocated.
+	got := &FlatServer{}
+	if err := flatjson.UnmarshalFlat(enc, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, val) {
+		t.Errorf("Unexpected result:\n     got: %+v\nexpected: %+v", got, val)
+	}
+
+	// The same goes for other options.
+	opts := flatjson.Options{Separator: "/", Prefix: "srv"}
+	enc, _ = json.Marshal(flatjson.FlattenWithOptions(val, opts))
+	got = &FlatServer{}
+	if err := opts.UnmarshalFlat(enc, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, val) {
+		t.Errorf("Unexpected result with options:\n     got: %+v\nexpected: %+v", got, val)
+	}
+}
+
+func TestUnmarshalFlatUnknownKeys(t *testing.T) {
+	data := []byte(`{"name":"a","port":80,"extra":1,"tls.key":"k","tls.cert":"c"}`)
+
+	got := &FlatServer{}
+	err := flatjson.UnmarshalFlat(data, got)
+	uerr, ok := err.(*flatjson.UnknownKeysError)
+	if !ok {
+		t.Fatalf("Expected an UnknownKeysError, got %v", err)
+	}
+	if expected := []string{"extra", "tls.key"}; !reflect.DeepEqual(uerr.Keys, expected) {
+		t.Errorf("Expected unknown keys %v, got %v", expected, uerr.Keys)
+	}
+	if err.Error() != "flatjson: unknown keys: extra, tls.key" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// The known keys are still decoded.
+	if got.Name != "a" || got.Port != 80 || got.TLS == nil || got.TLS.Cert != "c" {
+		t.Errorf("Expected the known keys to be decoded, got %+v", got)
+	}
+
+	opts := flatjson.Options{IgnoreUnknownKeys: true}
+	if err := opts.UnmarshalFlat(data, &FlatServer{}); err != nil {
+		t.Errorf("Expected unknown keys to be ignored, got %v", err)
+	}
+}
+
+func TestUnmarshalFlatErrors(t *testing.T) {
+	for _, test := range []struct {
+		data, expected string
+	}{
+		{`{"port":70000}`, `flatjson: key "port": cannot decode number 70000 into uint16`},
+		{`{"name":5}`, `flatjson: key "name": cannot decode number into string`},
+		{`{"count":5}`, `flatjson: key "count": expected a quoted value for int64, got 5`},
+		{`{"count":"x"}`, `flatjson: key "count": invalid character 'x' looking for beginning of value`},
+		{`[1]`, `flatjson: expected a JSON object, got array`},
+		{`null`, `flatjson: expected a JSON object, got null`},
+	} {
+		if err := flatjson.UnmarshalFlat([]byte(test.data), &FlatServer{}); err == nil || err.Error() != test.expected {
+			t.Errorf("Unexpected error for %s:\n     got: %v\nexpected: %s", test.data, err, test.expected)
+		}
+	}
+
+	if err := flatjson.UnmarshalFlat([]byte(`{}`), FlatServer{}); err == nil {
+		t.Error("Expected an error for a struct value")
+	}
+}
+
+func TestMapUnmarshalJSON(t *testing.T) {
+	val := &FlatServer{Name: "a", Port: 8080, Tags: []string{"x"}}
+	flat := flatjson.Flatten(val)
+
+	enc, err := json.Marshal(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(enc, &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["name"], doc["port"], doc["weight"], doc["count"] = "b", 9090, 1.5, "12"
+	doc["tags"], doc["started"] = []string{"y", "z"}, "2015-06-01T12:00:00Z"
+	delete(doc, "Requests")
+	val.Requests = 3
+	enc, _ = json.Marshal(doc)
+
+	// The values are written through to the struct, and fields missing from
+	// the document are left alone.
+	if err := json.Unmarshal(enc, &flat); err != nil {
+		t.Fatal(err)
+	}
+	expected := &FlatServer{
+		Name: "b", Port: 9090, Weight: 1.5, Count: 12,
+		Started: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC),
+		Tags:    []string{"y", "z"},
+	}
+	expected.Requests = 3
+	if !reflect.DeepEqual(val, expected) {
+		t.Errorf("Unexpected result:\n     got: %+v\nexpected: %+v", val, expected)
+	}
+
+	// A new Map is filled in as a plain map.
+	var fresh flatjson.Map
+	if err := json.Unmarshal([]byte(`{"a":1}`), &fresh); err != nil || !reflect.DeepEqual(fresh, flatjson.Map{"a": 1.0}) {
+		t.Errorf("Unexpected result %v: %v", fresh, err)
+	}
+}
+
+func TestMapUnmarshalJSONErrors(t *testing.T) {
+	val := &struct {
+		Port   uint16         `json:"port"`
+		Name   string         `json:"name"`
+		Limits map[string]int `json:"limits"`
+	}{Limits: map[string]int{"a": 1}}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{FlattenMaps: true})
+
+	for _, data := range []string{
+		`{"port":"x"}`,
+		`{"port":70000}`,
+		`{"limits.a":2}`,
+		`[1]`,
+	} {
+		if err := flat.UnmarshalJSON([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %s", data)
+		}
+	}
+
+	// Unknown keys are reported once the others are written.
+	err := flat.UnmarshalJSON([]byte(`{"name":"a","other":1,"more":2}`))
+	if e, ok := err.(*flatjson.UnknownKeysError); !ok || !reflect.DeepEqual(e.Keys, []string{"more", "other"}) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if val.Name != "a" {
+		t.Errorf("Expected the known keys to be written, got %q", val.Name)
+	}
+
+	opts := flatjson.Options{IgnoreUnknownKeys: true}
+	if err := opts.UnmarshalMap(flat, []byte(`{"name":"b","other":1}`)); err != nil || val.Name != "b" {
+		t.Errorf("Unexpected result %q: %v", val.Name, err)
+	}
+}
+
+func TestMapUnmarshalJSONRedacted(t *testing.T) {
+	val := &struct {
+		Name     string `json:"name"`
+		Password string `json:"password" flatjson:",redact"`
+		Token    string `json:"token"`
+	}{Name: "a", Password: "secret", Token: "t0"}
+	flat := flatjson.FlattenWithOptions(val, flatjson.Options{
+		RedactFunc: func(key string, v interface{}) (interface{}, bool) {
+			return "hidden", key == "token"
+		},
+	})
+
+	// The Map's own encoding round-trips without touching redacted fields.
+	enc, err := json.Marshal(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val.Name = "b"
+	if err := json.Unmarshal(enc, &flat); err != nil {
+		t.Fatal(err)
+	}
+	if val.Name != "a" || val.Password != "secret" || val.Token != "t0" {
+		t.Errorf("Unexpected result of the round trip: %+v", val)
+	}
+
+	// Entries whose encoding can't be decoded are rejected.
+	formatted := flatjson.FlattenWithOptions(&struct {
+		Timeout time.Duration `json:"timeout"`
+	}{}, flatjson.Options{DurationFormat: flatjson.DurationString})
+	err = formatted.UnmarshalJSON([]byte(`{"timeout":"1s"}`))
+	if e, ok := err.(*flatjson.Error); !ok || e.Key != "timeout" {
+		t.Errorf("Expected an error for the formatted entry, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// isUnsupported reports whether values of type t can't be encoded by
+// encoding/json because t, or the element type of a pointer, slice, array or
+// map type it is built from, is a function, channel, unsafe.Pointer or
+// complex type without a marshaler.
+func isUnsupported(t reflect.Type) bool {
+	for {
+		if isMarshaler(t) {
+			return false
+		}
+
+		switch t.Kind() {
+		case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+			return true
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+}
+
+// isComplex reports whether t is a complex type, or a pointer to one.
+func isComplex(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Complex64 || t.Kind() == reflect.Complex128
+}
+
+// complexObject is the encoding of a complex number when Options.ComplexObjects
+// is set.
+type complexObject struct {
+	Real float64 `json:"real"`
+	Imag float64 `json:"imag"`
+}
+
+// marshalComplex encodes v, a complex number or a pointer to one, as a
+// complexObject.
+func marshalComplex(v reflect.Value) ([]byte, error) {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return []byte("null"), nil
+	}
+	c := v.Complex()
+	return json.Marshal(complexObject{real(c), imag(c)})
+}
@@ -0,0 +1,116 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Validate checks the keys that flattening values of val's type produces, as
+// Flatten does with Options.StrictKeys set. It is Options.Validate with the
+// zero Options.
+func Validate(val interface{}) error {
+	return Options{}.Validate(val)
+}
+
+// Validate checks the keys that flattening values of val's type according to
+// o produces, with o.StrictKeys set, so that bad tags can be found once at
+// startup. Only the type of val matters: like Keys, it flattens a value with
+// every pointer to a struct allocated, so that the keys of every field are
+// checked, but maps and slices which would be flattened element by element
+// have no elements. Val may be a struct or a pointer to one. An error is
+// returned for the same reasons Options.Flatten returns one, and for keys in
+// o.IgnoreFields that don't name a field and keys of o.ValueFuncs no field is
+// flattened under, which includes those of fields that would be nested under
+// map or slice elements.
+func (o Options) Validate(val interface{}) error {
+	t := reflect.TypeOf(val)
+	if t == nil {
+		return rootError("Validate", nil, "flatjson: expected struct or pointer to struct, got nil")
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return rootError("Validate", t, "flatjson: %s is not a struct", t)
+	}
+
+	o.StrictKeys = true
+	o.EagerOmitEmpty = false
+	o.NilStructs = NilStructAllocate
+	out := Map{}
+	f := newFlattener(o, out)
+	f.flatten(reflect.New(t).Elem(), f.opts.rootPrefix(), nil)
+	if err := f.err(); err != nil {
+		return err
+	}
+	if err := f.sel.unknownError(); err != nil {
+		return err
+	}
+
+	var unknown []string
+	for key := range o.ValueFuncs {
+		if _, ok := out[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		return keyListError("Validate", ErrKeyNotFound, "value funcs for unknown keys", unknown)
+	}
+	return nil
+}
+
+// checkKey records key, added for the value described by n, in f.invalidKeys
+// if it breaks the rules of Options.StrictKeys.
+func (f *flattener) checkKey(key string, n node) {
+	problem := f.opts.keyProblem(key)
+	if problem == "" {
+		return
+	}
+	f.invalidKeys = append(f.invalidKeys, fmt.Sprintf("key %q of field %s %s", key, n.field, problem))
+}
+
+// keyProblem describes the rule key breaks, or returns an empty string if it
+// is valid.
+func (o Options) keyProblem(key string) string {
+	for _, segment := range o.SplitKey(key) {
+		if segment == "" {
+			return "has an empty segment"
+		}
+		for _, r := range segment {
+			if unicode.IsSpace(r) {
+				return "contains whitespace"
+			}
+			if unicode.IsControl(r) || r == unicode.ReplacementChar {
+				return "contains a control or invalid character"
+			}
+		}
+	}
+
+	if p := o.KeyPattern; p != nil && !p.MatchString(key) {
+		return "doesn't match " + p.String()
+	}
+	return ""
+}
+
+// invalidKeysError returns the error for the problems collected in
+// f.invalidKeys.
+func invalidKeysError(problems []string) error {
+	sort.Strings(problems)
+	return newError("Flatten", ErrInvalidKey, "flatjson: invalid keys: %s", strings.Join(problems, "; "))
+}
+
+// fieldName returns the name field is described by in errors: the name of
+// the struct type t declaring it, if it has one, followed by the field's.
+func fieldName(t reflect.Type, field string) string {
+	if t.Name() == "" {
+		return field
+	}
+	return t.Name() + "." + field
+}
@@ -0,0 +1,87 @@
+package flatjson_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type BadInner struct {
+	OK    int `json:"ok"`
+	Space int `json:"has space"`
+}
+
+type BadOuter struct {
+	Name  string `json:"name"`
+	Empty int    `json:"a..b"`
+	Inner struct {
+		Tab  int       `json:"tab\there"`
+		Deep *BadInner `json:"deep"`
+	} `json:"inner"`
+}
+
+func TestValidate(t *testing.T) {
+	expected := `flatjson: invalid keys: ` +
+		`key "a..b" of field BadOuter.Empty has an empty segment; ` +
+		`key "inner.deep.has space" of field BadInner.Space contains whitespace; ` +
+		`key "inner.tab\there" of field Tab contains whitespace`
+
+	// The nil pointer is allocated, so every key is checked.
+	for _, val := range []interface{}{BadOuter{}, &BadOuter{}, (*BadOuter)(nil)} {
+		if err := flatjson.Validate(val); err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error for %T:\n     got: %v\nexpected: %s", val, err, expected)
+		}
+	}
+
+	if err := flatjson.Validate(&ConnStats{}); err != nil {
+		t.Errorf("Expected valid keys, got %v", err)
+	}
+	if err := flatjson.Validate(3); err == nil {
+		t.Error("Expected an error for a non-struct")
+	}
+	if err := flatjson.Validate(nil); err == nil {
+		t.Error("Expected an error for nil")
+	}
+}
+
+func TestStrictKeys(t *testing.T) {
+	val := &BadOuter{}
+	if _, err := flatjson.FlattenE(val); err != nil {
+		t.Errorf("Expected keys to be accepted by default, got %v", err)
+	}
+
+	// Only the keys produced by the value are checked.
+	opts := flatjson.Options{StrictKeys: true}
+	expected := `flatjson: invalid keys: ` +
+		`key "a..b" of field BadOuter.Empty has an empty segment; ` +
+		`key "inner.tab\there" of field Tab contains whitespace`
+	if _, err := opts.Flatten(val); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error:\n     got: %v\nexpected: %s", err, expected)
+	}
+
+	// Map keys are checked too, and named after the map field.
+	labels := &struct {
+		Labels map[string]int `json:"labels"`
+	}{map[string]int{"ok": 1, "": 2, "new\nline": 3}}
+	opts = flatjson.Options{StrictKeys: true, FlattenMaps: true}
+	expected = `flatjson: invalid keys: ` +
+		`key "labels." of field Labels has an empty segment; ` +
+		`key "labels.new\nline" of field Labels contains whitespace`
+	if _, err := opts.Flatten(labels); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error:\n     got: %v\nexpected: %s", err, expected)
+	}
+
+	// A pattern applies to whole keys, including the prefix.
+	opts = flatjson.Options{StrictKeys: true, Prefix: "app", KeyPattern: regexp.MustCompile(`^[a-z.]+$`)}
+	expected = `flatjson: invalid keys: key "app.CC" of field Child.C doesn't match ^[a-z.]+$; ` +
+		`key "app.CD" of field Child.D doesn't match ^[a-z.]+$`
+	if _, err := opts.Flatten(&Child{}); err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error:\n     got: %v\nexpected: %s", err, expected)
+	}
+	if err := opts.Validate(&struct {
+		X int `json:"x"`
+	}{}); err != nil {
+		t.Errorf("Expected valid keys, got %v", err)
+	}
+}
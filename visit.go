@@ -0,0 +1,92 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"reflect"
+	"sort"
+)
+
+// A VisitFunc is called by Visit for each leaf value. Path holds the segments
+// of the leaf's key, as split by Options.SplitKey, field is the struct field
+// the value was found in, as described by FieldMeta.Field, and v is the value
+// itself, which is addressable unless it was found through a map, an
+// unexported field, or an interface holding a struct by value.
+type VisitFunc func(path []string, field reflect.StructField, v reflect.Value) error
+
+// Visit calls fn for each leaf value of val, which is any value Flatten
+// accepts; see Options.Visit.
+func Visit(val interface{}, fn VisitFunc) error {
+	return Options{}.Visit(val, fn)
+}
+
+// Visit calls fn for each leaf value of val, the values flattening val
+// according to o gives entries, in the order flattening reaches them: the
+// fields of each struct in the order they are declared. It is the same
+// traversal as Flatten, with the same rules for tags, embedded structs,
+// pointers and skipped fields, so it can be used for other purposes like
+// building command line flags from the fields of a configuration struct.
+//
+// Leaves are visited whatever their current values, even those of fields
+// tagged with omitempty, whose entries would be left out when encoding a Map.
+// The fields of interfaces flattened with o.DynamicInterfaces are visited as
+// they currently are, in sorted key order.
+//
+// If fn returns an error, the traversal stops there and Visit returns the
+// error. Otherwise an error is returned in the same cases as Options.Flatten,
+// after visiting every leaf.
+func (o Options) Visit(val interface{}, fn VisitFunc) error {
+	o.RecordMeta = true
+	s := &visitSink{opts: o, fn: fn, seen: map[string]bool{}}
+	err := flattenValue(reflect.ValueOf(val), o, s)
+	if s.err != nil {
+		return s.err
+	}
+	return err
+}
+
+// A visitSink calls the VisitFunc of Visit for each entry added to it, instead
+// of keeping them.
+type visitSink struct {
+	opts Options
+	fn   VisitFunc
+	seen map[string]bool
+	err  error // Returned by fn.
+}
+
+func (s *visitSink) add(key string, value interface{}) bool {
+	if s.err != nil {
+		return false
+	}
+	if d, ok := value.(*dynamic); ok {
+		expanded := Map{}
+		d.expandInto(expanded)
+		keys := make([]string, 0, len(expanded))
+		for key := range expanded {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		replaced := false
+		for _, key := range keys {
+			replaced = s.add(key, expanded[key]) || replaced
+		}
+		return replaced
+	}
+
+	replaced := s.seen[key]
+	s.seen[key] = true
+
+	var field reflect.StructField
+	if meta := metaOf(value); meta != nil {
+		field = meta.Field
+	}
+	s.err = s.fn(s.opts.SplitKey(key), field, resolve(value))
+	return replaced
+}
+
+func (s *visitSink) halted() bool {
+	return s.err != nil
+}
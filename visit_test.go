@@ -0,0 +1,137 @@
+package flatjson_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pushrax/flatjson"
+)
+
+type VisitFixture struct {
+	ConnStats
+	Labels  map[string]int `json:"labels"`
+	Any     interface{}    `json:"any"`
+	Skipped int            `json:"-"`
+	Nil     *Pool          `json:"nil"`
+}
+
+func TestVisit(t *testing.T) {
+	val := &VisitFixture{
+		ConnStats: ConnStats{
+			CommonStats: CommonStats{Requests: 4, Errors: 5},
+			Remote:      "host",
+			Pools:       []Pool{{6, 7}, {8, 9}},
+			Child:       &Child{10, "d"},
+		},
+		Labels: map[string]int{"a": 1, "b": 2},
+		Any:    &Child{3, "c"},
+	}
+	for _, opts := range []flatjson.Options{
+		{},
+		{IndexSlices: true, FlattenMaps: true, DynamicInterfaces: true},
+		{Prefix: "p", Separator: "/", KeyCase: flatjson.KeyCaseSnake, IndexSlices: true},
+	} {
+		visited := flatjson.Map{}
+		err := opts.Visit(val, func(path []string, field reflect.StructField, v reflect.Value) error {
+			visited[opts.JoinKey(path...)] = v.Interface()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The leaves are those Flatten makes entries for, with the same
+		// values, once those of dynamic interfaces are expanded.
+		testSameEncoding(t, flatjson.FlattenWithOptions(val, opts), visited)
+	}
+}
+
+func TestVisitFields(t *testing.T) {
+	val := &VisitFixture{
+		ConnStats: ConnStats{
+			CommonStats: CommonStats{Requests: 4, Errors: 5},
+			Remote:      "host",
+			Pools:       []Pool{{6, 7}, {8, 9}},
+			Child:       &Child{10, "d"},
+		},
+		Labels: map[string]int{"a": 1, "b": 2},
+		Any:    &Child{3, "c"},
+	}
+	var paths []string
+	fields := map[string]string{}
+	err := flatjson.Options{IndexSlices: true}.Visit(val, func(path []string, field reflect.StructField, v reflect.Value) error {
+		key := strings.Join(path, ".")
+		paths = append(paths, key)
+		fields[key] = field.Name
+		if key == "remote" {
+			v.SetString("other")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields are visited in the order they are declared.
+	expected := []string{
+		"Requests", "Errors", "active", "idle", "remote", "bytes_in", "bytes_out",
+		"latency.Min", "latency.Max", "latency.Mean",
+		"pools.0.active", "pools.0.idle", "pools.1.active", "pools.1.idle",
+		"child.CC", "child.CD", "labels", "any.CC", "any.CD", "nil",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Unexpected paths:\n     got: %q\nexpected: %q", paths, expected)
+	}
+	for key, name := range map[string]string{"Errors": "Errors", "pools.1.idle": "Idle", "latency.Max": "Max", "child.CD": "D"} {
+		if fields[key] != name {
+			t.Errorf("Expected field %s for %s, got %q", name, key, fields[key])
+		}
+	}
+
+	// The values are the fields themselves.
+	if val.Remote != "other" {
+		t.Errorf("Expected the field to be set, got %q", val.Remote)
+	}
+}
+
+func TestVisitErrors(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := flatjson.Visit(&struct{ A, B, C, D int }{}, func(path []string, field reflect.StructField, v reflect.Value) error {
+		if calls++; calls == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || calls != 3 {
+		t.Errorf("Expected to stop after 3 calls, got %d and %v", calls, err)
+	}
+
+	// Nothing is traversed after fn fails.
+	counted := &struct {
+		A int
+		B visitedFlattener
+		C struct{ D visitedFlattener }
+	}{}
+	leaves := 0
+	err = flatjson.Visit(counted, func([]string, reflect.StructField, reflect.Value) error {
+		leaves++
+		return stop
+	})
+	if err != stop || leaves != 1 || counted.B.visited || counted.C.D.visited {
+		t.Errorf("Expected to stop after the first leaf, got %d leaves and %v", leaves, err)
+	}
+
+	val := &struct {
+		A int `json:"a"`
+		B int `flatjson:"a"`
+	}{}
+	if err := flatjson.Visit(val, func([]string, reflect.StructField, reflect.Value) error { return nil }); err == nil {
+		t.Error("Expected an error for duplicate keys")
+	}
+	if err := flatjson.Visit(3, func([]string, reflect.StructField, reflect.Value) error { return nil }); err == nil {
+		t.Error("Expected an error for a non-struct")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 The flatjson Authors. All rights reserved.
+// Use of this source code is governed by the BSD 2-Clause license,
+// which can be found in the LICENSE file.
+
+package flatjson
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Watcher calls a function when the values of some of the entries in a Map
+// change, for reacting to in-process metrics, such as triggering alerts,
+// without an external scraper. Like a DeltaEncoder, it keeps a copy of each
+// watched value, taken the same way as by Map.Values, and compares the
+// current values to those with reflect.DeepEqual.
+//
+// A Watcher isn't safe for concurrent use, apart from running it with Run.
+type Watcher struct {
+	m        Map
+	patterns []string
+	fn       func(key string, old, new interface{})
+	last     map[string]interface{}
+}
+
+// Watch returns a Watcher calling fn for each change to the values of m under
+// keys. A key ending in * is a pattern matching every key which starts with
+// what comes before the *, so that db.* watches every entry under db, including
+// those of interface fields flattened with Options.DynamicInterfaces. The
+// current values are recorded right away, and Check compares against them.
+func (m Map) Watch(keys []string, fn func(key string, old, new interface{})) *Watcher {
+	w := &Watcher{m: m, patterns: keys, fn: fn}
+	w.last = w.current()
+	return w
+}
+
+// Check compares the current values of the watched entries to those recorded
+// by the previous call, or by Watch, and calls the Watcher's function for
+// each that changed, in sorted key order, before recording the current ones.
+// An entry that wasn't there before is reported with an old value of nil, and
+// one that is gone with a new value of nil. It returns the number of changes
+// found.
+func (w *Watcher) Check() int {
+	current := w.current()
+
+	var changed []string
+	for key, value := range current {
+		if last, ok := w.last[key]; !ok || !reflect.DeepEqual(last, value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range w.last {
+		if _, ok := current[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+
+	for _, key := range changed {
+		w.fn(key, w.last[key], current[key])
+	}
+	w.last = current
+	return len(changed)
+}
+
+// Run calls Check every interval until ctx is done, and returns ctx's error.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// current returns copies of the current values of the watched entries.
+func (w *Watcher) current() map[string]interface{} {
+	m := w.m.expandDynamic()
+	values := map[string]interface{}{}
+	copied := map[visit]reflect.Value{}
+
+	for key, value := range m {
+		if !w.watches(key) {
+			continue
+		}
+		var current interface{}
+		if rv := resolve(value); rv.IsValid() {
+			current = deepCopy(rv, copied).Interface()
+		}
+		values[key] = current
+	}
+	return values
+}
+
+// watches reports whether key is one of the watched keys, or matches one of the
+// patterns.
+func (w *Watcher) watches(key string) bool {
+	for _, p := range w.patterns {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(key, p[:len(p)-1]) || key == p {
+			return true
+		}
+	}
+	return false
+}
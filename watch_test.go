@@ -0,0 +1,83 @@
+package flatjson_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pushrax/flatjson"
+)
+
+type change struct {
+	key      string
+	old, new interface{}
+}
+
+func TestWatch(t *testing.T) {
+	val := &struct {
+		Conns int            `json:"conns"`
+		Name  string         `json:"name"`
+		DB    map[string]int `json:"db"`
+		Tags  []string       `json:"tags"`
+	}{Conns: 1, Name: "a", DB: map[string]int{"reads": 1}, Tags: []string{"x"}}
+	opts := flatjson.Options{FlattenMaps: true}
+	flat := flatjson.FlattenWithOptions(val, opts)
+
+	var changes []change
+	w := flat.Watch([]string{"conns", "tags", "db.*"}, func(key string, old, new interface{}) {
+		changes = append(changes, change{key, old, new})
+	})
+
+	check := func(expected ...change) {
+		changes = nil
+		n := w.Check()
+		if n != len(expected) || !reflect.DeepEqual(changes, expected) {
+			t.Errorf("Unexpected changes (%d):\n     got: %v\nexpected: %v", n, changes, expected)
+		}
+	}
+
+	// Nothing changed since Watch, and unwatched keys are ignored.
+	val.Name = "b"
+	check()
+
+	val.Conns = 2
+	val.DB["reads"] = 3
+	check(change{"conns", 1, 2}, change{"db.reads", 1, 3})
+	check()
+
+	// The recorded values are copies, so changes in place are found.
+	val.Tags[0] = "y"
+	check(change{"tags", []string{"x"}, []string{"y"}})
+	check()
+
+	// Keys matching a pattern can come and go.
+	val.DB["writes"] = 4
+	opts.Refresh(flat, val)
+	check(change{"db.writes", nil, 4})
+	delete(val.DB, "reads")
+	opts.Refresh(flat, val)
+	check(change{"db.reads", 3, nil})
+	check()
+}
+
+func TestWatchRun(t *testing.T) {
+	val := &struct{ N int }{}
+	flat := flatjson.Flatten(val)
+
+	changed := make(chan interface{}, 10)
+	w := flat.Watch([]string{"N"}, func(key string, old, new interface{}) { changed <- new })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx, time.Millisecond) }()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(changed) != 0 {
+		t.Errorf("Expected no changes, got %d", len(changed))
+	}
+}